@@ -11,6 +11,8 @@ CREATE TABLE IF NOT EXISTS users (
     last_name VARCHAR(100),
     is_active BOOLEAN DEFAULT TRUE,
     is_admin BOOLEAN DEFAULT FALSE,
+    scheduler_algorithm VARCHAR(20) CHECK (scheduler_algorithm IN ('', 'sm2', 'fsrs')),
+    desired_retention DECIMAL(3,2) CHECK (desired_retention >= 0.7 AND desired_retention <= 0.99),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -22,6 +24,20 @@ CREATE TABLE IF NOT EXISTS domains (
     privacy VARCHAR(20) CHECK (privacy IN ('public', 'private')) NOT NULL,
     owner_id INT NOT NULL,
     description TEXT,
+    scheduler_algorithm VARCHAR(20) DEFAULT 'sm2' CHECK (scheduler_algorithm IN ('sm2', 'fsrs')),
+    desired_retention DECIMAL(3,2) DEFAULT 0.9 CHECK (desired_retention >= 0.7 AND desired_retention <= 0.99),
+    leech_threshold INTEGER DEFAULT 8 CHECK (leech_threshold >= 0), -- 0 disables leech detection
+    leech_action VARCHAR(20) DEFAULT 'tag' CHECK (leech_action IN ('tag', 'suspend')),
+    graduation_interval DECIMAL(8,2) DEFAULT 21 CHECK (graduation_interval >= 0), -- 0 disables graduation to learned
+    graduation_success_rate DECIMAL(3,2) DEFAULT 0.8 CHECK (graduation_success_rate >= 0 AND graduation_success_rate <= 1),
+    credit_decay VARCHAR(20) DEFAULT 'harmonic' CHECK (credit_decay IN ('harmonic', 'exponential', 'linear')),
+    credit_threshold DECIMAL(5,4) DEFAULT 0.01 CHECK (credit_threshold >= 0 AND credit_threshold < 1),
+    credit_max_depth INTEGER DEFAULT 6 CHECK (credit_max_depth >= 0 AND credit_max_depth <= 20),
+    credit_success_multiplier DECIMAL(4,2) DEFAULT 1.0 CHECK (credit_success_multiplier >= 0 AND credit_success_multiplier <= 5),
+    credit_failure_multiplier DECIMAL(4,2) DEFAULT 1.0 CHECK (credit_failure_multiplier >= 0 AND credit_failure_multiplier <= 5),
+    credit_quality_scale TEXT, -- JSON array, credit factor per quality 0-5
+    credit_target_time INTEGER DEFAULT 0 CHECK (credit_target_time >= 0), -- seconds, 0 ignores response time
+    credit_min_time_factor DECIMAL(3,2) DEFAULT 0.5 CHECK (credit_min_time_factor >= 0 AND credit_min_time_factor <= 1),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP,
@@ -48,6 +64,7 @@ CREATE TABLE IF NOT EXISTS definitions (
     name VARCHAR(200) NOT NULL,
     description TEXT NOT NULL,
     notes TEXT,
+    tags TEXT, -- JSON array
     domain_id INT NOT NULL,
     owner_id INT NOT NULL,
     x_position DECIMAL(10,2) DEFAULT 0,
@@ -79,6 +96,7 @@ CREATE TABLE IF NOT EXISTS exercises (
     description TEXT,
     notes TEXT,
     hints TEXT,
+    tags TEXT, -- JSON array
     domain_id INT NOT NULL,
     owner_id INT NOT NULL,
     verifiable BOOLEAN DEFAULT FALSE,
@@ -125,12 +143,20 @@ CREATE TABLE IF NOT EXISTS user_node_progress (
     easiness_factor DECIMAL(3,2) DEFAULT 2.5 CHECK (easiness_factor >= 1.3),
     interval_days DECIMAL(8,2) DEFAULT 0,
     repetitions INTEGER DEFAULT 0,
+    algorithm VARCHAR(20) DEFAULT 'sm2', -- scheduler that produced the current interval
+    stability DECIMAL(10,4) DEFAULT 0, -- FSRS memory stability (days)
+    difficulty DECIMAL(6,4) DEFAULT 0, -- FSRS difficulty (1-10)
     last_review TIMESTAMP,
     next_review TIMESTAMP,
     accumulated_credit DECIMAL(5,3) DEFAULT 0 CHECK (accumulated_credit >= -1.0 AND accumulated_credit <= 1.0),
     credit_postponed BOOLEAN DEFAULT FALSE,
     total_reviews INTEGER DEFAULT 0,
     successful_reviews INTEGER DEFAULT 0,
+    lapses INTEGER DEFAULT 0, -- failed reviews after a successful one
+    is_leech BOOLEAN DEFAULT FALSE,
+    suspended BOOLEAN DEFAULT FALSE, -- excluded from due reviews
+    buried_until TIMESTAMP, -- excluded from due reviews until then
+    version INTEGER NOT NULL DEFAULT 0, -- incremented by every write, for undo
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
@@ -142,11 +168,12 @@ CREATE TABLE IF NOT EXISTS study_sessions (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL,
     domain_id INTEGER NOT NULL,
-    session_type VARCHAR(20) CHECK (session_type IN ('definition', 'exercise', 'mixed')) NOT NULL,
+    session_type VARCHAR(20) CHECK (session_type IN ('definition', 'exercise', 'mixed', 'path')) NOT NULL,
     start_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     end_time TIMESTAMP,
     total_reviews INTEGER DEFAULT 0,
     successful_reviews INTEGER DEFAULT 0,
+    nodes TEXT, -- JSON nodes to study, in order (path sessions)
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY (domain_id) REFERENCES domains(id) ON DELETE CASCADE
 );
@@ -182,6 +209,53 @@ CREATE TABLE IF NOT EXISTS review_history (
     easiness_factor_after DECIMAL(3,2),
     interval_before DECIMAL(8,2),
     interval_after DECIMAL(8,2),
+    credit_before DECIMAL(5,3),
+    credit_after DECIMAL(5,3),
+    next_review_before TIMESTAMP,
+    next_review_after TIMESTAMP,
+    algorithm VARCHAR(20) DEFAULT 'sm2',
+    stability_before DECIMAL(10,4),
+    stability_after DECIMAL(10,4),
+    difficulty_before DECIMAL(6,4),
+    difficulty_after DECIMAL(6,4),
+    retrievability DECIMAL(5,4),
+    source_review_id INTEGER, -- explicit review that caused an implicit one
+    credit_trace TEXT, -- JSON path, decay and multiplier of an implicit credit
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (source_review_id) REFERENCES review_history(id) ON DELETE SET NULL
+);
+
+-- Review snapshots (undo information for the most recent reviews)
+CREATE TABLE IF NOT EXISTS review_snapshots (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    node_id INTEGER NOT NULL,
+    node_type VARCHAR(20) NOT NULL CHECK (node_type IN ('definition', 'exercise')),
+    session_id INTEGER,
+    success BOOLEAN NOT NULL,
+    credit_flow TEXT, -- JSON credit updates of the review
+    progress_before TEXT, -- JSON node states before the review
+    history_ids TEXT, -- JSON review_history ids created by the review
+    session_review_ids TEXT, -- JSON session_reviews ids created by the review
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Scheduler parameters fitted per user from review_history
+CREATE TABLE IF NOT EXISTS user_scheduler_params (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL UNIQUE,
+    first_interval DECIMAL(6,2) DEFAULT 1,
+    second_interval DECIMAL(6,2) DEFAULT 6,
+    ef_base DECIMAL(6,4) DEFAULT 0.1,
+    ef_linear DECIMAL(6,4) DEFAULT 0.08,
+    ef_quadratic DECIMAL(6,4) DEFAULT 0.02,
+    review_count INTEGER DEFAULT 0,
+    log_loss_before DECIMAL(8,5),
+    log_loss_after DECIMAL(8,5),
+    fitted_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
@@ -302,6 +376,8 @@ CREATE INDEX IF NOT EXISTS idx_user_progress_next_review ON user_node_progress(n
 CREATE INDEX IF NOT EXISTS idx_user_progress_status ON user_node_progress(status);
 CREATE INDEX IF NOT EXISTS idx_user_progress_node ON user_node_progress(node_id, node_type);
 CREATE INDEX IF NOT EXISTS idx_review_history_user_node ON review_history(user_id, node_id, node_type);
+CREATE INDEX IF NOT EXISTS idx_review_history_source_review_id ON review_history(source_review_id);
+CREATE INDEX IF NOT EXISTS idx_review_snapshots_user ON review_snapshots(user_id);
 CREATE INDEX IF NOT EXISTS idx_session_reviews_session ON session_reviews(session_id);
 CREATE INDEX IF NOT EXISTS idx_definitions_domain ON definitions(domain_id);
 CREATE INDEX IF NOT EXISTS idx_exercises_domain ON exercises(domain_id);
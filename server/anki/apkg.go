@@ -0,0 +1,430 @@
+// Package anki reads and writes Anki .apkg packages: a zip holding the
+// SQLite collection (notes, cards, review log) and the media files, which
+// the "media" entry maps from their numbered entry names to file names.
+package anki
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrUnsupportedPackage is returned for packages without a collection this
+// package can read, e.g. the compressed collection of recent Anki versions
+// when exported without "Support older Anki versions"
+var ErrUnsupportedPackage = errors.New("unsupported Anki package")
+
+// ErrPackageTooLarge is returned for packages whose entries uncompress to
+// more than the limits below, e.g. zip bombs
+var ErrPackageTooLarge = errors.New("Anki package too large")
+
+// Limits on the uncompressed size of a package, variables for the tests
+var (
+	maxEntrySize   int64 = 512 << 20 // bytes of one entry
+	maxPackageSize int64 = 1 << 30   // bytes of all the entries read
+)
+
+// FieldSeparator separates the fields of a note in the collection
+const FieldSeparator = "\x1f"
+
+// Note type kinds
+const (
+	KindStandard = 0
+	KindCloze    = 1
+)
+
+// Card types
+const (
+	CardNew        = 0
+	CardLearning   = 1
+	CardReview     = 2
+	CardRelearning = 3
+)
+
+// Card queues; queues below zero take a card out of the reviews
+const (
+	QueueNew       = 0
+	QueueLearning  = 1
+	QueueReview    = 2
+	QueueSuspended = -1
+	QueueBuried    = -3
+)
+
+// Review log types
+const (
+	ReviewLearn    = 0
+	ReviewReview   = 1
+	ReviewRelearn  = 2
+	ReviewFiltered = 3
+	ReviewManual   = 4 // rescheduled by hand, not a review
+)
+
+// NoteType describes the fields of a kind of note and the cards made from
+// them
+type NoteType struct {
+	ID        int64
+	Name      string
+	Kind      int // KindStandard or KindCloze
+	Fields    []string
+	SortField int // index of the field the browser sorts by
+	Templates []Template
+	CSS       string
+}
+
+// Template renders one card of a note; {{Field}} stands for a field
+type Template struct {
+	Name  string
+	Front string
+	Back  string
+}
+
+// Note is a note, whose fields follow its note type
+type Note struct {
+	ID         int64
+	GUID       string
+	NoteTypeID int64
+	Fields     []string
+	Tags       []string
+	Modified   time.Time
+}
+
+// Card is one card of a note with its scheduling state
+type Card struct {
+	ID       int64
+	NoteID   int64
+	DeckID   int64
+	Ord      int
+	Type     int
+	Queue    int
+	Due      int64 // review cards: days since the collection was created; learning cards: Unix seconds
+	Interval int   // days, or seconds when negative
+	Factor   int   // ease factor in permille
+	Reps     int
+	Lapses   int
+}
+
+// IntervalDays returns the card interval in days
+func (c Card) IntervalDays() float64 {
+	return intervalDays(c.Interval)
+}
+
+// Review is an entry of the review log
+type Review struct {
+	ID           int64 // time of the review in Unix milliseconds
+	CardID       int64
+	Ease         int // 1-4 (again, hard, good, easy), 0 for manual entries
+	Interval     int // days, or seconds when negative
+	LastInterval int
+	Factor       int // ease factor in permille after the review
+	Duration     int // milliseconds
+	Type         int
+}
+
+// Time returns the time of the review
+func (r Review) Time() time.Time {
+	return time.UnixMilli(r.ID)
+}
+
+// IntervalDays returns the interval after the review in days
+func (r Review) IntervalDays() float64 {
+	return intervalDays(r.Interval)
+}
+
+// LastIntervalDays returns the interval before the review in days
+func (r Review) LastIntervalDays() float64 {
+	return intervalDays(r.LastInterval)
+}
+
+func intervalDays(interval int) float64 {
+	if interval < 0 {
+		return float64(-interval) / 86400
+	}
+	return float64(interval)
+}
+
+// Package is the content of an .apkg file
+type Package struct {
+	Created   time.Time // day the collection was created, from which review card due days count
+	NoteTypes map[int64]NoteType
+	Decks     map[int64]string
+	Notes     []Note
+	Cards     []Card
+	Reviews   []Review
+	Media     map[string][]byte // media files by name
+}
+
+// NoteType returns the note type of a note
+func (p *Package) NoteType(note Note) NoteType {
+	return p.NoteTypes[note.NoteTypeID]
+}
+
+// DueTime returns when a card is due, or nil for new cards
+func (p *Package) DueTime(card Card) *time.Time {
+	var due time.Time
+	switch card.Type {
+	case CardReview:
+		due = p.Created.AddDate(0, 0, int(card.Due))
+	case CardLearning, CardRelearning:
+		due = time.Unix(card.Due, 0)
+	default:
+		return nil
+	}
+	return &due
+}
+
+// Read reads an .apkg package
+func Read(r io.ReaderAt, size int64) (*Package, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedPackage, err)
+	}
+
+	entries := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		entries[file.Name] = file
+	}
+
+	// Recent Anki versions export a compressed anki21b collection next to a
+	// placeholder anki2 one asking to upgrade Anki. With "Support older Anki
+	// versions", they keep the legacy collection as anki21, older versions
+	// as anki2.
+	if entries["collection.anki21b"] != nil {
+		return nil, fmt.Errorf("%w: compressed collection (collection.anki21b) of a recent Anki version, export with \"Support older Anki versions\"", ErrUnsupportedPackage)
+	}
+	collection := entries["collection.anki21"]
+	if collection == nil {
+		collection = entries["collection.anki2"]
+	}
+	if collection == nil {
+		return nil, fmt.Errorf("%w: no collection", ErrUnsupportedPackage)
+	}
+
+	budget := maxPackageSize
+	pkg, err := readCollection(collection, &budget)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg.Media = map[string][]byte{}
+	if media := entries["media"]; media != nil {
+		content, err := readEntry(media, &budget)
+		if err != nil {
+			return nil, err
+		}
+		var names map[string]string
+		if err := json.Unmarshal(content, &names); err != nil {
+			return nil, fmt.Errorf("%w: invalid media map: %v", ErrUnsupportedPackage, err)
+		}
+		for entry, name := range names {
+			file := entries[entry]
+			if file == nil {
+				continue
+			}
+			content, err := readEntry(file, &budget)
+			if err != nil {
+				return nil, err
+			}
+			pkg.Media[name] = content
+		}
+	}
+	return pkg, nil
+}
+
+// ReadFile reads an .apkg file
+func ReadFile(path string) (*Package, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(file, info.Size())
+}
+
+func readEntry(file *zip.File, budget *int64) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := copyEntry(&buf, file, budget); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// copyEntry copies an entry uncompressed, failing once it exceeds
+// maxEntrySize or the budget left for the package, which it decreases. The
+// sizes in the zip headers are not trusted.
+func copyEntry(dst io.Writer, file *zip.File, budget *int64) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	limit := min(maxEntrySize, *budget)
+	n, err := io.Copy(dst, io.LimitReader(rc, limit+1))
+	*budget -= n
+	if err != nil {
+		return err
+	}
+	if n > limit {
+		return fmt.Errorf("%w: %s uncompresses to more than %d bytes", ErrPackageTooLarge, file.Name, limit)
+	}
+	return nil
+}
+
+// readCollection copies the SQLite collection out of the zip, since SQLite
+// reads from files, and reads it
+func readCollection(file *zip.File, budget *int64) (*Package, error) {
+	tmp, err := os.CreateTemp("", "collection-*.anki2")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := copyEntry(tmp, file, budget); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	db, err := openCollection(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer closeCollection(db)
+
+	pkg, err := readTables(db)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedPackage, err)
+	}
+	return pkg, nil
+}
+
+func openCollection(path string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+}
+
+func closeCollection(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+func readTables(db *gorm.DB) (*Package, error) {
+	var col struct {
+		Crt    int64
+		Models string
+		Decks  string
+	}
+	if err := db.Raw("SELECT crt, models, decks FROM col LIMIT 1").Scan(&col).Error; err != nil {
+		return nil, err
+	}
+
+	pkg := &Package{
+		Created:   time.Unix(col.Crt, 0),
+		NoteTypes: map[int64]NoteType{},
+		Decks:     map[int64]string{},
+	}
+
+	var models map[string]struct {
+		Name   string `json:"name"`
+		Type   int    `json:"type"`
+		Sortf  int    `json:"sortf"`
+		CSS    string `json:"css"`
+		Fields []struct {
+			Name string `json:"name"`
+			Ord  int    `json:"ord"`
+		} `json:"flds"`
+		Templates []struct {
+			Name  string `json:"name"`
+			Ord   int    `json:"ord"`
+			Front string `json:"qfmt"`
+			Back  string `json:"afmt"`
+		} `json:"tmpls"`
+	}
+	if err := json.Unmarshal([]byte(col.Models), &models); err != nil {
+		return nil, fmt.Errorf("invalid note types: %v", err)
+	}
+	for key, model := range models {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid note type id %q", key)
+		}
+		sort.Slice(model.Fields, func(i, j int) bool { return model.Fields[i].Ord < model.Fields[j].Ord })
+		fields := make([]string, len(model.Fields))
+		for i, field := range model.Fields {
+			fields[i] = field.Name
+		}
+		sort.Slice(model.Templates, func(i, j int) bool { return model.Templates[i].Ord < model.Templates[j].Ord })
+		templates := make([]Template, len(model.Templates))
+		for i, template := range model.Templates {
+			templates[i] = Template{Name: template.Name, Front: template.Front, Back: template.Back}
+		}
+		pkg.NoteTypes[id] = NoteType{
+			ID:        id,
+			Name:      model.Name,
+			Kind:      model.Type,
+			Fields:    fields,
+			SortField: model.Sortf,
+			Templates: templates,
+			CSS:       model.CSS,
+		}
+	}
+
+	var decks map[string]struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(col.Decks), &decks); err != nil {
+		return nil, fmt.Errorf("invalid decks: %v", err)
+	}
+	for key, deck := range decks {
+		if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+			pkg.Decks[id] = deck.Name
+		}
+	}
+
+	var notes []struct {
+		ID   int64
+		GUID string
+		Mid  int64
+		Mod  int64
+		Tags string
+		Flds string
+	}
+	if err := db.Raw("SELECT id, guid, mid, mod, tags, flds FROM notes ORDER BY id").Scan(&notes).Error; err != nil {
+		return nil, err
+	}
+	for _, n := range notes {
+		pkg.Notes = append(pkg.Notes, Note{
+			ID:         n.ID,
+			GUID:       n.GUID,
+			NoteTypeID: n.Mid,
+			Fields:     strings.Split(n.Flds, FieldSeparator),
+			Tags:       strings.Fields(n.Tags),
+			Modified:   time.Unix(n.Mod, 0),
+		})
+	}
+
+	if err := db.Raw("SELECT id, nid AS note_id, did AS deck_id, ord, type, queue, due, ivl AS interval, factor, reps, lapses FROM cards ORDER BY id").Scan(&pkg.Cards).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Raw("SELECT id, cid AS card_id, ease, ivl AS interval, lastIvl AS last_interval, factor, time AS duration, type FROM revlog ORDER BY id").Scan(&pkg.Reviews).Error; err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
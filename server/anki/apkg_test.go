@@ -0,0 +1,243 @@
+package anki
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildPackage writes a small legacy collection, as Anki exports it, with
+// one note reviewed twice and a media file
+func buildPackage(t *testing.T) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "collection.anki2")
+	db, err := openCollection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := []string{
+		`CREATE TABLE col (id integer primary key, crt integer, models text, decks text)`,
+		`CREATE TABLE notes (id integer primary key, guid text, mid integer, mod integer, tags text, flds text)`,
+		`CREATE TABLE cards (id integer primary key, nid integer, did integer, ord integer, type integer, queue integer, due integer, ivl integer, factor integer, reps integer, lapses integer)`,
+		`CREATE TABLE revlog (id integer primary key, cid integer, ease integer, ivl integer, lastIvl integer, factor integer, time integer, type integer)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	models := `{"1600000000000": {"name": "Basic", "type": 0, "flds": [{"name": "Back", "ord": 1}, {"name": "Front", "ord": 0}]}}`
+	decks := `{"1": {"name": "Default"}}`
+	if err := db.Exec(`INSERT INTO col VALUES (1, 1600000000, ?, ?)`, models, decks).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(`INSERT INTO notes VALUES (10, 'abc', 1600000000000, 1600000100, ' set math ', ?)`, "Set"+FieldSeparator+`A collection <img src="venn.png">`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(`INSERT INTO cards VALUES (20, 10, 1, 0, 2, 2, 5, 4, 2500, 2, 0)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(`INSERT INTO revlog VALUES (1600000200000, 20, 3, -600, 0, 0, 8000, 0), (1600086600000, 20, 3, 4, -600, 2500, 5000, 1)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	closeCollection(db)
+
+	collection, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range map[string][]byte{
+		"collection.anki2": collection,
+		"media":            []byte(`{"0": "venn.png"}`),
+		"0":                []byte("png"),
+	} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	content := buildPackage(t)
+	pkg, err := Read(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noteType := pkg.NoteTypes[1600000000000]
+	if noteType.Name != "Basic" || !reflect.DeepEqual(noteType.Fields, []string{"Front", "Back"}) {
+		t.Errorf("note type = %+v, want Basic with fields Front, Back in order", noteType)
+	}
+	if len(pkg.Notes) != 1 {
+		t.Fatalf("read %d notes, want 1", len(pkg.Notes))
+	}
+	note := pkg.Notes[0]
+	if !reflect.DeepEqual(note.Fields, []string{"Set", `A collection <img src="venn.png">`}) || !reflect.DeepEqual(note.Tags, []string{"set", "math"}) {
+		t.Errorf("note = %+v", note)
+	}
+	if len(pkg.Cards) != 1 || pkg.Cards[0].NoteID != 10 || pkg.Cards[0].Factor != 2500 {
+		t.Errorf("cards = %+v", pkg.Cards)
+	}
+	if len(pkg.Reviews) != 2 || pkg.Reviews[0].LastIntervalDays() != 0 || pkg.Reviews[1].LastIntervalDays() != 600.0/86400 {
+		t.Errorf("reviews = %+v", pkg.Reviews)
+	}
+	if string(pkg.Media["venn.png"]) != "png" {
+		t.Errorf("media = %v, want venn.png", pkg.Media)
+	}
+
+	due := pkg.DueTime(pkg.Cards[0])
+	if want := time.Unix(1600000000, 0).AddDate(0, 0, 5); due == nil || !due.Equal(want) {
+		t.Errorf("due = %v, want %v", due, want)
+	}
+}
+
+func TestReadRejectsCompressedCollection(t *testing.T) {
+	// Recent Anki versions add a placeholder legacy collection
+	legacy := buildPackage(t)
+	placeholder, err := zip.NewReader(bytes.NewReader(legacy), int64(len(legacy)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, file := range placeholder.File {
+		if err := w.Copy(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.Create("collection.anki21b"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	_, err = Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !errors.Is(err, ErrUnsupportedPackage) || !strings.Contains(err.Error(), "anki21b") {
+		t.Errorf("error = %v, want ErrUnsupportedPackage naming anki21b", err)
+	}
+}
+
+func TestReadLimitsSize(t *testing.T) {
+	content := buildPackage(t)
+	defer func(entry, total int64) { maxEntrySize, maxPackageSize = entry, total }(maxEntrySize, maxPackageSize)
+
+	// The collection alone is too large
+	maxEntrySize = 1024
+	if _, err := Read(bytes.NewReader(content), int64(len(content))); !errors.Is(err, ErrPackageTooLarge) {
+		t.Errorf("entry limit error = %v, want ErrPackageTooLarge", err)
+	}
+
+	// The collection fits, the media do not
+	maxEntrySize = 1 << 20
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range archive.File {
+		if file.Name == "collection.anki2" {
+			maxPackageSize = int64(file.UncompressedSize64) + 5
+		}
+	}
+	if _, err := Read(bytes.NewReader(content), int64(len(content))); !errors.Is(err, ErrPackageTooLarge) {
+		t.Errorf("package limit error = %v, want ErrPackageTooLarge", err)
+	}
+
+	maxPackageSize += 100
+	if _, err := Read(bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Errorf("package within the limits: %v", err)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := map[string]string{
+		"Set":                                "Set",
+		"<b>Group</b> &amp; ring":            "Group & ring",
+		"line<br>break<div>block</div>":      "line break block",
+		"{{c1::Paris::city}} is the capital": "Paris is the capital",
+		"word [sound:word.mp3]":              "word",
+	}
+	for field, want := range tests {
+		if got := PlainText(field); got != want {
+			t.Errorf("PlainText(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestMediaRefs(t *testing.T) {
+	got := MediaRefs(`<img src="a.png"> text <img class="x" src='b&amp;c.jpg'> [sound:d.mp3]`)
+	want := []string{"a.png", "b&c.jpg", "d.mp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MediaRefs = %v, want %v", got, want)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	written := &Package{
+		Created: time.Unix(1600000000, 0),
+		NoteTypes: map[int64]NoteType{
+			7: {
+				ID:        7,
+				Name:      "Definition",
+				Fields:    []string{"Code", "Name", "Description"},
+				SortField: 1,
+				Templates: []Template{{Name: "Card 1", Front: "{{Name}}", Back: "{{FrontSide}}<hr id=answer>{{Description}}"}},
+				CSS:       ".card { color: black; }",
+			},
+		},
+		Decks: map[int64]string{5: "Sets"},
+		Notes: []Note{
+			{ID: 10, GUID: "set", NoteTypeID: 7, Fields: []string{"SET", "Set", "A collection"}, Tags: []string{"prereq::ELEM"}, Modified: time.Unix(1600000100, 0)},
+		},
+		Cards: []Card{
+			{ID: 20, NoteID: 10, DeckID: 5, Type: CardReview, Queue: QueueSuspended, Due: 5, Interval: 4, Factor: 2500, Reps: 2, Lapses: 1},
+		},
+		Reviews: []Review{
+			{ID: 1600000200000, CardID: 20, Ease: 3, Interval: 4, LastInterval: -600, Factor: 2500, Duration: 5000, Type: ReviewReview},
+		},
+		Media: map[string][]byte{"venn.png": []byte("png")},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, written); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !read.Created.Equal(written.Created) {
+		t.Errorf("created = %v, want %v", read.Created, written.Created)
+	}
+	if !reflect.DeepEqual(read.NoteTypes[7], written.NoteTypes[7]) {
+		t.Errorf("note type = %+v, want %+v", read.NoteTypes[7], written.NoteTypes[7])
+	}
+	if read.Decks[5] != "Sets" || read.Decks[DefaultDeckID] != "Default" {
+		t.Errorf("decks = %v", read.Decks)
+	}
+	if len(read.Notes) != 1 || !reflect.DeepEqual(read.Notes[0], written.Notes[0]) {
+		t.Errorf("notes = %+v, want %+v", read.Notes, written.Notes)
+	}
+	if !reflect.DeepEqual(read.Cards, written.Cards) {
+		t.Errorf("cards = %+v, want %+v", read.Cards, written.Cards)
+	}
+	if !reflect.DeepEqual(read.Reviews, written.Reviews) {
+		t.Errorf("reviews = %+v, want %+v", read.Reviews, written.Reviews)
+	}
+	if string(read.Media["venn.png"]) != "png" {
+		t.Errorf("media = %v", read.Media)
+	}
+}
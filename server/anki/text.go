@@ -0,0 +1,39 @@
+package anki
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	clozePattern = regexp.MustCompile(`\{\{c\d+::(.*?)(::.*?)?\}\}`)
+	tagPattern   = regexp.MustCompile(`(?s)<[^>]*>`)
+	breakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</?(div|p|li)(\s[^>]*)?>`)
+	soundPattern = regexp.MustCompile(`\[sound:([^\]]+)\]`)
+	imagePattern = regexp.MustCompile(`(?i)<img[^>]*\ssrc=["']?([^"'>\s]+)`)
+)
+
+// PlainText turns a field into plain text: cloze deletions show their
+// answer, HTML tags and sounds are dropped, entities decoded and white space
+// collapsed
+func PlainText(field string) string {
+	text := clozePattern.ReplaceAllString(field, "$1")
+	text = breakPattern.ReplaceAllString(text, " ")
+	text = tagPattern.ReplaceAllString(text, "")
+	text = soundPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// MediaRefs returns the media file names a field refers to, in images and
+// sounds
+func MediaRefs(field string) []string {
+	var refs []string
+	for _, pattern := range []*regexp.Regexp{imagePattern, soundPattern} {
+		for _, match := range pattern.FindAllStringSubmatch(field, -1) {
+			refs = append(refs, html.UnescapeString(match[1]))
+		}
+	}
+	return refs
+}
@@ -0,0 +1,289 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// collectionVersion is the legacy collection schema, which every Anki
+// version since 2.1 imports
+const collectionVersion = 11
+
+// DefaultDeckID is the deck every collection has
+const DefaultDeckID int64 = 1
+
+var collectionSchema = []string{
+	`CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null, ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null, models text not null, decks text not null, dconf text not null, tags text not null)`,
+	`CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null, usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null, flags integer not null, data text not null)`,
+	`CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null, mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null, ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null)`,
+	`CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ease integer not null, ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null)`,
+	`CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null)`,
+	`CREATE INDEX ix_notes_usn ON notes (usn)`,
+	`CREATE INDEX ix_cards_usn ON cards (usn)`,
+	`CREATE INDEX ix_revlog_usn ON revlog (usn)`,
+	`CREATE INDEX ix_cards_nid ON cards (nid)`,
+	`CREATE INDEX ix_cards_sched ON cards (did, queue, due)`,
+	`CREATE INDEX ix_revlog_cid ON revlog (cid)`,
+	`CREATE INDEX ix_notes_csum ON notes (csum)`,
+}
+
+// Write writes a package as an .apkg file holding a legacy collection. The
+// decks use Anki's default options; a deck missing from Decks is named
+// after its ID.
+func Write(w io.Writer, pkg *Package) error {
+	tmp, err := os.CreateTemp("", "collection-*.anki2")
+	if err != nil {
+		return err
+	}
+	path := tmp.Name()
+	tmp.Close()
+	defer os.Remove(path)
+
+	if err := writeCollection(path, pkg); err != nil {
+		return err
+	}
+	collection, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	if err := writeEntry(archive, "collection.anki2", collection); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(pkg.Media))
+	for name := range pkg.Media {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	media := make(map[string]string, len(names))
+	for i, name := range names {
+		entry := strconv.Itoa(i)
+		media[entry] = name
+		if err := writeEntry(archive, entry, pkg.Media[name]); err != nil {
+			return err
+		}
+	}
+	mediaMap, err := json.Marshal(media)
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(archive, "media", mediaMap); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// WriteFile writes a package to an .apkg file
+func WriteFile(path string, pkg *Package) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Write(file, pkg); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeEntry(archive *zip.Writer, name string, content []byte) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return err
+}
+
+func writeCollection(path string, pkg *Package) error {
+	db, err := openCollection(path)
+	if err != nil {
+		return err
+	}
+	defer closeCollection(db)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range collectionSchema {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		models, decks, dconf, conf, err := collectionConfig(pkg, now)
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec(`INSERT INTO col VALUES (1, ?, ?, ?, ?, 0, 0, 0, ?, ?, ?, ?, '{}')`,
+			pkg.Created.Unix(), now.UnixMilli(), now.UnixMilli(), collectionVersion, conf, models, decks, dconf).Error; err != nil {
+			return err
+		}
+
+		for _, note := range pkg.Notes {
+			noteType := pkg.NoteType(note)
+			sortField := ""
+			if noteType.SortField < len(note.Fields) {
+				sortField = PlainText(note.Fields[noteType.SortField])
+			}
+			modified := note.Modified
+			if modified.IsZero() {
+				modified = now
+			}
+			tags := ""
+			if len(note.Tags) > 0 {
+				tags = " " + strings.Join(note.Tags, " ") + " "
+			}
+			if err := tx.Exec(`INSERT INTO notes VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, 0, '')`,
+				note.ID, note.GUID, note.NoteTypeID, modified.Unix(), tags,
+				strings.Join(note.Fields, FieldSeparator), sortField, fieldChecksum(note.Fields)).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, card := range pkg.Cards {
+			if err := tx.Exec(`INSERT INTO cards VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?, ?, 0, 0, 0, 0, '')`,
+				card.ID, card.NoteID, card.DeckID, card.Ord, now.Unix(), card.Type, card.Queue,
+				card.Due, card.Interval, card.Factor, card.Reps, card.Lapses).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, review := range pkg.Reviews {
+			if err := tx.Exec(`INSERT INTO revlog VALUES (?, ?, 0, ?, ?, ?, ?, ?, ?)`,
+				review.ID, review.CardID, review.Ease, review.Interval, review.LastInterval,
+				review.Factor, review.Duration, review.Type).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// fieldChecksum is the checksum Anki looks duplicates up by: the first 8
+// hex digits of the SHA-1 of the first field's text
+func fieldChecksum(fields []string) int64 {
+	if len(fields) == 0 {
+		return 0
+	}
+	sum := sha1.Sum([]byte(PlainText(fields[0])))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
+
+// collectionConfig builds the JSON the col table keeps the note types,
+// decks, deck options and collection settings in
+func collectionConfig(pkg *Package, now time.Time) (models, decks, dconf, conf string, err error) {
+	modelMap := make(map[string]interface{}, len(pkg.NoteTypes))
+	var curModel interface{}
+	for id, noteType := range pkg.NoteTypes {
+		modelMap[strconv.FormatInt(id, 10)] = noteTypeConfig(noteType, now)
+		if curModel == nil {
+			curModel = strconv.FormatInt(id, 10)
+		}
+	}
+
+	deckMap := map[string]interface{}{
+		strconv.FormatInt(DefaultDeckID, 10): deckConfig(DefaultDeckID, "Default", now),
+	}
+	for id, name := range pkg.Decks {
+		deckMap[strconv.FormatInt(id, 10)] = deckConfig(id, name, now)
+	}
+	for _, card := range pkg.Cards {
+		key := strconv.FormatInt(card.DeckID, 10)
+		if _, exists := deckMap[key]; !exists {
+			deckMap[key] = deckConfig(card.DeckID, key, now)
+		}
+	}
+
+	optionsMap := map[string]interface{}{
+		"1": map[string]interface{}{
+			"id": 1, "name": "Default", "mod": 0, "usn": 0,
+			"maxTaken": 60, "autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+			"new": map[string]interface{}{
+				"delays": []float64{1, 10}, "ints": []int{1, 4, 0}, "initialFactor": 2500,
+				"order": 1, "perDay": 20, "bury": false,
+			},
+			"rev": map[string]interface{}{
+				"perDay": 200, "ease4": 1.3, "ivlFct": 1, "maxIvl": 36500,
+				"hardFactor": 1.2, "bury": false,
+			},
+			"lapse": map[string]interface{}{
+				"delays": []float64{10}, "mult": 0, "minInt": 1,
+				"leechFails": 8, "leechAction": 1,
+			},
+		},
+	}
+
+	confMap := map[string]interface{}{
+		"activeDecks": []int64{DefaultDeckID}, "curDeck": DefaultDeckID, "curModel": curModel,
+		"nextPos": len(pkg.Notes) + 1, "newSpread": 0, "collapseTime": 1200, "timeLim": 0,
+		"estTimes": true, "dueCounts": true, "sortType": "noteFld", "sortBackwards": false,
+		"addToCur": true,
+	}
+
+	values := make([]string, 4)
+	for i, value := range []interface{}{modelMap, deckMap, optionsMap, confMap} {
+		content, err := json.Marshal(value)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		values[i] = string(content)
+	}
+	return values[0], values[1], values[2], values[3], nil
+}
+
+func noteTypeConfig(noteType NoteType, now time.Time) map[string]interface{} {
+	fields := make([]map[string]interface{}, len(noteType.Fields))
+	for i, name := range noteType.Fields {
+		fields[i] = map[string]interface{}{
+			"name": name, "ord": i, "sticky": false, "rtl": false,
+			"font": "Arial", "size": 20, "media": []string{},
+		}
+	}
+
+	templates := make([]map[string]interface{}, len(noteType.Templates))
+	requirements := make([]interface{}, 0, len(noteType.Templates))
+	for i, template := range noteType.Templates {
+		templates[i] = map[string]interface{}{
+			"name": template.Name, "ord": i, "qfmt": template.Front, "afmt": template.Back,
+			"bqfmt": "", "bafmt": "", "did": nil, "bfont": "", "bsize": 0,
+		}
+		// A card is made when any field its front shows is filled
+		required := []int{}
+		for ord, name := range noteType.Fields {
+			if strings.Contains(template.Front, name+"}}") {
+				required = append(required, ord)
+			}
+		}
+		requirements = append(requirements, []interface{}{i, "any", required})
+	}
+
+	return map[string]interface{}{
+		"id": noteType.ID, "name": noteType.Name, "type": noteType.Kind,
+		"mod": now.Unix(), "usn": 0, "sortf": noteType.SortField, "did": DefaultDeckID,
+		"flds": fields, "tmpls": templates, "req": requirements, "css": noteType.CSS,
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}", "latexsvg": false,
+		"tags": []string{}, "vers": []int{},
+	}
+}
+
+func deckConfig(id int64, name string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id": id, "name": name, "mod": now.Unix(), "usn": 0, "desc": "",
+		"dyn": 0, "conf": 1, "collapsed": false, "browserCollapsed": false,
+		"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0},
+		"timeToday": []int{0, 0}, "extendNew": 0, "extendRev": 0,
+	}
+}
@@ -1,52 +1,18 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"myapp/server/dao"
+	"myapp/server/interchange"
 	"myapp/server/models"
 	"gorm.io/gorm"
 )
 
-// TutorialData represents the JSON structure for tutorial content
-type TutorialData struct {
-	Definitions map[string]TutorialDefinitionNode `json:"definitions"`
-	Exercises   map[string]TutorialExerciseNode   `json:"exercises"`
-}
-
-// TutorialDefinitionNode represents a definition in the tutorial JSON
-type TutorialDefinitionNode struct {
-	Code          string   `json:"code"`
-	Name          string   `json:"name"`
-	Description   []string `json:"description"`
-	Notes         string   `json:"notes,omitempty"`
-	References    []string `json:"references,omitempty"`
-	Prerequisites []string `json:"prerequisites,omitempty"`
-	XPosition     float64  `json:"xPosition,omitempty"`
-	YPosition     float64  `json:"yPosition,omitempty"`
-}
-
-// TutorialExerciseNode represents an exercise in the tutorial JSON
-type TutorialExerciseNode struct {
-	Code          string   `json:"code"`
-	Name          string   `json:"name"`
-	Statement     string   `json:"statement"`
-	Description   string   `json:"description,omitempty"`
-	Hints         string   `json:"hints,omitempty"`
-	Difficulty    int      `json:"difficulty,omitempty"`
-	Verifiable    bool     `json:"verifiable,omitempty"`
-	Result        string   `json:"result,omitempty"`
-	Prerequisites []string `json:"prerequisites,omitempty"`
-	XPosition     float64  `json:"xPosition,omitempty"`
-	YPosition     float64  `json:"yPosition,omitempty"`
-}
-
 const (
 	TutorialDomainName = "Tutorial: Introduction to Learning"
 	TutorialFileName   = "tutorial.json"
@@ -110,7 +76,7 @@ func autoImportTutorial(db *gorm.DB) error {
 	log.Printf("Created tutorial domain: %s (ID: %d)", tutorialDomain.Name, tutorialDomain.ID)
 
 	// Import tutorial content
-	if err := importTutorialContent(db, tutorialDomain, adminUser, tutorialData); err != nil {
+	if err := importTutorialContent(db, tutorialDomain, tutorialData); err != nil {
 		return fmt.Errorf("failed to import tutorial content: %v", err)
 	}
 
@@ -118,8 +84,9 @@ func autoImportTutorial(db *gorm.DB) error {
 	return nil
 }
 
-// readTutorialFile reads and parses the tutorial JSON file
-func readTutorialFile() (*TutorialData, error) {
+// readTutorialFile reads and parses the tutorial JSON file, which may be in
+// any version of the interchange format
+func readTutorialFile() (*interchange.Document, error) {
 	// Try multiple possible locations for the tutorial file
 	possiblePaths := []string{
 		TutorialFileName,                    // Current directory
@@ -152,102 +119,20 @@ func readTutorialFile() (*TutorialData, error) {
 		return nil, fmt.Errorf("failed to read tutorial file: %v", err)
 	}
 
-	var tutorialData TutorialData
-	if err := json.Unmarshal(byteValue, &tutorialData); err != nil {
+	tutorialData, err := interchange.Parse(byteValue)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse tutorial JSON: %v", err)
 	}
 
-	return &tutorialData, nil
+	return tutorialData, nil
 }
 
 // importTutorialContent imports the tutorial definitions and exercises
-func importTutorialContent(db *gorm.DB, domain *models.Domain, owner *models.User, data *TutorialData) error {
-	definitionDAO := dao.NewDefinitionDAO(db)
-	exerciseDAO := dao.NewExerciseDAO(db)
-
-	// Create definitions first (without prerequisites)
-	definitions := make(map[string]*models.Definition)
-	for code, defNode := range data.Definitions {
-		// Join multiple description lines
-		descriptionStr := strings.Join(defNode.Description, "\n\n")
-
-		definition := &models.Definition{
-			Code:        defNode.Code,
-			Name:        defNode.Name,
-			Description: descriptionStr,
-			Notes:       defNode.Notes,
-			DomainID:    domain.ID,
-			OwnerID:     owner.ID,
-			XPosition:   defNode.XPosition,
-			YPosition:   defNode.YPosition,
-		}
-
-		// Create definition with references but no prerequisites yet
-		if err := definitionDAO.Create(definition, defNode.References, nil); err != nil {
-			return fmt.Errorf("failed to create definition %s: %v", code, err)
-		}
-
-		definitions[code] = definition
-		log.Printf("Created definition: %s (ID: %d)", definition.Name, definition.ID)
-	}
-
-	// Now add prerequisites for definitions
-	for code, defNode := range data.Definitions {
-		if len(defNode.Prerequisites) > 0 {
-			definition := definitions[code]
-			var prerequisiteIDs []uint
-
-			for _, prereqCode := range defNode.Prerequisites {
-				if prereqDef, exists := definitions[prereqCode]; exists {
-					prerequisiteIDs = append(prerequisiteIDs, prereqDef.ID)
-				} else {
-					log.Printf("Warning: Prerequisite %s not found for definition %s", prereqCode, code)
-				}
-			}
-
-			if len(prerequisiteIDs) > 0 {
-				// Update definition with prerequisites
-				if err := definitionDAO.Update(definition, defNode.References, prerequisiteIDs); err != nil {
-					return fmt.Errorf("failed to update definition %s with prerequisites: %v", code, err)
-				}
-			}
-		}
-	}
-
-	// Create exercises
-	for code, exNode := range data.Exercises {
-		exercise := &models.Exercise{
-			Code:        exNode.Code,
-			Name:        exNode.Name,
-			Statement:   exNode.Statement,
-			Description: exNode.Description,
-			Hints:       exNode.Hints,
-			DomainID:    domain.ID,
-			OwnerID:     owner.ID,
-			Verifiable:  exNode.Verifiable,
-			Result:      exNode.Result,
-			Difficulty:  exNode.Difficulty,
-			XPosition:   exNode.XPosition,
-			YPosition:   exNode.YPosition,
-		}
-
-		// Collect prerequisite IDs
-		var prerequisiteIDs []uint
-		for _, prereqCode := range exNode.Prerequisites {
-			if prereqDef, exists := definitions[prereqCode]; exists {
-				prerequisiteIDs = append(prerequisiteIDs, prereqDef.ID)
-			} else {
-				log.Printf("Warning: Prerequisite %s not found for exercise %s", prereqCode, code)
-			}
-		}
-
-		// Create exercise with prerequisites
-		if err := exerciseDAO.Create(exercise, prerequisiteIDs); err != nil {
-			return fmt.Errorf("failed to create exercise %s: %v", code, err)
-		}
-
-		log.Printf("Created exercise: %s (ID: %d)", exercise.Name, exercise.ID)
+func importTutorialContent(db *gorm.DB, domain *models.Domain, data *interchange.Document) error {
+	if err := dao.NewGraphDAO(db).ImportDomain(domain.ID, domain.OwnerID, data.GraphData()); err != nil {
+		return err
 	}
+	log.Printf("Imported %d definitions and %d exercises", len(data.Definitions), len(data.Exercises))
 
 	// Verify prerequisites were created correctly
 	var prereqCount int64
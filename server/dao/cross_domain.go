@@ -0,0 +1,358 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"myapp/server/models"
+)
+
+// ErrPrerequisiteNotReadable is returned when a prerequisite lies in another
+// domain that the author of the node cannot read
+var ErrPrerequisiteNotReadable = errors.New("prerequisite is in a domain the author cannot read")
+
+// ErrDependentNodes is returned when a replace import leaves out nodes that
+// nodes of other domains require
+var ErrDependentNodes = errors.New("nodes of other domains require nodes the import leaves out")
+
+// ErrUnresolvedExternal is returned when an imported external stub matches
+// no definition of another domain, or its domain name matches several
+var ErrUnresolvedExternal = errors.New("external prerequisite matches no definition")
+
+// ExternalNode is a prerequisite from another domain, exported as a stub
+type ExternalNode struct {
+	ID         uint   `json:"-"` // local to this database, not exported
+	Type       string `json:"-"`
+	DomainID   uint   `json:"domainId"`
+	DomainName string `json:"domainName"`
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+}
+
+// externalRef is how a prerequisite of another domain is written in
+// prerequisite code lists: the domain ID and the code, e.g. "3:SET-1"
+func externalRef(domainID uint, code string) string {
+	return fmt.Sprintf("%d:%s", domainID, code)
+}
+
+// checkPrerequisiteReadable checks that a prerequisite of a node of the
+// domain lies in the same domain, in a public domain, or in a domain of the
+// same owner
+func checkPrerequisiteReadable(db *gorm.DB, domainID uint, prereqID uint, prereqType string) error {
+	prereqDomainID, err := nodeDomainID(db, prereqID, prereqType)
+	if err != nil || prereqDomainID == domainID {
+		return err
+	}
+
+	var domains []models.Domain
+	if err := db.Select("id", "owner_id", "privacy").Where("id IN ?", []uint{domainID, prereqDomainID}).Find(&domains).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]models.Domain, len(domains))
+	for _, domain := range domains {
+		byID[domain.ID] = domain
+	}
+
+	prereqDomain := byID[prereqDomainID]
+	if prereqDomain.Privacy == "public" || prereqDomain.OwnerID == byID[domainID].OwnerID {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %d is in domain %d", ErrPrerequisiteNotReadable, prereqType, prereqID, prereqDomainID)
+}
+
+// checkPrerequisiteReadableBy checks that a user may read the domain of a
+// prerequisite: it is public, the user owns it, or the user is an admin.
+// Imports check their external prerequisites this way, for the user running
+// the import.
+func checkPrerequisiteReadableBy(db *gorm.DB, userID uint, prereqID uint, prereqType string) error {
+	prereqDomainID, err := nodeDomainID(db, prereqID, prereqType)
+	if err != nil {
+		return err
+	}
+
+	var domain models.Domain
+	if err := db.Select("id", "owner_id", "privacy").First(&domain, prereqDomainID).Error; err != nil {
+		return err
+	}
+	if domain.Privacy == "public" || domain.OwnerID == userID {
+		return nil
+	}
+
+	var admins int64
+	if err := db.Model(&models.User{}).Where("id = ? AND is_admin = ?", userID, true).Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %d is in domain %d", ErrPrerequisiteNotReadable, prereqType, prereqID, prereqDomainID)
+}
+
+// nodeDomains returns the domain of every node at either end of the
+// prerequisites, by node key
+func nodeDomains(db *gorm.DB, prerequisites []models.NodePrerequisite) (map[string]uint, error) {
+	ids := map[string][]uint{}
+	for _, p := range prerequisites {
+		ids[p.NodeType] = append(ids[p.NodeType], p.NodeID)
+		ids[p.PrerequisiteType] = append(ids[p.PrerequisiteType], p.PrerequisiteID)
+	}
+
+	domains := make(map[string]uint)
+	for nodeType, table := range map[string]string{"definition": "definitions", "exercise": "exercises"} {
+		if len(ids[nodeType]) == 0 {
+			continue
+		}
+		var rows []struct {
+			ID       uint
+			DomainID uint
+		}
+		if err := db.Table(table).Select("id", "domain_id").Where("id IN ?", ids[nodeType]).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			domains[nodeKey(row.ID, nodeType)] = row.DomainID
+		}
+	}
+	return domains, nil
+}
+
+// GetLinkedPrerequisites gets the prerequisites of a domain together with
+// those of the domains it is linked to by cross-domain edges, in either
+// direction, as long as follow accepts the linked domain. Edges into a
+// domain that is not followed are left out, so every returned edge has both
+// ends in the domain or in followed domains.
+func (d *SRSDao) GetLinkedPrerequisites(domainID uint, follow func(domainID uint) bool) ([]models.NodePrerequisite, error) {
+	included := map[uint]bool{domainID: true}
+	rejected := map[uint]bool{}
+	queue := []uint{domainID}
+	seen := map[uint]bool{}
+	domains := map[string]uint{}
+	var candidates []models.NodePrerequisite
+
+	for len(queue) > 0 {
+		prerequisites, err := d.GetPrerequisitesByDomain(queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+
+		var fresh []models.NodePrerequisite
+		for _, p := range prerequisites {
+			if !seen[p.ID] {
+				seen[p.ID] = true
+				fresh = append(fresh, p)
+			}
+		}
+		freshDomains, err := nodeDomains(d.db, fresh)
+		if err != nil {
+			return nil, err
+		}
+		for key, id := range freshDomains {
+			domains[key] = id
+		}
+		for _, p := range fresh {
+			for _, linked := range []uint{domains[nodeKey(p.NodeID, p.NodeType)], domains[nodeKey(p.PrerequisiteID, p.PrerequisiteType)]} {
+				if linked == 0 || included[linked] || rejected[linked] {
+					continue
+				}
+				if follow(linked) {
+					included[linked] = true
+					queue = append(queue, linked)
+				} else {
+					rejected[linked] = true
+				}
+			}
+		}
+		candidates = append(candidates, fresh...)
+	}
+
+	var linked []models.NodePrerequisite
+	for _, p := range candidates {
+		if included[domains[nodeKey(p.NodeID, p.NodeType)]] && included[domains[nodeKey(p.PrerequisiteID, p.PrerequisiteType)]] {
+			linked = append(linked, p)
+		}
+	}
+	return linked, nil
+}
+
+// GetPrerequisitesForUser gets the prerequisites that credit and status
+// propagation follow for a user in a domain: those of the domain and, across
+// cross-domain edges, of the other domains the user is enrolled in
+func (d *SRSDao) GetPrerequisitesForUser(userID uint, domainID uint) ([]models.NodePrerequisite, error) {
+	var enrolledIDs []uint
+	if err := d.db.Model(&models.UserDomainProgress{}).Where("user_id = ?", userID).Pluck("domain_id", &enrolledIDs).Error; err != nil {
+		return nil, err
+	}
+	enrolled := make(map[uint]bool, len(enrolledIDs))
+	for _, id := range enrolledIDs {
+		enrolled[id] = true
+	}
+	return d.GetLinkedPrerequisites(domainID, func(linked uint) bool { return enrolled[linked] })
+}
+
+// getExternalNodes gets the nodes outside the domain that nodes of the
+// domain require, by node key
+func (d *GraphDAO) getExternalNodes(domainID uint, prerequisites []models.NodePrerequisite) (map[string]ExternalNode, error) {
+	ids := map[string][]uint{}
+	for _, p := range prerequisites {
+		ids[p.PrerequisiteType] = append(ids[p.PrerequisiteType], p.PrerequisiteID)
+	}
+
+	nodes, err := namedNodes(d.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	external := make(map[string]ExternalNode, len(nodes))
+	for key, node := range nodes {
+		if node.DomainID != domainID {
+			external[key] = node
+		}
+	}
+	return external, nil
+}
+
+// namedNodes gets the code, name and domain of nodes given by type and ID,
+// by node key
+func namedNodes(db *gorm.DB, ids map[string][]uint) (map[string]ExternalNode, error) {
+	nodes := make(map[string]ExternalNode)
+	for nodeType, table := range map[string]string{"definition": "definitions", "exercise": "exercises"} {
+		if len(ids[nodeType]) == 0 {
+			continue
+		}
+		var rows []struct {
+			ID         uint
+			Code       string
+			Name       string
+			DomainID   uint
+			DomainName string
+		}
+		if err := db.Table(table+" n").
+			Select("n.id, n.code, n.name, n.domain_id, dm.name AS domain_name").
+			Joins("JOIN domains dm ON dm.id = n.domain_id").
+			Where("n.id IN ?", ids[nodeType]).
+			Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			nodes[nodeKey(row.ID, nodeType)] = ExternalNode{
+				ID:         row.ID,
+				Type:       nodeType,
+				DomainID:   row.DomainID,
+				DomainName: row.DomainName,
+				Code:       row.Code,
+				Name:       row.Name,
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// inboundPrerequisite is a prerequisite that a node of another domain has
+// on a node of the domain
+type inboundPrerequisite struct {
+	edge      models.NodePrerequisite
+	code      string       // of the required node of the domain
+	dependent ExternalNode // the node of the other domain
+}
+
+func (p inboundPrerequisite) String() string {
+	return fmt.Sprintf("%s %s of domain %s requires %s %s", p.dependent.Type, p.dependent.Code, p.dependent.DomainName, p.edge.PrerequisiteType, p.code)
+}
+
+// getInboundPrerequisites gets the prerequisites that nodes of other domains
+// have on nodes of the domain, ordered by edge ID
+func getInboundPrerequisites(db *gorm.DB, domainID uint) ([]inboundPrerequisite, error) {
+	prerequisites, err := NewSRSDao(db).GetPrerequisitesByDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string][]uint{}
+	for _, p := range prerequisites {
+		ids[p.NodeType] = append(ids[p.NodeType], p.NodeID)
+		ids[p.PrerequisiteType] = append(ids[p.PrerequisiteType], p.PrerequisiteID)
+	}
+	nodes, err := namedNodes(db, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var inbound []inboundPrerequisite
+	for _, p := range prerequisites {
+		dependent := nodes[nodeKey(p.NodeID, p.NodeType)]
+		required, exists := nodes[nodeKey(p.PrerequisiteID, p.PrerequisiteType)]
+		if !exists || required.DomainID != domainID || dependent.DomainID == domainID {
+			continue
+		}
+		inbound = append(inbound, inboundPrerequisite{edge: p, code: required.Code, dependent: dependent})
+	}
+	sort.Slice(inbound, func(i, j int) bool { return inbound[i].edge.ID < inbound[j].edge.ID })
+	return inbound, nil
+}
+
+// missingDependents returns the inbound prerequisites on nodes whose code
+// the import does not have
+func missingDependents(inbound []inboundPrerequisite, data *GraphData) []inboundPrerequisite {
+	codes := map[string]map[string]bool{"definition": {}, "exercise": {}}
+	for _, defNode := range data.Definitions {
+		codes["definition"][defNode.Code] = true
+	}
+	for _, exNode := range data.Exercises {
+		codes["exercise"][exNode.Code] = true
+	}
+
+	var missing []inboundPrerequisite
+	for _, p := range inbound {
+		if !codes[p.edge.PrerequisiteType][p.code] {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+// dependentsError names the inbound prerequisites a replace import cannot
+// keep
+func dependentsError(missing []inboundPrerequisite) error {
+	names := make([]string, len(missing))
+	for i, p := range missing {
+		names[i] = p.String()
+	}
+	return fmt.Errorf("%w: %s", ErrDependentNodes, strings.Join(names, "; "))
+}
+
+// resolveExternal finds the definition an imported external stub refers to:
+// by domain ID if that domain still has the name, else by domain name if
+// exactly one domain has it. A stub without a domain name only matches by
+// ID and name, so never.
+func resolveExternal(db *gorm.DB, node ExternalNode) (*models.Definition, error) {
+	unresolved := fmt.Errorf("%w: %s", ErrUnresolvedExternal, externalRef(node.DomainID, node.Code))
+	if node.DomainName == "" {
+		return nil, unresolved
+	}
+
+	var domains []models.Domain
+	if err := db.Where("id = ? AND name = ?", node.DomainID, node.DomainName).Find(&domains).Error; err != nil {
+		return nil, err
+	}
+	if len(domains) == 0 {
+		if err := db.Where("name = ?", node.DomainName).Limit(2).Find(&domains).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(domains) != 1 {
+		return nil, unresolved
+	}
+
+	var definition models.Definition
+	err := db.Where("domain_id = ? AND code = ?", domains[0].ID, node.Code).First(&definition).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, unresolved
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
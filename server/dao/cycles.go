@@ -0,0 +1,193 @@
+package dao
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+	"myapp/server/graph"
+	"myapp/server/models"
+)
+
+// CycleNode is a node of a prerequisite cycle
+type CycleNode struct {
+	ID       uint   `json:"id"`
+	Type     string `json:"type"`
+	Code     string `json:"code"`
+	DomainID uint   `json:"domainId"`
+}
+
+// DomainCycles lists the prerequisite cycles found in a domain
+type DomainCycles struct {
+	DomainID   uint          `json:"domainId"`
+	DomainName string        `json:"domainName"`
+	Cycles     [][]CycleNode `json:"cycles"`
+}
+
+// domainGraph is the prerequisite graph of a domain and of the domains it is
+// linked to by cross-domain prerequisites, keyed by node key (type_id), with
+// the codes needed to name its cycles
+type domainGraph struct {
+	edges graph.Edges
+	nodes map[string]CycleNode
+}
+
+func nodeKey(nodeID uint, nodeType string) string {
+	return fmt.Sprintf("%s_%d", nodeType, nodeID)
+}
+
+// nodeDomainID returns the domain of a definition or exercise
+func nodeDomainID(db *gorm.DB, nodeID uint, nodeType string) (uint, error) {
+	var domainIDs []uint
+	table := "definitions"
+	if nodeType == "exercise" {
+		table = "exercises"
+	}
+	if err := db.Table(table).Where("id = ?", nodeID).Pluck("domain_id", &domainIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(domainIDs) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return domainIDs[0], nil
+}
+
+// loadDomainGraph reads the prerequisite graph of a domain, following
+// cross-domain prerequisites into every linked domain, since a cycle may
+// leave the domain and come back
+func loadDomainGraph(db *gorm.DB, domainID uint) (*domainGraph, error) {
+	prerequisites, err := NewSRSDao(db).GetLinkedPrerequisites(domainID, func(uint) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	g := &domainGraph{edges: graph.Edges{}, nodes: map[string]CycleNode{}}
+	domainIDs := []uint{domainID}
+	domains, err := nodeDomains(db, prerequisites)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range domains {
+		domainIDs = append(domainIDs, id)
+	}
+	for _, p := range prerequisites {
+		g.edges.Add(nodeKey(p.NodeID, p.NodeType), nodeKey(p.PrerequisiteID, p.PrerequisiteType))
+	}
+
+	var definitions []models.Definition
+	if err := db.Select("id", "code", "domain_id").Where("domain_id IN ?", domainIDs).Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+	for _, def := range definitions {
+		g.nodes[nodeKey(def.ID, "definition")] = CycleNode{ID: def.ID, Type: "definition", Code: def.Code, DomainID: def.DomainID}
+	}
+
+	var exercises []models.Exercise
+	if err := db.Select("id", "code", "domain_id").Where("domain_id IN ?", domainIDs).Find(&exercises).Error; err != nil {
+		return nil, err
+	}
+	for _, ex := range exercises {
+		g.nodes[nodeKey(ex.ID, "exercise")] = CycleNode{ID: ex.ID, Type: "exercise", Code: ex.Code, DomainID: ex.DomainID}
+	}
+
+	return g, nil
+}
+
+// named turns a cycle of node keys into cycle nodes
+func (g *domainGraph) named(cycle []string) []CycleNode {
+	nodes := make([]CycleNode, len(cycle))
+	for i, key := range cycle {
+		node, ok := g.nodes[key]
+		if !ok {
+			// Missing node, name it by its key
+			node = CycleNode{Code: key}
+		}
+		nodes[i] = node
+	}
+	return nodes
+}
+
+// cycleError names a cycle by node codes
+func (g *domainGraph) cycleError(cycle []string) error {
+	codes := make([]string, len(cycle))
+	for i, node := range g.named(cycle) {
+		codes[i] = node.Code
+	}
+	return &graph.CycleError{Cycle: codes}
+}
+
+// checkNoCycleThrough returns a *graph.CycleError if a prerequisite cycle
+// runs through the node. It is called inside the transaction that changed the
+// node's prerequisites, after the change, so that the error rolls it back.
+// Every path that adds prerequisite edges goes through here.
+func checkNoCycleThrough(tx *gorm.DB, domainID uint, nodeID uint, nodeType string) error {
+	g, err := loadDomainGraph(tx, domainID)
+	if err != nil {
+		return err
+	}
+	if cycle := graph.FindCycleThrough(g.edges, nodeKey(nodeID, nodeType)); cycle != nil {
+		return g.cycleError(cycle)
+	}
+	return nil
+}
+
+// checkNoDomainCycle returns a *graph.CycleError if a prerequisite cycle
+// runs through any node of the domain. It checks a whole rewritten domain
+// with a single graph load, where checkNoCycleThrough would load it per node.
+func checkNoDomainCycle(tx *gorm.DB, domainID uint) error {
+	cycles, err := NewGraphDAO(tx).FindDomainCycles(domainID)
+	if err != nil {
+		return err
+	}
+	if len(cycles) == 0 {
+		return nil
+	}
+	codes := make([]string, len(cycles[0]))
+	for i, node := range cycles[0] {
+		codes[i] = node.Code
+	}
+	return &graph.CycleError{Cycle: codes}
+}
+
+// FindDomainCycles returns the prerequisite cycles through nodes of a
+// domain, one per group of nodes that require each other. Such a group may
+// extend into other domains through cross-domain prerequisites.
+func (d *GraphDAO) FindDomainCycles(domainID uint) ([][]CycleNode, error) {
+	g, err := loadDomainGraph(d.db, domainID)
+	if err != nil {
+		return nil, err
+	}
+	cycles := [][]CycleNode{}
+	for _, cycle := range graph.FindCycles(g.edges) {
+		named := g.named(cycle)
+		for _, node := range named {
+			if node.DomainID == domainID {
+				cycles = append(cycles, named)
+				break
+			}
+		}
+	}
+	return cycles, nil
+}
+
+// AuditCycles checks every domain for prerequisite cycles and returns the
+// domains that have some, with the number of domains checked
+func (d *GraphDAO) AuditCycles() ([]DomainCycles, int, error) {
+	var domains []models.Domain
+	if err := d.db.Select("id", "name").Find(&domains).Error; err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].ID < domains[j].ID })
+
+	results := []DomainCycles{}
+	for _, domain := range domains {
+		cycles, err := d.FindDomainCycles(domain.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(cycles) > 0 {
+			results = append(results, DomainCycles{DomainID: domain.ID, DomainName: domain.Name, Cycles: cycles})
+		}
+	}
+	return results, len(domains), nil
+}
@@ -5,7 +5,6 @@ import (
 	"myapp/server/models"
 	"os"
 	"testing"
-	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -231,7 +230,7 @@ func TestDefinitionAndExercise(t *testing.T) {
 		DomainID:    domain.ID,
 		OwnerID:     user.ID,
 		Verifiable:  false,
-		Difficulty:  "medium",
+		Difficulty:  3,
 		XPosition:   400.0,
 		YPosition:   300.0,
 	}
@@ -245,18 +244,22 @@ func TestDefinitionAndExercise(t *testing.T) {
 		t.Fatalf("Failed to find definition by code: %v", err)
 	}
 
+	if len(foundDef) != 1 {
+		t.Fatalf("Expected 1 definition with code 'DEF2', got %d", len(foundDef))
+	}
+
 	// Verify definition properties
-	if foundDef.Name != "Functions" {
-		t.Errorf("Expected definition name 'Functions', got '%s'", foundDef.Name)
+	if foundDef[0].Name != "Functions" {
+		t.Errorf("Expected definition name 'Functions', got '%s'", foundDef[0].Name)
 	}
 
 	// Verify references
-	if len(foundDef.References) != 1 || foundDef.References[0].Reference != "Book C" {
+	if len(foundDef[0].References) != 1 || foundDef[0].References[0].Reference != "Book C" {
 		t.Errorf("References not correctly loaded")
 	}
 
 	// Verify prerequisites
-	if len(foundDef.Prerequisites) != 1 || foundDef.Prerequisites[0].Code != "DEF1" {
+	if len(foundDef[0].PrerequisiteCodes) != 1 || foundDef[0].PrerequisiteCodes[0] != "DEF1" {
 		t.Errorf("Prerequisites not correctly loaded")
 	}
 
@@ -267,19 +270,20 @@ func TestDefinitionAndExercise(t *testing.T) {
 	}
 
 	// Verify exercise properties
-	if foundEx.Name != "Function Exercise" {
-		t.Errorf("Expected exercise name 'Function Exercise', got '%s'", foundEx.Name)
+	if len(foundEx) != 1 || foundEx[0].Name != "Function Exercise" {
+		t.Errorf("Expected one exercise named 'Function Exercise', got %d", len(foundEx))
 	}
 
 	// Test update operations
-	foundDef.Name = "Updated Functions"
+	updated := foundDef[0].Definition
+	updated.Name = "Updated Functions"
 	newReferences := []string{"Book D", "Book E"}
-	if err := definitionDAO.Update(foundDef, newReferences, prerequisiteIDs); err != nil {
+	if err := definitionDAO.Update(&updated, newReferences, prerequisiteIDs); err != nil {
 		t.Fatalf("Failed to update definition: %v", err)
 	}
 
 	// Verify update
-	updatedDef, _ := definitionDAO.FindByID(foundDef.ID)
+	updatedDef, _ := definitionDAO.FindByID(updated.ID)
 	if updatedDef.Name != "Updated Functions" {
 		t.Errorf("Expected updated name 'Updated Functions', got '%s'", updatedDef.Name)
 	}
@@ -405,7 +409,7 @@ func TestProgressTracking(t *testing.T) {
 	}
 
 	// Get session details
-	session, defs, exs, err := progressDAO.GetSessionDetails(sessions[0].ID)
+	session, sessionDefs, sessionExs, err := progressDAO.GetSessionDetails(sessions[0].ID)
 	if err != nil {
 		t.Fatalf("Failed to get session details: %v", err)
 	}
@@ -413,11 +417,11 @@ func TestProgressTracking(t *testing.T) {
 	if session == nil {
 		t.Errorf("Expected session to be non-nil")
 	}
-	if len(defs) != 1 {
-		t.Errorf("Expected 1 definition review in session, got %d", len(defs))
+	if len(sessionDefs) != 1 {
+		t.Errorf("Expected 1 definition review in session, got %d", len(sessionDefs))
 	}
-	if len(exs) != 1 {
-		t.Errorf("Expected 1 exercise in session, got %d", len(exs))
+	if len(sessionExs) != 1 {
+		t.Errorf("Expected 1 exercise in session, got %d", len(sessionExs))
 	}
 }
 
@@ -560,7 +564,7 @@ func TestGraphDAO(t *testing.T) {
 	}
 
 	// Import the modified graph
-	if err := graphDAO.ImportDomain(domain.ID, graph); err != nil {
+	if err := graphDAO.ImportDomain(domain.ID, domain.OwnerID, graph); err != nil {
 		t.Fatalf("Failed to import domain from graph: %v", err)
 	}
 
@@ -57,6 +57,8 @@ func InitDB() (*gorm.DB, error) {
     &models.StudySession{},
     &models.SessionReview{},
     &models.ReviewHistory{},
+    &models.UserSchedulerParams{},
+    &models.ReviewSnapshot{},
 	}
 	
 	// AutoMigrate all models - note that in production you might want more controlled migrations
@@ -66,5 +68,10 @@ func InitDB() (*gorm.DB, error) {
 		}
 	}
 
+	// Schema changes AutoMigrate does not make
+	if err := runMigrations(db, migrations); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
@@ -40,35 +40,42 @@ func (d *DefinitionDAO) Create(definition *models.Definition, references []strin
 		}
 		
 		// Add prerequisites to node_prerequisites table
-		if len(prerequisiteIDs) > 0 {
-			for _, prereqID := range prerequisiteIDs {
-				// Verify prerequisite exists
-				var count int64
-				if err := tx.Model(&models.Definition{}).Where("id = ?", prereqID).Count(&count).Error; err != nil {
-					return err
-				}
-				if count == 0 {
-					continue // Skip invalid prerequisite
-				}
-				
-				prerequisite := models.NodePrerequisite{
-					NodeID:           definition.ID,
-					NodeType:         "definition",
-					PrerequisiteID:   prereqID,
-					PrerequisiteType: "definition",
-					Weight:           1.0,
-					IsManual:         false,
-				}
-				
-				if err := tx.Create(&prerequisite).Error; err != nil {
-					// Ignore duplicates
-					continue
-				}
-			}
+		return addDefinitionPrerequisites(tx, definition, prerequisiteIDs)
+	})
+}
+
+// addDefinitionPrerequisites adds prerequisite definitions to a definition,
+// skipping unknown and duplicate ones. It does not check for cycles: callers
+// that can close one check afterwards.
+func addDefinitionPrerequisites(tx *gorm.DB, definition *models.Definition, prerequisiteIDs []uint) error {
+	for _, prereqID := range prerequisiteIDs {
+		// Verify prerequisite exists
+		var count int64
+		if err := tx.Model(&models.Definition{}).Where("id = ?", prereqID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			continue // Skip invalid prerequisite
+		}
+		if err := checkPrerequisiteReadable(tx, definition.DomainID, prereqID, "definition"); err != nil {
+			return err
 		}
 		
-		return nil
-	})
+		prerequisite := models.NodePrerequisite{
+			NodeID:           definition.ID,
+			NodeType:         "definition",
+			PrerequisiteID:   prereqID,
+			PrerequisiteType: "definition",
+			Weight:           1.0,
+			IsManual:         false,
+		}
+		
+		if err := tx.Create(&prerequisite).Error; err != nil {
+			// Ignore duplicates
+			continue
+		}
+	}
+	return nil
 }
 
 // Update updates an existing definition and its prerequisites
@@ -103,30 +110,12 @@ func (d *DefinitionDAO) Update(definition *models.Definition, references []strin
 		}
 		
 		if len(prerequisiteIDs) > 0 {
-			for _, prereqID := range prerequisiteIDs {
-				// Verify prerequisite exists
-				var count int64
-				if err := tx.Model(&models.Definition{}).Where("id = ?", prereqID).Count(&count).Error; err != nil {
-					return err
-				}
-				if count == 0 {
-					continue // Skip invalid prerequisite
-				}
-				
-				prerequisite := models.NodePrerequisite{
-					NodeID:           definition.ID,
-					NodeType:         "definition",
-					PrerequisiteID:   prereqID,
-					PrerequisiteType: "definition",
-					Weight:           1.0,
-					IsManual:         false,
-				}
-				
-				if err := tx.Create(&prerequisite).Error; err != nil {
-					// Ignore duplicates
-					continue
-				}
+			if err := addDefinitionPrerequisites(tx, definition, prerequisiteIDs); err != nil {
+				return err
 			}
+			
+			// Reject prerequisites that close a cycle
+			return checkNoCycleThrough(tx, definition.DomainID, definition.ID, "definition")
 		}
 		
 		return nil
@@ -279,6 +268,7 @@ func (d *DefinitionDAO) ConvertToResponse(definition *models.DefinitionWithPrere
 		Description:   definition.Description,
 		Notes:         definition.Notes,
 		References:    references,
+		Tags:          definition.Tags,
 		Prerequisites: definition.PrerequisiteCodes,
 		DomainID:      definition.DomainID,
 		OwnerID:       definition.OwnerID,
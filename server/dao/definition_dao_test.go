@@ -1,6 +1,8 @@
 package dao
 
 import (
+	"errors"
+	"myapp/server/graph"
 	"myapp/server/models"
 	"testing"
 
@@ -174,11 +176,14 @@ func TestDefinitionWithPrerequisites(t *testing.T) {
 	}
 
 	// Verify prerequisites
-	if len(foundDef.Prerequisites) != 1 {
-		t.Errorf("Expected 1 prerequisite, got %d", len(foundDef.Prerequisites))
+	if len(foundDef) != 1 {
+		t.Fatalf("Expected 1 definition with code 'DEF2', got %d", len(foundDef))
 	}
-	if foundDef.Prerequisites[0].Code != "DEF1" {
-		t.Errorf("Expected prerequisite code 'DEF1', got '%s'", foundDef.Prerequisites[0].Code)
+	if len(foundDef[0].PrerequisiteCodes) != 1 {
+		t.Fatalf("Expected 1 prerequisite, got %d", len(foundDef[0].PrerequisiteCodes))
+	}
+	if foundDef[0].PrerequisiteCodes[0] != "DEF1" {
+		t.Errorf("Expected prerequisite code 'DEF1', got '%s'", foundDef[0].PrerequisiteCodes[0])
 	}
 }
 
@@ -400,7 +405,7 @@ func TestFindDefinitionsByDomain(t *testing.T) {
 	}
 
 	// Find definitions by domain
-	definitions, err := definitionDAO.FindByDomain(domain1.ID)
+	definitions, err := definitionDAO.GetByDomainID(domain1.ID)
 	if err != nil {
 		t.Fatalf("Failed to find definitions by domain: %v", err)
 	}
@@ -411,7 +416,7 @@ func TestFindDefinitionsByDomain(t *testing.T) {
 	}
 
 	// Find definitions by domain 2
-	definitions2, err := definitionDAO.FindByDomain(domain2.ID)
+	definitions2, err := definitionDAO.GetByDomainID(domain2.ID)
 	if err != nil {
 		t.Fatalf("Failed to find definitions by domain 2: %v", err)
 	}
@@ -421,3 +426,93 @@ func TestFindDefinitionsByDomain(t *testing.T) {
 		t.Errorf("Expected 1 definition in domain 2, got %d", len(definitions2))
 	}
 }
+
+// createCycleTestDefinitions creates a user, a domain and definitions with
+// the given codes, without prerequisites
+func createCycleTestDefinitions(t *testing.T, db *gorm.DB, codes ...string) []*models.Definition {
+	t.Helper()
+	user := &models.User{Username: "author", Email: "author@example.com", Password: "password123"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	domain := &models.Domain{Name: "Cycles", Privacy: "private", OwnerID: user.ID}
+	if err := db.Create(domain).Error; err != nil {
+		t.Fatalf("Failed to create domain: %v", err)
+	}
+
+	definitionDAO := NewDefinitionDAO(db)
+	definitions := make([]*models.Definition, len(codes))
+	for i, code := range codes {
+		definitions[i] = &models.Definition{Code: code, Name: code, Description: code, DomainID: domain.ID, OwnerID: user.ID}
+		if err := definitionDAO.Create(definitions[i], nil, nil); err != nil {
+			t.Fatalf("Failed to create definition %s: %v", code, err)
+		}
+	}
+	return definitions
+}
+
+func TestDefinitionUpdateRejectsCycle(t *testing.T) {
+	db := setupSRSTestDB(t)
+	definitionDAO := NewDefinitionDAO(db)
+	defs := createCycleTestDefinitions(t, db, "A", "B", "C")
+	a, b, c := defs[0], defs[1], defs[2]
+
+	// C requires B requires A
+	if err := definitionDAO.Update(b, nil, []uint{a.ID}); err != nil {
+		t.Fatalf("Failed to add prerequisite: %v", err)
+	}
+	if err := definitionDAO.Update(c, nil, []uint{b.ID}); err != nil {
+		t.Fatalf("Failed to add prerequisite: %v", err)
+	}
+
+	// A requiring C closes the cycle
+	a.Name = "A renamed"
+	err := definitionDAO.Update(a, []string{"ref"}, []uint{c.ID})
+	var cycleErr *graph.CycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("Update error = %v, want a cycle error", err)
+	}
+	if len(cycleErr.Cycle) != 4 || cycleErr.Cycle[0] != cycleErr.Cycle[3] {
+		t.Errorf("cycle = %v, want A, B and C back to the first", cycleErr.Cycle)
+	}
+
+	// The whole update is rolled back
+	var edges int64
+	db.Model(&models.NodePrerequisite{}).Where("node_id = ? AND node_type = ?", a.ID, "definition").Count(&edges)
+	if edges != 0 {
+		t.Errorf("A has %d prerequisites after the rejected update, want 0", edges)
+	}
+	stored, err := definitionDAO.FindByID(a.ID)
+	if err != nil || stored.Name != "A" {
+		t.Errorf("stored A = %+v, %v, want the name unchanged", stored, err)
+	}
+
+	// A node requiring itself is a cycle too
+	if err := definitionDAO.Update(b, nil, []uint{b.ID}); !errors.As(err, &cycleErr) {
+		t.Errorf("self prerequisite error = %v, want a cycle error", err)
+	}
+}
+
+func TestDefinitionUpdateAllowsDiamond(t *testing.T) {
+	db := setupSRSTestDB(t)
+	definitionDAO := NewDefinitionDAO(db)
+	defs := createCycleTestDefinitions(t, db, "A", "B", "C", "D")
+	a, b, c, d := defs[0], defs[1], defs[2], defs[3]
+
+	// D requires B and C, which both require A: shared prerequisites are
+	// not a cycle
+	for _, update := range []struct {
+		def     *models.Definition
+		prereqs []uint
+	}{{b, []uint{a.ID}}, {c, []uint{a.ID}}, {d, []uint{b.ID, c.ID}}} {
+		if err := definitionDAO.Update(update.def, nil, update.prereqs); err != nil {
+			t.Fatalf("Update of %s failed: %v", update.def.Code, err)
+		}
+	}
+
+	var edges int64
+	db.Model(&models.NodePrerequisite{}).Count(&edges)
+	if edges != 4 {
+		t.Errorf("stored %d prerequisites, want 4", edges)
+	}
+}
@@ -302,7 +302,7 @@ func TestFindDomainsByOwner(t *testing.T) {
 	}
 
 	// Find domains by owner (user 1)
-	domains, err := domainDAO.FindByOwner(user1.ID)
+	domains, err := domainDAO.GetByOwnerID(user1.ID)
 	if err != nil {
 		t.Fatalf("Failed to find domains by owner: %v", err)
 	}
@@ -313,7 +313,7 @@ func TestFindDomainsByOwner(t *testing.T) {
 	}
 
 	// Find domains by owner (user 2)
-	domains2, err := domainDAO.FindByOwner(user2.ID)
+	domains2, err := domainDAO.GetByOwnerID(user2.ID)
 	if err != nil {
 		t.Fatalf("Failed to find domains by owner: %v", err)
 	}
@@ -373,7 +373,7 @@ func TestFindPublicDomains(t *testing.T) {
 	}
 
 	// Find public domains
-	domains, err := domainDAO.FindPublic()
+	domains, err := domainDAO.GetPublicDomains()
 	if err != nil {
 		t.Fatalf("Failed to find public domains: %v", err)
 	}
@@ -37,6 +37,9 @@ func (d *ExerciseDAO) Create(exercise *models.Exercise, prerequisiteIDs []uint)
 				if count == 0 {
 					continue // Skip invalid prerequisite
 				}
+				if err := checkPrerequisiteReadable(tx, exercise.DomainID, prereqID, "definition"); err != nil {
+					return err
+				}
 				
 				prerequisite := models.NodePrerequisite{
 					NodeID:           exercise.ID,
@@ -82,6 +85,9 @@ func (d *ExerciseDAO) Update(exercise *models.Exercise, prerequisiteIDs []uint)
 				if count == 0 {
 					continue // Skip invalid prerequisite
 				}
+				if err := checkPrerequisiteReadable(tx, exercise.DomainID, prereqID, "definition"); err != nil {
+					return err
+				}
 				
 				prerequisite := models.NodePrerequisite{
 					NodeID:           exercise.ID,
@@ -97,6 +103,9 @@ func (d *ExerciseDAO) Update(exercise *models.Exercise, prerequisiteIDs []uint)
 					continue
 				}
 			}
+			
+			// Reject prerequisites that close a cycle
+			return checkNoCycleThrough(tx, exercise.DomainID, exercise.ID, "exercise")
 		}
 		
 		return nil
@@ -244,6 +253,7 @@ func (d *ExerciseDAO) ConvertToResponse(exercise *models.ExerciseWithPrerequisit
 		Verifiable:    exercise.Verifiable,
 		Result:        exercise.Result,
 		Difficulty:    exercise.Difficulty,
+		Tags:          exercise.Tags,
 		Prerequisites: exercise.PrerequisiteCodes,
 		XPosition:     exercise.XPosition,
 		YPosition:     exercise.YPosition,
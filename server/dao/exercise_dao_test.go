@@ -108,7 +108,7 @@ func TestExerciseCreate(t *testing.T) {
 	}
 
 	// Find exercise by ID
-	foundEx, err := exerciseDAO.FindByID(exercise.ID)
+	foundEx, err := exerciseDAO.FindByIDWithPrerequisites(exercise.ID)
 	if err != nil {
 		t.Fatalf("Failed to find exercise by ID: %v", err)
 	}
@@ -125,11 +125,11 @@ func TestExerciseCreate(t *testing.T) {
 	}
 
 	// Verify prerequisites
-	if len(foundEx.Prerequisites) != 1 {
-		t.Errorf("Expected 1 prerequisite, got %d", len(foundEx.Prerequisites))
+	if len(foundEx.PrerequisiteCodes) != 1 {
+		t.Fatalf("Expected 1 prerequisite, got %d", len(foundEx.PrerequisiteCodes))
 	}
-	if foundEx.Prerequisites[0].ID != definition.ID {
-		t.Errorf("Expected prerequisite ID %d, got %d", definition.ID, foundEx.Prerequisites[0].ID)
+	if foundEx.PrerequisiteCodes[0] != definition.Code {
+		t.Errorf("Expected prerequisite code %s, got %s", definition.Code, foundEx.PrerequisiteCodes[0])
 	}
 }
 
@@ -221,7 +221,7 @@ func TestExerciseUpdate(t *testing.T) {
 	}
 
 	// Find updated exercise
-	updatedEx, err := exerciseDAO.FindByID(exercise.ID)
+	updatedEx, err := exerciseDAO.FindByIDWithPrerequisites(exercise.ID)
 	if err != nil {
 		t.Fatalf("Failed to find updated exercise: %v", err)
 	}
@@ -247,11 +247,11 @@ func TestExerciseUpdate(t *testing.T) {
 	}
 
 	// Verify updated prerequisites
-	if len(updatedEx.Prerequisites) != 1 {
-		t.Errorf("Expected 1 prerequisite after update, got %d", len(updatedEx.Prerequisites))
+	if len(updatedEx.PrerequisiteCodes) != 1 {
+		t.Fatalf("Expected 1 prerequisite after update, got %d", len(updatedEx.PrerequisiteCodes))
 	}
-	if updatedEx.Prerequisites[0].ID != def2.ID {
-		t.Errorf("Expected prerequisite ID %d after update, got %d", def2.ID, updatedEx.Prerequisites[0].ID)
+	if updatedEx.PrerequisiteCodes[0] != def2.Code {
+		t.Errorf("Expected prerequisite code %s after update, got %s", def2.Code, updatedEx.PrerequisiteCodes[0])
 	}
 }
 
@@ -404,7 +404,7 @@ func TestFindExercisesByDomain(t *testing.T) {
 	}
 
 	// Find exercises by domain
-	exercises, err := exerciseDAO.FindByDomain(domain1.ID)
+	exercises, err := exerciseDAO.GetByDomainID(domain1.ID)
 	if err != nil {
 		t.Fatalf("Failed to find exercises by domain: %v", err)
 	}
@@ -415,7 +415,7 @@ func TestFindExercisesByDomain(t *testing.T) {
 	}
 
 	// Find exercises by domain 2
-	exercises2, err := exerciseDAO.FindByDomain(domain2.ID)
+	exercises2, err := exerciseDAO.GetByDomainID(domain2.ID)
 	if err != nil {
 		t.Fatalf("Failed to find exercises by domain 2: %v", err)
 	}
@@ -483,17 +483,23 @@ func TestFindExerciseByCode(t *testing.T) {
 	}
 
 	// Verify exercise properties
-	if foundEx.Name != "Exercise with Unique Code" {
-		t.Errorf("Expected exercise name 'Exercise with Unique Code', got '%s'", foundEx.Name)
+	if len(foundEx) != 1 {
+		t.Fatalf("Expected 1 exercise with code 'UNIQUE_CODE', got %d", len(foundEx))
 	}
-	if foundEx.Notes != "Notes for exercise with unique code" {
-		t.Errorf("Expected notes 'Notes for exercise with unique code', got '%s'", foundEx.Notes)
+	if foundEx[0].Name != "Exercise with Unique Code" {
+		t.Errorf("Expected exercise name 'Exercise with Unique Code', got '%s'", foundEx[0].Name)
+	}
+	if foundEx[0].Notes != "Notes for exercise with unique code" {
+		t.Errorf("Expected notes 'Notes for exercise with unique code', got '%s'", foundEx[0].Notes)
 	}
 
 	// Try to find exercise with non-existent code
-	_, err = exerciseDAO.FindByCode("NONEXISTENT_CODE")
-	if err == nil {
-		t.Error("Expected error when finding exercise with non-existent code, got nil")
+	missing, err := exerciseDAO.FindByCode("NONEXISTENT_CODE")
+	if err != nil {
+		t.Fatalf("Failed to look up non-existent code: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("Expected no exercise with non-existent code, got %d", len(missing))
 	}
 }
 
@@ -554,7 +560,7 @@ func TestExerciseConvertToResponse(t *testing.T) {
 	}
 
 	// Convert to response
-	response := exerciseDAO.ConvertToResponse(exercise)
+	response := exerciseDAO.ConvertToResponse(&models.ExerciseWithPrerequisites{Exercise: *exercise})
 
 	// Verify response fields
 	if response.ID != exercise.ID {
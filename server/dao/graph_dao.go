@@ -6,10 +6,12 @@ import (
 	"errors"
 	"myapp/server/models"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
 	"gorm.io/gorm"
+	"myapp/server/graph"
 )
 
 // GraphDAO handles operations related to the knowledge graph
@@ -26,6 +28,7 @@ func NewGraphDAO(db *gorm.DB) *GraphDAO {
 type GraphData struct {
 	Definitions map[string]DefinitionNode `json:"definitions"`
 	Exercises   map[string]ExerciseNode   `json:"exercises"`
+	External    map[string]ExternalNode   `json:"external,omitempty"` // prerequisites from other domains, by their reference in prerequisite lists
 }
 
 // DefinitionNode represents a definition in the graph export/import format
@@ -35,11 +38,29 @@ type DefinitionNode struct {
 	Description   string   `json:"description"`
 	Notes         string   `json:"notes,omitempty"`
 	References    []string `json:"references,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
 	Prerequisites []string `json:"prerequisites,omitempty"`
 	XPosition     float64  `json:"xPosition,omitempty"`
 	YPosition     float64  `json:"yPosition,omitempty"`
+
+	// PrerequisiteLinks gives, by prerequisite code, the weight and manual
+	// flag of prerequisites; see PrerequisiteLink
+	PrerequisiteLinks map[string]PrerequisiteLink `json:"prerequisiteLinks,omitempty"`
+}
+
+// PrerequisiteLink is the weight and manual flag of a prerequisite edge.
+// Exports only list the edges with a weight other than 1 or added manually.
+// Imports create prerequisites without a link with weight 1, and merges
+// keep the weight and flag of existing ones.
+type PrerequisiteLink struct {
+	Weight float64 `json:"weight"`
+	Manual bool    `json:"manual,omitempty"`
 }
 
+// ErrInvalidWeight is returned when an import gives a prerequisite a weight
+// outside (0, 1]
+var ErrInvalidWeight = errors.New("prerequisite weight must be above 0 and at most 1")
+
 // ExerciseNode represents an exercise in the graph export/import format
 type ExerciseNode struct {
 	Code          string   `json:"code"`
@@ -50,9 +71,12 @@ type ExerciseNode struct {
 	Verifiable    bool     `json:"verifiable,omitempty"`
 	Result        string   `json:"result,omitempty"`
 	Difficulty    int      `json:"difficulty,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
 	Prerequisites []string `json:"prerequisites,omitempty"`
 	XPosition     float64  `json:"xPosition,omitempty"`
 	YPosition     float64  `json:"yPosition,omitempty"`
+
+	PrerequisiteLinks map[string]PrerequisiteLink `json:"prerequisiteLinks,omitempty"`
 }
 
 // VisualNode represents a node in the visual graph
@@ -64,6 +88,9 @@ type VisualNode struct {
 	X             float64  `json:"x,omitempty"`
 	Y             float64  `json:"y,omitempty"`
 	Prerequisites []string `json:"prerequisites,omitempty"`
+	External      bool     `json:"external,omitempty"` // stub of a prerequisite from another domain
+	DomainID      uint     `json:"domainId,omitempty"` // set on external stubs
+	DomainName    string   `json:"domainName,omitempty"`
 }
 
 // VisualGraph represents the graph structure for visualization
@@ -113,7 +140,7 @@ func (d *GraphDAO) GetVisualGraph(domainID uint) (*VisualGraph, error) {
 		nodeID := fmt.Sprintf("def_%d", def.ID)
 		
 		// Get prerequisite codes for this definition
-		prereqCodes, err := d.getPrerequisiteCodes(def.ID, "definition")
+		prereqCodes, err := d.getPrerequisiteCodes(domainID, def.ID, "definition")
 		if err != nil {
 			return nil, err
 		}
@@ -135,7 +162,7 @@ func (d *GraphDAO) GetVisualGraph(domainID uint) (*VisualGraph, error) {
 		nodeID := fmt.Sprintf("ex_%d", ex.ID)
 		
 		// Get prerequisite codes for this exercise
-		prereqCodes, err := d.getPrerequisiteCodes(ex.ID, "exercise")
+		prereqCodes, err := d.getPrerequisiteCodes(domainID, ex.ID, "exercise")
 		if err != nil {
 			return nil, err
 		}
@@ -167,6 +194,30 @@ func (d *GraphDAO) GetVisualGraph(domainID uint) (*VisualGraph, error) {
 		return nil, err
 	}
 	
+	// Add stubs for prerequisites from other domains
+	external, err := d.getExternalNodes(domainID, prerequisites)
+	if err != nil {
+		return nil, err
+	}
+	stubs := make([]VisualNode, 0, len(external))
+	for _, node := range external {
+		stubID := fmt.Sprintf("def_%d", node.ID)
+		if node.Type == "exercise" {
+			stubID = fmt.Sprintf("ex_%d", node.ID)
+		}
+		stubs = append(stubs, VisualNode{
+			ID:         stubID,
+			Type:       node.Type,
+			Name:       node.Name,
+			Code:       externalRef(node.DomainID, node.Code),
+			External:   true,
+			DomainID:   node.DomainID,
+			DomainName: node.DomainName,
+		})
+	}
+	sort.Slice(stubs, func(i, j int) bool { return stubs[i].Code < stubs[j].Code })
+	graph.Nodes = append(graph.Nodes, stubs...)
+	
 	// Create links from prerequisites
 	for _, prereq := range prerequisites {
 		var sourceID, targetID string
@@ -224,6 +275,53 @@ func (d *GraphDAO) ExportDomain(domainID uint) (*GraphData, error) {
 		Exercises:   make(map[string]ExerciseNode),
 	}
 	
+	// Stubs for prerequisites from other domains
+	var prerequisites []models.NodePrerequisite
+	query := `
+		SELECT np.* FROM node_prerequisites np
+		WHERE (np.node_type = 'definition' AND np.node_id IN (SELECT id FROM definitions WHERE domain_id = ?))
+		   OR (np.node_type = 'exercise' AND np.node_id IN (SELECT id FROM exercises WHERE domain_id = ?))
+	`
+	if err := d.db.Raw(query, domainID, domainID).Scan(&prerequisites).Error; err != nil {
+		return nil, err
+	}
+	external, err := d.getExternalNodes(domainID, prerequisites)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range external {
+		if node.Type != "definition" {
+			continue // only definitions are exported as prerequisites
+		}
+		if graphData.External == nil {
+			graphData.External = make(map[string]ExternalNode)
+		}
+		graphData.External[externalRef(node.DomainID, node.Code)] = node
+	}
+	
+	// Weights other than 1 and manual edges, by node and prerequisite code
+	prerequisiteCodes := make(map[uint]string, len(definitions)+len(external))
+	for _, def := range definitions {
+		prerequisiteCodes[def.ID] = def.Code
+	}
+	for _, node := range external {
+		if node.Type == "definition" {
+			prerequisiteCodes[node.ID] = externalRef(node.DomainID, node.Code)
+		}
+	}
+	links := map[string]map[string]PrerequisiteLink{}
+	for _, prereq := range prerequisites {
+		code, exists := prerequisiteCodes[prereq.PrerequisiteID]
+		if !exists || prereq.PrerequisiteType != "definition" || (prereq.Weight == 1 && !prereq.IsManual) {
+			continue
+		}
+		key := nodeKey(prereq.NodeID, prereq.NodeType)
+		if links[key] == nil {
+			links[key] = map[string]PrerequisiteLink{}
+		}
+		links[key][code] = PrerequisiteLink{Weight: prereq.Weight, Manual: prereq.IsManual}
+	}
+	
 	// Add definitions
 	for _, def := range definitions {
 		// Extract references
@@ -233,7 +331,7 @@ func (d *GraphDAO) ExportDomain(domainID uint) (*GraphData, error) {
 		}
 		
 		// Get prerequisite codes
-		prerequisiteCodes, err := d.getPrerequisiteCodes(def.ID, "definition")
+		prerequisiteCodes, err := d.getPrerequisiteCodes(domainID, def.ID, "definition")
 		if err != nil {
 			return nil, err
 		}
@@ -245,16 +343,19 @@ func (d *GraphDAO) ExportDomain(domainID uint) (*GraphData, error) {
 			Description:   def.Description,
 			Notes:         def.Notes,
 			References:    references,
+			Tags:          def.Tags,
 			Prerequisites: prerequisiteCodes,
 			XPosition:     def.XPosition,
 			YPosition:     def.YPosition,
+
+			PrerequisiteLinks: links[nodeKey(def.ID, "definition")],
 		}
 	}
 	
 	// Add exercises
 	for _, ex := range exercises {
 		// Get prerequisite codes
-		prerequisiteCodes, err := d.getPrerequisiteCodes(ex.ID, "exercise")
+		prerequisiteCodes, err := d.getPrerequisiteCodes(domainID, ex.ID, "exercise")
 		if err != nil {
 			return nil, err
 		}
@@ -269,9 +370,12 @@ func (d *GraphDAO) ExportDomain(domainID uint) (*GraphData, error) {
 			Verifiable:    ex.Verifiable,
 			Result:        ex.Result,
 			Difficulty:    ex.Difficulty,
+			Tags:          ex.Tags,
 			Prerequisites: prerequisiteCodes,
 			XPosition:     ex.XPosition,
 			YPosition:     ex.YPosition,
+
+			PrerequisiteLinks: links[nodeKey(ex.ID, "exercise")],
 		}
 	}
 	
@@ -283,26 +387,43 @@ func idToString(id uint) string {
 	return strconv.FormatUint(uint64(id), 10)
 }
 
-// Helper function to get prerequisite codes for a node
-func (d *GraphDAO) getPrerequisiteCodes(nodeID uint, nodeType string) ([]string, error) {
+// Helper function to get prerequisite codes for a node. Prerequisites from
+// other domains are given by their external reference (see externalRef).
+func (d *GraphDAO) getPrerequisiteCodes(domainID uint, nodeID uint, nodeType string) ([]string, error) {
 	query := `
-		SELECT d.code 
+		SELECT d.code, d.domain_id
 		FROM node_prerequisites np
 		JOIN definitions d ON np.prerequisite_id = d.id 
 		WHERE np.node_id = ? AND np.node_type = ? AND np.prerequisite_type = 'definition'
 		ORDER BY d.code
 	`
 	
-	var codes []string
-	if err := d.db.Raw(query, nodeID, nodeType).Scan(&codes).Error; err != nil {
+	var rows []struct {
+		Code     string
+		DomainID uint
+	}
+	if err := d.db.Raw(query, nodeID, nodeType).Scan(&rows).Error; err != nil {
 		return nil, err
 	}
 	
+	codes := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.DomainID != domainID {
+			codes = append(codes, externalRef(row.DomainID, row.Code))
+			continue
+		}
+		codes = append(codes, row.Code)
+	}
 	return codes, nil
 }
 
-// ImportDomain imports a domain from the graph format using clean DAOs
-func (d *GraphDAO) ImportDomain(domainID uint, data *GraphData) error {
+// ImportDomain imports a domain from the graph format using clean DAOs,
+// replacing its nodes. userID is the user running the import, who must be
+// able to read the external prerequisites. Prerequisites that nodes of other
+// domains have on the domain's nodes are moved to the re-created nodes with
+// the same code; if the import leaves out such a node, it fails with
+// ErrDependentNodes naming the dependents.
+func (d *GraphDAO) ImportDomain(domainID uint, userID uint, data *GraphData) error {
 	return d.db.Transaction(func(tx *gorm.DB) error {
 		// Verify domain exists
 		var domain models.Domain
@@ -310,13 +431,44 @@ func (d *GraphDAO) ImportDomain(domainID uint, data *GraphData) error {
 			return err
 		}
 		
+		// Reject circular prerequisites and invalid weights before touching
+		// the domain
+		if err := checkImportCycles(data); err != nil {
+			return err
+		}
+		if err := checkImportWeights(data); err != nil {
+			return err
+		}
+		
+		// Resolve prerequisites from other domains
+		codeToExternal, err := resolveImportExternal(tx, data)
+		if err != nil {
+			return err
+		}
+		if err := checkImportExternalReadable(tx, userID, data, codeToExternal); err != nil {
+			return err
+		}
+		
+		// Nodes of other domains requiring nodes of this one keep their
+		// prerequisites, on the re-created nodes
+		inbound, err := getInboundPrerequisites(tx, domainID)
+		if err != nil {
+			return err
+		}
+		if missing := missingDependents(inbound, data); len(missing) > 0 {
+			return dependentsError(missing)
+		}
+		
 		// Clear existing data for this domain
-		// Delete prerequisites first
+		// Delete prerequisites first, including those of other domains'
+		// nodes on this domain's nodes, which are re-created below
 		if err := tx.Exec(`
 			DELETE FROM node_prerequisites 
 			WHERE (node_type = 'definition' AND node_id IN (SELECT id FROM definitions WHERE domain_id = ?))
 			   OR (node_type = 'exercise' AND node_id IN (SELECT id FROM exercises WHERE domain_id = ?))
-		`, domainID, domainID).Error; err != nil {
+			   OR (prerequisite_type = 'definition' AND prerequisite_id IN (SELECT id FROM definitions WHERE domain_id = ?))
+			   OR (prerequisite_type = 'exercise' AND prerequisite_id IN (SELECT id FROM exercises WHERE domain_id = ?))
+		`, domainID, domainID, domainID, domainID).Error; err != nil {
 			return err
 		}
 		
@@ -342,6 +494,7 @@ func (d *GraphDAO) ImportDomain(domainID uint, data *GraphData) error {
 				Name:        defNode.Name,
 				Description: defNode.Description,
 				Notes:       defNode.Notes,
+				Tags:        defNode.Tags,
 				DomainID:    domainID,
 				OwnerID:     domain.OwnerID,
 				XPosition:   defNode.XPosition,
@@ -360,28 +513,27 @@ func (d *GraphDAO) ImportDomain(domainID uint, data *GraphData) error {
 		for _, def := range definitions {
 			codeToDefinition[def.Code] = def
 		}
+		resolve := func(code string) (uint, bool) {
+			if prereqDef, exists := codeToDefinition[code]; exists {
+				return prereqDef.ID, true
+			}
+			if prereqDef, exists := codeToExternal[code]; exists {
+				return prereqDef.ID, true
+			}
+			return 0, false
+		}
 		
-		// Add definition prerequisites
+		// Add definition prerequisites; cycles are checked once the whole
+		// graph is written
 		for nodeID, defNode := range data.Definitions {
-			if len(defNode.Prerequisites) > 0 {
-				def := definitions[nodeID]
-				var prerequisiteIDs []uint
-				
-				for _, prereqCode := range defNode.Prerequisites {
-					if prereqDef, exists := codeToDefinition[prereqCode]; exists {
-						prerequisiteIDs = append(prerequisiteIDs, prereqDef.ID)
-					}
-				}
-				
-				if len(prerequisiteIDs) > 0 {
-					if err := definitionDAO.Update(def, defNode.References, prerequisiteIDs); err != nil {
-						return err
-					}
-				}
+			def := definitions[nodeID]
+			if err := addImportPrerequisites(tx, def.ID, "definition", defNode.Prerequisites, defNode.PrerequisiteLinks, resolve); err != nil {
+				return err
 			}
 		}
 		
 		// Create exercises
+		codeToExercise := make(map[string]*models.Exercise)
 		for _, exNode := range data.Exercises {
 			ex := &models.Exercise{
 				Code:        exNode.Code,
@@ -389,6 +541,7 @@ func (d *GraphDAO) ImportDomain(domainID uint, data *GraphData) error {
 				Statement:   exNode.Statement,
 				Description: exNode.Description,
 				Hints:       exNode.Hints,
+				Tags:        exNode.Tags,
 				DomainID:    domainID,
 				OwnerID:     domain.OwnerID,
 				Verifiable:  exNode.Verifiable,
@@ -398,15 +551,40 @@ func (d *GraphDAO) ImportDomain(domainID uint, data *GraphData) error {
 				YPosition:   exNode.YPosition,
 			}
 			
-			// Add prerequisites using code matching
-			var prerequisiteIDs []uint
-			for _, prereqCode := range exNode.Prerequisites {
-				if prereqDef, exists := codeToDefinition[prereqCode]; exists {
-					prerequisiteIDs = append(prerequisiteIDs, prereqDef.ID)
-				}
+			if err := exerciseDAO.Create(ex, nil); err != nil {
+				return err
 			}
+			codeToExercise[ex.Code] = ex
 			
-			if err := exerciseDAO.Create(ex, prerequisiteIDs); err != nil {
+			// Add prerequisites using code matching
+			if err := addImportPrerequisites(tx, ex.ID, "exercise", exNode.Prerequisites, exNode.PrerequisiteLinks, resolve); err != nil {
+				return err
+			}
+		}
+		
+		// Point the other domains' prerequisites at the re-created nodes
+		for _, p := range inbound {
+			edge := p.edge
+			edge.ID = 0
+			if edge.PrerequisiteType == "definition" {
+				edge.PrerequisiteID = codeToDefinition[p.code].ID
+			} else {
+				edge.PrerequisiteID = codeToExercise[p.code].ID
+			}
+			if err := tx.Create(&edge).Error; err != nil {
+				return err
+			}
+		}
+		
+		// The imported graph has no cycle of its own, but one may run
+		// through prerequisites in other domains
+		if err := checkNoDomainCycle(tx, domainID); err != nil {
+			return err
+		}
+		
+		// Lay out the nodes imported without coordinates
+		if importMissesPositions(data) {
+			if _, err := NewGraphDAO(tx).LayoutDomain(domainID, true, graph.LayoutOptions{}); err != nil {
 				return err
 			}
 		}
@@ -415,6 +593,215 @@ func (d *GraphDAO) ImportDomain(domainID uint, data *GraphData) error {
 	})
 }
 
+// resolveImportExternal finds the definitions of other domains that the
+// imported external stubs refer to, by their reference. Stubs no node
+// requires are ignored; a required stub that matches no definition fails
+// the import with ErrUnresolvedExternal. Whether the author may read them is
+// checked when the prerequisites are created.
+func resolveImportExternal(tx *gorm.DB, data *GraphData) (map[string]*models.Definition, error) {
+	resolved := make(map[string]*models.Definition, len(data.External))
+	for ref, node := range data.External {
+		if !externalUsed(data, ref) {
+			continue
+		}
+		def, err := resolveExternal(tx, node)
+		if err != nil {
+			return nil, err
+		}
+		resolved[ref] = def
+	}
+	return resolved, nil
+}
+
+// importMissesPositions reports whether some imported node has no position
+func importMissesPositions(data *GraphData) bool {
+	for _, defNode := range data.Definitions {
+		if defNode.XPosition == 0 && defNode.YPosition == 0 {
+			return true
+		}
+	}
+	for _, exNode := range data.Exercises {
+		if exNode.XPosition == 0 && exNode.YPosition == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImportWeights rejects imports giving a prerequisite a weight outside
+// (0, 1]
+func checkImportWeights(data *GraphData) error {
+	for _, defNode := range sortedDefinitionNodes(data) {
+		for _, code := range sortedKeys(defNode.PrerequisiteLinks) {
+			if weight := defNode.PrerequisiteLinks[code].Weight; weight <= 0 || weight > 1 {
+				return fmt.Errorf("%w: %s of definition %s has weight %g", ErrInvalidWeight, code, defNode.Code, weight)
+			}
+		}
+	}
+	for _, exNode := range sortedExerciseNodes(data) {
+		for _, code := range sortedKeys(exNode.PrerequisiteLinks) {
+			if weight := exNode.PrerequisiteLinks[code].Weight; weight <= 0 || weight > 1 {
+				return fmt.Errorf("%w: %s of exercise %s has weight %g", ErrInvalidWeight, code, exNode.Code, weight)
+			}
+		}
+	}
+	return nil
+}
+
+// addImportPrerequisites creates the definition prerequisites of an
+// imported node, with the weight and manual flag of their links (weight 1
+// without a link). Codes resolve to imported definitions or to external
+// ones already checked with checkImportExternalReadable; unknown codes are
+// skipped.
+func addImportPrerequisites(tx *gorm.DB, nodeID uint, nodeType string, codes []string, links map[string]PrerequisiteLink, resolve func(code string) (uint, bool)) error {
+	added := map[uint]bool{}
+	for _, code := range codes {
+		prerequisiteID, exists := resolve(code)
+		if !exists || added[prerequisiteID] {
+			continue
+		}
+		added[prerequisiteID] = true
+		
+		prerequisite := models.NodePrerequisite{
+			NodeID:           nodeID,
+			NodeType:         nodeType,
+			PrerequisiteID:   prerequisiteID,
+			PrerequisiteType: "definition",
+			Weight:           1.0,
+		}
+		if link, exists := links[code]; exists {
+			prerequisite.Weight, prerequisite.IsManual = link.Weight, link.Manual
+		}
+		if err := tx.Create(&prerequisite).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkImportExternalReadable checks that the user running an import may
+// read every external prerequisite the import uses
+func checkImportExternalReadable(tx *gorm.DB, userID uint, data *GraphData, codeToExternal map[string]*models.Definition) error {
+	for _, ref := range sortedKeys(codeToExternal) {
+		if !externalUsed(data, ref) {
+			continue
+		}
+		if err := checkPrerequisiteReadableBy(tx, userID, codeToExternal[ref].ID, "definition"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// externalUsed reports whether an imported node lists an external stub
+// among its prerequisites
+func externalUsed(data *GraphData, ref string) bool {
+	for _, defNode := range data.Definitions {
+		for _, prereqCode := range defNode.Prerequisites {
+			if prereqCode == ref {
+				return true
+			}
+		}
+	}
+	for _, exNode := range data.Exercises {
+		for _, prereqCode := range exNode.Prerequisites {
+			if prereqCode == ref {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkImportCycles returns a *graph.CycleError, named by definition codes,
+// if the prerequisites of the imported definitions are circular. Exercises
+// only require definitions, so they cannot be part of a cycle.
+func checkImportCycles(data *GraphData) error {
+	edges := graph.Edges{}
+	for _, defNode := range data.Definitions {
+		for _, prereqCode := range defNode.Prerequisites {
+			edges.Add(defNode.Code, prereqCode)
+		}
+	}
+	if cycles := graph.FindCycles(edges); len(cycles) > 0 {
+		return &graph.CycleError{Cycle: cycles[0]}
+	}
+	return nil
+}
+
+// LayoutDomain computes a layered layout of the domain's graph (see
+// graph.Layout) and saves it through UpdateGraphPositions. With keepPlaced,
+// nodes that already have a position (not 0,0), e.g. placed by hand, keep
+// it, even if their layer changed, and only the others are laid out.
+// Positions are keyed like the visual graph (def_ID, ex_ID); only the nodes
+// that moved are saved and returned.
+func (d *GraphDAO) LayoutDomain(domainID uint, keepPlaced bool, opts graph.LayoutOptions) (map[string]graph.Point, error) {
+	var definitions []models.Definition
+	if err := d.db.Select("id", "x_position", "y_position").Where("domain_id = ?", domainID).Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+	var exercises []models.Exercise
+	if err := d.db.Select("id", "x_position", "y_position").Where("domain_id = ?", domainID).Find(&exercises).Error; err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]graph.Point, len(definitions)+len(exercises))
+	for _, def := range definitions {
+		current[fmt.Sprintf("def_%d", def.ID)] = graph.Point{X: def.XPosition, Y: def.YPosition}
+	}
+	for _, ex := range exercises {
+		current[fmt.Sprintf("ex_%d", ex.ID)] = graph.Point{X: ex.XPosition, Y: ex.YPosition}
+	}
+
+	var prerequisites []models.NodePrerequisite
+	query := `
+		SELECT np.* FROM node_prerequisites np
+		WHERE (np.node_type = 'definition' AND np.node_id IN (SELECT id FROM definitions WHERE domain_id = ?))
+		   OR (np.node_type = 'exercise' AND np.node_id IN (SELECT id FROM exercises WHERE domain_id = ?))
+	`
+	if err := d.db.Raw(query, domainID, domainID).Scan(&prerequisites).Error; err != nil {
+		return nil, err
+	}
+
+	visualKey := func(nodeID uint, nodeType string) string {
+		if nodeType == "definition" {
+			return fmt.Sprintf("def_%d", nodeID)
+		}
+		return fmt.Sprintf("ex_%d", nodeID)
+	}
+	edges := graph.Edges{}
+	for _, prereq := range prerequisites {
+		edges.Add(visualKey(prereq.NodeID, prereq.NodeType), visualKey(prereq.PrerequisiteID, prereq.PrerequisiteType))
+	}
+
+	nodes := make([]string, 0, len(current))
+	opts.Fixed = map[string]graph.Point{}
+	for key, p := range current {
+		nodes = append(nodes, key)
+		if keepPlaced && (p.X != 0 || p.Y != 0) {
+			opts.Fixed[key] = p
+		}
+	}
+
+	positions, err := graph.Layout(nodes, edges, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	moved := make(map[string]graph.Point)
+	updates := make(map[string]struct{ X, Y float64 })
+	for key, p := range positions {
+		if p != current[key] {
+			moved[key] = p
+			updates[key] = struct{ X, Y float64 }{p.X, p.Y}
+		}
+	}
+	if err := d.UpdateGraphPositions(updates); err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
 // UpdateGraphPositions updates the positions of nodes in the graph
 func (d *GraphDAO) UpdateGraphPositions(positionUpdates map[string]struct{ X, Y float64 }) error {
 	return d.db.Transaction(func(tx *gorm.DB) error {
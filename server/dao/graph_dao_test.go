@@ -1,7 +1,10 @@
 package dao
 
 import (
+	"errors"
+	"myapp/server/graph"
 	"myapp/server/models"
+	"strings"
 	"testing"
 
 	"gorm.io/driver/sqlite"
@@ -265,7 +268,7 @@ func TestImportDomain(t *testing.T) {
 	}
 
 	// Import the graph
-	if err := graphDAO.ImportDomain(domain.ID, graph); err != nil {
+	if err := graphDAO.ImportDomain(domain.ID, domain.OwnerID, graph); err != nil {
 		t.Fatalf("Failed to import domain from graph: %v", err)
 	}
 
@@ -429,3 +432,264 @@ func TestUpdateGraphPositions(t *testing.T) {
 		}
 	}
 }
+
+func TestImportDomainPrerequisites(t *testing.T) {
+	db := setupSRSTestDB(t)
+	graphDAO := NewGraphDAO(db)
+	defs := createCycleTestDefinitions(t, db, "OLD")
+	domainID := defs[0].DomainID
+
+	data := &GraphData{
+		Definitions: map[string]DefinitionNode{
+			"A": {Code: "A", Name: "A", Description: "a", XPosition: 10, YPosition: 10},
+			"B": {Code: "B", Name: "B", Description: "b", Prerequisites: []string{"A"}, XPosition: 20, YPosition: 10},
+			"C": {Code: "C", Name: "C", Description: "c", Prerequisites: []string{"A", "B"}, XPosition: 30, YPosition: 10,
+				PrerequisiteLinks: map[string]PrerequisiteLink{"A": {Weight: 0.5, Manual: true}}},
+		},
+		Exercises: map[string]ExerciseNode{
+			"X": {Code: "X", Name: "X", Statement: "x", Prerequisites: []string{"C"}, XPosition: 40, YPosition: 10},
+		},
+	}
+	if err := graphDAO.ImportDomain(domainID, defs[0].OwnerID, data); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	var prerequisites []models.NodePrerequisite
+	if err := db.Find(&prerequisites).Error; err != nil {
+		t.Fatalf("Failed to read prerequisites: %v", err)
+	}
+	if len(prerequisites) != 4 {
+		t.Errorf("imported %d prerequisites, want 4", len(prerequisites))
+	}
+	weighted := 0
+	for _, p := range prerequisites {
+		if p.Weight == 0.5 && p.IsManual {
+			weighted++
+		}
+	}
+	if weighted != 1 {
+		t.Errorf("%d prerequisites carry the imported link, want 1", weighted)
+	}
+
+	// A cyclic import is rejected and leaves the domain as it was
+	data.Definitions["A"] = DefinitionNode{Code: "A", Name: "A", Description: "a", Prerequisites: []string{"C"}}
+	var cycleErr *graph.CycleError
+	if err := graphDAO.ImportDomain(domainID, defs[0].OwnerID, data); !errors.As(err, &cycleErr) {
+		t.Fatalf("cyclic import error = %v, want a cycle error", err)
+	}
+	var count int64
+	db.Model(&models.NodePrerequisite{}).Count(&count)
+	if count != 4 {
+		t.Errorf("%d prerequisites after the rejected import, want 4", count)
+	}
+}
+
+func TestImportDomainKeepsInboundPrerequisites(t *testing.T) {
+	db := setupSRSTestDB(t)
+	graphDAO := NewGraphDAO(db)
+	defs := createCycleTestDefinitions(t, db, "A")
+	domainID, ownerID := defs[0].DomainID, defs[0].OwnerID
+
+	// A definition and an exercise of another domain require A
+	other := &models.Domain{Name: "Other", Privacy: "public", OwnerID: ownerID}
+	if err := db.Create(other).Error; err != nil {
+		t.Fatalf("Failed to create domain: %v", err)
+	}
+	z := &models.Definition{Code: "Z", Name: "Z", Description: "z", DomainID: other.ID, OwnerID: ownerID}
+	if err := db.Create(z).Error; err != nil {
+		t.Fatalf("Failed to create definition: %v", err)
+	}
+	y := &models.Exercise{Code: "Y", Name: "Y", Statement: "y", DomainID: other.ID, OwnerID: ownerID}
+	if err := db.Create(y).Error; err != nil {
+		t.Fatalf("Failed to create exercise: %v", err)
+	}
+	for _, p := range []models.NodePrerequisite{
+		{NodeID: z.ID, NodeType: "definition", PrerequisiteID: defs[0].ID, PrerequisiteType: "definition", Weight: 0.5, IsManual: true},
+		{NodeID: y.ID, NodeType: "exercise", PrerequisiteID: defs[0].ID, PrerequisiteType: "definition", Weight: 1},
+	} {
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("Failed to create prerequisite: %v", err)
+		}
+	}
+
+	data := &GraphData{
+		Definitions: map[string]DefinitionNode{
+			"A": {Code: "A", Name: "A", Description: "a", XPosition: 10, YPosition: 10},
+			"B": {Code: "B", Name: "B", Description: "b", Prerequisites: []string{"A"}, XPosition: 20, YPosition: 10},
+		},
+	}
+	if err := graphDAO.ImportDomain(domainID, ownerID, data); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	var a models.Definition
+	if err := db.Where("domain_id = ? AND code = ?", domainID, "A").First(&a).Error; err != nil {
+		t.Fatalf("Failed to find the imported A: %v", err)
+	}
+	var inbound []models.NodePrerequisite
+	if err := db.Where("prerequisite_id = ? AND node_id IN ?", a.ID, []uint{z.ID, y.ID}).Order("node_type").Find(&inbound).Error; err != nil {
+		t.Fatalf("Failed to read prerequisites: %v", err)
+	}
+	if len(inbound) != 2 {
+		t.Fatalf("%d prerequisites of the other domain on the imported A, want 2", len(inbound))
+	}
+	if p := inbound[0]; p.NodeType != "definition" || p.Weight != 0.5 || !p.IsManual {
+		t.Errorf("Z's prerequisite = %+v, want its weight and manual flag kept", p)
+	}
+
+	// An import leaving A out is refused and names the dependents
+	delete(data.Definitions, "A")
+	data.Definitions["B"] = DefinitionNode{Code: "B", Name: "B", Description: "b", XPosition: 20, YPosition: 10}
+	err := graphDAO.ImportDomain(domainID, ownerID, data)
+	if !errors.Is(err, ErrDependentNodes) {
+		t.Fatalf("import error = %v, want ErrDependentNodes", err)
+	}
+	for _, dependent := range []string{"definition Z of domain Other", "exercise Y of domain Other"} {
+		if !strings.Contains(err.Error(), dependent) {
+			t.Errorf("import error %q does not name %s", err, dependent)
+		}
+	}
+	var count int64
+	db.Model(&models.NodePrerequisite{}).Where("prerequisite_id = ?", a.ID).Count(&count)
+	if count != 3 {
+		t.Errorf("%d prerequisites on A after the refused import, want 3", count)
+	}
+
+	report, err := graphDAO.ValidateImport(domainID, ownerID, data, ImportModeReplace, false)
+	if err != nil {
+		t.Fatalf("Failed to validate: %v", err)
+	}
+	if report.Valid || len(report.Errors) != 2 || report.Errors[0].Kind != IssueDependentNode || report.Errors[0].Code != "A" {
+		t.Errorf("report errors = %+v, want two dependent node errors on A", report.Errors)
+	}
+
+	// A cycle through the other domain is rejected
+	data.Definitions["A"] = DefinitionNode{Code: "A", Name: "A", Description: "a", Prerequisites: []string{externalRef(other.ID, "Z")}}
+	data.External = map[string]ExternalNode{externalRef(other.ID, "Z"): {DomainID: other.ID, DomainName: "Other", Code: "Z", Name: "Z"}}
+	var cycleErr *graph.CycleError
+	if err := graphDAO.ImportDomain(domainID, ownerID, data); !errors.As(err, &cycleErr) {
+		t.Errorf("cyclic import error = %v, want a cycle error", err)
+	}
+}
+
+func TestImportDomainChecksRequesterAccess(t *testing.T) {
+	db := setupSRSTestDB(t)
+	graphDAO := NewGraphDAO(db)
+	defs := createCycleTestDefinitions(t, db, "A")
+	domainID, ownerID := defs[0].DomainID, defs[0].OwnerID
+
+	// The domain owner's private domain, which an admin may read and
+	// another user may not
+	private := &models.Domain{Name: "Private", Privacy: "private", OwnerID: ownerID}
+	if err := db.Create(private).Error; err != nil {
+		t.Fatalf("Failed to create domain: %v", err)
+	}
+	if err := db.Create(&models.Definition{Code: "P", Name: "P", Description: "p", DomainID: private.ID, OwnerID: ownerID}).Error; err != nil {
+		t.Fatalf("Failed to create definition: %v", err)
+	}
+	admin := &models.User{Username: "admin", Email: "admin@example.com", Password: "password123", IsAdmin: true}
+	stranger := &models.User{Username: "stranger", Email: "stranger@example.com", Password: "password123"}
+	for _, user := range []*models.User{admin, stranger} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	ref := externalRef(private.ID, "P")
+	data := &GraphData{
+		Definitions: map[string]DefinitionNode{
+			"A": {Code: "A", Name: "A", Description: "a", Prerequisites: []string{ref}, XPosition: 10, YPosition: 10},
+		},
+		External: map[string]ExternalNode{ref: {DomainID: private.ID, DomainName: "Private", Code: "P", Name: "P"}},
+	}
+
+	if err := graphDAO.ImportDomain(domainID, stranger.ID, data); !errors.Is(err, ErrPrerequisiteNotReadable) {
+		t.Errorf("import by another user error = %v, want ErrPrerequisiteNotReadable", err)
+	}
+	if _, err := graphDAO.MergeDomain(domainID, stranger.ID, data, false); !errors.Is(err, ErrPrerequisiteNotReadable) {
+		t.Errorf("merge by another user error = %v, want ErrPrerequisiteNotReadable", err)
+	}
+	report, err := graphDAO.ValidateImport(domainID, stranger.ID, data, ImportModeReplace, false)
+	if err != nil {
+		t.Fatalf("Failed to validate: %v", err)
+	}
+	if report.Valid || len(report.Errors) != 1 || report.Errors[0].Kind != IssueUnreadablePrerequisite {
+		t.Errorf("report errors = %+v, want an unreadable prerequisite", report.Errors)
+	}
+
+	for _, userID := range []uint{ownerID, admin.ID} {
+		if err := graphDAO.ImportDomain(domainID, userID, data); err != nil {
+			t.Errorf("import by user %d: %v", userID, err)
+		}
+	}
+}
+
+func TestImportDomainResolvesExternalByUniqueName(t *testing.T) {
+	db := setupSRSTestDB(t)
+	graphDAO := NewGraphDAO(db)
+	defs := createCycleTestDefinitions(t, db, "A")
+	domainID, ownerID := defs[0].DomainID, defs[0].OwnerID
+
+	// Two domains named Shared and one named Unique, each with definition P
+	var unique *models.Domain
+	for _, name := range []string{"Shared", "Shared", "Unique"} {
+		domain := &models.Domain{Name: name, Privacy: "public", OwnerID: ownerID}
+		if err := db.Create(domain).Error; err != nil {
+			t.Fatalf("Failed to create domain: %v", err)
+		}
+		if err := db.Create(&models.Definition{Code: "P", Name: "P", Description: "p", DomainID: domain.ID, OwnerID: ownerID}).Error; err != nil {
+			t.Fatalf("Failed to create definition: %v", err)
+		}
+		unique = domain
+	}
+
+	// The stubs come from another database: their domain IDs match nothing
+	importWith := func(node ExternalNode) *GraphData {
+		ref := externalRef(node.DomainID, node.Code)
+		return &GraphData{
+			Definitions: map[string]DefinitionNode{
+				"A": {Code: "A", Name: "A", Description: "a", Prerequisites: []string{ref}, XPosition: 10, YPosition: 10},
+			},
+			External: map[string]ExternalNode{ref: node},
+		}
+	}
+
+	if err := graphDAO.ImportDomain(domainID, ownerID, importWith(ExternalNode{DomainID: 999, DomainName: "Unique", Code: "P"})); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	var a models.Definition
+	if err := db.Where("domain_id = ? AND code = ?", domainID, "A").First(&a).Error; err != nil {
+		t.Fatalf("Failed to read A: %v", err)
+	}
+	var prereq models.Definition
+	if err := db.Joins("JOIN node_prerequisites ON node_prerequisites.prerequisite_id = definitions.id").
+		Where("node_prerequisites.node_id = ? AND node_prerequisites.node_type = ?", a.ID, "definition").First(&prereq).Error; err != nil {
+		t.Fatalf("A has no prerequisite: %v", err)
+	}
+	if prereq.DomainID != unique.ID {
+		t.Errorf("A requires P of domain %d, want %d", prereq.DomainID, unique.ID)
+	}
+
+	for _, node := range []ExternalNode{
+		{DomainID: 999, DomainName: "Shared", Code: "P"},
+		{DomainID: 999, DomainName: "", Code: "P"},
+		{DomainID: 999, DomainName: "Unique", Code: "MISSING"},
+	} {
+		data := importWith(node)
+		ref := externalRef(node.DomainID, node.Code)
+		err := graphDAO.ImportDomain(domainID, ownerID, data)
+		if !errors.Is(err, ErrUnresolvedExternal) || !strings.Contains(err.Error(), ref) {
+			t.Errorf("import of stub %+v error = %v, want ErrUnresolvedExternal naming %s", node, err, ref)
+		}
+		if _, err := graphDAO.MergeDomain(domainID, ownerID, data, false); !errors.Is(err, ErrUnresolvedExternal) {
+			t.Errorf("merge of stub %+v error = %v, want ErrUnresolvedExternal", node, err)
+		}
+		report, err := graphDAO.ValidateImport(domainID, ownerID, data, ImportModeReplace, false)
+		if err != nil {
+			t.Fatalf("Failed to validate: %v", err)
+		}
+		if report.Valid || len(report.Errors) != 1 || report.Errors[0].Kind != IssueUnresolvedExternal || report.Errors[0].Prerequisite != ref {
+			t.Errorf("report errors for stub %+v = %+v, want an unresolved external %s", node, report.Errors, ref)
+		}
+	}
+}
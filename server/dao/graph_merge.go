@@ -0,0 +1,529 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+	"myapp/server/graph"
+	"myapp/server/models"
+)
+
+// ErrDuplicateCode is returned when an import has two definitions or two
+// exercises with the same code, so nodes cannot be matched by code
+var ErrDuplicateCode = errors.New("duplicate code in import")
+
+// MergeChanges lists the codes of the nodes of one type a merge import
+// created, updated or deleted
+type MergeChanges struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Deleted   []string `json:"deleted"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// MergeResult summarizes a merge import
+type MergeResult struct {
+	Definitions MergeChanges `json:"definitions"`
+	Exercises   MergeChanges `json:"exercises"`
+}
+
+func newMergeChanges() MergeChanges {
+	return MergeChanges{Created: []string{}, Updated: []string{}, Deleted: []string{}}
+}
+
+// MergeDomain imports a domain without replacing it: nodes are matched by
+// code, so matched nodes keep their ID and the learners' progress on them.
+// Matched nodes are updated where the import differs, new codes are
+// created, and nodes missing from the import are deleted only with
+// deleteMissing. A missing position (0,0) keeps the current one. userID is
+// the user running the import, who must be able to read the external
+// prerequisites.
+//
+// Prerequisites of matched nodes are made to match the import: missing
+// edges are added with weight 1, existing ones keep their weight, and edges
+// to definitions the import no longer lists are removed unless they were
+// added manually. Prerequisite links, when given, set the weight and manual
+// flag of new and existing edges. Edges to exercises cannot be expressed in
+// the import and are kept.
+func (d *GraphDAO) MergeDomain(domainID uint, userID uint, data *GraphData, deleteMissing bool) (*MergeResult, error) {
+	result := &MergeResult{Definitions: newMergeChanges(), Exercises: newMergeChanges()}
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		var domain models.Domain
+		if err := tx.First(&domain, domainID).Error; err != nil {
+			return err
+		}
+		if err := checkImportCodes(data); err != nil {
+			return err
+		}
+		if err := checkImportCycles(data); err != nil {
+			return err
+		}
+		if err := checkImportWeights(data); err != nil {
+			return err
+		}
+		codeToExternal, err := resolveImportExternal(tx, data)
+		if err != nil {
+			return err
+		}
+		if err := checkImportExternalReadable(tx, userID, data, codeToExternal); err != nil {
+			return err
+		}
+
+		m := &domainMerge{
+			tx:          tx,
+			domain:      &domain,
+			result:      result,
+			definitions: map[string]*models.Definition{},
+			exercises:   map[string]*models.Exercise{},
+			changed:     map[string]bool{},
+		}
+		if err := m.loadExisting(); err != nil {
+			return err
+		}
+		if err := m.mergeDefinitions(data); err != nil {
+			return err
+		}
+		if err := m.mergeExercises(data); err != nil {
+			return err
+		}
+		if err := m.mergePrerequisites(data, codeToExternal); err != nil {
+			return err
+		}
+		if deleteMissing {
+			if err := m.deleteMissing(data); err != nil {
+				return err
+			}
+		}
+		if err := m.checkCycles(); err != nil {
+			return err
+		}
+
+		// Lay out the new nodes imported without coordinates
+		if m.unplaced {
+			if _, err := NewGraphDAO(tx).LayoutDomain(domainID, true, graph.LayoutOptions{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkImportCodes rejects imports where two definitions or two exercises
+// share a code
+func checkImportCodes(data *GraphData) error {
+	seen := map[string]bool{}
+	for _, defNode := range data.Definitions {
+		if seen[defNode.Code] {
+			return fmt.Errorf("%w: definition %s", ErrDuplicateCode, defNode.Code)
+		}
+		seen[defNode.Code] = true
+	}
+	seen = map[string]bool{}
+	for _, exNode := range data.Exercises {
+		if seen[exNode.Code] {
+			return fmt.Errorf("%w: exercise %s", ErrDuplicateCode, exNode.Code)
+		}
+		seen[exNode.Code] = true
+	}
+	return nil
+}
+
+// domainMerge holds the state of a merge import
+type domainMerge struct {
+	tx     *gorm.DB
+	domain *models.Domain
+	result *MergeResult
+
+	// Nodes of the domain by code; with duplicate codes the oldest node is
+	// matched and the others are treated as missing
+	definitions map[string]*models.Definition
+	exercises   map[string]*models.Exercise
+	duplicates  []models.Definition
+	duplicateEx []models.Exercise
+
+	changed  map[string]bool // node keys whose prerequisites changed
+	unplaced bool            // a node was created without a position
+}
+
+// loadExisting reads the current nodes of the domain
+func (m *domainMerge) loadExisting() error {
+	var definitions []models.Definition
+	if err := m.tx.Preload("References", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Where("domain_id = ?", m.domain.ID).Order("id").Find(&definitions).Error; err != nil {
+		return err
+	}
+	for i := range definitions {
+		if _, exists := m.definitions[definitions[i].Code]; exists {
+			m.duplicates = append(m.duplicates, definitions[i])
+			continue
+		}
+		m.definitions[definitions[i].Code] = &definitions[i]
+	}
+
+	var exercises []models.Exercise
+	if err := m.tx.Where("domain_id = ?", m.domain.ID).Order("id").Find(&exercises).Error; err != nil {
+		return err
+	}
+	for i := range exercises {
+		if _, exists := m.exercises[exercises[i].Code]; exists {
+			m.duplicateEx = append(m.duplicateEx, exercises[i])
+			continue
+		}
+		m.exercises[exercises[i].Code] = &exercises[i]
+	}
+	return nil
+}
+
+// mergeDefinitions updates the matched definitions and creates the new ones
+func (m *domainMerge) mergeDefinitions(data *GraphData) error {
+	definitionDAO := NewDefinitionDAO(m.tx)
+	for _, defNode := range sortedDefinitionNodes(data) {
+		def, exists := m.definitions[defNode.Code]
+		if !exists {
+			def = &models.Definition{
+				Code:        defNode.Code,
+				Name:        defNode.Name,
+				Description: defNode.Description,
+				Notes:       defNode.Notes,
+				Tags:        defNode.Tags,
+				DomainID:    m.domain.ID,
+				OwnerID:     m.domain.OwnerID,
+				XPosition:   defNode.XPosition,
+				YPosition:   defNode.YPosition,
+			}
+			if err := definitionDAO.Create(def, defNode.References, nil); err != nil {
+				return err
+			}
+			m.definitions[def.Code] = def
+			m.result.Definitions.Created = append(m.result.Definitions.Created, def.Code)
+			m.unplaced = m.unplaced || (def.XPosition == 0 && def.YPosition == 0)
+			continue
+		}
+
+		if !definitionDiffers(def, defNode) {
+			continue
+		}
+		def.Name = defNode.Name
+		def.Description = defNode.Description
+		def.Notes = defNode.Notes
+		def.Tags = defNode.Tags
+		if defNode.XPosition != 0 || defNode.YPosition != 0 {
+			def.XPosition, def.YPosition = defNode.XPosition, defNode.YPosition
+		}
+		if err := m.tx.Omit("References").Save(def).Error; err != nil {
+			return err
+		}
+		if err := m.tx.Where("definition_id = ?", def.ID).Delete(&models.Reference{}).Error; err != nil {
+			return err
+		}
+		for _, ref := range defNode.References {
+			if err := m.tx.Create(&models.Reference{DefinitionID: def.ID, Reference: ref}).Error; err != nil {
+				return err
+			}
+		}
+		m.result.Definitions.Updated = append(m.result.Definitions.Updated, def.Code)
+	}
+	return nil
+}
+
+// mergeExercises updates the matched exercises and creates the new ones
+func (m *domainMerge) mergeExercises(data *GraphData) error {
+	exerciseDAO := NewExerciseDAO(m.tx)
+	for _, exNode := range sortedExerciseNodes(data) {
+		ex, exists := m.exercises[exNode.Code]
+		if !exists {
+			ex = &models.Exercise{
+				Code:        exNode.Code,
+				Name:        exNode.Name,
+				Statement:   exNode.Statement,
+				Description: exNode.Description,
+				Hints:       exNode.Hints,
+				Tags:        exNode.Tags,
+				DomainID:    m.domain.ID,
+				OwnerID:     m.domain.OwnerID,
+				Verifiable:  exNode.Verifiable,
+				Result:      exNode.Result,
+				Difficulty:  exNode.Difficulty,
+				XPosition:   exNode.XPosition,
+				YPosition:   exNode.YPosition,
+			}
+			if err := exerciseDAO.Create(ex, nil); err != nil {
+				return err
+			}
+			m.exercises[ex.Code] = ex
+			m.result.Exercises.Created = append(m.result.Exercises.Created, ex.Code)
+			m.unplaced = m.unplaced || (ex.XPosition == 0 && ex.YPosition == 0)
+			continue
+		}
+
+		if !exerciseDiffers(ex, exNode) {
+			continue
+		}
+		ex.Name = exNode.Name
+		ex.Statement = exNode.Statement
+		ex.Description = exNode.Description
+		ex.Hints = exNode.Hints
+		ex.Tags = exNode.Tags
+		ex.Verifiable = exNode.Verifiable
+		ex.Result = exNode.Result
+		ex.Difficulty = exNode.Difficulty
+		if exNode.XPosition != 0 || exNode.YPosition != 0 {
+			ex.XPosition, ex.YPosition = exNode.XPosition, exNode.YPosition
+		}
+		if err := m.tx.Save(ex).Error; err != nil {
+			return err
+		}
+		m.result.Exercises.Updated = append(m.result.Exercises.Updated, ex.Code)
+	}
+	return nil
+}
+
+// mergePrerequisites makes the definition prerequisites of every imported
+// node match the import
+func (m *domainMerge) mergePrerequisites(data *GraphData, codeToExternal map[string]*models.Definition) error {
+	merge := func(nodeID uint, nodeType string, codes []string, links map[string]PrerequisiteLink) (bool, error) {
+		wanted := map[uint]bool{}
+		linkOf := map[uint]PrerequisiteLink{}
+		for _, code := range codes {
+			var id uint
+			if def, exists := m.definitions[code]; exists {
+				id = def.ID
+			} else if def, exists := codeToExternal[code]; exists {
+				id = def.ID
+			} else {
+				continue
+			}
+			wanted[id] = true
+			if link, exists := links[code]; exists {
+				linkOf[id] = link
+			}
+		}
+
+		var existing []models.NodePrerequisite
+		if err := m.tx.Where("node_id = ? AND node_type = ?", nodeID, nodeType).Find(&existing).Error; err != nil {
+			return false, err
+		}
+
+		changed := false
+		for _, prereq := range existing {
+			if prereq.PrerequisiteType != "definition" {
+				continue
+			}
+			if wanted[prereq.PrerequisiteID] {
+				delete(wanted, prereq.PrerequisiteID)
+				link, exists := linkOf[prereq.PrerequisiteID]
+				if !exists || (link.Weight == prereq.Weight && link.Manual == prereq.IsManual) {
+					continue
+				}
+				if err := m.tx.Model(&models.NodePrerequisite{}).Where("id = ?", prereq.ID).
+					Updates(map[string]interface{}{"weight": link.Weight, "is_manual": link.Manual}).Error; err != nil {
+					return false, err
+				}
+				changed = true
+				continue
+			}
+			if prereq.IsManual {
+				continue
+			}
+			if err := m.tx.Delete(&models.NodePrerequisite{}, prereq.ID).Error; err != nil {
+				return false, err
+			}
+			changed = true
+		}
+
+		added := make([]uint, 0, len(wanted))
+		for id := range wanted {
+			added = append(added, id)
+		}
+		sort.Slice(added, func(i, j int) bool { return added[i] < added[j] })
+		for _, id := range added {
+			prerequisite := models.NodePrerequisite{
+				NodeID:           nodeID,
+				NodeType:         nodeType,
+				PrerequisiteID:   id,
+				PrerequisiteType: "definition",
+				Weight:           1.0,
+			}
+			if link, exists := linkOf[id]; exists {
+				prerequisite.Weight, prerequisite.IsManual = link.Weight, link.Manual
+			}
+			if err := m.tx.Create(&prerequisite).Error; err != nil {
+				return false, err
+			}
+			changed = true
+		}
+		return changed, nil
+	}
+
+	for _, defNode := range sortedDefinitionNodes(data) {
+		def := m.definitions[defNode.Code]
+		changed, err := merge(def.ID, "definition", defNode.Prerequisites, defNode.PrerequisiteLinks)
+		if err != nil {
+			return err
+		}
+		if changed {
+			m.changed[nodeKey(def.ID, "definition")] = true
+			m.result.Definitions.Updated = markUpdated(m.result.Definitions, def.Code)
+		}
+	}
+	for _, exNode := range sortedExerciseNodes(data) {
+		ex := m.exercises[exNode.Code]
+		changed, err := merge(ex.ID, "exercise", exNode.Prerequisites, exNode.PrerequisiteLinks)
+		if err != nil {
+			return err
+		}
+		if changed {
+			m.changed[nodeKey(ex.ID, "exercise")] = true
+			m.result.Exercises.Updated = markUpdated(m.result.Exercises, ex.Code)
+		}
+	}
+
+	m.result.Definitions.Unchanged = countUnchanged(len(data.Definitions), m.result.Definitions)
+	m.result.Exercises.Unchanged = countUnchanged(len(data.Exercises), m.result.Exercises)
+	return nil
+}
+
+// markUpdated adds a code to the updated list of a matched node, unless the
+// node was created or already counted
+func markUpdated(changes MergeChanges, code string) []string {
+	for _, list := range [][]string{changes.Created, changes.Updated} {
+		for _, c := range list {
+			if c == code {
+				return changes.Updated
+			}
+		}
+	}
+	return append(changes.Updated, code)
+}
+
+// deleteMissing deletes the nodes of the domain that the import does not
+// list, with their prerequisites
+func (m *domainMerge) deleteMissing(data *GraphData) error {
+	imported := map[string]bool{}
+	for _, defNode := range data.Definitions {
+		imported[defNode.Code] = true
+	}
+	missing := append([]models.Definition{}, m.duplicates...)
+	for code, def := range m.definitions {
+		if !imported[code] {
+			missing = append(missing, *def)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].ID < missing[j].ID })
+	definitionDAO := NewDefinitionDAO(m.tx)
+	for _, def := range missing {
+		if err := definitionDAO.Delete(def.ID); err != nil {
+			return err
+		}
+		m.result.Definitions.Deleted = append(m.result.Definitions.Deleted, def.Code)
+	}
+
+	imported = map[string]bool{}
+	for _, exNode := range data.Exercises {
+		imported[exNode.Code] = true
+	}
+	missingEx := append([]models.Exercise{}, m.duplicateEx...)
+	for code, ex := range m.exercises {
+		if !imported[code] {
+			missingEx = append(missingEx, *ex)
+		}
+	}
+	sort.Slice(missingEx, func(i, j int) bool { return missingEx[i].ID < missingEx[j].ID })
+	exerciseDAO := NewExerciseDAO(m.tx)
+	for _, ex := range missingEx {
+		if err := exerciseDAO.Delete(ex.ID); err != nil {
+			return err
+		}
+		m.result.Exercises.Deleted = append(m.result.Exercises.Deleted, ex.Code)
+	}
+	return nil
+}
+
+// checkCycles rejects the merge if a node whose prerequisites changed is now
+// part of a cycle, e.g. through a manual edge the import does not know about
+func (m *domainMerge) checkCycles() error {
+	if len(m.changed) == 0 {
+		return nil
+	}
+	g, err := loadDomainGraph(m.tx, m.domain.ID)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(m.changed))
+	for key := range m.changed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if cycle := graph.FindCycleThrough(g.edges, key); cycle != nil {
+			return g.cycleError(cycle)
+		}
+	}
+	return nil
+}
+
+// definitionDiffers reports whether an imported definition changes the
+// stored one, prerequisites aside
+func definitionDiffers(def *models.Definition, node DefinitionNode) bool {
+	if def.Name != node.Name || def.Description != node.Description || def.Notes != node.Notes || !equalStrings(def.Tags, node.Tags) {
+		return true
+	}
+	if (node.XPosition != 0 || node.YPosition != 0) && (def.XPosition != node.XPosition || def.YPosition != node.YPosition) {
+		return true
+	}
+	references := make([]string, len(def.References))
+	for i, ref := range def.References {
+		references[i] = ref.Reference
+	}
+	return !equalStrings(references, node.References)
+}
+
+// exerciseDiffers reports whether an imported exercise changes the stored
+// one, prerequisites aside
+func exerciseDiffers(ex *models.Exercise, node ExerciseNode) bool {
+	if ex.Name != node.Name || ex.Statement != node.Statement || ex.Description != node.Description ||
+		ex.Hints != node.Hints || ex.Verifiable != node.Verifiable || ex.Result != node.Result || ex.Difficulty != node.Difficulty ||
+		!equalStrings(ex.Tags, node.Tags) {
+		return true
+	}
+	return (node.XPosition != 0 || node.YPosition != 0) && (ex.XPosition != node.XPosition || ex.YPosition != node.YPosition)
+}
+
+// equalStrings compares two lists, nil being empty
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedDefinitionNodes returns the imported definitions ordered by code
+func sortedDefinitionNodes(data *GraphData) []DefinitionNode {
+	nodes := make([]DefinitionNode, 0, len(data.Definitions))
+	for _, node := range data.Definitions {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Code < nodes[j].Code })
+	return nodes
+}
+
+// sortedExerciseNodes returns the imported exercises ordered by code
+func sortedExerciseNodes(data *GraphData) []ExerciseNode {
+	nodes := make([]ExerciseNode, 0, len(data.Exercises))
+	for _, node := range data.Exercises {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Code < nodes[j].Code })
+	return nodes
+}
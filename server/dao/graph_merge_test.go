@@ -0,0 +1,148 @@
+package dao
+
+import (
+	"reflect"
+	"testing"
+
+	"myapp/server/models"
+)
+
+// mergeTestData is the import of a domain with definitions A and B, B
+// requiring A, and exercise X requiring B
+func mergeTestData() *GraphData {
+	return &GraphData{
+		Definitions: map[string]DefinitionNode{
+			"A": {Code: "A", Name: "A", Description: "A"},
+			"B": {Code: "B", Name: "B", Description: "B", Prerequisites: []string{"A"}},
+		},
+		Exercises: map[string]ExerciseNode{
+			"X": {Code: "X", Name: "X", Statement: "x", Prerequisites: []string{"B"}},
+		},
+	}
+}
+
+func TestMergeDomainKeepsProgress(t *testing.T) {
+	db := setupSRSTestDB(t)
+	graphDAO := NewGraphDAO(db)
+	defs := createCycleTestDefinitions(t, db, "A", "B")
+	a, b := defs[0], defs[1]
+	domainID, userID := a.DomainID, a.OwnerID
+
+	if err := NewDefinitionDAO(db).Update(b, nil, []uint{a.ID}); err != nil {
+		t.Fatalf("Failed to add prerequisite: %v", err)
+	}
+	x := &models.Exercise{Code: "X", Name: "X", Statement: "x", DomainID: domainID, OwnerID: userID}
+	if err := NewExerciseDAO(db).Create(x, []uint{b.ID}); err != nil {
+		t.Fatalf("Failed to create exercise: %v", err)
+	}
+
+	// The user has progress on A and X and has reviewed A
+	for _, progress := range []*models.UserNodeProgress{
+		{UserID: userID, NodeID: a.ID, NodeType: "definition", Status: "grasped", Repetitions: 2},
+		{UserID: userID, NodeID: x.ID, NodeType: "exercise", Status: "tackling"},
+	} {
+		if err := db.Create(progress).Error; err != nil {
+			t.Fatalf("Failed to create progress: %v", err)
+		}
+	}
+	if err := db.Create(&models.ReviewHistory{UserID: userID, NodeID: a.ID, NodeType: "definition", ReviewType: "explicit", Success: true}).Error; err != nil {
+		t.Fatalf("Failed to create review: %v", err)
+	}
+
+	// Rename A, drop B's prerequisite and add C
+	data := mergeTestData()
+	data.Definitions["A"] = DefinitionNode{Code: "A", Name: "Renamed", Description: "A"}
+	data.Definitions["B"] = DefinitionNode{Code: "B", Name: "B", Description: "B"}
+	data.Definitions["C"] = DefinitionNode{Code: "C", Name: "C", Description: "C", Prerequisites: []string{"A"}, XPosition: 10, YPosition: 10}
+	result, err := graphDAO.MergeDomain(domainID, userID, data, false)
+	if err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+	// B's prerequisites changed
+	if !reflect.DeepEqual(result.Definitions.Created, []string{"C"}) || !reflect.DeepEqual(result.Definitions.Updated, []string{"A", "B"}) || len(result.Definitions.Deleted) != 0 {
+		t.Errorf("definition changes = %+v, want C created, A and B updated", result.Definitions)
+	}
+	if result.Exercises.Unchanged != 1 {
+		t.Errorf("exercise changes = %+v, want X unchanged", result.Exercises)
+	}
+
+	var merged models.Definition
+	if err := db.First(&merged, a.ID).Error; err != nil {
+		t.Fatalf("A lost its ID: %v", err)
+	}
+	if merged.Name != "Renamed" {
+		t.Errorf("A is named %s, want Renamed", merged.Name)
+	}
+	var progress []models.UserNodeProgress
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&progress).Error; err != nil {
+		t.Fatalf("Failed to read progress: %v", err)
+	}
+	if len(progress) != 2 || progress[0].NodeID != a.ID || progress[0].Status != "grasped" || progress[0].Repetitions != 2 || progress[1].NodeID != x.ID {
+		t.Errorf("progress = %+v, want A's and X's kept", progress)
+	}
+	var reviews int64
+	db.Model(&models.ReviewHistory{}).Where("node_id = ? AND node_type = ?", a.ID, "definition").Count(&reviews)
+	if reviews != 1 {
+		t.Errorf("A has %d reviews, want 1", reviews)
+	}
+
+	var edges int64
+	db.Model(&models.NodePrerequisite{}).Where("node_id = ? AND node_type = ?", b.ID, "definition").Count(&edges)
+	if edges != 0 {
+		t.Errorf("B has %d prerequisites, want none", edges)
+	}
+	db.Model(&models.NodePrerequisite{}).Where("node_id = ? AND node_type = ? AND prerequisite_id = ?", x.ID, "exercise", b.ID).Count(&edges)
+	if edges != 1 {
+		t.Errorf("X has %d prerequisites on B, want 1", edges)
+	}
+}
+
+func TestMergeDomainDeleteMissing(t *testing.T) {
+	db := setupSRSTestDB(t)
+	graphDAO := NewGraphDAO(db)
+	defs := createCycleTestDefinitions(t, db, "A", "B")
+	domainID, userID := defs[0].DomainID, defs[0].OwnerID
+	if _, err := graphDAO.MergeDomain(domainID, userID, mergeTestData(), false); err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+	var x models.Exercise
+	if err := db.Where("domain_id = ? AND code = ?", domainID, "X").First(&x).Error; err != nil {
+		t.Fatalf("X was not created: %v", err)
+	}
+
+	// Without deleteMissing, nodes the import leaves out are kept
+	data := mergeTestData()
+	delete(data.Definitions, "B")
+	data.Exercises = map[string]ExerciseNode{}
+	result, err := graphDAO.MergeDomain(domainID, userID, data, false)
+	if err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+	if len(result.Definitions.Deleted) != 0 || len(result.Exercises.Deleted) != 0 {
+		t.Errorf("merge deleted %+v, want nothing deleted", result)
+	}
+	var count int64
+	db.Model(&models.Definition{}).Where("domain_id = ?", domainID).Count(&count)
+	if count != 2 {
+		t.Errorf("domain has %d definitions, want 2", count)
+	}
+
+	// With deleteMissing, they are deleted with their prerequisites
+	result, err = graphDAO.MergeDomain(domainID, userID, data, true)
+	if err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+	if !reflect.DeepEqual(result.Definitions.Deleted, []string{"B"}) || !reflect.DeepEqual(result.Exercises.Deleted, []string{"X"}) {
+		t.Errorf("merge deleted %+v and %+v, want B and X", result.Definitions.Deleted, result.Exercises.Deleted)
+	}
+	if err := db.First(&models.Definition{}, defs[1].ID).Error; err == nil {
+		t.Error("B still exists")
+	}
+	if err := db.First(&models.Definition{}, defs[0].ID).Error; err != nil {
+		t.Errorf("A was deleted: %v", err)
+	}
+	db.Model(&models.NodePrerequisite{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d prerequisites left, want none", count)
+	}
+}
@@ -0,0 +1,435 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"myapp/server/graph"
+	"myapp/server/models"
+)
+
+// Import modes: replace recreates the domain from the import (ImportDomain),
+// merge matches nodes by code (MergeDomain)
+const (
+	ImportModeReplace = "replace"
+	ImportModeMerge   = "merge"
+)
+
+// Kinds of import issues
+const (
+	IssueDuplicateCode          = "duplicate_code"
+	IssueUnknownPrerequisite    = "unknown_prerequisite"
+	IssueUnreadablePrerequisite = "unreadable_prerequisite"
+	IssueUnresolvedExternal     = "unresolved_external"
+	IssueDependentNode          = "dependent_node"
+	IssueCycle                  = "cycle"
+	IssueDifficultyOutOfRange   = "difficulty_out_of_range"
+	IssueWeightOutOfRange       = "weight_out_of_range"
+	IssueEmptyStatement         = "empty_statement"
+)
+
+// ImportIssue is a problem found in an import payload
+type ImportIssue struct {
+	Kind         string   `json:"kind"`
+	NodeType     string   `json:"nodeType,omitempty"`
+	Code         string   `json:"code,omitempty"`
+	Prerequisite string   `json:"prerequisite,omitempty"` // for unknown, unreadable and unresolved prerequisites
+	Message      string   `json:"message"`
+	Cycle        []string `json:"cycle,omitempty"` // codes, for cycles
+}
+
+// ImportReport is the result of validating an import without running it.
+// Errors make the import fail; warnings are tolerated, e.g. unknown
+// prerequisites are skipped.
+type ImportReport struct {
+	Valid    bool          `json:"valid"`
+	Mode     string        `json:"mode"`
+	Errors   []ImportIssue `json:"errors"`
+	Warnings []ImportIssue `json:"warnings"`
+	Changes  *MergeResult  `json:"changes,omitempty"` // by code, against the current domain
+}
+
+func (r *ImportReport) addError(issue ImportIssue) {
+	r.Errors = append(r.Errors, issue)
+	r.Valid = false
+}
+
+func (r *ImportReport) addWarning(issue ImportIssue) {
+	r.Warnings = append(r.Warnings, issue)
+}
+
+// CheckImport validates an import payload on its own, without the database:
+// duplicate codes, prerequisites that are neither an imported definition nor
+// an external stub, circular prerequisites, difficulties outside 1-7,
+// prerequisite weights outside (0, 1] and empty exercise statements. Duplicate codes fail a merge; a replace import
+// tolerates them but links prerequisites to only one of the nodes.
+func CheckImport(data *GraphData, mode string) *ImportReport {
+	report := &ImportReport{Valid: true, Mode: mode, Errors: []ImportIssue{}, Warnings: []ImportIssue{}}
+
+	duplicate := report.addWarning
+	if mode == ImportModeMerge {
+		duplicate = report.addError
+	}
+
+	definitionCodes := map[string]bool{}
+	for _, defNode := range sortedDefinitionNodes(data) {
+		if definitionCodes[defNode.Code] {
+			duplicate(ImportIssue{
+				Kind:     IssueDuplicateCode,
+				NodeType: "definition",
+				Code:     defNode.Code,
+				Message:  fmt.Sprintf("definition code %s is used more than once", defNode.Code),
+			})
+		}
+		definitionCodes[defNode.Code] = true
+	}
+
+	weights := func(nodeType, code string, links map[string]PrerequisiteLink) {
+		for _, prereqCode := range sortedKeys(links) {
+			if weight := links[prereqCode].Weight; weight <= 0 || weight > 1 {
+				report.addError(ImportIssue{
+					Kind:         IssueWeightOutOfRange,
+					NodeType:     nodeType,
+					Code:         code,
+					Prerequisite: prereqCode,
+					Message:      fmt.Sprintf("prerequisite %s of %s %s has weight %g, must be above 0 and at most 1", prereqCode, nodeType, code, weight),
+				})
+			}
+		}
+	}
+
+	unknown := func(nodeType, code string, prerequisites []string) {
+		for _, prereqCode := range prerequisites {
+			if definitionCodes[prereqCode] {
+				continue
+			}
+			if _, exists := data.External[prereqCode]; exists {
+				continue
+			}
+			report.addWarning(ImportIssue{
+				Kind:         IssueUnknownPrerequisite,
+				NodeType:     nodeType,
+				Code:         code,
+				Prerequisite: prereqCode,
+				Message:      fmt.Sprintf("prerequisite %s of %s %s is no imported definition nor external stub and will be skipped", prereqCode, nodeType, code),
+			})
+		}
+	}
+	for _, defNode := range sortedDefinitionNodes(data) {
+		unknown("definition", defNode.Code, defNode.Prerequisites)
+		weights("definition", defNode.Code, defNode.PrerequisiteLinks)
+	}
+
+	exerciseCodes := map[string]bool{}
+	for _, exNode := range sortedExerciseNodes(data) {
+		if exerciseCodes[exNode.Code] {
+			duplicate(ImportIssue{
+				Kind:     IssueDuplicateCode,
+				NodeType: "exercise",
+				Code:     exNode.Code,
+				Message:  fmt.Sprintf("exercise code %s is used more than once", exNode.Code),
+			})
+		}
+		exerciseCodes[exNode.Code] = true
+
+		unknown("exercise", exNode.Code, exNode.Prerequisites)
+		weights("exercise", exNode.Code, exNode.PrerequisiteLinks)
+		if exNode.Difficulty < 1 || exNode.Difficulty > 7 {
+			report.addError(ImportIssue{
+				Kind:     IssueDifficultyOutOfRange,
+				NodeType: "exercise",
+				Code:     exNode.Code,
+				Message:  fmt.Sprintf("difficulty of exercise %s is %d, must be between 1 and 7", exNode.Code, exNode.Difficulty),
+			})
+		}
+		if strings.TrimSpace(exNode.Statement) == "" {
+			report.addWarning(ImportIssue{
+				Kind:     IssueEmptyStatement,
+				NodeType: "exercise",
+				Code:     exNode.Code,
+				Message:  fmt.Sprintf("exercise %s has an empty statement", exNode.Code),
+			})
+		}
+	}
+
+	edges := graph.Edges{}
+	for _, defNode := range data.Definitions {
+		for _, prereqCode := range defNode.Prerequisites {
+			edges.Add(defNode.Code, prereqCode)
+		}
+	}
+	for _, cycle := range graph.FindCycles(edges) {
+		report.addError(ImportIssue{
+			Kind:     IssueCycle,
+			NodeType: "definition",
+			Code:     cycle[0],
+			Message:  (&graph.CycleError{Cycle: cycle}).Error(),
+			Cycle:    cycle,
+		})
+	}
+
+	return report
+}
+
+// ValidateImport validates an import into a domain without writing anything.
+// On top of CheckImport, it resolves the external stubs, checks that the
+// user running the import may read them, and lists by code the nodes the
+// import would create, update and delete. A replace import recreates every
+// node, so the changes then describe content only, as a merge deleting
+// missing nodes; it also fails when nodes of other domains require a node
+// it leaves out.
+func (d *GraphDAO) ValidateImport(domainID uint, userID uint, data *GraphData, mode string, deleteMissing bool) (*ImportReport, error) {
+	// Only read, in a transaction that is always rolled back, so that the
+	// merge state shared with MergeDomain cannot write
+	tx := d.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer tx.Rollback()
+
+	var domain models.Domain
+	if err := tx.First(&domain, domainID).Error; err != nil {
+		return nil, err
+	}
+
+	report := CheckImport(data, mode)
+
+	codeToExternal := make(map[string]*models.Definition, len(data.External))
+	for _, ref := range sortedKeys(data.External) {
+		node := data.External[ref]
+		if !externalUsed(data, ref) {
+			continue
+		}
+		def, err := resolveExternal(tx, node)
+		if errors.Is(err, ErrUnresolvedExternal) {
+			report.addError(ImportIssue{
+				Kind:         IssueUnresolvedExternal,
+				Prerequisite: ref,
+				Message:      fmt.Sprintf("external prerequisite %s (%s in domain %q) matches no definition, or several domains have that name", ref, node.Code, node.DomainName),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		codeToExternal[ref] = def
+		err = checkPrerequisiteReadableBy(tx, userID, def.ID, "definition")
+		if errors.Is(err, ErrPrerequisiteNotReadable) {
+			report.addError(ImportIssue{
+				Kind:         IssueUnreadablePrerequisite,
+				Prerequisite: ref,
+				Message:      fmt.Sprintf("external prerequisite %s is in domain %s, which you cannot read", ref, node.DomainName),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	merge := mode == ImportModeMerge
+	if !merge {
+		inbound, err := getInboundPrerequisites(tx, domainID)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range missingDependents(inbound, data) {
+			report.addError(ImportIssue{
+				Kind:     IssueDependentNode,
+				NodeType: p.edge.PrerequisiteType,
+				Code:     p.code,
+				Message:  fmt.Sprintf("%s, which the import leaves out", p),
+			})
+		}
+	}
+	if merge {
+		// A merge also links prerequisites to nodes of the domain that the
+		// import leaves out
+		var codes []string
+		if err := tx.Model(&models.Definition{}).Where("domain_id = ?", domainID).Pluck("code", &codes).Error; err != nil {
+			return nil, err
+		}
+		existing := make(map[string]bool, len(codes))
+		for _, code := range codes {
+			existing[code] = true
+		}
+		warnings := report.Warnings[:0]
+		for _, issue := range report.Warnings {
+			if issue.Kind != IssueUnknownPrerequisite || !existing[issue.Prerequisite] {
+				warnings = append(warnings, issue)
+			}
+		}
+		report.Warnings = warnings
+	}
+
+	changes, err := diffImport(tx, &domain, data, codeToExternal, merge, deleteMissing || !merge)
+	if err != nil {
+		return nil, err
+	}
+	report.Changes = changes
+	return report, nil
+}
+
+// diffImport lists by code what an import would change in a domain, reading
+// only; tx is a transaction the caller rolls back. With merge, prerequisites added manually and prerequisites on
+// exercises are kept, as MergeDomain does; otherwise every prerequisite
+// that differs from the import counts.
+func diffImport(tx *gorm.DB, domain *models.Domain, data *GraphData, codeToExternal map[string]*models.Definition, merge, deleteMissing bool) (*MergeResult, error) {
+	result := &MergeResult{Definitions: newMergeChanges(), Exercises: newMergeChanges()}
+
+	m := &domainMerge{
+		tx:          tx,
+		domain:      domain,
+		definitions: map[string]*models.Definition{},
+		exercises:   map[string]*models.Exercise{},
+	}
+	if err := m.loadExisting(); err != nil {
+		return nil, err
+	}
+
+	prerequisites, err := NewSRSDao(tx).GetPrerequisitesByDomain(domain.ID)
+	if err != nil {
+		return nil, err
+	}
+	byNode := map[string][]models.NodePrerequisite{}
+	for _, p := range prerequisites {
+		key := nodeKey(p.NodeID, p.NodeType)
+		byNode[key] = append(byNode[key], p)
+	}
+
+	// prerequisitesDiffer compares a matched node's prerequisites with the
+	// imported codes and links. Codes of definitions the import creates are
+	// new edges.
+	prerequisitesDiffer := func(key string, codes []string, links map[string]PrerequisiteLink) bool {
+		wanted := map[uint]bool{}
+		linkOf := map[uint]PrerequisiteLink{}
+		for _, code := range codes {
+			var id uint
+			if def, exists := m.definitions[code]; exists && (merge || definitionImported(data, code)) {
+				id = def.ID
+			} else if definitionImported(data, code) {
+				return true
+			} else if def, exists := codeToExternal[code]; exists {
+				id = def.ID
+			} else {
+				continue
+			}
+			wanted[id] = true
+			if link, exists := links[code]; exists {
+				linkOf[id] = link
+			}
+		}
+		seen := map[uint]bool{}
+		for _, p := range byNode[key] {
+			// The domain query may return an edge twice
+			if seen[p.ID] {
+				continue
+			}
+			seen[p.ID] = true
+			if p.PrerequisiteType != "definition" {
+				if !merge {
+					return true
+				}
+				continue
+			}
+			if wanted[p.PrerequisiteID] {
+				delete(wanted, p.PrerequisiteID)
+				if link, exists := linkOf[p.PrerequisiteID]; exists {
+					if link.Weight != p.Weight || link.Manual != p.IsManual {
+						return true
+					}
+				} else if !merge && (p.IsManual || p.Weight != 1) {
+					return true
+				}
+				continue
+			}
+			if !merge || !p.IsManual {
+				return true
+			}
+		}
+		return len(wanted) > 0
+	}
+
+	for _, defNode := range sortedDefinitionNodes(data) {
+		def, exists := m.definitions[defNode.Code]
+		switch {
+		case !exists:
+			result.Definitions.Created = append(result.Definitions.Created, defNode.Code)
+		case definitionDiffers(def, defNode) || prerequisitesDiffer(nodeKey(def.ID, "definition"), defNode.Prerequisites, defNode.PrerequisiteLinks):
+			result.Definitions.Updated = markUpdated(result.Definitions, defNode.Code)
+		}
+	}
+	for _, exNode := range sortedExerciseNodes(data) {
+		ex, exists := m.exercises[exNode.Code]
+		switch {
+		case !exists:
+			result.Exercises.Created = append(result.Exercises.Created, exNode.Code)
+		case exerciseDiffers(ex, exNode) || prerequisitesDiffer(nodeKey(ex.ID, "exercise"), exNode.Prerequisites, exNode.PrerequisiteLinks):
+			result.Exercises.Updated = markUpdated(result.Exercises, exNode.Code)
+		}
+	}
+	result.Definitions.Unchanged = countUnchanged(len(data.Definitions), result.Definitions)
+	result.Exercises.Unchanged = countUnchanged(len(data.Exercises), result.Exercises)
+
+	if deleteMissing {
+		imported := map[string]bool{}
+		for _, defNode := range data.Definitions {
+			imported[defNode.Code] = true
+		}
+		for _, def := range m.duplicates {
+			result.Definitions.Deleted = append(result.Definitions.Deleted, def.Code)
+		}
+		for _, code := range sortedKeys(m.definitions) {
+			if !imported[code] {
+				result.Definitions.Deleted = append(result.Definitions.Deleted, code)
+			}
+		}
+
+		imported = map[string]bool{}
+		for _, exNode := range data.Exercises {
+			imported[exNode.Code] = true
+		}
+		for _, ex := range m.duplicateEx {
+			result.Exercises.Deleted = append(result.Exercises.Deleted, ex.Code)
+		}
+		for _, code := range sortedKeys(m.exercises) {
+			if !imported[code] {
+				result.Exercises.Deleted = append(result.Exercises.Deleted, code)
+			}
+		}
+	}
+	return result, nil
+}
+
+// definitionImported reports whether the import has a definition with the
+// code, whatever its key
+func definitionImported(data *GraphData, code string) bool {
+	for _, defNode := range data.Definitions {
+		if defNode.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// countUnchanged counts the imported nodes of one type that are neither
+// created nor updated
+func countUnchanged(imported int, changes MergeChanges) int {
+	if unchanged := imported - len(changes.Created) - len(changes.Updated); unchanged > 0 {
+		return unchanged
+	}
+	return 0
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,156 @@
+package dao
+
+import (
+	"reflect"
+	"testing"
+
+	"myapp/server/models"
+)
+
+// issueKinds returns the kinds of the issues with the code, or of the
+// prerequisite for unknown prerequisites
+func issueKinds(issues []ImportIssue) map[string]string {
+	kinds := map[string]string{}
+	for _, issue := range issues {
+		key := issue.Code
+		if issue.Kind == IssueUnknownPrerequisite {
+			key = issue.Prerequisite
+		}
+		kinds[key] = issue.Kind
+	}
+	return kinds
+}
+
+func TestCheckImport(t *testing.T) {
+	data := &GraphData{
+		Definitions: map[string]DefinitionNode{
+			"1": {Code: "A", Name: "A", Prerequisites: []string{"C"}},
+			"2": {Code: "B", Name: "B", Prerequisites: []string{"A", "MISSING"}},
+			"3": {Code: "C", Name: "C", Prerequisites: []string{"B"}},
+			"4": {Code: "D", Name: "D"},
+			"5": {Code: "D", Name: "D again"},
+		},
+		Exercises: map[string]ExerciseNode{
+			"X": {Code: "X", Name: "X", Statement: "x", Difficulty: 9},
+			"Y": {Code: "Y", Name: "Y", Difficulty: 3, Prerequisites: []string{"D"}},
+		},
+	}
+
+	report := CheckImport(data, ImportModeReplace)
+	if report.Valid {
+		t.Error("import with a cycle is valid")
+	}
+	wantErrors := map[string]string{"A": IssueCycle, "X": IssueDifficultyOutOfRange}
+	if got := issueKinds(report.Errors); !reflect.DeepEqual(got, wantErrors) {
+		t.Errorf("errors = %v, want %v", got, wantErrors)
+	}
+	wantWarnings := map[string]string{"D": IssueDuplicateCode, "MISSING": IssueUnknownPrerequisite, "Y": IssueEmptyStatement}
+	if got := issueKinds(report.Warnings); !reflect.DeepEqual(got, wantWarnings) {
+		t.Errorf("warnings = %v, want %v", got, wantWarnings)
+	}
+	for _, issue := range report.Errors {
+		if issue.Kind == IssueCycle && (len(issue.Cycle) != 4 || issue.Cycle[0] != issue.Cycle[3]) {
+			t.Errorf("cycle = %v, want A, B and C closed on the first", issue.Cycle)
+		}
+	}
+
+	// A merge cannot match duplicate codes
+	report = CheckImport(data, ImportModeMerge)
+	if kind := issueKinds(report.Errors)["D"]; kind != IssueDuplicateCode {
+		t.Errorf("merge error on D = %q, want %s", kind, IssueDuplicateCode)
+	}
+}
+
+// createValidationTestDomain creates a domain with definitions A and B, B
+// requiring A, and exercise X requiring B
+func createValidationTestDomain(t *testing.T, graphDAO *GraphDAO, defs []*models.Definition) {
+	t.Helper()
+	data := &GraphData{
+		Definitions: map[string]DefinitionNode{
+			"A": {Code: "A", Name: "A", Description: "a", XPosition: 10, YPosition: 10},
+			"B": {Code: "B", Name: "B", Description: "b", Prerequisites: []string{"A"}, XPosition: 20, YPosition: 10},
+		},
+		Exercises: map[string]ExerciseNode{
+			"X": {Code: "X", Name: "X", Statement: "x", Difficulty: 3, Prerequisites: []string{"B"}, XPosition: 30, YPosition: 10},
+		},
+	}
+	if err := graphDAO.ImportDomain(defs[0].DomainID, defs[0].OwnerID, data); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+}
+
+func TestValidateImport(t *testing.T) {
+	db := setupSRSTestDB(t)
+	graphDAO := NewGraphDAO(db)
+	defs := createCycleTestDefinitions(t, db, "OLD")
+	domainID, userID := defs[0].DomainID, defs[0].OwnerID
+	createValidationTestDomain(t, graphDAO, defs)
+
+	// Rename A, add C requiring B and leave X out. Y requires B, which a
+	// merge links to the existing definition.
+	data := &GraphData{
+		Definitions: map[string]DefinitionNode{
+			"A": {Code: "A", Name: "Renamed", Description: "a", XPosition: 10, YPosition: 10},
+			"C": {Code: "C", Name: "C", Description: "c", Prerequisites: []string{"B", "MISSING"}, XPosition: 40, YPosition: 10},
+		},
+		Exercises: map[string]ExerciseNode{
+			"Y": {Code: "Y", Name: "Y", Statement: "y", Difficulty: 3, Prerequisites: []string{"B"}, XPosition: 50, YPosition: 10},
+		},
+	}
+
+	report, err := graphDAO.ValidateImport(domainID, userID, data, ImportModeMerge, false)
+	if err != nil {
+		t.Fatalf("Failed to validate: %v", err)
+	}
+	if !report.Valid {
+		t.Errorf("merge is invalid: %+v", report.Errors)
+	}
+	if got, want := issueKinds(report.Warnings), map[string]string{"MISSING": IssueUnknownPrerequisite}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merge warnings = %v, want %v", got, want)
+	}
+	wantDefinitions := MergeChanges{Created: []string{"C"}, Updated: []string{"A"}, Deleted: []string{}, Unchanged: 0}
+	wantExercises := MergeChanges{Created: []string{"Y"}, Updated: []string{}, Deleted: []string{}, Unchanged: 0}
+	if got := report.Changes; !reflect.DeepEqual(got.Definitions, wantDefinitions) || !reflect.DeepEqual(got.Exercises, wantExercises) {
+		t.Errorf("merge changes = %+v, want %+v and %+v", got, wantDefinitions, wantExercises)
+	}
+
+	report, err = graphDAO.ValidateImport(domainID, userID, data, ImportModeMerge, true)
+	if err != nil {
+		t.Fatalf("Failed to validate: %v", err)
+	}
+	if got := report.Changes; !reflect.DeepEqual(got.Definitions.Deleted, []string{"B"}) || !reflect.DeepEqual(got.Exercises.Deleted, []string{"X"}) {
+		t.Errorf("merge deleting missing nodes deletes %v and %v, want B and X", got.Definitions.Deleted, got.Exercises.Deleted)
+	}
+
+	// Replacing recreates the domain: B is unknown to the import
+	report, err = graphDAO.ValidateImport(domainID, userID, data, ImportModeReplace, false)
+	if err != nil {
+		t.Fatalf("Failed to validate: %v", err)
+	}
+	if got, want := issueKinds(report.Warnings), map[string]string{"B": IssueUnknownPrerequisite, "MISSING": IssueUnknownPrerequisite}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replace warnings = %v, want %v", got, want)
+	}
+	if got := report.Changes; !reflect.DeepEqual(got.Definitions.Deleted, []string{"B"}) || !reflect.DeepEqual(got.Exercises.Deleted, []string{"X"}) {
+		t.Errorf("replace deletes %v and %v, want B and X", got.Definitions.Deleted, got.Exercises.Deleted)
+	}
+
+	// A cyclic import is reported, not rejected
+	data.Definitions["A"] = DefinitionNode{Code: "A", Name: "A", Description: "a", Prerequisites: []string{"C"}}
+	data.Definitions["C"] = DefinitionNode{Code: "C", Name: "C", Description: "c", Prerequisites: []string{"A"}}
+	report, err = graphDAO.ValidateImport(domainID, userID, data, ImportModeMerge, false)
+	if err != nil {
+		t.Fatalf("Failed to validate: %v", err)
+	}
+	if report.Valid || issueKinds(report.Errors)["A"] != IssueCycle {
+		t.Errorf("cyclic import errors = %+v, want a cycle", report.Errors)
+	}
+
+	// Validating wrote nothing
+	var definitions []models.Definition
+	if err := db.Where("domain_id = ?", domainID).Order("code").Find(&definitions).Error; err != nil {
+		t.Fatalf("Failed to read definitions: %v", err)
+	}
+	if len(definitions) != 2 || definitions[0].Name != "A" || definitions[1].Code != "B" {
+		t.Errorf("definitions after validating = %+v, want A and B unchanged", definitions)
+	}
+}
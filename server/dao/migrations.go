@@ -0,0 +1,70 @@
+package dao
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SchemaMigration records a migration applied to the database
+type SchemaMigration struct {
+	ID        string    `gorm:"primaryKey;column:id"`
+	AppliedAt time.Time `gorm:"column:applied_at;autoCreateTime"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migration is a schema change AutoMigrate cannot make, such as changing a
+// CHECK constraint. Databases created from init-sql.sql already have the
+// change, so statements must also apply cleanly there.
+type migration struct {
+	ID         string
+	Statements []string
+}
+
+// migrations are applied in order, each once
+var migrations = []migration{
+	{
+		// Learning path sessions
+		ID: "001_study_sessions_path_type",
+		Statements: []string{
+			`ALTER TABLE study_sessions DROP CONSTRAINT IF EXISTS study_sessions_session_type_check`,
+			`ALTER TABLE study_sessions ADD CONSTRAINT study_sessions_session_type_check
+				CHECK (session_type IN ('definition', 'exercise', 'mixed', 'path'))`,
+		},
+	},
+}
+
+// runMigrations applies the migrations not recorded in schema_migrations,
+// each in its own transaction together with its record
+func runMigrations(db *gorm.DB, migrations []migration) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		var count int64
+		if err := db.Model(&SchemaMigration{}).Where("id = ?", m.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, statement := range m.Statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&SchemaMigration{ID: m.ID}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.ID, err)
+		}
+	}
+	return nil
+}
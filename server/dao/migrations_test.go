@@ -0,0 +1,42 @@
+package dao
+
+import (
+	"testing"
+)
+
+func TestRunMigrations(t *testing.T) {
+	db := setupSRSTestDB(t)
+
+	steps := []migration{
+		{ID: "001_create", Statements: []string{`CREATE TABLE widgets (id INTEGER PRIMARY KEY)`}},
+		{ID: "002_fill", Statements: []string{`INSERT INTO widgets (id) VALUES (1)`}},
+	}
+	if err := runMigrations(db, steps); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	// Applied migrations are not run again
+	if err := runMigrations(db, steps); err != nil {
+		t.Fatalf("Failed to run migrations again: %v", err)
+	}
+	var widgets int64
+	db.Table("widgets").Count(&widgets)
+	if widgets != 1 {
+		t.Errorf("%d widgets, want the insert applied once", widgets)
+	}
+
+	// A failing migration is rolled back and not recorded
+	steps = append(steps, migration{ID: "003_broken", Statements: []string{
+		`INSERT INTO widgets (id) VALUES (2)`,
+		`INSERT INTO missing_table (id) VALUES (1)`,
+	}})
+	if err := runMigrations(db, steps); err == nil {
+		t.Fatal("Expected the broken migration to fail")
+	}
+	db.Table("widgets").Count(&widgets)
+	var applied []string
+	db.Model(&SchemaMigration{}).Order("id").Pluck("id", &applied)
+	if widgets != 1 || len(applied) != 2 {
+		t.Errorf("widgets = %d, applied = %v, want the broken migration rolled back", widgets, applied)
+	}
+}
@@ -1,8 +1,8 @@
 package dao
 
 import (
-	"math"
 	"myapp/server/models"
+	"myapp/server/scheduler"
 	"time"
 
 	"gorm.io/gorm"
@@ -151,10 +151,8 @@ func (d *ProgressDAO) TrackDefinitionReview(userID, definitionID uint, result mo
 		
 		// Update based on SM-2 algorithm (modified version of the Anki algorithm)
 		progress.LastReview = time.Now()
-		progress.Repetitions++
 		
-		// Apply SM-2 algorithm
-		// Calculate new easiness factor and interval
+		// Map the review result onto the SM-2 quality scale
 		var qualityScore int
 		switch result {
 		case models.ReviewAgain:
@@ -167,23 +165,12 @@ func (d *ProgressDAO) TrackDefinitionReview(userID, definitionID uint, result mo
 			qualityScore = 5
 		}
 		
-		// Update easiness factor (EF)
-		progress.EasinessFactor = math.Max(1.3, progress.EasinessFactor+
-			(0.1-(5-float64(qualityScore))*(0.08+(5-float64(qualityScore))*0.02)))
-		
-		// Calculate next interval
-		if qualityScore < 3 {
-			progress.Repetitions = 0
-			progress.IntervalDays = 1
-		} else {
-			if progress.Repetitions == 1 {
-				progress.IntervalDays = 1
-			} else if progress.Repetitions == 2 {
-				progress.IntervalDays = 6
-			} else {
-				progress.IntervalDays = int(float64(progress.IntervalDays) * progress.EasinessFactor)
-			}
-		}
+		// Apply the shared SM-2 step; intervals are kept rounded down as
+		// this tracking always did
+		ef, interval, reps := scheduler.SM2StepTruncated(progress.EasinessFactor, float64(progress.IntervalDays), progress.Repetitions, qualityScore)
+		progress.EasinessFactor = ef
+		progress.IntervalDays = int(interval)
+		progress.Repetitions = reps
 		
 		// Set next review date
 		progress.NextReview = time.Now().AddDate(0, 0, progress.IntervalDays)
@@ -20,9 +20,22 @@ func NewSRSDao(db *gorm.DB) *SRSDao {
 
 // === Node Prerequisites ===
 
-// CreatePrerequisite creates a new prerequisite relationship
+// CreatePrerequisite creates a new prerequisite relationship. Edges that
+// would close a cycle are rejected with a *graph.CycleError.
 func (d *SRSDao) CreatePrerequisite(prerequisite *models.NodePrerequisite) error {
-	return d.db.Create(prerequisite).Error
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(prerequisite).Error; err != nil {
+			return err
+		}
+		domainID, err := nodeDomainID(tx, prerequisite.NodeID, prerequisite.NodeType)
+		if err != nil {
+			return err
+		}
+		if err := checkPrerequisiteReadable(tx, domainID, prerequisite.PrerequisiteID, prerequisite.PrerequisiteType); err != nil {
+			return err
+		}
+		return checkNoCycleThrough(tx, domainID, prerequisite.NodeID, prerequisite.NodeType)
+	})
 }
 
 // GetPrerequisitesByDomain gets all prerequisites for nodes in a domain
@@ -86,6 +99,15 @@ func (d *SRSDao) DeletePrerequisitesForNode(nodeID uint, nodeType string) error
 	return d.db.Where("node_id = ? AND node_type = ?", nodeID, nodeType).Delete(&models.NodePrerequisite{}).Error
 }
 
+// DeletePrerequisitesByIDs deletes prerequisite relationships by ID
+func (d *SRSDao) DeletePrerequisitesByIDs(ids []uint) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := d.db.Where("id IN ?", ids).Delete(&models.NodePrerequisite{})
+	return result.RowsAffected, result.Error
+}
+
 // === User Node Progress ===
 
 // GetUserProgress gets progress for a user on a specific node
@@ -100,11 +122,65 @@ func (d *SRSDao) GetUserProgress(userID uint, nodeID uint, nodeType string) (*mo
 	return &progress, result.Error
 }
 
-// CreateOrUpdateProgress creates or updates user progress
+// CreateOrUpdateProgress creates or updates user progress, incrementing its
+// version
 func (d *SRSDao) CreateOrUpdateProgress(progress *models.UserNodeProgress) error {
+	progress.Version++
 	return d.db.Save(progress).Error
 }
 
+// domainProgressFilter selects the progress rows of a user (first argument)
+// for the nodes of a domain (second and third arguments); it also applies to
+// review history, which has the same node columns
+const domainProgressFilter = `user_id = ? AND (
+			(node_type = 'definition' AND node_id IN (SELECT id FROM definitions WHERE domain_id = ?))
+			OR (node_type = 'exercise' AND node_id IN (SELECT id FROM exercises WHERE domain_id = ?)))`
+
+// GetDomainNodeProgress gets the stored progress rows of a user for the nodes of a domain
+func (d *SRSDao) GetDomainNodeProgress(userID uint, domainID uint) ([]models.UserNodeProgress, error) {
+	var progress []models.UserNodeProgress
+	result := d.db.Where(domainProgressFilter, userID, domainID, domainID).
+		Order("node_type, node_id").
+		Find(&progress)
+	return progress, result.Error
+}
+
+// UnsuspendDomain clears the suspension of all the user's nodes in a domain
+// and returns how many nodes were unsuspended
+func (d *SRSDao) UnsuspendDomain(userID uint, domainID uint) (int64, error) {
+	result := d.db.Model(&models.UserNodeProgress{}).
+		Where(domainProgressFilter, userID, domainID, domainID).
+		Where("suspended = ?", true).
+		Updates(map[string]interface{}{"suspended": false, "version": gorm.Expr("version + 1")})
+	return result.RowsAffected, result.Error
+}
+
+// UnburyDomain clears the burial of all the user's nodes in a domain
+// and returns how many buried nodes were restored
+func (d *SRSDao) UnburyDomain(userID uint, domainID uint) (int64, error) {
+	result := d.db.Model(&models.UserNodeProgress{}).
+		Where(domainProgressFilter, userID, domainID, domainID).
+		Where("buried_until > NOW()").
+		Updates(map[string]interface{}{"buried_until": nil, "version": gorm.Expr("version + 1")})
+	return result.RowsAffected, result.Error
+}
+
+// RestoreProgress writes back a saved progress row exactly, version included,
+// so that it matches the snapshot of the review before. On Postgres a
+// trigger still sets updated_at to the time of the restore.
+func (d *SRSDao) RestoreProgress(progress *models.UserNodeProgress) error {
+	return d.db.Model(&models.UserNodeProgress{}).
+		Where("id = ?", progress.ID).
+		Select("*").
+		UpdateColumns(progress).Error
+}
+
+// DeleteProgress deletes the progress of a user on a node
+func (d *SRSDao) DeleteProgress(userID uint, nodeID uint, nodeType string) error {
+	return d.db.Where("user_id = ? AND node_id = ? AND node_type = ?", userID, nodeID, nodeType).
+		Delete(&models.UserNodeProgress{}).Error
+}
+
 // GetDomainProgress gets all progress for a user in a domain
 func (d *SRSDao) GetDomainProgress(userID uint, domainID uint) ([]models.NodeProgress, error) {
 	var results []models.NodeProgress
@@ -126,13 +202,19 @@ func (d *SRSDao) GetDomainProgress(userID uint, domainID uint) ([]models.NodePro
 			COALESCE(unp.credit_postponed, false) as credit_postponed,
 			COALESCE(unp.total_reviews, 0) as total_reviews,
 			COALESCE(unp.successful_reviews, 0) as successful_reviews,
+			COALESCE(unp.lapses, 0) as lapses,
+			COALESCE(unp.is_leech, false) as is_leech,
+			COALESCE(unp.suspended, false) as suspended,
+			unp.buried_until,
 			CASE 
 				WHEN unp.next_review IS NULL THEN NULL
 				WHEN unp.next_review <= NOW() THEN 0
 				ELSE EXTRACT(days FROM (unp.next_review - NOW()))::INTEGER
 			END as days_until_review,
 			CASE
-				WHEN unp.status = 'grasped' AND (unp.next_review IS NULL OR unp.next_review <= NOW()) THEN true
+				WHEN unp.status IN ('grasped', 'learned') AND NOT unp.suspended
+					AND (unp.buried_until IS NULL OR unp.buried_until <= NOW())
+					AND (unp.next_review IS NULL OR unp.next_review <= NOW()) THEN true
 				ELSE false
 			END as is_due
 		FROM definitions d
@@ -158,13 +240,19 @@ func (d *SRSDao) GetDomainProgress(userID uint, domainID uint) ([]models.NodePro
 			COALESCE(unp.credit_postponed, false) as credit_postponed,
 			COALESCE(unp.total_reviews, 0) as total_reviews,
 			COALESCE(unp.successful_reviews, 0) as successful_reviews,
+			COALESCE(unp.lapses, 0) as lapses,
+			COALESCE(unp.is_leech, false) as is_leech,
+			COALESCE(unp.suspended, false) as suspended,
+			unp.buried_until,
 			CASE 
 				WHEN unp.next_review IS NULL THEN NULL
 				WHEN unp.next_review <= NOW() THEN 0
 				ELSE EXTRACT(days FROM (unp.next_review - NOW()))::INTEGER
 			END as days_until_review,
 			CASE
-				WHEN unp.status = 'grasped' AND (unp.next_review IS NULL OR unp.next_review <= NOW()) THEN true
+				WHEN unp.status IN ('grasped', 'learned') AND NOT unp.suspended
+					AND (unp.buried_until IS NULL OR unp.buried_until <= NOW())
+					AND (unp.next_review IS NULL OR unp.next_review <= NOW()) THEN true
 				ELSE false
 			END as is_due
 		FROM exercises e
@@ -212,12 +300,16 @@ func (d *SRSDao) GetDueReviews(userID uint, domainID uint, nodeType string) ([]m
 				unp.credit_postponed,
 				unp.total_reviews,
 				unp.successful_reviews,
+				unp.lapses,
+				unp.is_leech,
+				unp.suspended,
 				0 as days_until_review,
 				true as is_due
 			FROM definitions d
 			JOIN user_node_progress unp ON d.id = unp.node_id 
 				AND unp.node_type = 'definition' AND unp.user_id = ?
-			WHERE d.domain_id = ? AND unp.status = 'grasped' 
+			WHERE d.domain_id = ? AND unp.status IN ('grasped', 'learned') AND NOT unp.suspended
+				AND (unp.buried_until IS NULL OR unp.buried_until <= NOW())
 				AND (unp.next_review IS NULL OR unp.next_review <= NOW())
 			ORDER BY unp.next_review ASC NULLS FIRST
 		`
@@ -238,12 +330,16 @@ func (d *SRSDao) GetDueReviews(userID uint, domainID uint, nodeType string) ([]m
 				unp.credit_postponed,
 				unp.total_reviews,
 				unp.successful_reviews,
+				unp.lapses,
+				unp.is_leech,
+				unp.suspended,
 				0 as days_until_review,
 				true as is_due
 			FROM exercises e
 			JOIN user_node_progress unp ON e.id = unp.node_id 
 				AND unp.node_type = 'exercise' AND unp.user_id = ?
-			WHERE e.domain_id = ? AND unp.status = 'grasped' 
+			WHERE e.domain_id = ? AND unp.status IN ('grasped', 'learned') AND NOT unp.suspended
+				AND (unp.buried_until IS NULL OR unp.buried_until <= NOW())
 				AND (unp.next_review IS NULL OR unp.next_review <= NOW())
 			ORDER BY unp.next_review ASC NULLS FIRST
 		`
@@ -265,12 +361,16 @@ func (d *SRSDao) GetDueReviews(userID uint, domainID uint, nodeType string) ([]m
 				unp.credit_postponed,
 				unp.total_reviews,
 				unp.successful_reviews,
+				unp.lapses,
+				unp.is_leech,
+				unp.suspended,
 				0 as days_until_review,
 				true as is_due
 			FROM definitions d
 			JOIN user_node_progress unp ON d.id = unp.node_id 
 				AND unp.node_type = 'definition' AND unp.user_id = ?
-			WHERE d.domain_id = ? AND unp.status = 'grasped' 
+			WHERE d.domain_id = ? AND unp.status IN ('grasped', 'learned') AND NOT unp.suspended
+				AND (unp.buried_until IS NULL OR unp.buried_until <= NOW())
 				AND (unp.next_review IS NULL OR unp.next_review <= NOW())
 		`
 		
@@ -290,12 +390,16 @@ func (d *SRSDao) GetDueReviews(userID uint, domainID uint, nodeType string) ([]m
 				unp.credit_postponed,
 				unp.total_reviews,
 				unp.successful_reviews,
+				unp.lapses,
+				unp.is_leech,
+				unp.suspended,
 				0 as days_until_review,
 				true as is_due
 			FROM exercises e
 			JOIN user_node_progress unp ON e.id = unp.node_id 
 				AND unp.node_type = 'exercise' AND unp.user_id = ?
-			WHERE e.domain_id = ? AND unp.status = 'grasped' 
+			WHERE e.domain_id = ? AND unp.status IN ('grasped', 'learned') AND NOT unp.suspended
+				AND (unp.buried_until IS NULL OR unp.buried_until <= NOW())
 				AND (unp.next_review IS NULL OR unp.next_review <= NOW())
 		`
 		
@@ -319,6 +423,40 @@ func (d *SRSDao) GetDueReviews(userID uint, domainID uint, nodeType string) ([]m
 	return results, d.db.Raw(query, userID, domainID).Scan(&results).Error
 }
 
+// DueDayKey is the day (YYYY-MM-DD, UTC) a review at t counts toward in
+// GetDueCountsByDay
+func DueDayKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// GetDueCountsByDay counts the user's scheduled (grasped or learned, not
+// suspended) nodes in a domain per next_review day between from and to,
+// keyed by DueDayKey. Days are cut in Go, not by the database session's
+// timezone, so callers can key days the same way.
+func (d *SRSDao) GetDueCountsByDay(userID uint, domainID uint, from time.Time, to time.Time) (map[string]int, error) {
+	query := `
+		SELECT unp.next_review
+		FROM user_node_progress unp
+		WHERE unp.user_id = ? AND unp.status IN ('grasped', 'learned') AND NOT unp.suspended
+			AND unp.next_review >= ? AND unp.next_review < ?
+			AND (
+				(unp.node_type = 'definition' AND unp.node_id IN (SELECT id FROM definitions WHERE domain_id = ?))
+				OR (unp.node_type = 'exercise' AND unp.node_id IN (SELECT id FROM exercises WHERE domain_id = ?))
+			)
+	`
+
+	var reviews []time.Time
+	if err := d.db.Raw(query, userID, from, to, domainID, domainID).Scan(&reviews).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, review := range reviews {
+		counts[DueDayKey(review)]++
+	}
+	return counts, nil
+}
+
 // === Study Sessions ===
 
 // CreateSession creates a new study session
@@ -371,6 +509,14 @@ func (d *SRSDao) CreateSessionReview(review *models.SessionReview) error {
 	return d.db.Create(review).Error
 }
 
+// DeleteSessionReviews deletes session review records by ID
+func (d *SRSDao) DeleteSessionReviews(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return d.db.Where("id IN ?", ids).Delete(&models.SessionReview{}).Error
+}
+
 // === Review History ===
 
 // CreateReviewHistory creates a review history record
@@ -378,14 +524,30 @@ func (d *SRSDao) CreateReviewHistory(history *models.ReviewHistory) error {
 	return d.db.Create(history).Error
 }
 
+// GetLastExplicitReview gets the latest explicit review of a node by a user
+func (d *SRSDao) GetLastExplicitReview(userID uint, nodeID uint, nodeType string) (*models.ReviewHistory, error) {
+	var history models.ReviewHistory
+	result := d.db.Where("user_id = ? AND node_id = ? AND node_type = ? AND review_type = ?", userID, nodeID, nodeType, "explicit").
+		Order("review_time DESC, id DESC").
+		First(&history)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil // Not reviewed yet
+	}
+	return &history, result.Error
+}
+
 // GetReviewHistory gets review history for a user
-func (d *SRSDao) GetReviewHistory(userID uint, nodeID *uint, nodeType *string, limit int) ([]models.ReviewHistory, error) {
+func (d *SRSDao) GetReviewHistory(userID uint, nodeID *uint, nodeType *string, reviewType *string, limit int) ([]models.ReviewHistory, error) {
 	var history []models.ReviewHistory
 	query := d.db.Where("user_id = ?", userID)
 	
 	if nodeID != nil && nodeType != nil {
 		query = query.Where("node_id = ? AND node_type = ?", *nodeID, *nodeType)
 	}
+
+	if reviewType != nil {
+		query = query.Where("review_type = ?", *reviewType)
+	}
 	
 	query = query.Order("review_time DESC")
 	
@@ -397,6 +559,102 @@ func (d *SRSDao) GetReviewHistory(userID uint, nodeID *uint, nodeType *string, l
 	return history, result.Error
 }
 
+// GetDomainNodes gets the definitions and exercises of a domain, ordered by
+// type and code
+func (d *SRSDao) GetDomainNodes(domainID uint) ([]models.GraphNodeRef, error) {
+	var nodes []models.GraphNodeRef
+	query := `
+		SELECT id AS node_id, 'definition' AS node_type, code AS node_code, name AS node_name
+		FROM definitions WHERE domain_id = ?
+		UNION ALL
+		SELECT id AS node_id, 'exercise' AS node_type, code AS node_code, name AS node_name
+		FROM exercises WHERE domain_id = ?
+		ORDER BY node_type, node_code
+	`
+	result := d.db.Raw(query, domainID, domainID).Scan(&nodes)
+	return nodes, result.Error
+}
+
+// NodeStudyTime is the average time taken by explicit reviews of a node
+type NodeStudyTime struct {
+	NodeID      uint
+	NodeType    string
+	UserAverage *float64 // nil if the user never reviewed the node with a time
+	UserReviews int
+	Average     float64 // over all users
+}
+
+// GetStudyTimes gets the average review time of the nodes of a domain, for
+// the user and over all users. Reviews without a time are ignored.
+func (d *SRSDao) GetStudyTimes(userID uint, domainID uint) ([]NodeStudyTime, error) {
+	var times []NodeStudyTime
+	query := `
+		SELECT
+			node_id,
+			node_type,
+			AVG(time_taken) FILTER (WHERE user_id = ?) AS user_average,
+			COUNT(*) FILTER (WHERE user_id = ?) AS user_reviews,
+			AVG(time_taken) AS average
+		FROM review_history
+		WHERE review_type = 'explicit' AND time_taken > 0
+			AND ((node_type = 'definition' AND node_id IN (SELECT id FROM definitions WHERE domain_id = ?))
+				OR (node_type = 'exercise' AND node_id IN (SELECT id FROM exercises WHERE domain_id = ?)))
+		GROUP BY node_id, node_type
+	`
+	result := d.db.Raw(query, userID, userID, domainID, domainID).Scan(&times)
+	return times, result.Error
+}
+
+// GetReviewHistoryByIDs gets review history rows of a user by ID
+func (d *SRSDao) GetReviewHistoryByIDs(userID uint, ids []uint) ([]models.ReviewHistory, error) {
+	var history []models.ReviewHistory
+	if len(ids) == 0 {
+		return history, nil
+	}
+	result := d.db.Where("user_id = ? AND id IN ?", userID, ids).Find(&history)
+	return history, result.Error
+}
+
+// DeleteReviewHistory deletes review history rows of a user by ID
+func (d *SRSDao) DeleteReviewHistory(userID uint, ids []uint) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := d.db.Where("user_id = ? AND id IN ?", userID, ids).Delete(&models.ReviewHistory{})
+	return result.RowsAffected, result.Error
+}
+
+// === Review Snapshots ===
+
+// CreateReviewSnapshot stores the undo information of a review
+func (d *SRSDao) CreateReviewSnapshot(snapshot *models.ReviewSnapshot) error {
+	return d.db.Create(snapshot).Error
+}
+
+// GetLastReviewSnapshot gets the most recent review snapshot of a user
+func (d *SRSDao) GetLastReviewSnapshot(userID uint) (*models.ReviewSnapshot, error) {
+	var snapshot models.ReviewSnapshot
+	result := d.db.Where("user_id = ?", userID).Order("id DESC").First(&snapshot)
+	
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil // Nothing to undo
+	}
+	
+	return &snapshot, result.Error
+}
+
+// DeleteReviewSnapshot deletes a review snapshot
+func (d *SRSDao) DeleteReviewSnapshot(id uint) error {
+	return d.db.Delete(&models.ReviewSnapshot{}, id).Error
+}
+
+// PruneReviewSnapshots keeps only the most recent snapshots of a user
+func (d *SRSDao) PruneReviewSnapshots(userID uint, keep int) error {
+	return d.db.Where("user_id = ? AND id NOT IN (?)", userID,
+		d.db.Model(&models.ReviewSnapshot{}).Select("id").Where("user_id = ?", userID).Order("id DESC").Limit(keep),
+	).Delete(&models.ReviewSnapshot{}).Error
+}
+
 // === Statistics ===
 
 // GetDomainStats gets domain statistics for a user
@@ -456,13 +714,15 @@ func (d *SRSDao) GetDomainStats(userID uint, domainID uint) (*models.DomainProgr
 			SELECT d.id FROM definitions d
 			JOIN user_node_progress unp ON d.id = unp.node_id 
 				AND unp.node_type = 'definition' AND unp.user_id = ?
-			WHERE d.domain_id = ? AND unp.status = 'grasped' 
+			WHERE d.domain_id = ? AND unp.status IN ('grasped', 'learned') AND NOT unp.suspended
+				AND (unp.buried_until IS NULL OR unp.buried_until <= NOW())
 				AND (unp.next_review IS NULL OR unp.next_review <= NOW())
 			UNION ALL
 			SELECT e.id FROM exercises e
 			JOIN user_node_progress unp ON e.id = unp.node_id 
 				AND unp.node_type = 'exercise' AND unp.user_id = ?
-			WHERE e.domain_id = ? AND unp.status = 'grasped' 
+			WHERE e.domain_id = ? AND unp.status IN ('grasped', 'learned') AND NOT unp.suspended
+				AND (unp.buried_until IS NULL OR unp.buried_until <= NOW())
 				AND (unp.next_review IS NULL OR unp.next_review <= NOW())
 		) due_nodes
 	`
@@ -520,3 +780,80 @@ func (d *SRSDao) GetDomainStats(userID uint, domainID uint) (*models.DomainProgr
 	
 	return &stats, nil
 }
+
+// === Scheduler Settings ===
+
+// GetSchedulerSettings returns the scheduler preferences of the user and
+// the domain (algorithm fields may be empty)
+func (d *SRSDao) GetSchedulerSettings(userID uint, domainID uint) (*models.SchedulerSettings, error) {
+	var user models.User
+	if err := d.db.Select("scheduler_algorithm", "desired_retention").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var domain models.Domain
+	if err := d.db.Select("scheduler_algorithm", "desired_retention", "leech_threshold", "leech_action",
+		"graduation_interval", "graduation_success_rate").First(&domain, domainID).Error; err != nil {
+		return nil, err
+	}
+
+	return &models.SchedulerSettings{
+		UserAlgorithm:   user.SchedulerAlgorithm,
+		DomainAlgorithm: domain.SchedulerAlgorithm,
+		UserRetention:   user.DesiredRetention,
+		DomainRetention: domain.DesiredRetention,
+		LeechThreshold:  domain.LeechThreshold,
+		LeechAction:     domain.LeechAction,
+		GraduationInterval:    domain.GraduationInterval,
+		GraduationSuccessRate: domain.GraduationSuccessRate,
+	}, nil
+}
+
+// GetSchedulerParams gets the fitted scheduler parameters of a user
+func (d *SRSDao) GetSchedulerParams(userID uint) (*models.UserSchedulerParams, error) {
+	var params models.UserSchedulerParams
+	result := d.db.Where("user_id = ?", userID).First(&params)
+	
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil // Not fitted yet, defaults apply
+	}
+	
+	return &params, result.Error
+}
+
+// SaveSchedulerParams creates or updates the fitted scheduler parameters of
+// a user. The model has no column defaults, so fitted zeros are stored.
+func (d *SRSDao) SaveSchedulerParams(params *models.UserSchedulerParams) error {
+	return d.db.Save(params).Error
+}
+
+// GetDomainExplicitReviews gets the explicit reviews of a user on the nodes
+// of a domain in chronological order
+func (d *SRSDao) GetDomainExplicitReviews(userID uint, domainID uint) ([]models.ReviewHistory, error) {
+	var history []models.ReviewHistory
+	result := d.db.Where(domainProgressFilter, userID, domainID, domainID).
+		Where("review_type = ?", "explicit").
+		Order("review_time ASC, id ASC").
+		Find(&history)
+	return history, result.Error
+}
+
+// GetExplicitReviews gets all explicit reviews of a user in chronological order
+func (d *SRSDao) GetExplicitReviews(userID uint) ([]models.ReviewHistory, error) {
+	var history []models.ReviewHistory
+	result := d.db.Where("user_id = ? AND review_type = ?", userID, "explicit").
+		Order("review_time ASC, id ASC").
+		Find(&history)
+	return history, result.Error
+}
+
+// GetUsersWithReviews gets the IDs of all users with explicit review history
+func (d *SRSDao) GetUsersWithReviews() ([]uint, error) {
+	var userIDs []uint
+	result := d.db.Model(&models.ReviewHistory{}).
+		Where("review_type = ?", "explicit").
+		Distinct("user_id").
+		Order("user_id").
+		Pluck("user_id", &userIDs)
+	return userIDs, result.Error
+}
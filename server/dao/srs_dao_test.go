@@ -0,0 +1,166 @@
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"myapp/server/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupSRSTestDB opens a private in-memory database with the graph and
+// SRS tables
+func setupSRSTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get database handle: %v", err)
+	}
+	// Every connection to :memory: is a new database
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Domain{},
+		&models.Definition{},
+		&models.Reference{},
+		&models.Exercise{},
+		&models.NodePrerequisite{},
+		&models.UserNodeProgress{},
+		&models.ReviewHistory{},
+		&models.UserSchedulerParams{},
+	); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+func TestSaveSchedulerParamsKeepsZeros(t *testing.T) {
+	db := setupSRSTestDB(t)
+	srsDao := NewSRSDao(db)
+
+	// A first fit that drives coefficients to 0
+	fitted := &models.UserSchedulerParams{
+		UserID:         7,
+		FirstInterval:  2,
+		SecondInterval: 5,
+		EFBase:         0,
+		EFLinear:       0,
+		EFQuadratic:    0,
+		ReviewCount:    40,
+	}
+	if err := srsDao.SaveSchedulerParams(fitted); err != nil {
+		t.Fatalf("Failed to save parameters: %v", err)
+	}
+
+	stored, err := srsDao.GetSchedulerParams(7)
+	if err != nil || stored == nil {
+		t.Fatalf("Failed to read parameters back: %v", err)
+	}
+	if stored.EFBase != 0 || stored.EFLinear != 0 || stored.EFQuadratic != 0 {
+		t.Errorf("Stored coefficients = %g, %g, %g, want the fitted zeros", stored.EFBase, stored.EFLinear, stored.EFQuadratic)
+	}
+	if stored.FirstInterval != 2 || stored.SecondInterval != 5 {
+		t.Errorf("Stored intervals = %g, %g, want 2, 5", stored.FirstInterval, stored.SecondInterval)
+	}
+
+	// A later fit updates the row in place
+	stored.EFLinear = 0.05
+	if err := srsDao.SaveSchedulerParams(stored); err != nil {
+		t.Fatalf("Failed to update parameters: %v", err)
+	}
+	updated, err := srsDao.GetSchedulerParams(7)
+	if err != nil || updated.ID != stored.ID || updated.EFLinear != 0.05 || updated.EFBase != 0 {
+		t.Errorf("Updated parameters = %+v, %v, want row %d with efLinear 0.05", updated, err, stored.ID)
+	}
+}
+
+func TestGetDueCountsByDayUTCKeys(t *testing.T) {
+	db := setupSRSTestDB(t)
+	srsDao := NewSRSDao(db)
+
+	def := &models.Definition{Code: "D1", Name: "D1", Description: "d", DomainID: 1, OwnerID: 1}
+	other := &models.Definition{Code: "D2", Name: "D2", Description: "d", DomainID: 2, OwnerID: 1}
+	if err := db.Create(def).Error; err != nil {
+		t.Fatalf("Failed to create definition: %v", err)
+	}
+	if err := db.Create(other).Error; err != nil {
+		t.Fatalf("Failed to create definition: %v", err)
+	}
+
+	lateEvening := time.Date(2024, 3, 4, 23, 30, 0, 0, time.UTC)
+	nextMorning := time.Date(2024, 3, 5, 0, 30, 0, 0, time.UTC)
+	progress := []*models.UserNodeProgress{
+		{UserID: 1, NodeID: def.ID, NodeType: "definition", Status: "grasped", NextReview: &lateEvening},
+		{UserID: 1, NodeID: def.ID + 100, NodeType: "exercise", Status: "learned", NextReview: &lateEvening},
+		{UserID: 1, NodeID: def.ID, NodeType: "definition", Status: "learned", NextReview: &nextMorning},
+		{UserID: 1, NodeID: other.ID, NodeType: "definition", Status: "grasped", NextReview: &nextMorning},
+		{UserID: 1, NodeID: def.ID, NodeType: "definition", Status: "tackling", NextReview: &nextMorning},
+		{UserID: 2, NodeID: def.ID, NodeType: "definition", Status: "grasped", NextReview: &nextMorning},
+	}
+	for _, p := range progress {
+		if err := db.Create(p).Error; err != nil {
+			t.Fatalf("Failed to create progress: %v", err)
+		}
+	}
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	counts, err := srsDao.GetDueCountsByDay(1, 1, from, from.AddDate(0, 0, 10))
+	if err != nil {
+		t.Fatalf("Failed to count due reviews: %v", err)
+	}
+	if len(counts) != 2 || counts["2024-03-04"] != 1 || counts["2024-03-05"] != 1 {
+		t.Errorf("counts = %v, want one review on 2024-03-04 and one on 2024-03-05", counts)
+	}
+
+	// Keys are UTC days whatever the location of the time
+	tokyo := time.FixedZone("JST", 9*60*60)
+	if key := DueDayKey(lateEvening.In(tokyo)); key != "2024-03-04" {
+		t.Errorf("DueDayKey(%v) = %s, want 2024-03-04", lateEvening.In(tokyo), key)
+	}
+}
+
+func TestGetDomainExplicitReviews(t *testing.T) {
+	db := setupSRSTestDB(t)
+	srsDao := NewSRSDao(db)
+
+	def := &models.Definition{Code: "D1", Name: "D1", Description: "d", DomainID: 1, OwnerID: 1}
+	other := &models.Definition{Code: "D2", Name: "D2", Description: "d", DomainID: 2, OwnerID: 1}
+	ex := &models.Exercise{Code: "E1", Name: "E1", Statement: "e", DomainID: 1, OwnerID: 1}
+	otherEx := &models.Exercise{Code: "E2", Name: "E2", Statement: "e", DomainID: 2, OwnerID: 1}
+	for _, node := range []interface{}{def, other, ex, otherEx} {
+		if err := db.Create(node).Error; err != nil {
+			t.Fatalf("Failed to create node: %v", err)
+		}
+	}
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	reviews := []*models.ReviewHistory{
+		{UserID: 1, NodeID: ex.ID, NodeType: "exercise", ReviewType: "explicit", ReviewTime: start.Add(2 * time.Hour)},
+		{UserID: 1, NodeID: def.ID, NodeType: "definition", ReviewType: "explicit", ReviewTime: start},
+		{UserID: 1, NodeID: def.ID, NodeType: "definition", ReviewType: "implicit", ReviewTime: start.Add(time.Hour)},
+		{UserID: 1, NodeID: other.ID, NodeType: "definition", ReviewType: "explicit", ReviewTime: start},
+		{UserID: 2, NodeID: def.ID, NodeType: "definition", ReviewType: "explicit", ReviewTime: start},
+		{UserID: 1, NodeID: otherEx.ID, NodeType: "exercise", ReviewType: "explicit", ReviewTime: start},
+	}
+	for _, review := range reviews {
+		if err := db.Create(review).Error; err != nil {
+			t.Fatalf("Failed to create review: %v", err)
+		}
+	}
+
+	history, err := srsDao.GetDomainExplicitReviews(1, 1)
+	if err != nil {
+		t.Fatalf("Failed to get reviews: %v", err)
+	}
+	if len(history) != 2 || history[0].ID != reviews[1].ID || history[1].ID != reviews[0].ID {
+		t.Errorf("reviews = %+v, want the explicit reviews of D1 and E1 in order", history)
+	}
+}
@@ -134,6 +134,17 @@ func (d *UserDAO) UpdateUser(user *models.User) error {
 	return d.db.Save(user).Error
 }
 
+// UpdateSchedulerPreferences sets a user's scheduler algorithm and desired
+// retention; an empty algorithm and a nil retention inherit the domain's
+func (d *UserDAO) UpdateSchedulerPreferences(userID uint, algorithm string, retention *float64) error {
+	return d.db.Model(&models.User{}).Where("id = ?", userID).
+		Select("scheduler_algorithm", "desired_retention").
+		Updates(map[string]interface{}{
+			"scheduler_algorithm": algorithm,
+			"desired_retention":   retention,
+		}).Error
+}
+
 // CreateAdminUser creates an admin user if one doesn't exist with the same email
 func (d *UserDAO) CreateAdminUser(adminUser *models.User) error {
 	// Check if an admin already exists
@@ -78,3 +78,26 @@ func TestGetAllUsers(t *testing.T) {
 
 }
 
+
+func TestUpdateSchedulerPreferencesClears(t *testing.T) {
+	db := setupSRSTestDB(t)
+	userDAO := NewUserDAO(db)
+
+	retention := 0.85
+	user := models.User{Username: "sched", Email: "sched@example.com", Level: "user", SchedulerAlgorithm: "fsrs", DesiredRetention: &retention}
+	if err := userDAO.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Clearing both settings makes the user inherit the domain's again
+	if err := userDAO.UpdateSchedulerPreferences(user.ID, "", nil); err != nil {
+		t.Fatalf("Failed to clear scheduler preferences: %v", err)
+	}
+	found, err := userDAO.FindUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to find user: %v", err)
+	}
+	if found.SchedulerAlgorithm != "" || found.DesiredRetention != nil {
+		t.Errorf("Preferences = %q, %v, want both cleared", found.SchedulerAlgorithm, found.DesiredRetention)
+	}
+}
@@ -0,0 +1,166 @@
+// Package graph holds algorithms on prerequisite graphs. Nodes are plain
+// string keys (node keys or codes), so the algorithms do not depend on how
+// the graph is stored.
+package graph
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ErrCycle is matched (errors.Is) by every CycleError
+var ErrCycle = errors.New("prerequisite cycle")
+
+// CycleError reports a change that would make prerequisites circular. Cycle
+// starts and ends with the same node, e.g. [A B C A] for A requires B
+// requires C requires A.
+type CycleError struct {
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return "prerequisite cycle: " + strings.Join(e.Cycle, " -> ")
+}
+
+// Is makes errors.Is(err, ErrCycle) true for cycle errors
+func (e *CycleError) Is(target error) bool {
+	return target == ErrCycle
+}
+
+// Edges maps each node to the nodes it requires
+type Edges map[string][]string
+
+// Add adds the edge node -> prerequisite
+func (e Edges) Add(node string, prerequisite string) {
+	e[node] = append(e[node], prerequisite)
+}
+
+// sorted returns the prerequisites of a node in a fixed order, so that the
+// cycle reported does not depend on how the edges were loaded
+func (e Edges) sorted(node string) []string {
+	next := append([]string{}, e[node]...)
+	sort.Strings(next)
+	return next
+}
+
+// FindCycleThrough returns the shortest cycle that runs through start,
+// following prerequisite edges, or nil if there is none. Prerequisites are
+// visited in sorted order, so ties always give the same cycle.
+func FindCycleThrough(edges Edges, start string) []string {
+	parent := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, next := range edges.sorted(node) {
+			if next == start {
+				cycle := []string{start}
+				for n := node; n != start; n = parent[n] {
+					cycle = append(cycle, n)
+				}
+				cycle = append(cycle, start)
+				// The walk back listed the cycle reversed
+				for i, j := 1, len(cycle)-2; i < j; i, j = i+1, j-1 {
+					cycle[i], cycle[j] = cycle[j], cycle[i]
+				}
+				return cycle
+			}
+			if _, seen := parent[next]; !seen {
+				parent[next] = node
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// FindCycles returns one cycle per group of nodes that require each other
+// (strongly connected component), starting from the smallest node of the
+// group. An acyclic graph gives nil.
+func FindCycles(edges Edges) [][]string {
+	var cycles [][]string
+	for _, component := range stronglyConnected(edges) {
+		start := component[0]
+		if len(component) == 1 && !requiresItself(edges, start) {
+			continue
+		}
+		cycles = append(cycles, FindCycleThrough(edges, start))
+	}
+	return cycles
+}
+
+func requiresItself(edges Edges, node string) bool {
+	for _, next := range edges[node] {
+		if next == node {
+			return true
+		}
+	}
+	return false
+}
+
+// stronglyConnected returns the strongly connected components of the graph
+// (Tarjan), each sorted, ordered by their smallest node
+func stronglyConnected(edges Edges) [][]string {
+	nodeSet := map[string]bool{}
+	for node, prerequisites := range edges {
+		nodeSet[node] = true
+		for _, p := range prerequisites {
+			nodeSet[p] = true
+		}
+	}
+	nodes := make([]string, 0, len(nodeSet))
+	for node := range nodeSet {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var components [][]string
+
+	var visit func(node string)
+	visit = func(node string) {
+		index[node] = len(index)
+		low[node] = index[node]
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, next := range edges.sorted(node) {
+			if _, seen := index[next]; !seen {
+				visit(next)
+				low[node] = min(low[node], low[next])
+			} else if onStack[next] {
+				low[node] = min(low[node], index[next])
+			}
+		}
+
+		if low[node] == index[node] {
+			var component []string
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == node {
+					break
+				}
+			}
+			sort.Strings(component)
+			components = append(components, component)
+		}
+	}
+
+	for _, node := range nodes {
+		if _, seen := index[node]; !seen {
+			visit(node)
+		}
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0] < components[j][0]
+	})
+	return components
+}
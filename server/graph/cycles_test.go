@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func edgesOf(pairs ...string) Edges {
+	edges := Edges{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		edges.Add(pairs[i], pairs[i+1])
+	}
+	return edges
+}
+
+func TestFindCycleThrough(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges Edges
+		start string
+		want  []string
+	}{
+		{
+			name:  "acyclic",
+			edges: edgesOf("A", "B", "B", "C", "A", "C"),
+			start: "A",
+			want:  nil,
+		},
+		{
+			name:  "self loop",
+			edges: edgesOf("A", "A"),
+			start: "A",
+			want:  []string{"A", "A"},
+		},
+		{
+			name:  "triangle",
+			edges: edgesOf("A", "B", "B", "C", "C", "A"),
+			start: "B",
+			want:  []string{"B", "C", "A", "B"},
+		},
+		{
+			name:  "shortest of two cycles",
+			edges: edgesOf("A", "B", "B", "C", "C", "D", "D", "A", "B", "A"),
+			start: "A",
+			want:  []string{"A", "B", "A"},
+		},
+		{
+			name:  "cycle elsewhere is not through start",
+			edges: edgesOf("A", "B", "B", "C", "C", "B"),
+			start: "A",
+			want:  nil,
+		},
+		{
+			name:  "ties go to the smaller prerequisite",
+			edges: edgesOf("A", "Y", "A", "X", "X", "A", "Y", "A"),
+			start: "A",
+			want:  []string{"A", "X", "A"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindCycleThrough(tt.edges, tt.start); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindCycleThrough() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindCycles(t *testing.T) {
+	edges := edgesOf(
+		"A", "B", "B", "A", // cycle
+		"C", "A", // leads into the cycle, not part of it
+		"D", "E", "E", "F", "F", "D", // second cycle
+		"G", "G", // self loop
+		"H", "I", // acyclic
+	)
+
+	want := [][]string{{"A", "B", "A"}, {"D", "E", "F", "D"}, {"G", "G"}}
+	if got := FindCycles(edges); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindCycles() = %v, want %v", got, want)
+	}
+
+	if got := FindCycles(edgesOf("A", "B", "B", "C")); got != nil {
+		t.Errorf("FindCycles() on an acyclic graph = %v, want nil", got)
+	}
+}
+
+func TestCycleError(t *testing.T) {
+	err := fmt.Errorf("update failed: %w", &CycleError{Cycle: []string{"A", "B", "A"}})
+	if !errors.Is(err, ErrCycle) {
+		t.Errorf("errors.Is(%v, ErrCycle) = false", err)
+	}
+	if want := "update failed: prerequisite cycle: A -> B -> A"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
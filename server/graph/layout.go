@@ -0,0 +1,337 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Point is a position on the graph canvas
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// LayoutOptions configures Layout
+type LayoutOptions struct {
+	NodeSpacing  float64          // horizontal distance between nodes of a layer
+	LayerSpacing float64          // vertical distance between layers
+	Fixed        map[string]Point // nodes that keep their position
+}
+
+// Default spacing of Layout, in canvas units
+const (
+	DefaultNodeSpacing  = 200.0
+	DefaultLayerSpacing = 150.0
+)
+
+// layoutSweeps is the number of ordering and positioning passes
+const layoutSweeps = 8
+
+// layeredGraph is the graph Layout works on: every edge spans exactly one
+// layer, longer edges go through dummy nodes
+type layeredGraph struct {
+	layers [][]string
+	layer  map[string]int
+	up     map[string][]string // neighbours in the layer above (prerequisites)
+	down   map[string][]string // neighbours in the layer below (dependents)
+	dummy  map[string]bool
+}
+
+// Layout places the nodes of a DAG in layers, Sugiyama style: every node
+// sits one layer below its deepest prerequisite, so prerequisites are above
+// their dependents (y grows downwards). The order within layers is chosen
+// to reduce edge crossings (barycenter heuristic), then nodes are pulled
+// towards the nodes they are connected to. The first layer is at y =
+// LayerSpacing and, without fixed nodes, the leftmost node at x =
+// NodeSpacing, so that no node lands on (0,0), which callers take as
+// unplaced. Fixed nodes keep their position and the other nodes are moved
+// aside so they do not overlap them; a fixed node is not moved to the y of
+// its layer, so if its layer changed it may sit level with or above its
+// prerequisites. The result only depends on the node keys, not on the
+// order of nodes or edges.
+func Layout(nodes []string, edges Edges, opts LayoutOptions) (map[string]Point, error) {
+	if opts.NodeSpacing <= 0 {
+		opts.NodeSpacing = DefaultNodeSpacing
+	}
+	if opts.LayerSpacing <= 0 {
+		opts.LayerSpacing = DefaultLayerSpacing
+	}
+
+	g, err := buildLayers(nodes, edges)
+	if err != nil {
+		return nil, err
+	}
+	g.orderLayers()
+	x := g.positionLayers(opts)
+
+	positions := make(map[string]Point, len(nodes))
+	minX := math.Inf(1)
+	for node, l := range g.layer {
+		if g.dummy[node] {
+			continue
+		}
+		positions[node] = Point{X: math.Round(x[node]), Y: float64(l+1) * opts.LayerSpacing}
+		minX = math.Min(minX, positions[node].X)
+	}
+
+	// Start at x = NodeSpacing unless fixed nodes give the frame
+	if len(opts.Fixed) == 0 {
+		for node, p := range positions {
+			positions[node] = Point{X: p.X - minX + opts.NodeSpacing, Y: p.Y}
+		}
+		return positions, nil
+	}
+
+	avoidFixed(g, positions, opts)
+	return positions, nil
+}
+
+// buildLayers assigns each node its layer (longest path from a node without
+// prerequisites) and splits long edges with dummy nodes
+func buildLayers(nodes []string, edges Edges) (*layeredGraph, error) {
+	nodeSet := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		nodeSet[node] = true
+	}
+	sorted := make([]string, 0, len(nodeSet))
+	for node := range nodeSet {
+		sorted = append(sorted, node)
+	}
+	sort.Strings(sorted)
+
+	// Edges between known nodes, without duplicates
+	prerequisites := make(map[string][]string)
+	dependents := make(map[string][]string)
+	for _, node := range sorted {
+		seen := map[string]bool{}
+		for _, p := range edges.sorted(node) {
+			if nodeSet[p] && !seen[p] {
+				seen[p] = true
+				prerequisites[node] = append(prerequisites[node], p)
+				dependents[p] = append(dependents[p], node)
+			}
+		}
+	}
+
+	g := &layeredGraph{
+		layer: make(map[string]int, len(sorted)),
+		up:    make(map[string][]string),
+		down:  make(map[string][]string),
+		dummy: make(map[string]bool),
+	}
+
+	remaining := make(map[string]int, len(sorted))
+	var ready []string
+	for _, node := range sorted {
+		remaining[node] = len(prerequisites[node])
+		if remaining[node] == 0 {
+			ready = append(ready, node)
+		}
+	}
+	placed := 0
+	for len(ready) > 0 {
+		node := ready[0]
+		ready = ready[1:]
+		placed++
+		g.layer[node] = 0
+		for _, p := range prerequisites[node] {
+			g.layer[node] = max(g.layer[node], g.layer[p]+1)
+		}
+		for _, d := range dependents[node] {
+			remaining[d]--
+			if remaining[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	if placed < len(sorted) {
+		sub := Edges{}
+		for _, node := range sorted {
+			if remaining[node] > 0 {
+				sub[node] = prerequisites[node]
+			}
+		}
+		return nil, &CycleError{Cycle: FindCycles(sub)[0]}
+	}
+
+	depth := 0
+	for _, node := range sorted {
+		depth = max(depth, g.layer[node]+1)
+	}
+	g.layers = make([][]string, depth)
+	for _, node := range sorted {
+		g.layers[g.layer[node]] = append(g.layers[g.layer[node]], node)
+	}
+
+	dummies := 0
+	for _, node := range sorted {
+		for _, p := range prerequisites[node] {
+			prev := p
+			for l := g.layer[p] + 1; l < g.layer[node]; l++ {
+				d := fmt.Sprintf("\x00dummy%d", dummies)
+				dummies++
+				g.dummy[d] = true
+				g.layer[d] = l
+				g.layers[l] = append(g.layers[l], d)
+				g.connect(prev, d)
+				prev = d
+			}
+			g.connect(prev, node)
+		}
+	}
+
+	return g, nil
+}
+
+func (g *layeredGraph) connect(upper string, lower string) {
+	g.down[upper] = append(g.down[upper], lower)
+	g.up[lower] = append(g.up[lower], upper)
+}
+
+// orderLayers reduces crossings by sorting each layer by the barycenter of
+// its neighbours' positions, sweeping down and up
+func (g *layeredGraph) orderLayers() {
+	index := make(map[string]float64)
+	for _, layer := range g.layers {
+		for i, node := range layer {
+			index[node] = float64(i)
+		}
+	}
+
+	for sweep := 0; sweep < layoutSweeps; sweep++ {
+		if sweep%2 == 0 {
+			for l := 1; l < len(g.layers); l++ {
+				g.sortLayer(l, g.up, index)
+			}
+		} else {
+			for l := len(g.layers) - 2; l >= 0; l-- {
+				g.sortLayer(l, g.down, index)
+			}
+		}
+	}
+}
+
+func (g *layeredGraph) sortLayer(l int, neighbours map[string][]string, index map[string]float64) {
+	layer := g.layers[l]
+	center := make(map[string]float64, len(layer))
+	for _, node := range layer {
+		center[node] = barycenter(neighbours[node], index, index[node])
+	}
+	sort.SliceStable(layer, func(i, j int) bool {
+		return center[layer[i]] < center[layer[j]]
+	})
+	for i, node := range layer {
+		index[node] = float64(i)
+	}
+}
+
+// barycenter is the mean value of the neighbours, or fallback without any
+func barycenter(neighbours []string, value map[string]float64, fallback float64) float64 {
+	if len(neighbours) == 0 {
+		return fallback
+	}
+	sum := 0.0
+	for _, n := range neighbours {
+		sum += value[n]
+	}
+	return sum / float64(len(neighbours))
+}
+
+// positionLayers computes x coordinates: nodes start evenly spaced, then
+// each pass moves every node towards the mean x of its neighbours in the
+// previous layer while keeping the layer order and spacing. Fixed nodes
+// pull their neighbours towards their fixed x.
+func (g *layeredGraph) positionLayers(opts LayoutOptions) map[string]float64 {
+	x := make(map[string]float64)
+	for _, layer := range g.layers {
+		for i, node := range layer {
+			x[node] = (float64(i) - float64(len(layer)-1)/2) * opts.NodeSpacing
+		}
+	}
+
+	for pass := 0; pass < layoutSweeps; pass++ {
+		if pass%2 == 0 {
+			for l := 1; l < len(g.layers); l++ {
+				g.alignLayer(l, g.up, x, opts)
+			}
+		} else {
+			for l := len(g.layers) - 2; l >= 0; l-- {
+				g.alignLayer(l, g.down, x, opts)
+			}
+		}
+	}
+	return x
+}
+
+func (g *layeredGraph) alignLayer(l int, neighbours map[string][]string, x map[string]float64, opts LayoutOptions) {
+	layer := g.layers[l]
+	if len(layer) == 0 {
+		return
+	}
+
+	desired := make([]float64, len(layer))
+	for i, node := range layer {
+		if p, fixed := opts.Fixed[node]; fixed {
+			desired[i] = p.X
+		} else {
+			desired[i] = barycenter(neighbours[node], x, x[node])
+		}
+	}
+
+	// Keep the order and spacing, then shift the layer so that nodes are on
+	// average where they want to be
+	placed := make([]float64, len(layer))
+	shift := 0.0
+	for i := range layer {
+		placed[i] = desired[i]
+		if i > 0 {
+			placed[i] = math.Max(desired[i], placed[i-1]+opts.NodeSpacing)
+		}
+		shift += placed[i] - desired[i]
+	}
+	shift /= float64(len(layer))
+	for i, node := range layer {
+		x[node] = placed[i] - shift
+	}
+}
+
+// avoidFixed gives fixed nodes their position and moves free nodes right,
+// together with the rest of their layer, until they do not overlap one
+func avoidFixed(g *layeredGraph, positions map[string]Point, opts LayoutOptions) {
+	var fixed []Point
+	for node, p := range opts.Fixed {
+		if _, ok := positions[node]; ok {
+			positions[node] = p
+			fixed = append(fixed, p)
+		}
+	}
+
+	overlaps := func(p Point) bool {
+		for _, f := range fixed {
+			if math.Abs(f.X-p.X) < opts.NodeSpacing/2 && math.Abs(f.Y-p.Y) < opts.LayerSpacing/2 {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, layer := range g.layers {
+		offset := 0.0
+		for _, node := range layer {
+			if g.dummy[node] {
+				continue
+			}
+			if _, isFixed := opts.Fixed[node]; isFixed {
+				continue
+			}
+			p := positions[node]
+			p.X += offset
+			for overlaps(p) {
+				p.X += opts.NodeSpacing / 2
+			}
+			offset = p.X - positions[node].X
+			positions[node] = p
+		}
+	}
+}
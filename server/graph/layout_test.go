@@ -0,0 +1,172 @@
+package graph
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// layoutGraph: B and C require A, D requires B and C, E requires A and D
+// (a long edge), F is isolated
+func layoutGraph() ([]string, Edges) {
+	nodes := []string{"A", "B", "C", "D", "E", "F"}
+	edges := edgesOf("B", "A", "C", "A", "D", "B", "D", "C", "E", "A", "E", "D")
+	return nodes, edges
+}
+
+func checkLayout(t *testing.T, nodes []string, edges Edges, positions map[string]Point, opts LayoutOptions) {
+	t.Helper()
+	if len(positions) != len(nodes) {
+		t.Fatalf("got %d positions, want %d", len(positions), len(nodes))
+	}
+	for node, prerequisites := range edges {
+		for _, p := range prerequisites {
+			if positions[p].Y >= positions[node].Y {
+				t.Errorf("prerequisite %s (y=%.0f) is not above %s (y=%.0f)", p, positions[p].Y, node, positions[node].Y)
+			}
+		}
+	}
+	for i, a := range nodes {
+		for _, b := range nodes[i+1:] {
+			pa, pb := positions[a], positions[b]
+			if math.Abs(pa.X-pb.X) < opts.NodeSpacing/2 && math.Abs(pa.Y-pb.Y) < opts.LayerSpacing/2 {
+				t.Errorf("%s %v and %s %v overlap", a, pa, b, pb)
+			}
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	nodes, edges := layoutGraph()
+	opts := LayoutOptions{NodeSpacing: 100, LayerSpacing: 50}
+	positions, err := Layout(nodes, edges, opts)
+	if err != nil {
+		t.Fatalf("Layout() error = %v", err)
+	}
+	checkLayout(t, nodes, edges, positions, opts)
+
+	wantY := map[string]float64{"A": 50, "F": 50, "B": 100, "C": 100, "D": 150, "E": 200}
+	for node, y := range wantY {
+		if positions[node].Y != y {
+			t.Errorf("y of %s = %.0f, want %.0f", node, positions[node].Y, y)
+		}
+	}
+
+	minX := math.Inf(1)
+	for _, p := range positions {
+		minX = math.Min(minX, p.X)
+	}
+	if minX != opts.NodeSpacing {
+		t.Errorf("layout starts at x = %.0f, want the node spacing", minX)
+	}
+}
+
+func TestLayoutChainIsStraight(t *testing.T) {
+	positions, err := Layout([]string{"A", "B", "C"}, edgesOf("B", "A", "C", "B"), LayoutOptions{})
+	if err != nil {
+		t.Fatalf("Layout() error = %v", err)
+	}
+	if positions["A"].X != positions["B"].X || positions["B"].X != positions["C"].X {
+		t.Errorf("chain is not vertical: %v", positions)
+	}
+	if positions["B"].Y != 2*DefaultLayerSpacing {
+		t.Errorf("y of B = %.0f, want the second layer at twice the default layer spacing", positions["B"].Y)
+	}
+}
+
+func TestLayoutAvoidsCrossings(t *testing.T) {
+	// X requires B and Y requires A: X must end up on B's side
+	positions, err := Layout([]string{"A", "B", "X", "Y"}, edgesOf("X", "B", "Y", "A"), LayoutOptions{})
+	if err != nil {
+		t.Fatalf("Layout() error = %v", err)
+	}
+	if (positions["A"].X < positions["B"].X) != (positions["Y"].X < positions["X"].X) {
+		t.Errorf("edges cross: %v", positions)
+	}
+}
+
+func TestLayoutIsDeterministic(t *testing.T) {
+	nodes, edges := layoutGraph()
+	want, err := Layout(nodes, edges, LayoutOptions{})
+	if err != nil {
+		t.Fatalf("Layout() error = %v", err)
+	}
+
+	reversed := Edges{}
+	for node, prerequisites := range edges {
+		for i := len(prerequisites) - 1; i >= 0; i-- {
+			reversed.Add(node, prerequisites[i])
+		}
+	}
+	got, err := Layout([]string{"F", "E", "D", "C", "B", "A", "A"}, reversed, LayoutOptions{})
+	if err != nil {
+		t.Fatalf("Layout() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Layout() = %v, want %v", got, want)
+	}
+}
+
+func TestLayoutKeepsFixedNodes(t *testing.T) {
+	nodes, edges := layoutGraph()
+	opts := LayoutOptions{
+		NodeSpacing:  100,
+		LayerSpacing: 50,
+		// B sits where the free layout would put other nodes
+		Fixed: map[string]Point{"B": {X: 0, Y: 100}, "E": {X: 400, Y: 0}},
+	}
+	positions, err := Layout(nodes, edges, opts)
+	if err != nil {
+		t.Fatalf("Layout() error = %v", err)
+	}
+	for node, p := range opts.Fixed {
+		if positions[node] != p {
+			t.Errorf("fixed node %s moved to %v, want %v", node, positions[node], p)
+		}
+	}
+
+	// E is fixed above its prerequisites and keeps that position rather
+	// than the y of its layer, so only check the free nodes
+	free := Edges{}
+	for node, prerequisites := range edges {
+		if node != "E" {
+			free[node] = prerequisites
+		}
+	}
+	checkLayout(t, nodes, free, positions, opts)
+	checkPlaced(t, positions)
+}
+
+// checkPlaced fails if a node is at (0,0), which means unplaced
+func checkPlaced(t *testing.T, positions map[string]Point) {
+	t.Helper()
+	for node, p := range positions {
+		if p == (Point{}) {
+			t.Errorf("%s is at (0,0)", node)
+		}
+	}
+}
+
+func TestLayoutLeavesOrigin(t *testing.T) {
+	nodes, edges := layoutGraph()
+	positions, err := Layout(nodes, edges, LayoutOptions{})
+	if err != nil {
+		t.Fatalf("Layout() error = %v", err)
+	}
+	checkPlaced(t, positions)
+
+	// A fixed node far right leaves the free nodes around x = 0
+	positions, err = Layout(nodes, edges, LayoutOptions{Fixed: map[string]Point{"F": {X: 1000, Y: 600}}})
+	if err != nil {
+		t.Fatalf("Layout() error = %v", err)
+	}
+	checkPlaced(t, positions)
+}
+
+func TestLayoutCycle(t *testing.T) {
+	_, err := Layout([]string{"A", "B", "C"}, edgesOf("A", "B", "B", "A", "C", "A"), LayoutOptions{})
+	if !errors.Is(err, ErrCycle) {
+		t.Errorf("Layout() error = %v, want a cycle error", err)
+	}
+}
@@ -0,0 +1,85 @@
+package graph
+
+import "sort"
+
+// Prerequisites returns the target and all of its transitive prerequisites
+// in topological order: every node comes after the nodes it requires, and
+// the target comes last. Nodes that could go in either order are sorted by
+// key. A cycle among them gives a *CycleError.
+func Prerequisites(edges Edges, target string) ([]string, error) {
+	// Collect the target's ancestors
+	needed := map[string]bool{target: true}
+	stack := []string{target}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, p := range edges[node] {
+			if !needed[p] {
+				needed[p] = true
+				stack = append(stack, p)
+			}
+		}
+	}
+
+	nodes := make([]string, 0, len(needed))
+	for node := range needed {
+		nodes = append(nodes, node)
+	}
+	return Order(edges, nodes)
+}
+
+// Order sorts nodes in topological order: every node comes after the nodes
+// it requires. Edges to nodes outside the list are ignored, and nodes that
+// could go in either order are sorted by key. A cycle among the nodes gives
+// a *CycleError.
+func Order(edges Edges, nodes []string) ([]string, error) {
+	needed := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		needed[node] = true
+	}
+
+	// Kahn's algorithm: a node is ready once all its prerequisites are placed
+	remaining := make(map[string]int, len(needed))
+	dependents := make(map[string][]string)
+	var ready []string
+	for node := range needed {
+		seen := map[string]bool{}
+		for _, p := range edges[node] {
+			if needed[p] && !seen[p] {
+				seen[p] = true
+				remaining[node]++
+				dependents[p] = append(dependents[p], node)
+			}
+		}
+		if remaining[node] == 0 {
+			ready = append(ready, node)
+		}
+	}
+
+	order := make([]string, 0, len(needed))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		node := ready[0]
+		ready = ready[1:]
+		order = append(order, node)
+		for _, d := range dependents[node] {
+			remaining[d]--
+			if remaining[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	if len(order) < len(needed) {
+		sub := Edges{}
+		for node := range needed {
+			for _, p := range edges[node] {
+				if needed[p] {
+					sub.Add(node, p)
+				}
+			}
+		}
+		return nil, &CycleError{Cycle: FindCycles(sub)[0]}
+	}
+	return order, nil
+}
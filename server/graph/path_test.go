@@ -0,0 +1,72 @@
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPrerequisites(t *testing.T) {
+	// T requires B and C, both require A; D is unrelated; C also requires E
+	edges := edgesOf("T", "B", "T", "C", "B", "A", "C", "A", "C", "E", "D", "A")
+
+	tests := []struct {
+		name   string
+		target string
+		want   []string
+	}{
+		{name: "diamond", target: "T", want: []string{"A", "B", "E", "C", "T"}},
+		{name: "inner node", target: "C", want: []string{"A", "E", "C"}},
+		{name: "no prerequisites", target: "A", want: []string{"A"}},
+		{name: "unknown node", target: "Z", want: []string{"Z"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Prerequisites(edges, tt.target)
+			if err != nil {
+				t.Fatalf("Prerequisites() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Prerequisites() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrerequisitesDuplicateEdges(t *testing.T) {
+	got, err := Prerequisites(edgesOf("B", "A", "B", "A"), "B")
+	if err != nil {
+		t.Fatalf("Prerequisites() error = %v", err)
+	}
+	if want := []string{"A", "B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Prerequisites() = %v, want %v", got, want)
+	}
+}
+
+func TestPrerequisitesCycle(t *testing.T) {
+	_, err := Prerequisites(edgesOf("T", "A", "A", "B", "B", "A"), "T")
+	var cycleErr *CycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("Prerequisites() error = %v, want a cycle error", err)
+	}
+	if want := []string{"A", "B", "A"}; !reflect.DeepEqual(cycleErr.Cycle, want) {
+		t.Errorf("cycle = %v, want %v", cycleErr.Cycle, want)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	// C requires B, B requires A and X, which is not in the list
+	got, err := Order(edgesOf("C", "B", "B", "A", "B", "X"), []string{"C", "D", "B", "A"})
+	if err != nil {
+		t.Fatalf("Order() error = %v", err)
+	}
+	if want := []string{"A", "B", "C", "D"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Order() = %v, want %v", got, want)
+	}
+
+	var cycleErr *CycleError
+	if _, err := Order(edgesOf("A", "B", "B", "A"), []string{"A", "B"}); !errors.As(err, &cycleErr) {
+		t.Errorf("Order() error = %v, want a cycle error", err)
+	}
+}
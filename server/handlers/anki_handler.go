@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"myapp/server/anki"
+	"myapp/server/dao"
+	"myapp/server/services"
+)
+
+// AnkiHandler handles Anki package imports and exports
+type AnkiHandler struct {
+	importService *services.AnkiImportService
+	exportService *services.AnkiExportService
+	domainDAO     *dao.DomainDAO
+}
+
+// NewAnkiHandler creates a new AnkiHandler
+func NewAnkiHandler(db *gorm.DB) *AnkiHandler {
+	return &AnkiHandler{
+		importService: services.NewAnkiImportService(db),
+		exportService: services.NewAnkiExportService(db),
+		domainDAO:     dao.NewDomainDAO(db),
+	}
+}
+
+// ImportPackage creates a domain from an uploaded Anki .apkg file
+func (h *AnkiHandler) ImportPackage(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An .apkg file is required in the file field"})
+		return
+	}
+
+	opts := services.AnkiImportOptions{
+		DomainName:    strings.TrimSpace(c.PostForm("name")),
+		Description:   c.PostForm("description"),
+		Privacy:       c.DefaultPostForm("privacy", "private"),
+		ImportReviews: c.PostForm("reviews") == "true",
+		Difficulty:    services.DefaultAnkiDifficulty,
+	}
+	if opts.DomainName == "" {
+		opts.DomainName = strings.TrimSuffix(filepath.Base(fileHeader.Filename), filepath.Ext(fileHeader.Filename))
+	}
+	if opts.Privacy != "public" && opts.Privacy != "private" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Privacy must be public or private"})
+		return
+	}
+	if difficultyStr := c.PostForm("difficulty"); difficultyStr != "" {
+		difficulty, err := strconv.Atoi(difficultyStr)
+		if err != nil || difficulty < 1 || difficulty > 7 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Difficulty must be between 1 and 7"})
+			return
+		}
+		opts.Difficulty = difficulty
+	}
+	for _, names := range c.PostFormArray("exerciseNoteTypes") {
+		for _, name := range strings.Split(names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.ExerciseNoteTypes = append(opts.ExerciseNoteTypes, name)
+			}
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	pkg, err := anki.Read(file, fileHeader.Size)
+	if err != nil {
+		if errors.Is(err, anki.ErrUnsupportedPackage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, anki.ErrPackageTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the Anki package"})
+		return
+	}
+
+	result, err := h.importService.Import(pkg, userID.(uint), opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import the Anki package"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// ExportPackage exports a domain as an Anki .apkg file, with ?schedule=true
+// including the user's scheduling state
+func (h *AnkiHandler) ExportPackage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	// Check access to the domain
+	domain, err := h.domainDAO.FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if domain.Privacy != "public" {
+		if !exists || userID.(uint) != domain.OwnerID {
+			isAdmin, adminExists := c.Get("isAdmin")
+			if !adminExists || !isAdmin.(bool) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You don't have access to this domain"})
+				return
+			}
+		}
+	}
+
+	schedule := c.Query("schedule") == "true"
+	if schedule && !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+	var uid uint
+	if exists {
+		uid = userID.(uint)
+	}
+
+	pkg, err := h.exportService.Export(uint(id), uid, schedule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export domain"})
+		return
+	}
+	var buf bytes.Buffer
+	if err := anki.Write(&buf, pkg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write the Anki package"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", packageFileName(domain.Name)))
+	c.Data(http.StatusOK, "application/octet-stream", buf.Bytes())
+}
+
+// packageFileName names the .apkg file of a domain, keeping only letters,
+// digits, dashes and underscores of its name
+func packageFileName(name string) string {
+	fileName := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return '_'
+		}
+		return -1
+	}, name)
+	if fileName == "" {
+		fileName = "domain"
+	}
+	return fileName + ".apkg"
+}
+
+// RegisterRoutes registers the Anki routes
+func (h *AnkiHandler) RegisterRoutes(router *gin.RouterGroup) {
+	domains := router.Group("/domains")
+	{
+		domains.POST("/import/apkg", h.ImportPackage)
+		domains.GET("/:id/export/apkg", h.ExportPackage)
+	}
+}
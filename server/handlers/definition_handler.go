@@ -3,11 +3,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"myapp/server/dao"
+	"myapp/server/graph"
 	"myapp/server/models"
 )
 
@@ -112,6 +114,10 @@ func (h *DefinitionHandler) CreateDefinition(c *gin.Context) {
 	}
 
 	if err := h.definitionDAO.Create(definition, req.References, req.PrerequisiteIDs); err != nil {
+		if errors.Is(err, dao.ErrPrerequisiteNotReadable) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create definition"})
 		return
 	}
@@ -216,6 +222,14 @@ func (h *DefinitionHandler) UpdateDefinition(c *gin.Context) {
 
 	// Update definition
 	if err := h.definitionDAO.Update(definition, req.References, req.PrerequisiteIDs); err != nil {
+		if errors.Is(err, dao.ErrPrerequisiteNotReadable) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, graph.ErrCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update definition"})
 		return
 	}
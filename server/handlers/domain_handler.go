@@ -7,6 +7,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"myapp/server/dao"
 	"myapp/server/models"
+	"myapp/server/scheduler"
+	"myapp/server/services"
 )
 
 // DomainHandler handles domain-related HTTP requests
@@ -187,6 +189,20 @@ func (h *DomainHandler) UpdateDomain(c *gin.Context) {
 		Name        string `json:"name"`
 		Privacy     string `json:"privacy"`
 		Description string `json:"description"`
+		SchedulerAlgorithm string `json:"schedulerAlgorithm"`
+		DesiredRetention *float64 `json:"desiredRetention"`
+		LeechThreshold *int `json:"leechThreshold"`
+		LeechAction string `json:"leechAction"`
+		GraduationInterval *float64 `json:"graduationInterval"`
+		GraduationSuccessRate *float64 `json:"graduationSuccessRate"`
+		CreditDecay string `json:"creditDecay"`
+		CreditThreshold *float64 `json:"creditThreshold"`
+		CreditMaxDepth *int `json:"creditMaxDepth"`
+		CreditSuccessMultiplier *float64 `json:"creditSuccessMultiplier"`
+		CreditFailureMultiplier *float64 `json:"creditFailureMultiplier"`
+		CreditQualityScale []float64 `json:"creditQualityScale"`
+		CreditTargetTime *int `json:"creditTargetTime"`
+		CreditMinTimeFactor *float64 `json:"creditMinTimeFactor"`
 	}
 
 	if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -194,6 +210,31 @@ func (h *DomainHandler) UpdateDomain(c *gin.Context) {
 		return
 	}
 
+	if updateData.SchedulerAlgorithm != "" && !scheduler.IsValidAlgorithm(updateData.SchedulerAlgorithm) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduler algorithm. Must be 'sm2' or 'fsrs'"})
+		return
+	}
+	if updateData.DesiredRetention != nil && !scheduler.IsValidRetention(*updateData.DesiredRetention) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Desired retention must be between 0.7 and 0.99"})
+		return
+	}
+	if updateData.LeechThreshold != nil && *updateData.LeechThreshold < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leech threshold must be 0 (disabled) or positive"})
+		return
+	}
+	if updateData.LeechAction != "" && !scheduler.IsValidLeechAction(updateData.LeechAction) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid leech action. Must be 'tag' or 'suspend'"})
+		return
+	}
+	if updateData.GraduationInterval != nil && *updateData.GraduationInterval < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Graduation interval must be 0 (disabled) or positive"})
+		return
+	}
+	if updateData.GraduationSuccessRate != nil && !scheduler.IsValidSuccessRate(*updateData.GraduationSuccessRate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Graduation success rate must be between 0 and 1"})
+		return
+	}
+
 	// Update fields if provided
 	if updateData.Name != "" {
 		domain.Name = updateData.Name
@@ -204,6 +245,63 @@ func (h *DomainHandler) UpdateDomain(c *gin.Context) {
 	if updateData.Description != "" {
 		domain.Description = updateData.Description
 	}
+	if updateData.SchedulerAlgorithm != "" {
+		domain.SchedulerAlgorithm = updateData.SchedulerAlgorithm
+	}
+	if updateData.DesiredRetention != nil {
+		domain.DesiredRetention = *updateData.DesiredRetention
+	}
+	if updateData.LeechThreshold != nil {
+		domain.LeechThreshold = *updateData.LeechThreshold
+	}
+	if updateData.LeechAction != "" {
+		domain.LeechAction = updateData.LeechAction
+	}
+	if updateData.GraduationInterval != nil {
+		domain.GraduationInterval = *updateData.GraduationInterval
+	}
+	if updateData.GraduationSuccessRate != nil {
+		domain.GraduationSuccessRate = *updateData.GraduationSuccessRate
+	}
+
+	// Credit propagation settings are validated together
+	propagation := services.PropagationSettingsFromDomain(domain)
+	if updateData.CreditDecay != "" {
+		propagation.Decay = updateData.CreditDecay
+	}
+	if updateData.CreditThreshold != nil {
+		propagation.Threshold = *updateData.CreditThreshold
+	}
+	if updateData.CreditMaxDepth != nil {
+		propagation.MaxDepth = *updateData.CreditMaxDepth
+	}
+	if updateData.CreditSuccessMultiplier != nil {
+		propagation.SuccessMultiplier = *updateData.CreditSuccessMultiplier
+	}
+	if updateData.CreditFailureMultiplier != nil {
+		propagation.FailureMultiplier = *updateData.CreditFailureMultiplier
+	}
+	if updateData.CreditQualityScale != nil {
+		propagation.QualityScale = updateData.CreditQualityScale
+	}
+	if updateData.CreditTargetTime != nil {
+		propagation.TargetTime = *updateData.CreditTargetTime
+	}
+	if updateData.CreditMinTimeFactor != nil {
+		propagation.MinTimeFactor = *updateData.CreditMinTimeFactor
+	}
+	if err := propagation.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	domain.CreditDecay = propagation.Decay
+	domain.CreditThreshold = propagation.Threshold
+	domain.CreditMaxDepth = propagation.MaxDepth
+	domain.CreditSuccessMultiplier = propagation.SuccessMultiplier
+	domain.CreditFailureMultiplier = propagation.FailureMultiplier
+	domain.CreditQualityScale = propagation.QualityScale
+	domain.CreditTargetTime = propagation.TargetTime
+	domain.CreditMinTimeFactor = propagation.MinTimeFactor
 
 	// Update domain
 	if err := h.domainDAO.Update(domain); err != nil {
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"myapp/server/dao"
+	"myapp/server/graph"
 	"myapp/server/models"
 )
 
@@ -123,6 +125,10 @@ func (h *ExerciseHandler) CreateExercise(c *gin.Context) {
 	}
 
 	if err := h.exerciseDAO.Create(exercise, req.PrerequisiteIDs); err != nil {
+		if errors.Is(err, dao.ErrPrerequisiteNotReadable) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create exercise"})
 		return
 	}
@@ -240,6 +246,14 @@ func (h *ExerciseHandler) UpdateExercise(c *gin.Context) {
 
 	// Update exercise
 	if err := h.exerciseDAO.Update(exercise, req.PrerequisiteIDs); err != nil {
+		if errors.Is(err, dao.ErrPrerequisiteNotReadable) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, graph.ErrCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update exercise"})
 		return
 	}
@@ -1,24 +1,31 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"myapp/server/dao"
+	"myapp/server/graph"
+	"myapp/server/interchange"
+	"myapp/server/services"
 )
 
 // GraphHandler handles graph-related HTTP requests
 type GraphHandler struct {
-	graphDAO  *dao.GraphDAO
-	domainDAO *dao.DomainDAO
+	graphDAO        *dao.GraphDAO
+	domainDAO       *dao.DomainDAO
+	analysisService *services.GraphAnalysisService
 }
 
 // NewGraphHandler creates a new GraphHandler
-func NewGraphHandler(graphDAO *dao.GraphDAO, domainDAO *dao.DomainDAO) *GraphHandler {
+func NewGraphHandler(graphDAO *dao.GraphDAO, domainDAO *dao.DomainDAO, analysisService *services.GraphAnalysisService) *GraphHandler {
 	return &GraphHandler{
-		graphDAO:  graphDAO,
-		domainDAO: domainDAO,
+		graphDAO:        graphDAO,
+		domainDAO:       domainDAO,
+		analysisService: analysisService,
 	}
 }
 
@@ -59,6 +66,94 @@ func (h *GraphHandler) GetVisualGraph(c *gin.Context) {
 	c.JSON(http.StatusOK, graph)
 }
 
+// AnalyzeGraph reports structural diagnostics of a domain's graph
+func (h *GraphHandler) AnalyzeGraph(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	// Check access to the domain
+	domain, err := h.domainDAO.FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+
+	// Check if the domain is public or the user is the owner
+	if domain.Privacy != "public" {
+		userID, exists := c.Get("userID")
+		if !exists || userID.(uint) != domain.OwnerID {
+			isAdmin, adminExists := c.Get("isAdmin")
+			if !adminExists || !isAdmin.(bool) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You don't have access to this domain"})
+				return
+			}
+		}
+	}
+
+	bottlenecks := services.DefaultBottleneckCount
+	if limitStr := c.Query("bottlenecks"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l >= 0 {
+			bottlenecks = l
+		}
+	}
+
+	analysis, err := h.analysisService.AnalyzeDomain(uint(id), bottlenecks)
+	if err != nil {
+		if errors.Is(err, graph.ErrCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyze graph"})
+		return
+	}
+
+	c.JSON(http.StatusOK, analysis)
+}
+
+// ReduceGraph previews the removal of redundant prerequisite edges of a
+// domain, and removes them when confirmed with ?confirm=true
+func (h *GraphHandler) ReduceGraph(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	// Check access to the domain
+	domain, err := h.domainDAO.FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+
+	// Check if the user is the owner
+	userID, exists := c.Get("userID")
+	if !exists || userID.(uint) != domain.OwnerID {
+		isAdmin, adminExists := c.Get("isAdmin")
+		if !adminExists || !isAdmin.(bool) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to update this domain"})
+			return
+		}
+	}
+
+	confirm := c.Query("confirm") == "true"
+
+	reduction, err := h.analysisService.ReduceDomain(uint(id), confirm)
+	if err != nil {
+		if errors.Is(err, graph.ErrCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reduce graph"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reduction)
+}
+
 // UpdatePositions updates the positions of nodes in the graph
 func (h *GraphHandler) UpdatePositions(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -100,7 +195,65 @@ func (h *GraphHandler) UpdatePositions(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Positions updated successfully"})
 }
 
-// ExportDomain exports a domain to JSON format
+// LayoutGraph computes a layered layout of the domain's graph and saves it
+func (h *GraphHandler) LayoutGraph(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	// Check access to the domain
+	domain, err := h.domainDAO.FindByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+
+	// Check if the user is the owner
+	userID, exists := c.Get("userID")
+	if !exists || userID.(uint) != domain.OwnerID {
+		isAdmin, adminExists := c.Get("isAdmin")
+		if !adminExists || !isAdmin.(bool) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to update this domain"})
+			return
+		}
+	}
+
+	// The body is optional
+	var req struct {
+		KeepManual   bool    `json:"keepManual"`
+		NodeSpacing  float64 `json:"nodeSpacing" binding:"omitempty,gt=0"`
+		LayerSpacing float64 `json:"layerSpacing" binding:"omitempty,gt=0"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	positions, err := h.graphDAO.LayoutDomain(uint(id), req.KeepManual, graph.LayoutOptions{
+		NodeSpacing:  req.NodeSpacing,
+		LayerSpacing: req.LayerSpacing,
+	})
+	if err != nil {
+		if errors.Is(err, graph.ErrCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lay out graph"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"positions": positions,
+		"count":     len(positions),
+	})
+}
+
+// ExportDomain exports a domain to JSON format. With ?version=2 it exports
+// the domain in the versioned interchange format, which imports accept.
 func (h *GraphHandler) ExportDomain(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -127,6 +280,12 @@ func (h *GraphHandler) ExportDomain(c *gin.Context) {
 		}
 	}
 
+	version := c.Query("version")
+	if version != "" && version != "1" && version != strconv.Itoa(interchange.Version) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported export version"})
+		return
+	}
+
 	// Export the domain
 	graphData, err := h.graphDAO.ExportDomain(uint(id))
 	if err != nil {
@@ -134,10 +293,24 @@ func (h *GraphHandler) ExportDomain(c *gin.Context) {
 		return
 	}
 
+	if version == strconv.Itoa(interchange.Version) {
+		doc := interchange.FromGraphData(graphData)
+		doc.Domain = &interchange.Domain{Name: domain.Name, Description: domain.Description}
+		c.JSON(http.StatusOK, doc)
+		return
+	}
 	c.JSON(http.StatusOK, graphData)
 }
 
-// ImportDomain imports a domain from JSON format
+// GetInterchangeSchema returns the JSON Schema of the interchange format
+func (h *GraphHandler) GetInterchangeSchema(c *gin.Context) {
+	c.Data(http.StatusOK, "application/schema+json", interchange.Schema)
+}
+
+// ImportDomain imports a domain from JSON format, replacing its content, or
+// with ?mode=merge merging it by node code. The body may be in any version
+// of the interchange format. With ?dryRun=true it only validates the import
+// and reports what it would change.
 func (h *GraphHandler) ImportDomain(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -161,30 +334,94 @@ func (h *GraphHandler) ImportDomain(c *gin.Context) {
 			return
 		}
 	}
+	requesterID, _ := userID.(uint)
 
-	// Bind the graph data
-	var graphData dao.GraphData
-	if err := c.ShouldBindJSON(&graphData); err != nil {
+	// Parse the graph data, migrating older versions
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	doc, err := interchange.Parse(body)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	graphData := doc.GraphData()
+
+	mode := c.DefaultQuery("mode", dao.ImportModeReplace)
+	if mode != dao.ImportModeReplace && mode != dao.ImportModeMerge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import mode, use replace or merge"})
+		return
+	}
+	deleteMissing := c.Query("deleteMissing") == "true"
+
+	if c.Query("dryRun") == "true" {
+		report, err := h.graphDAO.ValidateImport(uint(id), requesterID, graphData, mode, deleteMissing)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate import"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+		return
+	}
 
 	// Import the domain
-	if err := h.graphDAO.ImportDomain(uint(id), &graphData); err != nil {
+	var result *dao.MergeResult
+	if mode == dao.ImportModeMerge {
+		result, err = h.graphDAO.MergeDomain(uint(id), requesterID, graphData, deleteMissing)
+	} else {
+		err = h.graphDAO.ImportDomain(uint(id), requesterID, graphData)
+	}
+	if err != nil {
+		if errors.Is(err, dao.ErrPrerequisiteNotReadable) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, dao.ErrDependentNodes) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, graph.ErrCycle) || errors.Is(err, dao.ErrDuplicateCode) || errors.Is(err, dao.ErrInvalidWeight) || errors.Is(err, dao.ErrUnresolvedExternal) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import domain"})
 		return
 	}
 
+	if result != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Domain merged successfully", "changes": result})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Domain imported successfully"})
 }
 
+// AuditCycles checks all domains for prerequisite cycles (admin)
+func (h *GraphHandler) AuditCycles(c *gin.Context) {
+	domains, checked, err := h.graphDAO.AuditCycles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to audit prerequisite cycles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"domainsChecked": checked,
+		"domains":        domains,
+	})
+}
+
 // RegisterRoutes registers the graph routes
 func (h *GraphHandler) RegisterRoutes(router *gin.RouterGroup) {
 	domains := router.Group("/domains")
 	{
 		domains.GET("/:id/graph", h.GetVisualGraph)
 		domains.PUT("/:id/graph/positions", h.UpdatePositions)
+		domains.POST("/:id/graph/layout", h.LayoutGraph)
+		domains.GET("/:id/graph/analysis", h.AnalyzeGraph)
+		domains.POST("/:id/graph/reduce", h.ReduceGraph)
 		domains.GET("/:id/export", h.ExportDomain)
 		domains.POST("/:id/import", h.ImportDomain)
 	}
+	router.GET("/interchange/schema", h.GetInterchangeSchema)
 }
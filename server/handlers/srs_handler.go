@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	//"time"
 
 	"github.com/gin-gonic/gin"
 	"myapp/server/dao"
+	"myapp/server/graph"
 	"myapp/server/models"
+	"myapp/server/scheduler"
 	"myapp/server/services"
 	"gorm.io/gorm"
 )
@@ -17,6 +21,7 @@ type SRSHandler struct {
 	db         *gorm.DB
 	srsService *services.SRSService
 	srsDao     *dao.SRSDao
+	optimizer  *services.SchedulerOptimizerService
 }
 
 // NewSRSHandler creates a new SRSHandler
@@ -25,6 +30,7 @@ func NewSRSHandler(db *gorm.DB) *SRSHandler {
 		db:         db,
 		srsService: services.NewSRSService(db),
 		srsDao:     dao.NewSRSDao(db),
+		optimizer:  services.NewSchedulerOptimizerService(db),
 	}
 }
 
@@ -65,6 +71,27 @@ func (h *SRSHandler) SubmitReview(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// UndoLastReview rolls back the user's most recent review
+func (h *SRSHandler) UndoLastReview(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	response, err := h.srsService.UndoLastReview(userID.(uint))
+	if err != nil {
+		if errors.Is(err, services.ErrNothingToUndo) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 // GetDueReviews gets nodes due for review
 func (h *SRSHandler) GetDueReviews(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -109,6 +136,7 @@ func (h *SRSHandler) GetReviewHistory(c *gin.Context) {
 	// Optional filters
 	var nodeID *uint
 	var nodeType *string
+	var reviewType *string
 
 	if nodeIDStr := c.Query("nodeId"); nodeIDStr != "" {
 		if id, err := strconv.ParseUint(nodeIDStr, 10, 32); err == nil {
@@ -121,6 +149,14 @@ func (h *SRSHandler) GetReviewHistory(c *gin.Context) {
 		nodeType = &nodeTypeStr
 	}
 
+	if reviewTypeStr := c.Query("reviewType"); reviewTypeStr != "" {
+		if reviewTypeStr != "explicit" && reviewTypeStr != "implicit" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reviewType must be 'explicit' or 'implicit'"})
+			return
+		}
+		reviewType = &reviewTypeStr
+	}
+
 	limit := 100
 	if limitStr := c.Query("limit"); limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
@@ -128,7 +164,7 @@ func (h *SRSHandler) GetReviewHistory(c *gin.Context) {
 		}
 	}
 
-	history, err := h.srsDao.GetReviewHistory(userID.(uint), nodeID, nodeType, limit)
+	history, err := h.srsDao.GetReviewHistory(userID.(uint), nodeID, nodeType, reviewType, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve review history"})
 		return
@@ -137,6 +173,123 @@ func (h *SRSHandler) GetReviewHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"history": history})
 }
 
+// GetCreditExplanation explains the recent implicit credits of a node: the
+// reviews that caused them and the path each credit took
+func (h *SRSHandler) GetCreditExplanation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	nodeType := c.Param("type")
+	if nodeType != "definition" && nodeType != "exercise" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Node type must be 'definition' or 'exercise'"})
+		return
+	}
+
+	nodeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	limit := 20
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	explanation, err := h.srsService.ExplainCredit(userID.(uint), uint(nodeID), nodeType, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrNodeNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, explanation)
+}
+
+// GetLearningPath lists what to study, in order, before a target node
+func (h *SRSHandler) GetLearningPath(c *gin.Context) {
+	h.learningPath(c, func(userID uint, domainID uint, target string, nodeType string) {
+		path, err := h.srsService.GetLearningPath(userID, domainID, target, nodeType)
+		if err != nil {
+			h.learningPathError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, path)
+	})
+}
+
+// StartLearningPathSession starts a study session covering the learning
+// path to a target node
+func (h *SRSHandler) StartLearningPathSession(c *gin.Context) {
+	h.learningPath(c, func(userID uint, domainID uint, target string, nodeType string) {
+		path, session, err := h.srsService.StartLearningPathSession(userID, domainID, target, nodeType)
+		if err != nil {
+			h.learningPathError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, models.LearningPathSession{
+			Path: path,
+			Session: &models.SessionResponse{
+				ID:                session.ID,
+				DomainID:          session.DomainID,
+				SessionType:       session.SessionType,
+				StartTime:         session.StartTime,
+				TotalReviews:      session.TotalReviews,
+				SuccessfulReviews: session.SuccessfulReviews,
+				Nodes:             session.Nodes,
+			},
+		})
+	})
+}
+
+// learningPath reads the domain and target of a learning path request
+func (h *SRSHandler) learningPath(c *gin.Context, handle func(userID uint, domainID uint, target string, nodeType string)) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	domainID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	target := c.Query("target")
+	if target == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target (node code) is required"})
+		return
+	}
+
+	nodeType := c.Query("type")
+	if nodeType != "" && nodeType != "definition" && nodeType != "exercise" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Node type must be 'definition' or 'exercise'"})
+		return
+	}
+
+	handle(userID.(uint), uint(domainID), target, nodeType)
+}
+
+func (h *SRSHandler) learningPathError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNodeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target node not found in this domain"})
+	case errors.Is(err, services.ErrNothingToStudy), errors.Is(err, graph.ErrCycle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // === Progress Endpoints ===
 
 // GetDomainProgress gets progress for all nodes in a domain
@@ -162,6 +315,94 @@ func (h *SRSHandler) GetDomainProgress(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"progress": progress})
 }
 
+// GetWorkloadEstimate estimates the daily review load of a domain at a desired retention
+func (h *SRSHandler) GetWorkloadEstimate(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	domainID, err := strconv.ParseUint(c.Param("domainId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	// Default to the retention currently in effect
+	retention := 0.0
+	if retentionStr := c.Query("retention"); retentionStr != "" {
+		retention, err = strconv.ParseFloat(retentionStr, 64)
+		if err != nil || !scheduler.IsValidRetention(retention) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Retention must be a number between 0.7 and 0.99"})
+			return
+		}
+	}
+
+	estimate, err := h.srsService.EstimateWorkload(userID.(uint), uint(domainID), retention)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
+
+// GetReviewForecast projects daily review counts for a domain
+func (h *SRSHandler) GetReviewForecast(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	domainID, err := strconv.ParseUint(c.Param("domainId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	days := 30
+	if daysStr := c.Query("days"); daysStr != "" {
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days < 1 || days > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Days must be between 1 and 365"})
+			return
+		}
+	}
+
+	forecast, err := h.srsService.ForecastReviews(userID.(uint), uint(domainID), days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, forecast)
+}
+
+// GetLeeches lists the nodes of a domain the user keeps failing
+func (h *SRSHandler) GetLeeches(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	domainID, err := strconv.ParseUint(c.Param("domainId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	report, err := h.srsService.GetLeeches(userID.(uint), uint(domainID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
 // GetDomainStats gets statistics for a domain
 func (h *SRSHandler) GetDomainStats(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -229,6 +470,102 @@ func (h *SRSHandler) UpdateNodeStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Node status updated successfully"})
 }
 
+// SuspendNode takes a node out of due reviews until it is unsuspended
+func (h *SRSHandler) SuspendNode(c *gin.Context) {
+	h.updateSchedulingState(c, func(userID uint, request *models.NodeRequest) (*models.UserNodeProgress, error) {
+		return h.srsService.SuspendNode(userID, request.NodeID, request.NodeType, true)
+	})
+}
+
+// UnsuspendNode puts a suspended node back into due reviews
+func (h *SRSHandler) UnsuspendNode(c *gin.Context) {
+	h.updateSchedulingState(c, func(userID uint, request *models.NodeRequest) (*models.UserNodeProgress, error) {
+		return h.srsService.SuspendNode(userID, request.NodeID, request.NodeType, false)
+	})
+}
+
+// BuryNode takes a node out of due reviews until tomorrow
+func (h *SRSHandler) BuryNode(c *gin.Context) {
+	h.updateSchedulingState(c, func(userID uint, request *models.NodeRequest) (*models.UserNodeProgress, error) {
+		return h.srsService.BuryNode(userID, request.NodeID, request.NodeType, true)
+	})
+}
+
+// UnburyNode puts a buried node back into due reviews right away
+func (h *SRSHandler) UnburyNode(c *gin.Context) {
+	h.updateSchedulingState(c, func(userID uint, request *models.NodeRequest) (*models.UserNodeProgress, error) {
+		return h.srsService.BuryNode(userID, request.NodeID, request.NodeType, false)
+	})
+}
+
+// updateSchedulingState validates a node request and applies a suspend/bury change
+func (h *SRSHandler) updateSchedulingState(c *gin.Context, update func(userID uint, request *models.NodeRequest) (*models.UserNodeProgress, error)) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	var request models.NodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.NodeType != "definition" && request.NodeType != "exercise" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Node type must be 'definition' or 'exercise'"})
+		return
+	}
+
+	progress, err := update(userID.(uint), &request)
+	if err != nil {
+		if errors.Is(err, services.ErrNodeNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"progress": progress})
+}
+
+// UnsuspendDomain unsuspends all the user's nodes in a domain
+func (h *SRSHandler) UnsuspendDomain(c *gin.Context) {
+	h.restoreDomain(c, h.srsService.UnsuspendDomain, "unsuspended")
+}
+
+// UnburyDomain unburies all the user's nodes in a domain
+func (h *SRSHandler) UnburyDomain(c *gin.Context) {
+	h.restoreDomain(c, h.srsService.UnburyDomain, "unburied")
+}
+
+// restoreDomain runs a bulk unsuspend/unbury for a domain
+func (h *SRSHandler) restoreDomain(c *gin.Context, restore func(userID uint, domainID uint) (int64, error), verb string) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	domainID, err := strconv.ParseUint(c.Param("domainId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	count, err := restore(userID.(uint), uint(domainID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%d nodes %s", count, verb),
+		"count":   count,
+	})
+}
+
 // === Session Endpoints ===
 
 // StartSession starts a new study session
@@ -361,6 +698,7 @@ func (h *SRSHandler) GetUserSessions(c *gin.Context) {
 			TotalReviews:      session.TotalReviews,
 			SuccessfulReviews: session.SuccessfulReviews,
 			Duration:          duration,
+			Nodes:             session.Nodes,
 		})
 	}
 
@@ -419,6 +757,18 @@ func (h *SRSHandler) CreatePrerequisite(c *gin.Context) {
 	}
 
 	if err := h.srsDao.CreatePrerequisite(prerequisite); err != nil {
+		if errors.Is(err, dao.ErrPrerequisiteNotReadable) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, graph.ErrCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create prerequisite"})
 		return
 	}
@@ -468,15 +818,45 @@ func (h *SRSHandler) DeletePrerequisite(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Prerequisite deleted successfully"})
 }
 
+// === Scheduler Optimization ===
+
+// OptimizeSchedulerParams fits a user's scheduler parameters from their review history (admin only)
+func (h *SRSHandler) OptimizeSchedulerParams(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	params, err := h.optimizer.OptimizeUser(uint(userID))
+	if err != nil {
+		if errors.Is(err, services.ErrNotEnoughHistory) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"params":        params,
+		"reviewCount":   params.ReviewCount,
+		"logLossBefore": params.LogLossBefore,
+		"logLossAfter":  params.LogLossAfter,
+	})
+}
+
 // === Test/Debug Endpoints ===
 
 // TestCreditPropagation tests credit propagation for a node
 func (h *SRSHandler) TestCreditPropagation(c *gin.Context) {
 	var request struct {
-		DomainID uint   `json:"domainId" binding:"required"`
-		NodeID   uint   `json:"nodeId" binding:"required"`
-		NodeType string `json:"nodeType" binding:"required"`
-		Success  bool   `json:"success"`
+		DomainID  uint   `json:"domainId" binding:"required"`
+		NodeID    uint   `json:"nodeId" binding:"required"`
+		NodeType  string `json:"nodeType" binding:"required"`
+		Success   bool   `json:"success"`
+		Quality   *int   `json:"quality" binding:"omitempty,min=0,max=5"`
+		TimeTaken int    `json:"timeTaken"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -484,15 +864,11 @@ func (h *SRSHandler) TestCreditPropagation(c *gin.Context) {
 		return
 	}
 
-	prerequisites, err := h.srsDao.GetPrerequisitesByDomain(request.DomainID)
+	credits, settings, err := h.srsService.SimulateCreditPropagation(request.DomainID, request.NodeID, request.NodeType, request.Success, request.Quality, request.TimeTaken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get prerequisites"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	creditService := services.NewCreditPropagationService()
-	graph := creditService.BuildGraph(prerequisites)
-	credits := creditService.PropagateCredit(request.NodeID, request.NodeType, request.Success, graph)
-
-	c.JSON(http.StatusOK, gin.H{"credits": credits})
+	c.JSON(http.StatusOK, gin.H{"credits": credits, "settings": settings})
 }
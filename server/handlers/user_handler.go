@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
@@ -8,6 +9,7 @@ import (
 	"myapp/server/dao"
 	"myapp/server/middleware"
 	"myapp/server/models"
+	"myapp/server/scheduler"
 )
 
 // UserHandler handles user-related HTTP requests
@@ -144,7 +146,31 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-// UpdateCurrentUser updates the current user's information
+// nullable is a JSON field that tells a missing field (Set false) from an
+// explicit null (Set true, Value nil)
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+// UnmarshalJSON is called for every field present, null included
+func (n *nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Value = nil
+		return nil
+	}
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	n.Value = &value
+	return nil
+}
+
+// UpdateCurrentUser updates the current user's information. A null or
+// empty schedulerAlgorithm and a null desiredRetention clear the setting,
+// so that the domain's default applies again.
 func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -161,11 +187,13 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 
 	// Bind update data
 	var updateData struct {
-		Username  string `json:"username"`
-		Email     string `json:"email"`
-		Password  string `json:"password"`
-		FirstName string `json:"firstName"`
-		LastName  string `json:"lastName"`
+		Username           string            `json:"username"`
+		Email              string            `json:"email"`
+		Password           string            `json:"password"`
+		FirstName          string            `json:"firstName"`
+		LastName           string            `json:"lastName"`
+		SchedulerAlgorithm nullable[string]  `json:"schedulerAlgorithm"`
+		DesiredRetention   nullable[float64] `json:"desiredRetention"`
 	}
 
 	if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -173,6 +201,17 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 		return
 	}
 
+	algorithm := updateData.SchedulerAlgorithm.Value
+	if algorithm != nil && *algorithm != "" && !scheduler.IsValidAlgorithm(*algorithm) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduler algorithm. Must be 'sm2' or 'fsrs'"})
+		return
+	}
+	retention := updateData.DesiredRetention.Value
+	if retention != nil && !scheduler.IsValidRetention(*retention) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Desired retention must be between 0.7 and 0.99"})
+		return
+	}
+
 	// Update fields if provided
 	if updateData.Username != "" {
 		user.Username = updateData.Username
@@ -189,6 +228,15 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 	if updateData.LastName != "" {
 		user.LastName = updateData.LastName
 	}
+	if updateData.SchedulerAlgorithm.Set {
+		user.SchedulerAlgorithm = ""
+		if algorithm != nil {
+			user.SchedulerAlgorithm = *algorithm
+		}
+	}
+	if updateData.DesiredRetention.Set {
+		user.DesiredRetention = retention
+	}
 
 	// Update user
 	if err := h.userDAO.UpdateUser(user); err != nil {
@@ -196,6 +244,14 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 		return
 	}
 
+	// Updates skips zero values, so cleared settings are written explicitly
+	if updateData.SchedulerAlgorithm.Set || updateData.DesiredRetention.Set {
+		if err := h.userDAO.UpdateSchedulerPreferences(user.ID, user.SchedulerAlgorithm, user.DesiredRetention); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, user)
 }
 
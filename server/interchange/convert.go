@@ -0,0 +1,145 @@
+package interchange
+
+import (
+	"strconv"
+	"strings"
+
+	"myapp/server/dao"
+)
+
+// FromGraphData converts a domain export to a document of the current
+// version
+func FromGraphData(data *dao.GraphData) *Document {
+	doc := &Document{Version: Version, Definitions: []Definition{}, Exercises: []Exercise{}}
+	for _, key := range sortedKeys(data.External) {
+		node := data.External[key]
+		doc.External = append(doc.External, External{
+			DomainID:   node.DomainID,
+			DomainName: node.DomainName,
+			Code:       node.Code,
+			Name:       node.Name,
+		})
+	}
+	prerequisites := func(codes []string, links map[string]dao.PrerequisiteLink) []Prerequisite {
+		var list []Prerequisite
+		for _, code := range codes {
+			p := Prerequisite{Code: code, Weight: 1}
+			if node, exists := data.External[code]; exists {
+				p.Code, p.DomainID = node.Code, node.DomainID
+			}
+			if link, exists := links[code]; exists {
+				p.Weight, p.Manual = link.Weight, link.Manual
+			}
+			list = append(list, p)
+		}
+		return list
+	}
+
+	for _, key := range sortedKeys(data.Definitions) {
+		def := data.Definitions[key]
+		doc.Definitions = append(doc.Definitions, Definition{
+			Code:          def.Code,
+			Name:          def.Name,
+			Description:   SplitDescription(def.Description),
+			Notes:         def.Notes,
+			References:    def.References,
+			Tags:          def.Tags,
+			Prerequisites: prerequisites(def.Prerequisites, def.PrerequisiteLinks),
+			Position:      position(def.XPosition, def.YPosition),
+		})
+	}
+	for _, key := range sortedKeys(data.Exercises) {
+		ex := data.Exercises[key]
+		doc.Exercises = append(doc.Exercises, Exercise{
+			Code:          ex.Code,
+			Name:          ex.Name,
+			Statement:     ex.Statement,
+			Description:   SplitDescription(ex.Description),
+			Hints:         ex.Hints,
+			Verifiable:    ex.Verifiable,
+			Result:        ex.Result,
+			Difficulty:    ex.Difficulty,
+			Tags:          ex.Tags,
+			Prerequisites: prerequisites(ex.Prerequisites, ex.PrerequisiteLinks),
+			Position:      position(ex.XPosition, ex.YPosition),
+		})
+	}
+	sortDocument(doc)
+	return doc
+}
+
+// GraphData converts a document to the import format of the DAO. Every
+// prerequisite gets a link, so imports and merges set its weight and
+// manual flag.
+func (d *Document) GraphData() *dao.GraphData {
+	data := &dao.GraphData{
+		Definitions: make(map[string]dao.DefinitionNode, len(d.Definitions)),
+		Exercises:   make(map[string]dao.ExerciseNode, len(d.Exercises)),
+	}
+	for _, node := range d.External {
+		if data.External == nil {
+			data.External = make(map[string]dao.ExternalNode, len(d.External))
+		}
+		data.External[ref(node.DomainID, node.Code)] = dao.ExternalNode{
+			DomainID:   node.DomainID,
+			DomainName: node.DomainName,
+			Code:       node.Code,
+			Name:       node.Name,
+		}
+	}
+	prerequisites := func(list []Prerequisite) ([]string, map[string]dao.PrerequisiteLink) {
+		if len(list) == 0 {
+			return nil, nil
+		}
+		codes := make([]string, len(list))
+		links := make(map[string]dao.PrerequisiteLink, len(list))
+		for i, p := range list {
+			codes[i] = p.Code
+			if p.DomainID != 0 {
+				codes[i] = ref(p.DomainID, p.Code)
+			}
+			links[codes[i]] = dao.PrerequisiteLink{Weight: p.Weight, Manual: p.Manual}
+		}
+		return codes, links
+	}
+
+	// Nodes are keyed by their position in the document
+	for i, def := range d.Definitions {
+		codes, links := prerequisites(def.Prerequisites)
+		node := dao.DefinitionNode{
+			Code:              def.Code,
+			Name:              def.Name,
+			Description:       strings.Join(def.Description, DescriptionSeparator),
+			Notes:             def.Notes,
+			References:        def.References,
+			Tags:              def.Tags,
+			Prerequisites:     codes,
+			PrerequisiteLinks: links,
+		}
+		if def.Position != nil {
+			node.XPosition, node.YPosition = def.Position.X, def.Position.Y
+		}
+		data.Definitions[strconv.Itoa(i+1)] = node
+	}
+	for i, ex := range d.Exercises {
+		codes, links := prerequisites(ex.Prerequisites)
+		node := dao.ExerciseNode{
+			Code:              ex.Code,
+			Name:              ex.Name,
+			Statement:         ex.Statement,
+			Description:       strings.Join(ex.Description, DescriptionSeparator),
+			Hints:             ex.Hints,
+			Verifiable:        ex.Verifiable,
+			Result:            ex.Result,
+			Difficulty:        ex.Difficulty,
+			Tags:              ex.Tags,
+			Prerequisites:     codes,
+			PrerequisiteLinks: links,
+		}
+		if ex.Position != nil {
+			node.XPosition, node.YPosition = ex.Position.X, ex.Position.Y
+		}
+		data.Exercises[strconv.Itoa(i+1)] = node
+	}
+	return data
+}
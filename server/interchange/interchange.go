@@ -0,0 +1,195 @@
+// Package interchange is the versioned JSON format domains are exported in
+// and imported from. Documents carry their format version; Parse migrates
+// older documents, including the unversioned formats of earlier releases,
+// to the current one. Schema is the JSON Schema of the current version.
+package interchange
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Version is the current version of the format
+const Version = 2
+
+// Schema is the JSON Schema of the current version
+//
+//go:embed schema.json
+var Schema []byte
+
+// ErrUnsupportedVersion is returned for documents of a version newer than
+// Version or not a version at all
+var ErrUnsupportedVersion = errors.New("unsupported interchange format version")
+
+// ErrInvalidDocument is returned for documents that do not follow the format
+var ErrInvalidDocument = errors.New("invalid interchange document")
+
+// Document is a domain's definitions and exercises with their prerequisites
+type Document struct {
+	Schema      string       `json:"$schema,omitempty"`
+	Version     int          `json:"version"`
+	Domain      *Domain      `json:"domain,omitempty"`
+	Definitions []Definition `json:"definitions"`
+	Exercises   []Exercise   `json:"exercises"`
+	External    []External   `json:"external,omitempty"` // definitions of other domains the prerequisites name
+}
+
+// Domain describes the exported domain; imports into an existing domain
+// ignore it
+type Domain struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Definition is a definition, identified by its code within the domain
+type Definition struct {
+	Code          string         `json:"code"`
+	Name          string         `json:"name"`
+	Description   []string       `json:"description,omitempty"` // one entry per description
+	Notes         string         `json:"notes,omitempty"`
+	References    []string       `json:"references,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	Prerequisites []Prerequisite `json:"prerequisites,omitempty"`
+	Position      *Position      `json:"position,omitempty"` // nil if not placed
+}
+
+// Exercise is an exercise, identified by its code within the domain
+type Exercise struct {
+	Code          string         `json:"code"`
+	Name          string         `json:"name"`
+	Statement     string         `json:"statement"`
+	Description   []string       `json:"description,omitempty"`
+	Hints         string         `json:"hints,omitempty"`
+	Verifiable    bool           `json:"verifiable,omitempty"`
+	Result        string         `json:"result,omitempty"`
+	Difficulty    int            `json:"difficulty"` // 1-7
+	Tags          []string       `json:"tags,omitempty"`
+	Prerequisites []Prerequisite `json:"prerequisites,omitempty"`
+	Position      *Position      `json:"position,omitempty"`
+}
+
+// Prerequisite is a definition a node requires: a definition of the domain
+// by code, or with DomainID a definition of another domain listed in
+// External
+type Prerequisite struct {
+	Code     string  `json:"code"`
+	DomainID uint    `json:"domainId,omitempty"`
+	Weight   float64 `json:"weight"` // in (0, 1], 1 when omitted
+	Manual   bool    `json:"manual,omitempty"`
+}
+
+// UnmarshalJSON reads a prerequisite, defaulting its weight to 1
+func (p *Prerequisite) UnmarshalJSON(data []byte) error {
+	type plain Prerequisite
+	decoded := plain{Weight: 1}
+	if err := strictUnmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*p = Prerequisite(decoded)
+	return nil
+}
+
+// External is a definition of another domain
+type External struct {
+	DomainID   uint   `json:"domainId"`
+	DomainName string `json:"domainName,omitempty"`
+	Code       string `json:"code"`
+	Name       string `json:"name,omitempty"`
+}
+
+// Position is where a node is drawn in the graph
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Parse reads a document of any version, migrating it to the current one.
+// Documents without a version are read as version 1, the formats of the
+// domain export, the command line import and the tutorial.
+func Parse(data []byte) (*Document, error) {
+	var header struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	version := 1
+	if header.Version != nil {
+		version = *header.Version
+	}
+	if version < 1 || version > Version {
+		return nil, fmt.Errorf("%w: %d, the newest is %d", ErrUnsupportedVersion, version, Version)
+	}
+
+	for ; version < Version; version++ {
+		migrated, err := migrations[version](data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: version %d: %v", ErrInvalidDocument, version, err)
+		}
+		data = migrated
+	}
+
+	var doc Document
+	if err := strictUnmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	if err := doc.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	return &doc, nil
+}
+
+// strictUnmarshal decodes JSON rejecting fields the format does not have
+func strictUnmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// validate checks what the JSON types cannot: every node has a code and
+// every prerequisite of another domain is listed in External. Values the
+// import reports on, like difficulties and weights out of range, are left
+// to the import validation.
+func (d *Document) validate() error {
+	external := map[string]bool{}
+	for _, node := range d.External {
+		if strings.TrimSpace(node.Code) == "" || node.DomainID == 0 {
+			return errors.New("external definitions need a domainId and a code")
+		}
+		external[ref(node.DomainID, node.Code)] = true
+	}
+	checkPrerequisites := func(nodeType, code string, prerequisites []Prerequisite) error {
+		for _, p := range prerequisites {
+			if p.DomainID != 0 && !external[ref(p.DomainID, p.Code)] {
+				return fmt.Errorf("prerequisite %s of %s %s is not listed in external", ref(p.DomainID, p.Code), nodeType, code)
+			}
+		}
+		return nil
+	}
+	for _, def := range d.Definitions {
+		if strings.TrimSpace(def.Code) == "" {
+			return fmt.Errorf("definition %q has no code", def.Name)
+		}
+		if err := checkPrerequisites("definition", def.Code, def.Prerequisites); err != nil {
+			return err
+		}
+	}
+	for _, ex := range d.Exercises {
+		if strings.TrimSpace(ex.Code) == "" {
+			return fmt.Errorf("exercise %q has no code", ex.Name)
+		}
+		if err := checkPrerequisites("exercise", ex.Code, ex.Prerequisites); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ref names a definition of another domain, as the domain export does
+func ref(domainID uint, code string) string {
+	return fmt.Sprintf("%d:%s", domainID, code)
+}
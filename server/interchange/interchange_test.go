@@ -0,0 +1,382 @@
+package interchange
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"myapp/server/dao"
+	"myapp/server/models"
+)
+
+// testDocument exercises every field of the format; nodes are in code
+// order, as exports list them
+const testDocument = `{
+  "version": 2,
+  "definitions": [
+    {
+      "code": "GRP",
+      "name": "Group",
+      "description": ["A set with an operation", "that is associative"],
+      "notes": "See also rings",
+      "references": ["Herstein, Topics in Algebra", "Lang, Algebra"],
+      "tags": ["algebra"],
+      "prerequisites": [
+        {"code": "SET", "weight": 0.5, "manual": true},
+        {"code": "FUN", "domainId": %d, "weight": 0.75}
+      ],
+      "position": {"x": 120.5, "y": -40}
+    },
+    {
+      "code": "SET",
+      "name": "Set",
+      "description": ["A collection"],
+      "position": {"x": 10, "y": 20}
+    }
+  ],
+  "exercises": [
+    {
+      "code": "EX-1",
+      "name": "Identity",
+      "statement": "Show the identity is unique",
+      "description": ["Uniqueness", "of the identity"],
+      "hints": "Take two identities",
+      "verifiable": true,
+      "result": "e = e'",
+      "difficulty": 4,
+      "prerequisites": [{"code": "GRP", "weight": 1}],
+      "position": {"x": 200, "y": 80}
+    }
+  ],
+  "external": [
+    {"domainId": %d, "domainName": "Functions", "code": "FUN", "name": "Function"}
+  ]
+}`
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Domain{}, &models.Definition{}, &models.Reference{}, &models.Exercise{}, &models.NodePrerequisite{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createDomain(t *testing.T, db *gorm.DB, name string) *models.Domain {
+	t.Helper()
+	domain := &models.Domain{Name: name, Privacy: "public", OwnerID: 1}
+	if err := db.Create(domain).Error; err != nil {
+		t.Fatal(err)
+	}
+	return domain
+}
+
+// exportDocument exports a domain through the DAO as a parsed document
+func exportDocument(t *testing.T, db *gorm.DB, domainID uint) *Document {
+	t.Helper()
+	data, err := dao.NewGraphDAO(db).ExportDomain(domainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := json.Marshal(FromGraphData(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := Parse(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	functions := createDomain(t, db, "Functions")
+	if err := db.Create(&models.Definition{Code: "FUN", Name: "Function", DomainID: functions.ID, OwnerID: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	content := fmt.Sprintf(testDocument, functions.ID, functions.ID)
+	want, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Import, export, import the export elsewhere and export again
+	algebra := createDomain(t, db, "Algebra")
+	if err := dao.NewGraphDAO(db).ImportDomain(algebra.ID, algebra.OwnerID, want.GraphData()); err != nil {
+		t.Fatal(err)
+	}
+	exported := exportDocument(t, db, algebra.ID)
+	if !reflect.DeepEqual(exported, want) {
+		t.Errorf("export differs from import:\n got %s\nwant %s", mustJSON(t, exported), mustJSON(t, want))
+	}
+
+	copied := createDomain(t, db, "Algebra copy")
+	if err := dao.NewGraphDAO(db).ImportDomain(copied.ID, copied.OwnerID, exported.GraphData()); err != nil {
+		t.Fatal(err)
+	}
+	if again := exportDocument(t, db, copied.ID); !reflect.DeepEqual(again, want) {
+		t.Errorf("second export differs:\n got %s\nwant %s", mustJSON(t, again), mustJSON(t, want))
+	}
+
+	// A merge sets the weights the document gives
+	want.Definitions[0].Prerequisites[0].Weight = 0.25
+	want.Definitions[0].Prerequisites[0].Manual = false
+	if _, err := dao.NewGraphDAO(db).MergeDomain(algebra.ID, algebra.OwnerID, want.GraphData(), false); err != nil {
+		t.Fatal(err)
+	}
+	if merged := exportDocument(t, db, algebra.ID); !reflect.DeepEqual(merged, want) {
+		t.Errorf("merged export differs:\n got %s\nwant %s", mustJSON(t, merged), mustJSON(t, want))
+	}
+}
+
+func TestRoundTripWeightOutOfRange(t *testing.T) {
+	db := newTestDB(t)
+	domain := createDomain(t, db, "Algebra")
+	doc := &Document{
+		Version:     Version,
+		Definitions: []Definition{{Code: "A", Name: "A"}, {Code: "B", Name: "B", Prerequisites: []Prerequisite{{Code: "A", Weight: 1.5}}}},
+		Exercises:   []Exercise{},
+	}
+	if err := dao.NewGraphDAO(db).ImportDomain(domain.ID, domain.OwnerID, doc.GraphData()); !errors.Is(err, dao.ErrInvalidWeight) {
+		t.Errorf("error = %v, want ErrInvalidWeight", err)
+	}
+	if report := dao.CheckImport(doc.GraphData(), dao.ImportModeReplace); report.Valid || report.Errors[0].Kind != dao.IssueWeightOutOfRange {
+		t.Errorf("report = %+v, want a weight error", report)
+	}
+}
+
+func TestParseVersion1(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Document
+	}{
+		{
+			name: "domain export",
+			content: `{
+				"definitions": {
+					"7": {"code": "SET", "name": "Set", "description": "A collection|||of objects", "xPosition": 1, "yPosition": 2},
+					"8": {"code": "GRP", "name": "Group", "description": "", "prerequisites": ["SET", "3:FUN"],
+					      "prerequisiteLinks": {"SET": {"weight": 0.5, "manual": true}}}
+				},
+				"exercises": {
+					"9": {"code": "EX", "name": "Ex", "statement": "Prove", "description": "One|||Two", "difficulty": 5, "prerequisites": ["GRP"]}
+				},
+				"external": {"3:FUN": {"domainId": 3, "domainName": "Functions", "code": "FUN", "name": "Function"}}
+			}`,
+			want: Document{
+				Version: 2,
+				Definitions: []Definition{
+					{Code: "GRP", Name: "Group", Prerequisites: []Prerequisite{{Code: "SET", Weight: 0.5, Manual: true}, {Code: "FUN", DomainID: 3, Weight: 1}}},
+					{Code: "SET", Name: "Set", Description: []string{"A collection", "of objects"}, Position: &Position{X: 1, Y: 2}},
+				},
+				Exercises: []Exercise{{Code: "EX", Name: "Ex", Statement: "Prove", Description: []string{"One", "Two"}, Difficulty: 5, Prerequisites: []Prerequisite{{Code: "GRP", Weight: 1}}}},
+				External:  []External{{DomainID: 3, DomainName: "Functions", Code: "FUN", Name: "Function"}},
+			},
+		},
+		{
+			name: "command line import",
+			content: `{
+				"definitions": {"SET": {"name": "Set", "description": ["A collection", "of objects"], "references": ["Halmos"]}},
+				"exercises": {
+					"EX": {"code": "EX", "name": "Ex", "statement": "Prove", "difficulty": "6"},
+					"EY": {"code": "EY", "name": "Ey", "statement": "Prove", "difficulty": "hard"},
+					"EZ": {"code": "EZ", "name": "Ez", "statement": "Prove"}
+				}
+			}`,
+			want: Document{
+				Version:     2,
+				Definitions: []Definition{{Code: "SET", Name: "Set", Description: []string{"A collection", "of objects"}, References: []string{"Halmos"}}},
+				Exercises: []Exercise{
+					{Code: "EX", Name: "Ex", Statement: "Prove", Difficulty: 6},
+					{Code: "EY", Name: "Ey", Statement: "Prove", Difficulty: DefaultDifficulty},
+					{Code: "EZ", Name: "Ez", Statement: "Prove", Difficulty: DefaultDifficulty},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Parse() =\n %s\nwant\n %s", mustJSON(t, got), mustJSON(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		want    error
+	}{
+		"newer version":     {`{"version": 3, "definitions": [], "exercises": []}`, ErrUnsupportedVersion},
+		"version zero":      {`{"version": 0, "definitions": [], "exercises": []}`, ErrUnsupportedVersion},
+		"unknown field":     {`{"version": 2, "definitions": [{"code": "A", "name": "A", "xPosition": 1}], "exercises": []}`, ErrInvalidDocument},
+		"missing code":      {`{"version": 2, "definitions": [{"name": "A"}], "exercises": []}`, ErrInvalidDocument},
+		"unlisted external": {`{"version": 2, "definitions": [{"code": "A", "name": "A", "prerequisites": [{"code": "B", "domainId": 4}]}], "exercises": []}`, ErrInvalidDocument},
+		"not json":          {`definitions`, ErrInvalidDocument},
+	}
+	for name, tt := range tests {
+		if _, err := Parse([]byte(tt.content)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", name, err, tt.want)
+		}
+	}
+}
+
+func TestParseDefaultWeight(t *testing.T) {
+	doc, err := Parse([]byte(`{"version": 2, "definitions": [{"code": "A", "name": "A"}, {"code": "B", "name": "B", "prerequisites": [{"code": "A"}]}], "exercises": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weight := doc.Definitions[1].Prerequisites[0].Weight; weight != 1 {
+		t.Errorf("weight = %g, want 1 when omitted", weight)
+	}
+}
+
+// TestSchema checks that documents, exported ones and the repository's
+// version 1 files once migrated, validate against the published schema
+func TestSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("schema is not JSON: %v", err)
+	}
+
+	documents := map[string][]byte{"test document": []byte(fmt.Sprintf(testDocument, 3, 3))}
+	for _, path := range []string{"../sample.json", "../tutorial.json"} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		documents[path] = content
+	}
+
+	for name, content := range documents {
+		doc, err := Parse(content)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(mustJSON(t, doc)), &value); err != nil {
+			t.Fatal(err)
+		}
+		for _, problem := range validateSchema(schema, schema, value, "") {
+			t.Errorf("%s: %s", name, problem)
+		}
+	}
+
+	var invalid interface{}
+	json.Unmarshal([]byte(`{"version": 2, "definitions": [{"code": "", "name": "A", "extra": 1}], "exercises": [{"code": "E", "name": "E", "statement": "S", "difficulty": 9}]}`), &invalid)
+	if problems := validateSchema(schema, schema, invalid, ""); len(problems) != 3 {
+		t.Errorf("invalid document problems = %v, want the empty code, the extra field and the difficulty", problems)
+	}
+}
+
+// validateSchema checks a value against the parts of JSON Schema the
+// format's schema uses
+func validateSchema(root, schema map[string]interface{}, value interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/$defs/")
+		return validateSchema(root, root["$defs"].(map[string]interface{})[name].(map[string]interface{}), value, path)
+	}
+
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+	if want, ok := schema["const"]; ok && !reflect.DeepEqual(value, want) {
+		fail("%v is not %v", value, want)
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("not an object")
+			break
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, name := range schema["required"].([]interface{}) {
+			if _, exists := object[name.(string)]; !exists {
+				fail("missing %s", name)
+			}
+		}
+		for name, field := range object {
+			property, known := properties[name].(map[string]interface{})
+			if !known {
+				if schema["additionalProperties"] == false {
+					fail("unknown property %s", name)
+				}
+				continue
+			}
+			problems = append(problems, validateSchema(root, property, field, path+"/"+name)...)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("not an array")
+			break
+		}
+		for i, item := range items {
+			problems = append(problems, validateSchema(root, schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s/%d", path, i))...)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			fail("not a string")
+			break
+		}
+		if min, ok := schema["minLength"].(float64); ok && utf8.RuneCountInString(text) < int(min) {
+			fail("shorter than %g", min)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && utf8.RuneCountInString(text) > int(max) {
+			fail("longer than %g", max)
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok || (schema["type"] == "integer" && number != float64(int64(number))) {
+			fail("not an %s", schema["type"])
+			break
+		}
+		if min, ok := schema["minimum"].(float64); ok && number < min {
+			fail("%g is below %g", number, min)
+		}
+		if min, ok := schema["exclusiveMinimum"].(float64); ok && number <= min {
+			fail("%g is not above %g", number, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && number > max {
+			fail("%g is above %g", number, max)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("not a boolean")
+		}
+	}
+	return problems
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
@@ -0,0 +1,234 @@
+package interchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations upgrade a document from the version it is keyed by to the next
+var migrations = map[int]func([]byte) ([]byte, error){
+	1: migrateV1,
+}
+
+// DefaultDifficulty is the difficulty of version 1 exercises without one,
+// as the command line import gave them
+const DefaultDifficulty = 3
+
+// DescriptionSeparator joins the descriptions of a node where they are kept
+// as one string, in version 1 and in the database
+const DescriptionSeparator = "|||"
+
+// Version 1 is unversioned and comes in three variants, all maps of nodes:
+// the domain export keys nodes by ID and joins descriptions with |||, the
+// command line import keys them by code and gives descriptions as lists and
+// difficulties as strings, and the tutorial gives definition descriptions
+// as lists. Prerequisites are codes, or references domainId:code to the
+// external map.
+type v1Document struct {
+	Definitions map[string]v1Definition `json:"definitions"`
+	Exercises   map[string]v1Exercise   `json:"exercises"`
+	External    map[string]External     `json:"external"`
+}
+
+type v1Definition struct {
+	Code              string            `json:"code"`
+	Name              string            `json:"name"`
+	Description       v1Descriptions    `json:"description"`
+	Notes             string            `json:"notes"`
+	References        []string          `json:"references"`
+	Tags              []string          `json:"tags"`
+	Prerequisites     []string          `json:"prerequisites"`
+	PrerequisiteLinks map[string]v1Link `json:"prerequisiteLinks"`
+	XPosition         float64           `json:"xPosition"`
+	YPosition         float64           `json:"yPosition"`
+}
+
+type v1Exercise struct {
+	Code              string            `json:"code"`
+	Name              string            `json:"name"`
+	Statement         string            `json:"statement"`
+	Description       v1Descriptions    `json:"description"`
+	Hints             string            `json:"hints"`
+	Verifiable        bool              `json:"verifiable"`
+	Result            string            `json:"result"`
+	Difficulty        v1Difficulty      `json:"difficulty"`
+	Tags              []string          `json:"tags"`
+	Prerequisites     []string          `json:"prerequisites"`
+	PrerequisiteLinks map[string]v1Link `json:"prerequisiteLinks"`
+	XPosition         float64           `json:"xPosition"`
+	YPosition         float64           `json:"yPosition"`
+}
+
+type v1Link struct {
+	Weight float64 `json:"weight"`
+	Manual bool    `json:"manual"`
+}
+
+// v1Descriptions reads a list of descriptions or a string joining them
+type v1Descriptions []string
+
+func (d *v1Descriptions) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*d = list
+		return nil
+	}
+	var joined string
+	if err := json.Unmarshal(data, &joined); err != nil {
+		return fmt.Errorf("description must be a string or a list of strings")
+	}
+	*d = SplitDescription(joined)
+	return nil
+}
+
+// v1Difficulty reads a difficulty given as a number or a string; strings
+// that are no number give DefaultDifficulty
+type v1Difficulty int
+
+func (d *v1Difficulty) UnmarshalJSON(data []byte) error {
+	var number int
+	if err := json.Unmarshal(data, &number); err == nil {
+		*d = v1Difficulty(number)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("difficulty must be a number or a string")
+	}
+	number, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil {
+		number = DefaultDifficulty
+	}
+	*d = v1Difficulty(number)
+	return nil
+}
+
+// migrateV1 converts the map based version 1 into lists sorted by code.
+// Nodes without a code take the key they are listed under.
+func migrateV1(data []byte) ([]byte, error) {
+	var old v1Document
+	if err := json.Unmarshal(data, &old); err != nil {
+		return nil, err
+	}
+
+	doc := Document{Version: 2, Definitions: []Definition{}, Exercises: []Exercise{}}
+	for _, key := range sortedKeys(old.External) {
+		doc.External = append(doc.External, old.External[key])
+	}
+	prerequisites := func(codes []string, links map[string]v1Link) []Prerequisite {
+		var list []Prerequisite
+		for _, code := range codes {
+			p := Prerequisite{Code: code, Weight: 1}
+			if node, exists := old.External[code]; exists {
+				p.Code, p.DomainID = node.Code, node.DomainID
+			}
+			if link, exists := links[code]; exists {
+				p.Weight, p.Manual = link.Weight, link.Manual
+			}
+			list = append(list, p)
+		}
+		return list
+	}
+
+	for _, key := range sortedKeys(old.Definitions) {
+		def := old.Definitions[key]
+		doc.Definitions = append(doc.Definitions, Definition{
+			Code:          codeOrKey(def.Code, key),
+			Name:          def.Name,
+			Description:   def.Description,
+			Notes:         def.Notes,
+			References:    def.References,
+			Tags:          def.Tags,
+			Prerequisites: prerequisites(def.Prerequisites, def.PrerequisiteLinks),
+			Position:      position(def.XPosition, def.YPosition),
+		})
+	}
+	for _, key := range sortedKeys(old.Exercises) {
+		ex := old.Exercises[key]
+		difficulty := int(ex.Difficulty)
+		if difficulty == 0 {
+			difficulty = DefaultDifficulty
+		}
+		doc.Exercises = append(doc.Exercises, Exercise{
+			Code:          codeOrKey(ex.Code, key),
+			Name:          ex.Name,
+			Statement:     ex.Statement,
+			Description:   ex.Description,
+			Hints:         ex.Hints,
+			Verifiable:    ex.Verifiable,
+			Result:        ex.Result,
+			Difficulty:    difficulty,
+			Tags:          ex.Tags,
+			Prerequisites: prerequisites(ex.Prerequisites, ex.PrerequisiteLinks),
+			Position:      position(ex.XPosition, ex.YPosition),
+		})
+	}
+	sortDocument(&doc)
+	return json.Marshal(doc)
+}
+
+func codeOrKey(code, key string) string {
+	if strings.TrimSpace(code) == "" {
+		return key
+	}
+	return code
+}
+
+// position gives the position of a node, nil at 0,0 where unplaced nodes
+// are
+func position(x, y float64) *Position {
+	if x == 0 && y == 0 {
+		return nil
+	}
+	return &Position{X: x, Y: y}
+}
+
+// SplitDescription splits descriptions joined with DescriptionSeparator
+func SplitDescription(joined string) []string {
+	if joined == "" {
+		return nil
+	}
+	return strings.Split(joined, DescriptionSeparator)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortDocument orders nodes by code and prerequisites of the domain before
+// those of other domains, so that documents diff well; nodes sharing a code
+// keep their order
+func sortDocument(doc *Document) {
+	sort.SliceStable(doc.Definitions, func(i, j int) bool { return doc.Definitions[i].Code < doc.Definitions[j].Code })
+	sort.SliceStable(doc.Exercises, func(i, j int) bool { return doc.Exercises[i].Code < doc.Exercises[j].Code })
+	sort.SliceStable(doc.External, func(i, j int) bool {
+		return byDomainAndCode(doc.External[i].DomainID, doc.External[i].Code, doc.External[j].DomainID, doc.External[j].Code)
+	})
+	for _, def := range doc.Definitions {
+		sortPrerequisites(def.Prerequisites)
+	}
+	for _, ex := range doc.Exercises {
+		sortPrerequisites(ex.Prerequisites)
+	}
+}
+
+func sortPrerequisites(list []Prerequisite) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return byDomainAndCode(list[i].DomainID, list[i].Code, list[j].DomainID, list[j].Code)
+	})
+}
+
+func byDomainAndCode(domainA uint, codeA string, domainB uint, codeB string) bool {
+	if domainA != domainB {
+		return domainA < domainB
+	}
+	return codeA < codeB
+}
@@ -1,19 +1,20 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"strconv"
 	"strings"
 
+	"myapp/server/anki"
 	"myapp/server/dao"
 	"myapp/server/handlers"
+	"myapp/server/interchange"
 	"myapp/server/middleware"
 	"myapp/server/models"
+	"myapp/server/services"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -21,45 +22,19 @@ import (
 	"gorm.io/gorm"
 )
 
-// GraphData represents the JSON structure for imports
-type GraphData struct {
-	Definitions map[string]DefinitionNode `json:"definitions"`
-	Exercises   map[string]ExerciseNode   `json:"exercises"`
-}
-
-// DefinitionNode represents a definition in the JSON
-type DefinitionNode struct {
-	Code          string   `json:"code"`
-	Name          string   `json:"name"`
-	Description   []string `json:"description"`
-	Notes         string   `json:"notes,omitempty"`
-	References    []string `json:"references,omitempty"`
-	Prerequisites []string `json:"prerequisites,omitempty"`
-	XPosition     float64  `json:"xPosition,omitempty"`
-	YPosition     float64  `json:"yPosition,omitempty"`
-}
-
-// ExerciseNode represents an exercise in the JSON
-type ExerciseNode struct {
-	Code          string   `json:"code"`
-	Name          string   `json:"name"`
-	Statement     string   `json:"statement"`
-	Description   string   `json:"description,omitempty"`
-	Hints         string   `json:"hints,omitempty"`
-	Difficulty    string      `json:"difficulty,omitempty"`
-	Verifiable    bool     `json:"verifiable,omitempty"`
-	Result        string   `json:"result,omitempty"`
-	Prerequisites []string `json:"prerequisites,omitempty"`
-	XPosition     float64  `json:"xPosition,omitempty"`
-	YPosition     float64  `json:"yPosition,omitempty"`
-}
-
 func main() {
 	// Define command-line flags
 	testImportFlag := flag.Bool("test-import", false, "Run test import")
 	jsonFilePath := flag.String("file", "./sample.json", "Path to the JSON file")
 	domainName := flag.String("domain", "Test Domain", "Name of the domain to create")
 	domainDesc := flag.String("desc", "Domain imported from JSON", "Description of the domain")
+	dryRunFlag := flag.Bool("dry-run", false, "With -test-import, only validate the JSON file and print the report")
+	ankiImportFlag := flag.Bool("anki-import", false, "Import the Anki .apkg package given by -file as a new domain")
+	ankiReviewsFlag := flag.Bool("anki-reviews", false, "With -anki-import, import the review log as the owner's review history and progress; with -anki-export, include the -user's scheduling state")
+	ankiExportID := flag.Uint("anki-export", 0, "Export the domain with this ID as an Anki .apkg package to -file")
+	ankiExerciseTypes := flag.String("anki-exercise-types", "", "With -anki-import, comma-separated note types whose notes become exercises (default: cloze note types and those with a Statement field)")
+	optimizeFlag := flag.Bool("optimize-scheduler", false, "Fit per-user scheduler parameters from review history")
+	optimizeUser := flag.Uint("user", 0, "User ID to optimize (0 = all users with review history), owner of an Anki import (0 = admin), or user whose scheduling state an Anki export includes")
 	
 	// Parse command-line flags
 	flag.Parse()
@@ -84,10 +59,28 @@ func main() {
 
 	// Run test import if flag is set
 	if *testImportFlag {
-		runTestImport(db, *jsonFilePath, *domainName, *domainDesc)
+		runTestImport(db, *jsonFilePath, *domainName, *domainDesc, *dryRunFlag)
 		return // Exit after import
 	}
 
+	// Run Anki import if flag is set
+	if *ankiImportFlag {
+		runAnkiImport(db, *jsonFilePath, *domainName, *domainDesc, *optimizeUser, *ankiReviewsFlag, *ankiExerciseTypes)
+		return
+	}
+
+	// Run Anki export if flag is set
+	if *ankiExportID != 0 {
+		runAnkiExport(db, *ankiExportID, *jsonFilePath, *optimizeUser, *ankiReviewsFlag)
+		return
+	}
+
+	// Run scheduler optimization if flag is set
+	if *optimizeFlag {
+		runSchedulerOptimization(db, *optimizeUser)
+		return
+	}
+
 	// Initialize DAOs
 	userDAO := dao.NewUserDAO(db)
 	domainDAO := dao.NewDomainDAO(db)
@@ -118,8 +111,9 @@ func main() {
 	definitionHandler := handlers.NewDefinitionHandler(definitionDAO, domainDAO)
 	exerciseHandler := handlers.NewExerciseHandler(exerciseDAO, domainDAO)
 	progressHandler := handlers.NewProgressHandler(progressDAO, domainDAO, definitionDAO, exerciseDAO)
-	graphHandler := handlers.NewGraphHandler(graphDAO, domainDAO)
+	graphHandler := handlers.NewGraphHandler(graphDAO, domainDAO, services.NewGraphAnalysisService(db))
   srsHandler := handlers.NewSRSHandler(db)
+	ankiHandler := handlers.NewAnkiHandler(db)
 
 	// Initialize router
 	router := gin.Default()
@@ -163,6 +157,7 @@ func main() {
 
 		// Public domain routes
 		api.GET("/domains/public", domainHandler.GetPublicDomains)
+		api.GET("/interchange/schema", graphHandler.GetInterchangeSchema)
 
 		// Routes requiring authentication
 		authorized := api.Group("/")
@@ -200,8 +195,17 @@ func main() {
 				// Graph operations
 				domains.GET("/:id/graph", graphHandler.GetVisualGraph)
 				domains.PUT("/:id/graph/positions", graphHandler.UpdatePositions)
+				domains.POST("/:id/graph/layout", graphHandler.LayoutGraph)
+				domains.GET("/:id/graph/analysis", graphHandler.AnalyzeGraph)
+				domains.POST("/:id/graph/reduce", graphHandler.ReduceGraph)
 				domains.GET("/:id/export", graphHandler.ExportDomain)
+				domains.GET("/:id/export/apkg", ankiHandler.ExportPackage)
 				domains.POST("/:id/import", graphHandler.ImportDomain)
+				domains.POST("/import/apkg", ankiHandler.ImportPackage)
+
+				// Learning paths
+				domains.GET("/:id/path", srsHandler.GetLearningPath)
+				domains.POST("/:id/path/session", srsHandler.StartLearningPathSession)
 			}
 
 			// Definition routes
@@ -248,13 +252,24 @@ func main() {
     {
         // Review endpoints
         srs.POST("/reviews", srsHandler.SubmitReview)
+        srs.POST("/reviews/undo", srsHandler.UndoLastReview)
         srs.GET("/domains/:domainId/due", srsHandler.GetDueReviews)
         srs.GET("/reviews/history", srsHandler.GetReviewHistory)
+        srs.GET("/nodes/:type/:id/credit-explanation", srsHandler.GetCreditExplanation)
         
         // Progress endpoints
         srs.GET("/domains/:domainId/progress", srsHandler.GetDomainProgress)
         srs.GET("/domains/:domainId/stats", srsHandler.GetDomainStats)
+        srs.GET("/domains/:domainId/workload", srsHandler.GetWorkloadEstimate)
+        srs.GET("/domains/:domainId/forecast", srsHandler.GetReviewForecast)
+        srs.GET("/domains/:domainId/leeches", srsHandler.GetLeeches)
         srs.PUT("/nodes/status", srsHandler.UpdateNodeStatus)
+        srs.POST("/nodes/suspend", srsHandler.SuspendNode)
+        srs.POST("/nodes/unsuspend", srsHandler.UnsuspendNode)
+        srs.POST("/nodes/bury", srsHandler.BuryNode)
+        srs.POST("/nodes/unbury", srsHandler.UnburyNode)
+        srs.POST("/domains/:domainId/unsuspend", srsHandler.UnsuspendDomain)
+        srs.POST("/domains/:domainId/unbury", srsHandler.UnburyDomain)
         
         // Session endpoints
         srs.POST("/sessions", srsHandler.StartSession)
@@ -265,9 +280,6 @@ func main() {
         srs.POST("/prerequisites", srsHandler.CreatePrerequisite)
         srs.GET("/domains/:domainId/prerequisites", srsHandler.GetPrerequisites)
         srs.DELETE("/prerequisites/:prerequisiteId", srsHandler.DeletePrerequisite)
-        
-        // Test/Debug endpoints
-        srs.POST("/test/credit-propagation", srsHandler.TestCreditPropagation)
     }
 
 			// Admin routes
@@ -275,6 +287,9 @@ func main() {
 			admin.Use(middleware.AdminRequired())
 			{
 				admin.GET("/users", userHandler.GetAllUsers)
+				admin.POST("/users/:id/scheduler/optimize", srsHandler.OptimizeSchedulerParams)
+				admin.POST("/srs/test/credit-propagation", srsHandler.TestCreditPropagation)
+				admin.GET("/graph/cycles", graphHandler.AuditCycles)
 				// Add other admin routes here
 			}
 		}
@@ -295,10 +310,108 @@ func main() {
 	}
 }
 
+// runSchedulerOptimization fits scheduler parameters for one user, or for
+// every user with review history when userID is 0, and prints the log-loss
+func runSchedulerOptimization(db *gorm.DB, userID uint) {
+	optimizer := services.NewSchedulerOptimizerService(db)
+
+	printResult := func(params *models.UserSchedulerParams) {
+		fmt.Printf("User %d: %d reviews, log-loss %.4f -> %.4f (first=%.0f, second=%.0f, ef=%.4f/%.4f/%.4f)\n",
+			params.UserID, params.ReviewCount, params.LogLossBefore, params.LogLossAfter,
+			params.FirstInterval, params.SecondInterval, params.EFBase, params.EFLinear, params.EFQuadratic)
+	}
+
+	if userID != 0 {
+		params, err := optimizer.OptimizeUser(userID)
+		if err != nil {
+			log.Fatalf("Failed to optimize user %d: %v", userID, err)
+		}
+		printResult(params)
+		return
+	}
+
+	results, failures, err := optimizer.OptimizeAllUsers()
+	if err != nil {
+		log.Fatalf("Failed to optimize users: %v", err)
+	}
+	for _, params := range results {
+		printResult(params)
+	}
+	for id, err := range failures {
+		fmt.Printf("User %d: skipped (%v)\n", id, err)
+	}
+	fmt.Printf("Optimized %d users, skipped %d\n", len(results), len(failures))
+}
+
 // main.go - Updated runTestImport function to populate node_prerequisites directly
 
-// runTestImport imports the test JSON data into the database
-func runTestImport(db *gorm.DB, jsonFilePath, domainName, domainDesc string) {
+// runAnkiImport imports an Anki .apkg package as a new domain owned by the
+// user, or by the admin user when userID is 0
+func runAnkiImport(db *gorm.DB, path, domainName, domainDesc string, userID uint, reviews bool, exerciseTypes string) {
+	pkg, err := anki.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read Anki package: %v", err)
+	}
+
+	if userID == 0 {
+		adminUser, err := dao.NewUserDAO(db).FindUserByEmail("admin@example.com")
+		if err != nil {
+			log.Fatalf("Failed to find admin user: %v", err)
+		}
+		userID = adminUser.ID
+	}
+
+	opts := services.AnkiImportOptions{
+		DomainName:    domainName,
+		Description:   domainDesc,
+		ImportReviews: reviews,
+	}
+	for _, name := range strings.Split(exerciseTypes, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.ExerciseNoteTypes = append(opts.ExerciseNoteTypes, name)
+		}
+	}
+
+	result, err := services.NewAnkiImportService(db).Import(pkg, userID, opts)
+	if err != nil {
+		log.Fatalf("Failed to import Anki package: %v", err)
+	}
+	fmt.Printf("Created domain: %s (ID: %d)\n", result.Domain.Name, result.Domain.ID)
+	fmt.Printf("Imported %d definitions and %d exercises\n", result.Definitions, result.Exercises)
+	if reviews {
+		fmt.Printf("Imported %d reviews on %d nodes for user %d\n", result.Reviews, result.Progress, userID)
+	}
+	if len(result.Media) > 0 {
+		fmt.Printf("Media files not imported: %s\n", strings.Join(result.Media, ", "))
+	}
+}
+
+func runAnkiExport(db *gorm.DB, domainID uint, path string, userID uint, schedule bool) {
+	if !strings.HasSuffix(path, ".apkg") {
+		log.Fatalf("-file must name the .apkg file to write, got %s", path)
+	}
+	if schedule && userID == 0 {
+		log.Fatalf("-anki-reviews needs the -user whose scheduling state to export")
+	}
+
+	pkg, err := services.NewAnkiExportService(db).Export(domainID, userID, schedule)
+	if err != nil {
+		log.Fatalf("Failed to export domain: %v", err)
+	}
+	if err := anki.WriteFile(path, pkg); err != nil {
+		log.Fatalf("Failed to write Anki package: %v", err)
+	}
+	fmt.Printf("Exported %d notes to %s\n", len(pkg.Notes), path)
+	if schedule {
+		fmt.Printf("Included the scheduling state of user %d with %d reviews\n", userID, len(pkg.Reviews))
+	}
+}
+
+// runTestImport imports the test JSON data, in any version of the
+// interchange format, into the database. The data is validated first and
+// nothing is written if it has errors; with dryRun only the validation
+// report is printed.
+func runTestImport(db *gorm.DB, jsonFilePath, domainName, domainDesc string, dryRun bool) {
 	fmt.Println("Starting test import...")
 
 	// Read and parse the JSON file
@@ -313,16 +426,31 @@ func runTestImport(db *gorm.DB, jsonFilePath, domainName, domainDesc string) {
 		log.Fatalf("Failed to read JSON file: %v", err)
 	}
 
-	var graphData GraphData
-	if err := json.Unmarshal(byteValue, &graphData); err != nil {
+	doc, err := interchange.Parse(byteValue)
+	if err != nil {
 		log.Fatalf("Failed to parse JSON: %v", err)
 	}
+	graphData := doc.GraphData()
+
+	report := dao.CheckImport(graphData, dao.ImportModeReplace)
+	for _, issue := range report.Errors {
+		fmt.Printf("Error: %s\n", issue.Message)
+	}
+	for _, issue := range report.Warnings {
+		fmt.Printf("Warning: %s\n", issue.Message)
+	}
+	if dryRun {
+		fmt.Printf("Dry run: %d errors, %d warnings, nothing was written\n", len(report.Errors), len(report.Warnings))
+		return
+	}
+	if !report.Valid {
+		log.Fatalf("Import aborted with %d errors, nothing was written", len(report.Errors))
+	}
 
 	// Create DAOs
 	userDAO := dao.NewUserDAO(db)
 	domainDAO := dao.NewDomainDAO(db)
-	definitionDAO := dao.NewDefinitionDAO(db)
-	exerciseDAO := dao.NewExerciseDAO(db)
+	graphDAO := dao.NewGraphDAO(db)
 
 	// Get admin user or create one if it doesn't exist
 	adminUser := &models.User{
@@ -357,107 +485,10 @@ func runTestImport(db *gorm.DB, jsonFilePath, domainName, domainDesc string) {
 
 	fmt.Printf("Created domain: %s (ID: %d)\n", domain.Name, domain.ID)
 
-	// Create definitions first (without prerequisites)
-	definitions := make(map[string]*models.Definition)
-	for code, def := range graphData.Definitions {
-		// Process multiple descriptions - join with a delimiter for storing
-		descriptionStr := strings.Join(def.Description, "|||")
-
-		definition := &models.Definition{
-			Code:        code,
-			Name:        def.Name,
-			Description: descriptionStr,
-			Notes:       def.Notes,
-			DomainID:    domain.ID,
-			OwnerID:     adminUser.ID,
-			XPosition:   def.XPosition,
-			YPosition:   def.YPosition,
-		}
-		
-		// Create the definition with references but no prerequisites yet
-		if err := definitionDAO.Create(definition, def.References, nil); err != nil {
-			log.Fatalf("Failed to create definition %s: %v", code, err)
-		}
-		
-		definitions[code] = definition
-		fmt.Printf("Created definition: %s (ID: %d)\n", definition.Name, definition.ID)
-	}
-
-	// Now add prerequisites for definitions using the DAO method
-	for code, def := range graphData.Definitions {
-		if len(def.Prerequisites) > 0 {
-			definition := definitions[code]
-			var prerequisiteIDs []uint
-			
-			for _, prereqCode := range def.Prerequisites {
-				if prereqDef, exists := definitions[prereqCode]; exists {
-					prerequisiteIDs = append(prerequisiteIDs, prereqDef.ID)
-				} else {
-					log.Printf("Warning: Prerequisite %s not found for definition %s", prereqCode, code)
-				}
-			}
-			
-			if len(prerequisiteIDs) > 0 {
-				// Get references for the update
-				var references []string
-				for _, ref := range def.References {
-					references = append(references, ref)
-				}
-				
-				// Update definition with prerequisites using DAO method
-				if err := definitionDAO.Update(definition, references, prerequisiteIDs); err != nil {
-					log.Fatalf("Failed to update definition %s with prerequisites: %v", code, err)
-				}
-			}
-		}
-	}
-
-	// Create exercises
-	for code, ex := range graphData.Exercises {
-		difficultyStr := ex.Difficulty
-		if difficultyStr == "" {
-			difficultyStr = "3" // Default medium difficulty
-		}
-
-		// Convert string difficulty to int
-		difficultyInt, err := strconv.Atoi(difficultyStr)
-		if err != nil {
-			// Handle error or set a default value
-			difficultyInt = 3 // Default to medium difficulty (integer)
-		}
-
-		exercise := &models.Exercise{
-			Code:        code,
-			Name:        ex.Name,
-			Statement:   ex.Statement,
-			Description: ex.Description,
-			Hints:       ex.Hints,
-			DomainID:    domain.ID,
-			OwnerID:     adminUser.ID,
-			Verifiable:  ex.Verifiable,
-			Result:      ex.Result,
-			Difficulty:  difficultyInt,
-			XPosition:   ex.XPosition,
-			YPosition:   ex.YPosition,
-		}
-		
-		// Collect prerequisite IDs
-		var prerequisiteIDs []uint
-		for _, prereqCode := range ex.Prerequisites {
-			if prereqDef, exists := definitions[prereqCode]; exists {
-				prerequisiteIDs = append(prerequisiteIDs, prereqDef.ID)
-			} else {
-				log.Printf("Warning: Prerequisite %s not found for exercise %s", prereqCode, code)
-			}
-		}
-		
-		// Create the exercise with prerequisites using DAO method
-		if err := exerciseDAO.Create(exercise, prerequisiteIDs); err != nil {
-			log.Fatalf("Failed to create exercise %s: %v", code, err)
-		}
-		
-		fmt.Printf("Created exercise: %s (ID: %d)\n", exercise.Name, exercise.ID)
+	if err := graphDAO.ImportDomain(domain.ID, domain.OwnerID, graphData); err != nil {
+		log.Fatalf("Failed to import domain content: %v", err)
 	}
+	fmt.Printf("Imported %d definitions and %d exercises\n", len(doc.Definitions), len(doc.Exercises))
 
 	// Verify prerequisites were created correctly
 	var prereqCount int64
@@ -14,6 +14,7 @@ type Definition struct {
 	Name        string    `gorm:"column:name;not null" json:"name"`
 	Description string    `gorm:"column:description;not null" json:"description"`
 	Notes       string    `gorm:"column:notes" json:"notes"`
+	Tags        []string  `gorm:"column:tags;type:text;serializer:json" json:"tags,omitempty"` // e.g. kept from an Anki import
 	DomainID    uint      `gorm:"column:domain_id;not null" json:"domainId"`
 	OwnerID     uint      `gorm:"column:owner_id;not null" json:"ownerId"`
 	XPosition   float64   `gorm:"column:x_position;default:0" json:"xPosition"`
@@ -71,6 +72,7 @@ type DefinitionResponse struct {
 	Description   string    `json:"description"`
 	Notes         string    `json:"notes,omitempty"`
 	References    []string  `json:"references,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
 	Prerequisites []string  `json:"prerequisites,omitempty"` // Just the codes
 	DomainID      uint      `json:"domainId"`
 	OwnerID       uint      `json:"ownerId"`
@@ -15,6 +15,26 @@ type Domain struct {
     Privacy     string         `gorm:"column:privacy;not null" json:"privacy"`
     OwnerID     uint           `gorm:"column:owner_id;not null" json:"ownerId"`
     Description string         `gorm:"column:description" json:"description"`
+
+    // SRS settings
+    SchedulerAlgorithm string  `gorm:"column:scheduler_algorithm;default:sm2" json:"schedulerAlgorithm"` // sm2, fsrs
+    DesiredRetention   float64 `gorm:"column:desired_retention;default:0.9" json:"desiredRetention"`     // target recall probability (0.7-0.99)
+    LeechThreshold     int     `gorm:"column:leech_threshold;default:8" json:"leechThreshold"`           // lapses before a node is a leech, 0 = off
+    LeechAction        string  `gorm:"column:leech_action;default:tag" json:"leechAction"`               // tag, suspend
+
+    // Graduation from grasped to learned
+    GraduationInterval    float64 `gorm:"column:graduation_interval;default:21" json:"graduationInterval"`        // minimum interval in days, 0 = never
+    GraduationSuccessRate float64 `gorm:"column:graduation_success_rate;default:0.8" json:"graduationSuccessRate"` // minimum share of successful reviews (0-1)
+
+    // Credit propagation
+    CreditDecay             string  `gorm:"column:credit_decay;default:harmonic" json:"creditDecay"` // harmonic, exponential, linear
+    CreditThreshold         float64 `gorm:"column:credit_threshold;default:0.01" json:"creditThreshold"`
+    CreditMaxDepth          int     `gorm:"column:credit_max_depth;default:6" json:"creditMaxDepth"`
+    CreditSuccessMultiplier float64 `gorm:"column:credit_success_multiplier;default:1" json:"creditSuccessMultiplier"`
+    CreditFailureMultiplier float64 `gorm:"column:credit_failure_multiplier;default:1" json:"creditFailureMultiplier"`
+    CreditQualityScale      []float64 `gorm:"column:credit_quality_scale;type:text;serializer:json" json:"creditQualityScale"` // factor per quality 0-5
+    CreditTargetTime        int     `gorm:"column:credit_target_time;default:0" json:"creditTargetTime"`                   // seconds, 0 = ignore time
+    CreditMinTimeFactor     float64 `gorm:"column:credit_min_time_factor;default:0.5" json:"creditMinTimeFactor"`
     
     // Relationships
     Owner       *User        `gorm:"foreignKey:OwnerID" json:"-"`
@@ -16,6 +16,7 @@ type Exercise struct {
 	Description string    `gorm:"column:description" json:"description"`
 	Notes       string    `gorm:"column:notes" json:"notes"`
 	Hints       string    `gorm:"column:hints" json:"hints"`
+	Tags        []string  `gorm:"column:tags;type:text;serializer:json" json:"tags,omitempty"` // e.g. kept from an Anki import
 	DomainID    uint      `gorm:"column:domain_id;not null" json:"domainId"`
 	OwnerID     uint      `gorm:"column:owner_id;not null" json:"ownerId"`
 	Verifiable  bool      `gorm:"column:verifiable;default:false" json:"verifiable"`
@@ -70,6 +71,7 @@ type ExerciseResponse struct {
 	Verifiable    bool      `json:"verifiable"`
 	Result        string    `json:"result,omitempty"`
 	Difficulty    int       `json:"difficulty,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
 	Prerequisites []string  `json:"prerequisites,omitempty"` // Just the codes
 	XPosition     float64   `json:"xPosition,omitempty"`
 	YPosition     float64   `json:"yPosition,omitempty"`
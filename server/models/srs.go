@@ -36,6 +36,14 @@ type UserNodeProgress struct {
 	CreditPostponed   bool      `gorm:"column:credit_postponed;default:false" json:"creditPostponed"`
 	TotalReviews      int       `gorm:"column:total_reviews;default:0" json:"totalReviews"`
 	SuccessfulReviews int       `gorm:"column:successful_reviews;default:0" json:"successfulReviews"`
+	Algorithm         string    `gorm:"column:algorithm;default:sm2" json:"algorithm"` // sm2, fsrs - scheduler of the current interval
+	Stability         float64   `gorm:"column:stability;default:0" json:"stability"`   // FSRS memory stability in days, 0 = not initialized
+	Difficulty        float64   `gorm:"column:difficulty;default:0" json:"difficulty"` // FSRS difficulty (1-10)
+	Lapses            int       `gorm:"column:lapses;default:0" json:"lapses"`             // failed reviews after a success
+	IsLeech           bool      `gorm:"column:is_leech;default:false" json:"isLeech"`
+	Suspended         bool      `gorm:"column:suspended;default:false" json:"suspended"` // excluded from due reviews
+	BuriedUntil       *time.Time `gorm:"column:buried_until" json:"buriedUntil"`        // excluded from due reviews until then
+	Version           int       `gorm:"column:version;not null;default:0" json:"version"` // incremented by every write, to tell undo about later changes
 	CreatedAt         time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
 	UpdatedAt         time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
 	
@@ -52,11 +60,12 @@ type StudySession struct {
 	ID                uint      `gorm:"primaryKey" json:"id"`
 	UserID            uint      `gorm:"column:user_id;not null" json:"userId"`
 	DomainID          uint      `gorm:"column:domain_id;not null" json:"domainId"`
-	SessionType       string    `gorm:"column:session_type;not null" json:"sessionType"` // definition, exercise, mixed
+	SessionType       string    `gorm:"column:session_type;not null" json:"sessionType"` // definition, exercise, mixed, path
 	StartTime         time.Time `gorm:"column:start_time;autoCreateTime" json:"startTime"`
 	EndTime           *time.Time `gorm:"column:end_time" json:"endTime"`
 	TotalReviews      int       `gorm:"column:total_reviews;default:0" json:"totalReviews"`
 	SuccessfulReviews int       `gorm:"column:successful_reviews;default:0" json:"successfulReviews"`
+	Nodes             []SessionNode `gorm:"column:nodes;type:text;serializer:json" json:"nodes,omitempty"` // path sessions: the nodes to study, in order
 	
 	// Relationships
 	User   *User   `gorm:"foreignKey:UserID" json:"-"`
@@ -67,6 +76,12 @@ func (StudySession) TableName() string {
 	return "study_sessions"
 }
 
+// SessionNode is a node a session covers
+type SessionNode struct {
+	NodeID   uint   `json:"nodeId"`
+	NodeType string `json:"nodeType"`
+}
+
 // SessionReview represents an individual review within a session
 type SessionReview struct {
 	ID            uint      `gorm:"primaryKey" json:"id"`
@@ -104,6 +119,18 @@ type ReviewHistory struct {
 	EasinessFactorAfter   *float64  `gorm:"column:easiness_factor_after" json:"easinessFactorAfter"`
 	IntervalBefore        *float64  `gorm:"column:interval_before" json:"intervalBefore"`
 	IntervalAfter         *float64  `gorm:"column:interval_after" json:"intervalAfter"`
+	CreditBefore          *float64  `gorm:"column:credit_before" json:"creditBefore"`
+	CreditAfter           *float64  `gorm:"column:credit_after" json:"creditAfter"`
+	NextReviewBefore      *time.Time `gorm:"column:next_review_before" json:"nextReviewBefore"`
+	NextReviewAfter       *time.Time `gorm:"column:next_review_after" json:"nextReviewAfter"`
+	Algorithm             string    `gorm:"column:algorithm;default:sm2" json:"algorithm"`
+	StabilityBefore       *float64  `gorm:"column:stability_before" json:"stabilityBefore"`
+	StabilityAfter        *float64  `gorm:"column:stability_after" json:"stabilityAfter"`
+	DifficultyBefore      *float64  `gorm:"column:difficulty_before" json:"difficultyBefore"`
+	DifficultyAfter       *float64  `gorm:"column:difficulty_after" json:"difficultyAfter"`
+	Retrievability        *float64  `gorm:"column:retrievability" json:"retrievability"` // FSRS predicted recall at review time
+	SourceReviewID        *uint     `gorm:"column:source_review_id;index" json:"sourceReviewId"` // explicit review that caused an implicit one
+	CreditTrace           *CreditTrace `gorm:"column:credit_trace;type:text;serializer:json" json:"creditTrace,omitempty"`
 	
 	// Relationships
 	User *User `gorm:"foreignKey:UserID" json:"-"`
@@ -113,6 +140,120 @@ func (ReviewHistory) TableName() string {
 	return "review_history"
 }
 
+// ReviewSnapshot records everything an explicit review changed so that the
+// review can be undone: the state of every node before the credit flow and
+// the rows the review created
+type ReviewSnapshot struct {
+	ID               uint               `gorm:"primaryKey" json:"id"`
+	UserID           uint               `gorm:"column:user_id;not null;index" json:"userId"`
+	NodeID           uint               `gorm:"column:node_id;not null" json:"nodeId"`
+	NodeType         string             `gorm:"column:node_type;not null" json:"nodeType"`
+	SessionID        *uint              `gorm:"column:session_id" json:"sessionId"`
+	Success          bool               `gorm:"column:success;not null" json:"success"`
+	CreditFlow       []CreditUpdate     `gorm:"column:credit_flow;type:text;serializer:json" json:"creditFlow"`
+	ProgressBefore   []ProgressSnapshot `gorm:"column:progress_before;type:text;serializer:json" json:"progressBefore"`
+	HistoryIDs       []uint             `gorm:"column:history_ids;type:text;serializer:json" json:"historyIds"`
+	SessionReviewIDs []uint             `gorm:"column:session_review_ids;type:text;serializer:json" json:"sessionReviewIds"`
+	CreatedAt        time.Time          `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (ReviewSnapshot) TableName() string {
+	return "review_snapshots"
+}
+
+// ProgressSnapshot is the state of one node before a review touched it
+type ProgressSnapshot struct {
+	Existed  bool             `json:"existed"` // false if the review created the progress row
+	Progress UserNodeProgress `json:"progress"`
+
+	// The row as the review left it; another ID or version means it was
+	// written since
+	AfterID      uint `json:"afterId"`
+	AfterVersion int  `json:"afterVersion"`
+}
+
+// UserSchedulerParams stores SM-2 parameters fitted from a user's review
+// history. The coefficients have no GORM defaults: a fit may yield 0, which
+// GORM would replace by the default on insert.
+type UserSchedulerParams struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	UserID         uint      `gorm:"column:user_id;not null;uniqueIndex" json:"userId"`
+	FirstInterval  float64   `gorm:"column:first_interval" json:"firstInterval"`
+	SecondInterval float64   `gorm:"column:second_interval" json:"secondInterval"`
+	EFBase         float64   `gorm:"column:ef_base" json:"efBase"`
+	EFLinear       float64   `gorm:"column:ef_linear" json:"efLinear"`
+	EFQuadratic    float64   `gorm:"column:ef_quadratic" json:"efQuadratic"`
+	ReviewCount    int       `gorm:"column:review_count;default:0" json:"reviewCount"` // reviews scored during the fit
+	LogLossBefore  float64   `gorm:"column:log_loss_before" json:"logLossBefore"`
+	LogLossAfter   float64   `gorm:"column:log_loss_after" json:"logLossAfter"`
+	FittedAt       time.Time `gorm:"column:fitted_at" json:"fittedAt"`
+	CreatedAt      time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (UserSchedulerParams) TableName() string {
+	return "user_scheduler_params"
+}
+
+// SchedulerSettings are the user and domain preferences that select and tune
+// the scheduler for a review
+type SchedulerSettings struct {
+	UserAlgorithm   string
+	DomainAlgorithm string
+	UserRetention   *float64
+	DomainRetention float64
+	LeechThreshold  int
+	LeechAction     string
+	GraduationInterval    float64
+	GraduationSuccessRate float64
+}
+
+// UndoResponse describes the rollback of the last review
+type UndoResponse struct {
+	Success        bool               `json:"success"`
+	Message        string             `json:"message"`
+	NodeID         uint               `json:"nodeId"`
+	NodeType       string             `json:"nodeType"`
+	RestoredNodes  []UserNodeProgress `json:"restoredNodes"`
+	RemovedNodes   []CreditUpdate     `json:"removedNodes,omitempty"` // progress rows created by the review and deleted again
+	SkippedNodes   []CreditUpdate     `json:"skippedNodes,omitempty"` // nodes changed after the review, left as they are
+	HistoryRemoved int                `json:"historyRemoved"`
+}
+
+// WorkloadEstimate is the expected daily review load of a domain at a retention
+type WorkloadEstimate struct {
+	DomainID              uint    `json:"domainId"`
+	Retention             float64 `json:"retention"`
+	CurrentRetention      float64 `json:"currentRetention"`
+	NodeCount             int     `json:"nodeCount"`
+	CurrentDailyReviews   float64 `json:"currentDailyReviews"`
+	EstimatedDailyReviews float64 `json:"estimatedDailyReviews"`
+}
+
+// ReviewForecast projects the daily review load of a domain
+type ReviewForecast struct {
+	DomainID  uint          `json:"domainId"`
+	Days      int           `json:"days"`
+	StartDate string        `json:"startDate"` // YYYY-MM-DD, first forecast day (today)
+	Overdue   int           `json:"overdue"`   // reviews already due before today, counted on day 0
+	Total     int           `json:"total"`
+	Daily     []ForecastDay `json:"daily"`
+}
+
+// ForecastDay is the projected review count for one day
+type ForecastDay struct {
+	Date      string `json:"date"`      // YYYY-MM-DD
+	Scheduled int    `json:"scheduled"` // reviews already scheduled by next_review
+	FollowUp  int    `json:"followUp"`  // simulated reviews that follow reviews inside the window
+	Total     int    `json:"total"`
+}
+
 // Review request/response models
 type ReviewRequest struct {
 	NodeID      uint   `json:"nodeId" binding:"required"`
@@ -131,10 +272,28 @@ type ReviewResponse struct {
 }
 
 type CreditUpdate struct {
-	NodeID      uint    `json:"nodeId"`
-	NodeType    string  `json:"nodeType"`
-	Credit      float64 `json:"credit"`
-	Type        string  `json:"type"` // explicit, implicit
+	NodeID      uint         `json:"nodeId"`
+	NodeType    string       `json:"nodeType"`
+	Credit      float64      `json:"credit"`
+	Type        string       `json:"type"` // explicit, implicit
+	Trace       *CreditTrace `json:"trace,omitempty"` // implicit credits only
+}
+
+// CreditTrace is how an implicit credit was derived: the path it took from
+// the reviewed node, the decay for the path length and the review multiplier.
+// Credit = product of the hop weights × Decay × Multiplier.
+type CreditTrace struct {
+	Path       []CreditHop `json:"path"`
+	Decay      float64     `json:"decay"`
+	Multiplier float64     `json:"multiplier"` // success/failure multiplier × quality and time scale
+}
+
+// CreditHop is one step of a credit path: the node reached and the weight of
+// the prerequisite edge that led to it
+type CreditHop struct {
+	NodeID   uint    `json:"nodeId"`
+	NodeType string  `json:"nodeType"`
+	Weight   float64 `json:"weight"`
 }
 
 // Session request/response models
@@ -152,6 +311,7 @@ type SessionResponse struct {
 	TotalReviews      int       `json:"totalReviews"`
 	SuccessfulReviews int       `json:"successfulReviews"`
 	Duration          *int      `json:"duration"` // in seconds
+	Nodes             []SessionNode `json:"nodes,omitempty"`
 }
 
 // Progress models
@@ -170,10 +330,155 @@ type NodeProgress struct {
 	CreditPostponed   bool       `json:"creditPostponed"`
 	TotalReviews      int        `json:"totalReviews"`
 	SuccessfulReviews int        `json:"successfulReviews"`
+	Lapses            int        `json:"lapses"`
+	IsLeech           bool       `json:"isLeech"`
+	Suspended         bool       `json:"suspended"`
+	BuriedUntil       *time.Time `json:"buriedUntil"`
 	DaysUntilReview   *int       `json:"daysUntilReview"`
 	IsDue             bool       `json:"isDue"`
 }
 
+// LeechReport lists the leeches of a user in a domain
+type LeechReport struct {
+	DomainID  uint    `json:"domainId"`
+	Threshold int     `json:"threshold"`
+	Action    string  `json:"action"`
+	Leeches   []Leech `json:"leeches"`
+}
+
+// Leech is a node the user keeps failing, with its direct prerequisites,
+// since a weak prerequisite is often the real cause
+type Leech struct {
+	NodeProgress
+	Prerequisites []LeechPrerequisite `json:"prerequisites"`
+}
+
+// LeechPrerequisite is a prerequisite of a leech and the user's progress on it
+type LeechPrerequisite struct {
+	NodeProgress
+	Weight float64 `json:"weight"`
+}
+
+// LearningPath lists what is left to study, in order, before a target node:
+// its transitive prerequisites the user has not grasped, then the target
+type LearningPath struct {
+	DomainID         uint               `json:"domainId"`
+	Target           NodeProgress       `json:"target"`
+	Nodes            []LearningPathNode `json:"nodes"`
+	SkippedCount     int                `json:"skippedCount"` // prerequisites already grasped or learned
+	EstimatedSeconds int                `json:"estimatedSeconds"`
+}
+
+// LearningPathNode is a node of a learning path with its estimated study time
+type LearningPathNode struct {
+	NodeProgress
+	EstimatedSeconds int    `json:"estimatedSeconds"`
+	EstimateSource   string `json:"estimateSource"` // user, all_users, user_average or default
+}
+
+// LearningPathSession is a study session started for a learning path
+type LearningPathSession struct {
+	Path    *LearningPath    `json:"path"`
+	Session *SessionResponse `json:"session"`
+}
+
+// GraphAnalysis is a structural report on the prerequisite graph of a domain.
+// Edges point from a prerequisite to the node that requires it, so a node's
+// in-degree is its number of prerequisites and its out-degree the number of
+// nodes that require it.
+type GraphAnalysis struct {
+	DomainID                      uint                `json:"domainId"`
+	NodeCount                     int                 `json:"nodeCount"`
+	EdgeCount                     int                 `json:"edgeCount"`
+	MaxDepth                      int                 `json:"maxDepth"`
+	Nodes                         []GraphAnalysisNode `json:"nodes"`
+	Orphans                       []GraphNodeRef      `json:"orphans"` // neither prerequisites nor dependents
+	ExercisesWithoutPrerequisites []GraphNodeRef      `json:"exercisesWithoutPrerequisites"`
+	RedundantEdges                []RedundantEdge     `json:"redundantEdges"`
+	LongestChain                  []GraphNodeRef      `json:"longestChain"` // from a root to the deepest node
+	Bottlenecks                   []GraphAnalysisNode `json:"bottlenecks"`  // highest betweenness first
+}
+
+// GraphNodeRef identifies a node of a domain graph
+type GraphNodeRef struct {
+	NodeID   uint   `json:"nodeId"`
+	NodeType string `json:"nodeType"`
+	NodeCode string `json:"nodeCode"`
+	NodeName string `json:"nodeName"`
+}
+
+// GraphAnalysisNode holds the structural measures of one node
+type GraphAnalysisNode struct {
+	GraphNodeRef
+	Depth       int     `json:"depth"` // longest prerequisite chain below the node
+	InDegree    int     `json:"inDegree"`
+	OutDegree   int     `json:"outDegree"`
+	Betweenness float64 `json:"betweenness"` // share of shortest paths through the node, 0-1
+}
+
+// RedundantEdge is a prerequisite that is also required transitively, through
+// another prerequisite of the node
+type RedundantEdge struct {
+	ID           uint           `json:"id"` // of the NodePrerequisite
+	Node         GraphNodeRef   `json:"node"`
+	Prerequisite GraphNodeRef   `json:"prerequisite"`
+	Weight       float64        `json:"weight"`
+	IsManual     bool           `json:"isManual"`
+	Via          []GraphNodeRef `json:"via"` // shortest path between them, excluding both ends
+}
+
+// GraphReduction lists the redundant edges of a domain that a transitive
+// reduction removes, or would remove in a preview
+type GraphReduction struct {
+	DomainID  uint            `json:"domainId"`
+	Applied   bool            `json:"applied"` // false for a preview
+	Removed   int             `json:"removed"`
+	Removable []RedundantEdge `json:"removable"`
+	Kept      []RedundantEdge `json:"kept"` // redundant but added manually
+}
+
+// CreditExplanation lists the recent implicit credits a node received and
+// where they came from
+type CreditExplanation struct {
+	Node    NodeProgress  `json:"node"`
+	Credits []CreditEvent `json:"credits"`
+}
+
+// CreditEvent is one implicit credit as recorded in the review history.
+// Source and Path are empty for credits recorded before paths were kept.
+type CreditEvent struct {
+	HistoryID        uint             `json:"historyId"`
+	ReviewTime       time.Time        `json:"reviewTime"`
+	Credit           float64          `json:"credit"`
+	CreditBefore     *float64         `json:"creditBefore"`
+	CreditAfter      *float64         `json:"creditAfter"`
+	NextReviewBefore *time.Time       `json:"nextReviewBefore"`
+	NextReviewAfter  *time.Time       `json:"nextReviewAfter"`
+	Source           *CreditSource    `json:"source"`
+	Path             []CreditPathStep `json:"path"`
+	Decay            *float64         `json:"decay"`
+	Multiplier       *float64         `json:"multiplier"`
+}
+
+// CreditSource is the explicit review that caused an implicit credit
+type CreditSource struct {
+	HistoryID uint   `json:"historyId"`
+	NodeID    uint   `json:"nodeId"`
+	NodeType  string `json:"nodeType"`
+	NodeCode  string `json:"nodeCode"`
+	NodeName  string `json:"nodeName"`
+	Success   bool   `json:"success"`
+	Quality   *int   `json:"quality"`
+	TimeTaken *int   `json:"timeTaken"`
+}
+
+// CreditPathStep is a hop of a credit path with the node's code and name
+type CreditPathStep struct {
+	CreditHop
+	NodeCode string `json:"nodeCode"`
+	NodeName string `json:"nodeName"`
+}
+
 type DomainProgressSummary struct {
 	DomainID           uint  `json:"domainId"`
 	TotalNodes         int   `json:"totalNodes"`
@@ -193,6 +498,12 @@ type StatusUpdateRequest struct {
 	Status   string `json:"status" binding:"required"`
 }
 
+// Node request for suspend and bury
+type NodeRequest struct {
+	NodeID   uint   `json:"nodeId" binding:"required"`
+	NodeType string `json:"nodeType" binding:"required"`
+}
+
 // Prerequisite models
 type PrerequisiteRequest struct {
 	NodeID           uint    `json:"nodeId" binding:"required"`
@@ -15,6 +15,10 @@ type User struct {
 	LastName  string `gorm:"column:last_name" json:"lastName"`
 	IsActive  bool   `gorm:"column:is_active;default:true" json:"isActive"`
 	IsAdmin   bool   `gorm:"column:is_admin;default:false" json:"isAdmin"`
+
+	// SRS preferences (empty means use the domain setting)
+	SchedulerAlgorithm string   `gorm:"column:scheduler_algorithm" json:"schedulerAlgorithm"`
+	DesiredRetention   *float64 `gorm:"column:desired_retention" json:"desiredRetention"`
 }
 
 // TableName overrides the table name to match our schema
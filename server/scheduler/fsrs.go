@@ -0,0 +1,205 @@
+package scheduler
+
+import (
+	"math"
+	"time"
+
+	"myapp/server/models"
+)
+
+// FSRS constants for the power forgetting curve
+const (
+	fsrsDecay  = -0.5
+	fsrsFactor = 19.0 / 81.0
+
+	// DefaultDesiredRetention is the recall probability FSRS schedules for
+	DefaultDesiredRetention = 0.9
+	// DefaultMaximumInterval caps FSRS intervals (days)
+	DefaultMaximumInterval = 36500.0
+)
+
+// DefaultFSRSWeights are the FSRS-4.5 default model weights
+var DefaultFSRSWeights = [17]float64{
+	0.4872, 1.4003, 3.7145, 13.8206, 5.1618, 1.2298, 0.8975, 0.031,
+	1.6474, 0.1367, 1.0461, 2.1072, 0.0793, 0.3246, 1.587, 0.2272, 2.8755,
+}
+
+// FSRSScheduler implements the Free Spaced Repetition Scheduler, which
+// models each node with a stability (days until recall drops to 90%) and
+// a difficulty (1-10)
+type FSRSScheduler struct {
+	Weights          [17]float64
+	DesiredRetention float64
+	MaximumInterval  float64
+}
+
+// NewFSRSScheduler creates an FSRS scheduler with default weights
+func NewFSRSScheduler() *FSRSScheduler {
+	return &FSRSScheduler{
+		Weights:          DefaultFSRSWeights,
+		DesiredRetention: DefaultDesiredRetention,
+		MaximumInterval:  DefaultMaximumInterval,
+	}
+}
+
+// Name returns the algorithm identifier
+func (f *FSRSScheduler) Name() string {
+	return AlgorithmFSRS
+}
+
+// CalculateNextInterval schedules the next review using FSRS
+func (f *FSRSScheduler) CalculateNextInterval(
+	progress *models.UserNodeProgress,
+	quality int,
+	currentTime time.Time,
+) Result {
+	grade := QualityToGrade(quality)
+	stability, difficulty := f.initialState(progress)
+
+	retrievability := 0.0
+	if stability == 0 {
+		// First review: initialize the memory state from the grade
+		stability = f.initialStability(grade)
+		difficulty = f.initialDifficulty(grade)
+	} else {
+		elapsed := 0.0
+		if progress.LastReview != nil {
+			elapsed = math.Max(0, currentTime.Sub(*progress.LastReview).Hours()/24)
+		}
+		retrievability = Retrievability(elapsed, stability)
+
+		if grade == 1 {
+			stability = f.stabilityAfterForgetting(difficulty, stability, retrievability)
+		} else {
+			stability = f.stabilityAfterRecall(difficulty, stability, retrievability, grade)
+		}
+		difficulty = f.nextDifficulty(difficulty, grade)
+	}
+
+	reps := progress.Repetitions + 1
+	if grade == 1 {
+		reps = 0
+	}
+
+	interval := f.NextInterval(stability)
+
+	return Result{
+		Algorithm:      AlgorithmFSRS,
+		EasinessFactor: progress.EasinessFactor,
+		IntervalDays:   interval,
+		Repetitions:    reps,
+		NextReview:     addDays(currentTime, interval),
+		Stability:      stability,
+		Difficulty:     difficulty,
+		Retrievability: retrievability,
+	}
+}
+
+// NextInterval returns the interval (whole days) at which the predicted
+// recall probability falls to the desired retention
+func (f *FSRSScheduler) NextInterval(stability float64) float64 {
+	interval := stability / fsrsFactor * (math.Pow(f.DesiredRetention, 1/fsrsDecay) - 1)
+	return math.Min(f.MaximumInterval, math.Max(1, math.Round(interval)))
+}
+
+// Retrievability is the predicted recall probability after elapsedDays for
+// a memory of the given stability
+func Retrievability(elapsedDays float64, stability float64) float64 {
+	if stability <= 0 {
+		return 0
+	}
+	return math.Pow(1+fsrsFactor*elapsedDays/stability, fsrsDecay)
+}
+
+// QualityToGrade maps the 0-5 review quality to the FSRS 1-4 grade
+// (again, hard, good, easy)
+func QualityToGrade(quality int) int {
+	switch {
+	case quality < 3:
+		return 1
+	case quality == 3:
+		return 2
+	case quality == 4:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// GradeToQuality maps a 1-4 grade (again, hard, good, easy), as Anki
+// records it, to the 0-5 review quality. QualityToGrade gives the grade back.
+func GradeToQuality(grade int) int {
+	switch {
+	case grade <= 1:
+		return 1
+	case grade == 2:
+		return 3
+	case grade == 3:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// initialState returns the stored FSRS state, seeding it from the SM-2
+// state when the node was previously scheduled with SM-2
+func (f *FSRSScheduler) initialState(progress *models.UserNodeProgress) (float64, float64) {
+	if progress.Stability > 0 {
+		return progress.Stability, clampDifficulty(progress.Difficulty)
+	}
+	if progress.Repetitions == 0 || progress.IntervalDays <= 0 {
+		return 0, 0
+	}
+
+	// An SM-2 interval targets roughly 90% recall, which is what FSRS
+	// stability measures. Map EF 1.3 (hardest) - 2.5+ (easiest) onto 10 - 1.
+	difficulty := 10 - (progress.EasinessFactor-MinEasinessFactor)/(2.5-MinEasinessFactor)*9
+	return progress.IntervalDays, clampDifficulty(difficulty)
+}
+
+func (f *FSRSScheduler) initialStability(grade int) float64 {
+	return math.Max(0.1, f.Weights[grade-1])
+}
+
+func (f *FSRSScheduler) initialDifficulty(grade int) float64 {
+	return clampDifficulty(f.Weights[4] - float64(grade-3)*f.Weights[5])
+}
+
+func (f *FSRSScheduler) nextDifficulty(difficulty float64, grade int) float64 {
+	next := difficulty - f.Weights[6]*float64(grade-3)
+	// Mean reversion towards the initial difficulty of a "good" answer
+	next = f.Weights[7]*f.initialDifficulty(3) + (1-f.Weights[7])*next
+	return clampDifficulty(next)
+}
+
+func (f *FSRSScheduler) stabilityAfterRecall(difficulty, stability, retrievability float64, grade int) float64 {
+	hardPenalty := 1.0
+	if grade == 2 {
+		hardPenalty = f.Weights[15]
+	}
+	easyBonus := 1.0
+	if grade == 4 {
+		easyBonus = f.Weights[16]
+	}
+
+	growth := math.Exp(f.Weights[8]) *
+		(11 - difficulty) *
+		math.Pow(stability, -f.Weights[9]) *
+		(math.Exp((1-retrievability)*f.Weights[10]) - 1) *
+		hardPenalty * easyBonus
+
+	return stability * (growth + 1)
+}
+
+func (f *FSRSScheduler) stabilityAfterForgetting(difficulty, stability, retrievability float64) float64 {
+	next := f.Weights[11] *
+		math.Pow(difficulty, -f.Weights[12]) *
+		(math.Pow(stability+1, f.Weights[13]) - 1) *
+		math.Exp((1-retrievability)*f.Weights[14])
+	// Forgetting never makes a memory more stable than before
+	return math.Max(0.1, math.Min(next, stability))
+}
+
+func clampDifficulty(d float64) float64 {
+	return math.Max(1, math.Min(10, d))
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// fuzzMinInterval is the shortest interval (days) that gets fuzzed
+const fuzzMinInterval = 2.5
+
+// FuzzRange returns the window (whole days) an interval may be moved within.
+// Short intervals get a proportionally wider window: ±15% up to a week,
+// ±10% up to 20 days and ±5% beyond, but always at least one day.
+func FuzzRange(interval float64) (float64, float64) {
+	if interval < fuzzMinInterval {
+		return interval, interval
+	}
+
+	var delta float64
+	switch {
+	case interval < 7:
+		delta = interval * 0.15
+	case interval < 20:
+		delta = interval * 0.1
+	default:
+		delta = interval * 0.05
+	}
+	delta = math.Max(1, math.Round(delta))
+
+	return math.Max(1, math.Round(interval-delta)), math.Round(interval + delta)
+}
+
+// Fuzz moves an interval to a deterministic point of its fuzz window. The
+// same seed (e.g. user, node and repetition) always gives the same interval,
+// while nodes scheduled together spread over different days.
+func Fuzz(interval float64, seed string) float64 {
+	low, high := FuzzRange(interval)
+	if low == high {
+		return interval
+	}
+	return low + math.Floor(seedFraction(seed)*(high-low+1))
+}
+
+// BalanceInterval picks the day of the fuzz window with the fewest reviews
+// already due, as reported by load (days from now -> review count). Ties go
+// to the day closest to the deterministic fuzzed interval. Without a load
+// function this is the same as Fuzz.
+func BalanceInterval(interval float64, seed string, load func(days int) int) float64 {
+	fuzzed := Fuzz(interval, seed)
+	low, high := FuzzRange(interval)
+	if load == nil || low == high {
+		return fuzzed
+	}
+
+	best := fuzzed
+	bestLoad := load(int(fuzzed))
+	for day := low; day <= high; day++ {
+		dayLoad := load(int(day))
+		if dayLoad < bestLoad || (dayLoad == bestLoad && math.Abs(day-fuzzed) < math.Abs(best-fuzzed)) {
+			best, bestLoad = day, dayLoad
+		}
+	}
+	return best
+}
+
+// seedFraction hashes the seed to a number in [0, 1)
+func seedFraction(seed string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	return float64(h.Sum64()>>11) / float64(1<<53)
+}
@@ -0,0 +1,31 @@
+package scheduler
+
+import "myapp/server/models"
+
+// Default graduation rule: a node is learned once its interval reaches three
+// weeks with at least 80% of its explicit reviews successful
+const (
+	DefaultGraduationInterval    = 21.0
+	DefaultGraduationSuccessRate = 0.8
+)
+
+// GraduationPolicy decides when a grasped node is promoted to learned.
+// A MinInterval of 0 turns graduation off.
+type GraduationPolicy struct {
+	MinInterval    float64 // days
+	MinSuccessRate float64 // 0-1, over all explicit reviews of the node
+}
+
+// IsValidSuccessRate reports whether a success rate threshold is usable
+func IsValidSuccessRate(rate float64) bool {
+	return rate >= 0 && rate <= 1
+}
+
+// Graduates reports whether a node meets the graduation rule
+func (p GraduationPolicy) Graduates(progress *models.UserNodeProgress) bool {
+	if p.MinInterval <= 0 || progress.TotalReviews == 0 {
+		return false
+	}
+	successRate := float64(progress.SuccessfulReviews) / float64(progress.TotalReviews)
+	return progress.IntervalDays >= p.MinInterval && successRate >= p.MinSuccessRate
+}
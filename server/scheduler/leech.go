@@ -0,0 +1,38 @@
+package scheduler
+
+// Leech actions: what happens to a node once it becomes a leech
+const (
+	LeechActionTag     = "tag"     // keep reviewing it, but flag it
+	LeechActionSuspend = "suspend" // flag it and take it out of the review queue
+)
+
+// DefaultLeechThreshold is the number of lapses that makes a node a leech
+const DefaultLeechThreshold = 8
+
+// LeechPolicy decides when a node that keeps lapsing becomes a leech.
+// A threshold of 0 turns leech detection off.
+type LeechPolicy struct {
+	Threshold int
+	Action    string
+}
+
+// IsValidLeechAction reports whether the action is supported
+func IsValidLeechAction(action string) bool {
+	return action == LeechActionTag || action == LeechActionSuspend
+}
+
+// IsLapse reports whether a review is a lapse: a failed review (quality
+// below 3) of a node whose previous review was a success. Repeated
+// failures in a row therefore count as a single lapse.
+func IsLapse(previousQuality int, quality int) bool {
+	return previousQuality >= 3 && quality < 3
+}
+
+// Check returns whether a node with the given number of lapses is a leech,
+// and whether it should be suspended
+func (p LeechPolicy) Check(lapses int) (leech bool, suspend bool) {
+	if p.Threshold <= 0 || lapses < p.Threshold {
+		return false, false
+	}
+	return true, p.Action == LeechActionSuspend
+}
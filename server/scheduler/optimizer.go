@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// MinReviewsForFit is the number of scored reviews (reviews that follow an
+// earlier review of the same node) needed before parameters are fitted
+const MinReviewsForFit = 20
+
+// fitTargetRetention is the recall probability an SM-2 interval is assumed
+// to aim for when turning a schedule into a prediction
+const fitTargetRetention = 0.9
+
+// ReviewLog is one explicit review replayed by the optimizer
+type ReviewLog struct {
+	NodeKey    string
+	ReviewTime time.Time
+	Quality    int
+	Success    bool
+}
+
+// FitResult is the outcome of fitting SM-2 parameters to a review log
+type FitResult struct {
+	Params        SM2Params
+	ReviewCount   int
+	LogLossBefore float64
+	LogLossAfter  float64
+}
+
+// paramBound describes the search range of one SM-2 parameter
+type paramBound struct {
+	get     func(p *SM2Params) *float64
+	min     float64
+	max     float64
+	minStep float64
+}
+
+// clamp keeps v within the bounds, on the grid of the minimal step so that
+// intervals stay whole days
+func (b paramBound) clamp(v float64) float64 {
+	v = math.Round(v/b.minStep) * b.minStep
+	return math.Max(b.min, math.Min(b.max, v))
+}
+
+var sm2Bounds = []paramBound{
+	{func(p *SM2Params) *float64 { return &p.FirstInterval }, 1, 5, 1},
+	{func(p *SM2Params) *float64 { return &p.SecondInterval }, 2, 21, 1},
+	{func(p *SM2Params) *float64 { return &p.EFBase }, 0, 0.3, 0.0025},
+	{func(p *SM2Params) *float64 { return &p.EFLinear }, 0, 0.2, 0.0025},
+	{func(p *SM2Params) *float64 { return &p.EFQuadratic }, 0, 0.06, 0.0025},
+}
+
+// SM2LogLoss replays the logs node by node with the given parameters and
+// returns the mean log-loss of the predicted recall against the actual
+// outcome, together with the number of reviews that were scored.
+//
+// The prediction for a review is R = 0.9^(elapsed/interval): the scheduled
+// interval is taken as the point where recall drops to 90%.
+func SM2LogLoss(logs []ReviewLog, params SM2Params) (float64, int) {
+	return replayLogLoss(sortedLogs(logs), params)
+}
+
+// replayLogLoss is SM2LogLoss for logs that are already in chronological order
+func replayLogLoss(logs []ReviewLog, params SM2Params) (float64, int) {
+	type nodeState struct {
+		ef       float64
+		interval float64
+		reps     int
+		last     time.Time
+		seen     bool
+	}
+
+	states := make(map[string]*nodeState)
+	total := 0.0
+	count := 0
+
+	for _, entry := range logs {
+		state, ok := states[entry.NodeKey]
+		if !ok {
+			state = &nodeState{ef: 2.5}
+			states[entry.NodeKey] = state
+		}
+
+		if state.seen && state.interval > 0 {
+			elapsed := math.Max(0, entry.ReviewTime.Sub(state.last).Hours()/24)
+			p := math.Pow(fitTargetRetention, elapsed/state.interval)
+			p = math.Max(1e-4, math.Min(1-1e-4, p))
+			if entry.Success {
+				total -= math.Log(p)
+			} else {
+				total -= math.Log(1 - p)
+			}
+			count++
+		}
+
+		state.ef, state.interval, state.reps = params.Step(state.ef, state.interval, state.reps, entry.Quality)
+		state.last = entry.ReviewTime
+		state.seen = true
+	}
+
+	if count == 0 {
+		return 0, 0
+	}
+	return total / float64(count), count
+}
+
+// FitSM2Params searches for the SM-2 parameters that minimize the log-loss
+// of the review log, starting from initial. The search is a deterministic
+// coordinate descent within fixed bounds; if nothing beats the starting
+// point the initial parameters are returned unchanged.
+func FitSM2Params(logs []ReviewLog, initial SM2Params) FitResult {
+	logs = sortedLogs(logs)
+	before, count := replayLogLoss(logs, initial)
+	result := FitResult{
+		Params:        initial,
+		ReviewCount:   count,
+		LogLossBefore: before,
+		LogLossAfter:  before,
+	}
+	if count == 0 {
+		return result
+	}
+
+	best := initial
+	bestLoss := before
+	steps := make([]float64, len(sm2Bounds))
+	for i, b := range sm2Bounds {
+		// Start inside the bounds even if the initial params are not
+		v := b.get(&best)
+		*v = b.clamp(*v)
+		steps[i] = math.Max(b.minStep, (b.max-b.min)/4)
+	}
+	bestLoss, _ = replayLogLoss(logs, best)
+
+	for iteration := 0; iteration < 200; iteration++ {
+		improved := false
+		for i, b := range sm2Bounds {
+			for _, dir := range []float64{1, -1} {
+				candidate := best
+				v := b.get(&candidate)
+				*v = b.clamp(*v + dir*steps[i])
+				if *v == *b.get(&best) {
+					continue
+				}
+				if loss, _ := replayLogLoss(logs, candidate); loss < bestLoss-1e-9 {
+					best, bestLoss = candidate, loss
+					improved = true
+				}
+			}
+		}
+
+		if improved {
+			continue
+		}
+
+		// No move helped: refine the step sizes, stop once all are minimal
+		refined := false
+		for i, b := range sm2Bounds {
+			if steps[i] > b.minStep {
+				steps[i] = math.Max(b.minStep, steps[i]/2)
+				refined = true
+			}
+		}
+		if !refined {
+			break
+		}
+	}
+
+	if bestLoss < before {
+		result.Params = best
+		result.LogLossAfter = bestLoss
+	}
+	return result
+}
+
+// sortedLogs returns the logs in chronological order (stable for ties)
+func sortedLogs(logs []ReviewLog) []ReviewLog {
+	sorted := make([]ReviewLog, len(logs))
+	copy(sorted, logs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ReviewTime.Before(sorted[j].ReviewTime)
+	})
+	return sorted
+}
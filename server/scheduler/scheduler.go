@@ -0,0 +1,148 @@
+// Package scheduler contains the spaced repetition algorithms used to
+// compute review intervals. It only depends on models so that both the
+// DAOs and the services can share the same formulas.
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"myapp/server/models"
+)
+
+// Algorithm names as stored on users and domains
+const (
+	AlgorithmSM2  = "sm2"
+	AlgorithmFSRS = "fsrs"
+
+	// DefaultAlgorithm is used when neither the user nor the domain picked one
+	DefaultAlgorithm = AlgorithmSM2
+)
+
+// Accepted range for the desired retention setting
+const (
+	MinDesiredRetention = 0.7
+	MaxDesiredRetention = 0.99
+)
+
+// Result represents the outcome of scheduling a review
+type Result struct {
+	Algorithm      string
+	EasinessFactor float64
+	IntervalDays   float64
+	Repetitions    int
+	NextReview     time.Time
+
+	// FSRS memory state (left untouched by SM-2)
+	Stability      float64
+	Difficulty     float64
+	Retrievability float64
+}
+
+// Scheduler computes the next review of a node from its current progress
+type Scheduler interface {
+	// Name returns the algorithm identifier (sm2, fsrs)
+	Name() string
+
+	// CalculateNextInterval schedules the next review after a review of the
+	// given quality (0-5) at currentTime
+	CalculateNextInterval(progress *models.UserNodeProgress, quality int, currentTime time.Time) Result
+}
+
+// IsValidAlgorithm reports whether name is a known algorithm
+func IsValidAlgorithm(name string) bool {
+	return name == AlgorithmSM2 || name == AlgorithmFSRS
+}
+
+// Config selects and tunes a scheduler
+type Config struct {
+	Algorithm        string
+	DesiredRetention float64    // 0 means DefaultDesiredRetention
+	SM2Params        *SM2Params // nil means DefaultSM2Params
+}
+
+// New returns the scheduler with default parameters for the given algorithm
+func New(name string) (Scheduler, error) {
+	return NewWithConfig(Config{Algorithm: name})
+}
+
+// NewWithConfig returns the scheduler described by cfg
+func NewWithConfig(cfg Config) (Scheduler, error) {
+	retention := cfg.DesiredRetention
+	if retention == 0 {
+		retention = DefaultDesiredRetention
+	}
+	if !IsValidRetention(retention) {
+		return nil, fmt.Errorf("desired retention must be between %.2f and %.2f", MinDesiredRetention, MaxDesiredRetention)
+	}
+
+	switch cfg.Algorithm {
+	case AlgorithmSM2, "":
+		s := NewSM2Scheduler()
+		if cfg.SM2Params != nil {
+			s.Params = *cfg.SM2Params
+		}
+		s.DesiredRetention = retention
+		return s, nil
+	case AlgorithmFSRS:
+		f := NewFSRSScheduler()
+		f.DesiredRetention = retention
+		return f, nil
+	default:
+		return nil, fmt.Errorf("unknown scheduling algorithm: %s", cfg.Algorithm)
+	}
+}
+
+// ResolveAlgorithm picks the algorithm for a review: the user's preference
+// wins over the domain setting, and SM-2 is the fallback
+func ResolveAlgorithm(userAlgorithm, domainAlgorithm string) string {
+	if IsValidAlgorithm(userAlgorithm) {
+		return userAlgorithm
+	}
+	if IsValidAlgorithm(domainAlgorithm) {
+		return domainAlgorithm
+	}
+	return DefaultAlgorithm
+}
+
+// IsValidRetention reports whether r is an accepted desired retention
+func IsValidRetention(r float64) bool {
+	return r >= MinDesiredRetention && r <= MaxDesiredRetention
+}
+
+// ResolveRetention picks the desired retention for a review: the user's
+// setting wins over the domain setting, and 90% is the fallback
+func ResolveRetention(userRetention *float64, domainRetention float64) float64 {
+	if userRetention != nil && IsValidRetention(*userRetention) {
+		return *userRetention
+	}
+	if IsValidRetention(domainRetention) {
+		return domainRetention
+	}
+	return DefaultDesiredRetention
+}
+
+// RetentionModifier is the factor applied to an SM-2 interval to target
+// retention r instead of the ~90% SM-2 intervals are tuned for. Under an
+// exponential forgetting curve the time to reach r scales with ln(r).
+func RetentionModifier(r float64) float64 {
+	if r <= 0 || r >= 1 {
+		return 1
+	}
+	return math.Log(r) / math.Log(DefaultDesiredRetention)
+}
+
+// ImplicitQuality derives the quality of an implicit review from the
+// explicit review that triggered it: a pass at the explicit quality, pulled
+// toward the lowest passing grade (3) the less credit the node received.
+func ImplicitQuality(reviewQuality int, credit float64) int {
+	credit = math.Max(0, math.Min(1, credit))
+	quality := 3 + float64(reviewQuality-3)*credit
+	return int(math.Max(3, math.Min(5, math.Round(quality))))
+}
+
+// addDays schedules a review a whole number of days after t
+func addDays(t time.Time, days float64) time.Time {
+	return t.AddDate(0, 0, int(days))
+}
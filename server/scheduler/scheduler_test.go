@@ -0,0 +1,426 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"myapp/server/models"
+)
+
+func TestSM2Step(t *testing.T) {
+	tests := []struct {
+		name         string
+		ef           float64
+		interval     float64
+		reps         int
+		quality      int
+		wantEF       float64
+		wantInterval float64
+		wantReps     int
+	}{
+		{"first success", 2.5, 0, 0, 4, 2.5, 1, 1},
+		{"second success", 2.5, 1, 1, 4, 2.5, 6, 2},
+		{"third success", 2.5, 6, 2, 5, 2.6, 16, 3},
+		{"failure resets", 2.5, 16, 3, 1, 1.96, 1, 0},
+		{"ef floor", 1.3, 6, 2, 0, 1.3, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ef, interval, reps := SM2Step(tt.ef, tt.interval, tt.reps, tt.quality)
+			if math.Abs(ef-tt.wantEF) > 1e-9 {
+				t.Errorf("Expected EF %.2f, got %.2f", tt.wantEF, ef)
+			}
+			if interval != tt.wantInterval {
+				t.Errorf("Expected interval %.0f, got %.0f", tt.wantInterval, interval)
+			}
+			if reps != tt.wantReps {
+				t.Errorf("Expected repetitions %d, got %d", tt.wantReps, reps)
+			}
+		})
+	}
+}
+
+func TestSM2StepTruncated(t *testing.T) {
+	// 6 days at EF 2.6 is 15.6 days: SM2Step rounds it up, the truncated
+	// step down
+	if _, interval, _ := SM2Step(2.5, 6, 2, 5); interval != 16 {
+		t.Errorf("SM2Step interval = %g, want 16", interval)
+	}
+	ef, interval, reps := SM2StepTruncated(2.5, 6, 2, 5)
+	if math.Abs(ef-2.6) > 1e-9 || interval != 15 || reps != 3 {
+		t.Errorf("SM2StepTruncated = %g, %g, %d, want 2.6, 15, 3", ef, interval, reps)
+	}
+	if _, interval, reps := SM2StepTruncated(2.5, 15, 3, 1); interval != 1 || reps != 0 {
+		t.Errorf("SM2StepTruncated after a failure = %g, %d, want 1, 0", interval, reps)
+	}
+}
+
+func TestFSRSFirstReview(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	progress := &models.UserNodeProgress{EasinessFactor: 2.5}
+
+	result := NewFSRSScheduler().CalculateNextInterval(progress, 4, now)
+
+	if result.Algorithm != AlgorithmFSRS {
+		t.Errorf("Expected algorithm %s, got %s", AlgorithmFSRS, result.Algorithm)
+	}
+	if result.Stability != DefaultFSRSWeights[2] {
+		t.Errorf("Expected initial stability %.4f, got %.4f", DefaultFSRSWeights[2], result.Stability)
+	}
+	if result.Repetitions != 1 {
+		t.Errorf("Expected repetitions 1, got %d", result.Repetitions)
+	}
+	if result.IntervalDays < 1 {
+		t.Errorf("Expected interval of at least 1 day, got %.0f", result.IntervalDays)
+	}
+	if result.EasinessFactor != 2.5 {
+		t.Errorf("Expected FSRS to leave EF untouched, got %.2f", result.EasinessFactor)
+	}
+}
+
+func TestFSRSIntervalGrowth(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	f := NewFSRSScheduler()
+	progress := &models.UserNodeProgress{EasinessFactor: 2.5}
+
+	// Successive on-time "good" reviews should give growing intervals
+	previous := 0.0
+	for i := 0; i < 4; i++ {
+		result := f.CalculateNextInterval(progress, 4, now)
+		if result.IntervalDays <= previous {
+			t.Fatalf("Review %d: expected interval above %.0f, got %.0f", i+1, previous, result.IntervalDays)
+		}
+		previous = result.IntervalDays
+
+		last := now
+		progress.LastReview = &last
+		progress.Stability = result.Stability
+		progress.Difficulty = result.Difficulty
+		progress.Repetitions = result.Repetitions
+		progress.IntervalDays = result.IntervalDays
+		now = result.NextReview
+	}
+
+	// A lapse shrinks stability and resets repetitions
+	result := f.CalculateNextInterval(progress, 1, now)
+	if result.Stability >= progress.Stability {
+		t.Errorf("Expected stability to drop after a lapse, got %.2f (was %.2f)", result.Stability, progress.Stability)
+	}
+	if result.Repetitions != 0 {
+		t.Errorf("Expected repetitions 0 after a lapse, got %d", result.Repetitions)
+	}
+}
+
+func TestFSRSSeedsFromSM2(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	last := now.AddDate(0, 0, -10)
+	progress := &models.UserNodeProgress{
+		EasinessFactor: 2.5,
+		IntervalDays:   10,
+		Repetitions:    3,
+		LastReview:     &last,
+	}
+
+	result := NewFSRSScheduler().CalculateNextInterval(progress, 4, now)
+	if result.Stability <= 10 {
+		t.Errorf("Expected stability seeded from the SM-2 interval to grow, got %.2f", result.Stability)
+	}
+	if result.Retrievability < 0.85 || result.Retrievability > 0.95 {
+		t.Errorf("Expected retrievability near 0.9 at the SM-2 due date, got %.3f", result.Retrievability)
+	}
+}
+
+func TestResolveAlgorithm(t *testing.T) {
+	tests := []struct {
+		user, domain, want string
+	}{
+		{"", "", AlgorithmSM2},
+		{"", AlgorithmFSRS, AlgorithmFSRS},
+		{AlgorithmSM2, AlgorithmFSRS, AlgorithmSM2},
+		{AlgorithmFSRS, "", AlgorithmFSRS},
+		{"bogus", AlgorithmFSRS, AlgorithmFSRS},
+	}
+
+	for _, tt := range tests {
+		if got := ResolveAlgorithm(tt.user, tt.domain); got != tt.want {
+			t.Errorf("ResolveAlgorithm(%q, %q) = %q, want %q", tt.user, tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, name := range []string{"", AlgorithmSM2, AlgorithmFSRS} {
+		s, err := New(name)
+		if err != nil {
+			t.Fatalf("New(%q) returned error: %v", name, err)
+		}
+		want := name
+		if want == "" {
+			want = AlgorithmSM2
+		}
+		if s.Name() != want {
+			t.Errorf("New(%q).Name() = %q, want %q", name, s.Name(), want)
+		}
+	}
+
+	if _, err := New("bogus"); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+}
+
+func TestFitSM2Params(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A user who keeps forgetting shortly after the third interval: default
+	// SM-2 predicts ~90% recall there, so fitting should lower the log-loss
+	var logs []ReviewLog
+	for node := 0; node < 15; node++ {
+		key := fmt.Sprintf("definition_%d", node)
+		base := start.AddDate(0, 0, node)
+		logs = append(logs,
+			ReviewLog{NodeKey: key, ReviewTime: base, Quality: 4, Success: true},
+			ReviewLog{NodeKey: key, ReviewTime: base.AddDate(0, 0, 1), Quality: 4, Success: true},
+			ReviewLog{NodeKey: key, ReviewTime: base.AddDate(0, 0, 7), Quality: 4, Success: true},
+			ReviewLog{NodeKey: key, ReviewTime: base.AddDate(0, 0, 23), Quality: 1, Success: false},
+		)
+	}
+
+	result := FitSM2Params(logs, DefaultSM2Params)
+
+	if result.ReviewCount != 45 {
+		t.Errorf("Expected 45 scored reviews, got %d", result.ReviewCount)
+	}
+	if result.LogLossAfter >= result.LogLossBefore {
+		t.Errorf("Expected fitted log-loss below %.4f, got %.4f", result.LogLossBefore, result.LogLossAfter)
+	}
+	if loss, _ := SM2LogLoss(logs, result.Params); math.Abs(loss-result.LogLossAfter) > 1e-9 {
+		t.Errorf("Expected reported log-loss %.4f to match replay %.4f", result.LogLossAfter, loss)
+	}
+	if result.Params.FirstInterval != math.Round(result.Params.FirstInterval) ||
+		result.Params.SecondInterval != math.Round(result.Params.SecondInterval) {
+		t.Errorf("Expected whole-day initial intervals, got %.2f and %.2f", result.Params.FirstInterval, result.Params.SecondInterval)
+	}
+
+	// Fitting is deterministic
+	if again := FitSM2Params(logs, DefaultSM2Params); again.Params != result.Params {
+		t.Errorf("Expected identical fits, got %+v and %+v", result.Params, again.Params)
+	}
+}
+
+func TestSM2LogLossNeedsRepeatedReviews(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	logs := []ReviewLog{
+		{NodeKey: "definition_1", ReviewTime: now, Quality: 4, Success: true},
+		{NodeKey: "definition_2", ReviewTime: now, Quality: 4, Success: true},
+	}
+
+	loss, count := SM2LogLoss(logs, DefaultSM2Params)
+	if count != 0 || loss != 0 {
+		t.Errorf("Expected no scored reviews, got %d (loss %.4f)", count, loss)
+	}
+}
+
+func TestDesiredRetentionScalesIntervals(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	progress := &models.UserNodeProgress{EasinessFactor: 2.5, IntervalDays: 6, Repetitions: 2}
+
+	intervalAt := func(algorithm string, retention float64) float64 {
+		s, err := NewWithConfig(Config{Algorithm: algorithm, DesiredRetention: retention})
+		if err != nil {
+			t.Fatalf("NewWithConfig(%s, %.2f) returned error: %v", algorithm, retention, err)
+		}
+		return s.CalculateNextInterval(progress, 4, now).IntervalDays
+	}
+
+	for _, algorithm := range []string{AlgorithmSM2, AlgorithmFSRS} {
+		low, normal, high := intervalAt(algorithm, 0.8), intervalAt(algorithm, 0.9), intervalAt(algorithm, 0.95)
+		if !(low > normal && normal > high) {
+			t.Errorf("%s: expected intervals to shrink as retention rises, got %.0f / %.0f / %.0f", algorithm, low, normal, high)
+		}
+	}
+
+	if got := intervalAt(AlgorithmSM2, 0.9); got != 15 {
+		t.Errorf("Expected the default retention to keep the SM-2 interval at 15, got %.0f", got)
+	}
+
+	if _, err := NewWithConfig(Config{Algorithm: AlgorithmSM2, DesiredRetention: 0.5}); err == nil {
+		t.Error("Expected error for retention outside the accepted range")
+	}
+}
+
+func TestResolveRetention(t *testing.T) {
+	user := 0.85
+	invalid := 0.2
+
+	if got := ResolveRetention(&user, 0.95); got != 0.85 {
+		t.Errorf("Expected the user setting to win, got %.2f", got)
+	}
+	if got := ResolveRetention(nil, 0.95); got != 0.95 {
+		t.Errorf("Expected the domain setting, got %.2f", got)
+	}
+	if got := ResolveRetention(&invalid, 0); got != DefaultDesiredRetention {
+		t.Errorf("Expected the default retention, got %.2f", got)
+	}
+}
+
+func TestFuzzIsDeterministicAndBounded(t *testing.T) {
+	for _, interval := range []float64{1, 2, 6, 15, 60} {
+		low, high := FuzzRange(interval)
+		seen := make(map[float64]bool)
+		for node := 0; node < 50; node++ {
+			seed := fmt.Sprintf("1:definition_%d:2", node)
+			fuzzed := Fuzz(interval, seed)
+			if fuzzed != Fuzz(interval, seed) {
+				t.Fatalf("Fuzz(%.0f, %q) is not deterministic", interval, seed)
+			}
+			if fuzzed < low || fuzzed > high {
+				t.Errorf("Fuzz(%.0f) = %.0f, outside [%.0f, %.0f]", interval, fuzzed, low, high)
+			}
+			seen[fuzzed] = true
+		}
+		if interval >= 6 && len(seen) < 2 {
+			t.Errorf("Expected nodes with interval %.0f to spread over several days", interval)
+		}
+		if interval < 2.5 && (len(seen) != 1 || !seen[interval]) {
+			t.Errorf("Expected short interval %.0f to stay unchanged", interval)
+		}
+	}
+}
+
+func TestBalanceIntervalPicksQuietestDay(t *testing.T) {
+	low, high := FuzzRange(15)
+	quiet := low + 1
+	load := func(days int) int {
+		if float64(days) == quiet {
+			return 0
+		}
+		return 10
+	}
+
+	for node := 0; node < 20; node++ {
+		if got := BalanceInterval(15, fmt.Sprintf("1:exercise_%d:3", node), load); got != quiet {
+			t.Errorf("Expected the quiet day %.0f within [%.0f, %.0f], got %.0f", quiet, low, high, got)
+		}
+	}
+
+	// Equal load falls back to the fuzzed interval
+	flat := func(days int) int { return 3 }
+	if got, want := BalanceInterval(15, "seed", flat), Fuzz(15, "seed"); got != want {
+		t.Errorf("Expected fuzzed interval %.0f under flat load, got %.0f", want, got)
+	}
+}
+
+func TestLeechPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      LeechPolicy
+		lapses      int
+		wantLeech   bool
+		wantSuspend bool
+	}{
+		{"below threshold", LeechPolicy{Threshold: 8, Action: LeechActionTag}, 7, false, false},
+		{"tag at threshold", LeechPolicy{Threshold: 8, Action: LeechActionTag}, 8, true, false},
+		{"suspend at threshold", LeechPolicy{Threshold: 4, Action: LeechActionSuspend}, 4, true, true},
+		{"suspend above threshold", LeechPolicy{Threshold: 4, Action: LeechActionSuspend}, 9, true, true},
+		{"disabled", LeechPolicy{Threshold: 0, Action: LeechActionSuspend}, 20, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leech, suspend := tt.policy.Check(tt.lapses)
+			if leech != tt.wantLeech || suspend != tt.wantSuspend {
+				t.Errorf("Check(%d) = (%v, %v), want (%v, %v)", tt.lapses, leech, suspend, tt.wantLeech, tt.wantSuspend)
+			}
+		})
+	}
+}
+
+func TestIsLapse(t *testing.T) {
+	tests := []struct {
+		previous int
+		quality  int
+		want     bool
+	}{
+		{4, 2, true},
+		{3, 0, true},
+		{2, 1, false}, // still failing, same lapse
+		{4, 3, false},
+		{1, 4, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsLapse(tt.previous, tt.quality); got != tt.want {
+			t.Errorf("IsLapse(%d, %d) = %v, want %v", tt.previous, tt.quality, got, tt.want)
+		}
+	}
+}
+
+func TestGraduationPolicy(t *testing.T) {
+	policy := GraduationPolicy{MinInterval: 21, MinSuccessRate: 0.8}
+
+	tests := []struct {
+		name       string
+		policy     GraduationPolicy
+		interval   float64
+		successful int
+		total      int
+		want       bool
+	}{
+		{"meets both", policy, 25, 9, 10, true},
+		{"exactly at thresholds", policy, 21, 8, 10, true},
+		{"interval too short", policy, 20, 10, 10, false},
+		{"success rate too low", policy, 30, 7, 10, false},
+		{"never reviewed", policy, 30, 0, 0, false},
+		{"disabled", GraduationPolicy{MinInterval: 0, MinSuccessRate: 0}, 300, 10, 10, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := &models.UserNodeProgress{
+				IntervalDays:      tt.interval,
+				SuccessfulReviews: tt.successful,
+				TotalReviews:      tt.total,
+			}
+			if got := tt.policy.Graduates(progress); got != tt.want {
+				t.Errorf("Graduates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImplicitQuality(t *testing.T) {
+	tests := []struct {
+		quality int
+		credit  float64
+		want    int
+	}{
+		{5, 1, 5},
+		{5, 0.5, 4},
+		{5, 0.2, 3},
+		{4, 1, 4},
+		{3, 1, 3},
+		{1, 1, 3}, // implicit postponements are always passes
+		{5, 2, 5}, // credit is capped at 1
+	}
+
+	for _, tt := range tests {
+		if got := ImplicitQuality(tt.quality, tt.credit); got != tt.want {
+			t.Errorf("ImplicitQuality(%d, %.1f) = %d, want %d", tt.quality, tt.credit, got, tt.want)
+		}
+	}
+}
+
+func TestGradeToQuality(t *testing.T) {
+	for grade, want := range map[int]int{1: 1, 2: 3, 3: 4, 4: 5} {
+		quality := GradeToQuality(grade)
+		if quality != want {
+			t.Errorf("GradeToQuality(%d) = %d, want %d", grade, quality, want)
+		}
+		if back := QualityToGrade(quality); back != grade {
+			t.Errorf("QualityToGrade(GradeToQuality(%d)) = %d", grade, back)
+		}
+	}
+}
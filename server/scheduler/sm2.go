@@ -0,0 +1,123 @@
+package scheduler
+
+import (
+	"math"
+	"time"
+
+	"myapp/server/models"
+)
+
+// MinEasinessFactor is the lowest easiness factor allowed by SM-2
+const MinEasinessFactor = 1.3
+
+// SM2Params are the tunable constants of SM-2. The EF update after a
+// review of quality q is EFBase - (5-q)*(EFLinear + (5-q)*EFQuadratic).
+type SM2Params struct {
+	FirstInterval  float64 `json:"firstInterval"`  // interval after the first success (and after a lapse)
+	SecondInterval float64 `json:"secondInterval"` // interval after the second success
+	EFBase         float64 `json:"efBase"`
+	EFLinear       float64 `json:"efLinear"`
+	EFQuadratic    float64 `json:"efQuadratic"`
+}
+
+// DefaultSM2Params are the constants of the original SM-2 algorithm
+var DefaultSM2Params = SM2Params{
+	FirstInterval:  1,
+	SecondInterval: 6,
+	EFBase:         0.1,
+	EFLinear:       0.08,
+	EFQuadratic:    0.02,
+}
+
+// SM2Scheduler implements the SM-2 algorithm. Intervals are stretched or
+// shrunk by RetentionModifier when DesiredRetention differs from 90%, like
+// Anki's interval modifier.
+type SM2Scheduler struct {
+	Params           SM2Params
+	DesiredRetention float64
+}
+
+// NewSM2Scheduler creates a new SM-2 scheduler with the default parameters
+func NewSM2Scheduler() *SM2Scheduler {
+	return &SM2Scheduler{Params: DefaultSM2Params, DesiredRetention: DefaultDesiredRetention}
+}
+
+// NewSM2SchedulerWithParams creates an SM-2 scheduler with custom (e.g.
+// fitted per user) parameters
+func NewSM2SchedulerWithParams(params SM2Params) *SM2Scheduler {
+	return &SM2Scheduler{Params: params, DesiredRetention: DefaultDesiredRetention}
+}
+
+// Name returns the algorithm identifier
+func (s *SM2Scheduler) Name() string {
+	return AlgorithmSM2
+}
+
+// CalculateNextInterval implements the SM-2 algorithm
+func (s *SM2Scheduler) CalculateNextInterval(
+	progress *models.UserNodeProgress,
+	quality int,
+	currentTime time.Time,
+) Result {
+	ef, interval, reps := s.Params.Step(progress.EasinessFactor, progress.IntervalDays, progress.Repetitions, quality)
+
+	if modifier := RetentionModifier(s.DesiredRetention); modifier != 1 {
+		interval = math.Max(1, math.Round(interval*modifier))
+	}
+
+	return Result{
+		Algorithm:      AlgorithmSM2,
+		EasinessFactor: ef,
+		IntervalDays:   interval,
+		Repetitions:    reps,
+		NextReview:     addDays(currentTime, interval),
+		Stability:      progress.Stability,
+		Difficulty:     progress.Difficulty,
+	}
+}
+
+// SM2Step applies one SM-2 review with the default parameters and returns
+// the new easiness factor, interval (days) and repetition count
+func SM2Step(ef float64, interval float64, reps int, quality int) (float64, float64, int) {
+	return DefaultSM2Params.Step(ef, interval, reps, quality)
+}
+
+// SM2StepTruncated is SM2Step with intervals past the second success
+// rounded down instead of to the nearest day, as the legacy definition
+// progress tracking does
+func SM2StepTruncated(ef float64, interval float64, reps int, quality int) (float64, float64, int) {
+	return DefaultSM2Params.step(ef, interval, reps, quality, math.Trunc)
+}
+
+// Step applies one SM-2 review to the given state and returns the new
+// easiness factor, interval (days) and repetition count
+func (p SM2Params) Step(ef float64, interval float64, reps int, quality int) (float64, float64, int) {
+	return p.step(ef, interval, reps, quality, math.Round)
+}
+
+// step applies one SM-2 review, turning the grown interval into whole days
+// with round
+func (p SM2Params) step(ef float64, interval float64, reps int, quality int, round func(float64) float64) (float64, float64, int) {
+	// Update easiness factor (EF cannot go below 1.3)
+	miss := float64(5 - quality)
+	ef = math.Max(MinEasinessFactor, ef+(p.EFBase-miss*(p.EFLinear+miss*p.EFQuadratic)))
+
+	// Calculate next interval
+	if quality < 3 {
+		// Failed review - restart
+		reps = 0
+		interval = p.FirstInterval
+	} else {
+		// Successful review
+		reps++
+		if reps == 1 {
+			interval = p.FirstInterval
+		} else if reps == 2 {
+			interval = p.SecondInterval
+		} else {
+			interval = round(interval * ef)
+		}
+	}
+
+	return ef, interval, reps
+}
@@ -0,0 +1,454 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"myapp/server/anki"
+	"myapp/server/dao"
+	"myapp/server/graph"
+	"myapp/server/models"
+	"myapp/server/scheduler"
+)
+
+// prerequisiteTagPrefix marks the tags that carry the prerequisite codes of
+// an exported note, e.g. prereq::SET-1
+const prerequisiteTagPrefix = "prereq::"
+
+// IDs of the exported note types, fixed so that Anki recognizes them when a
+// domain is exported again
+const (
+	ankiDefinitionNoteTypeID int64 = 1590000000001
+	ankiExerciseNoteTypeID   int64 = 1590000000002
+)
+
+// ankiDeckIDBase plus the domain ID is the ID of a domain's deck
+const ankiDeckIDBase int64 = 1590000000000
+
+const ankiCSS = `.card { font-family: arial; font-size: 20px; text-align: center; color: black; background-color: white; }
+.code { font-size: 14px; color: grey; }
+.description, .notes, .references, .result { text-align: left; margin-top: 12px; }
+.notes, .references { font-size: 16px; color: #555; }`
+
+// fieldReplacer turns node text into Anki's HTML fields
+var fieldReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\n", "<br>")
+
+// AnkiExportService builds Anki packages from domains
+type AnkiExportService struct {
+	db *gorm.DB
+}
+
+// NewAnkiExportService creates a new Anki export service instance
+func NewAnkiExportService(db *gorm.DB) *AnkiExportService {
+	return &AnkiExportService{db: db}
+}
+
+// ankiSchedule is the scheduling state of a user carried into an export
+type ankiSchedule struct {
+	progress []models.UserNodeProgress
+	reviews  []models.ReviewHistory // explicit reviews, oldest first
+}
+
+// Export builds an Anki package from the definitions and exercises of a
+// domain, one note and card each, in one deck named after the domain. New
+// cards come in prerequisite order. With includeSchedule the cards carry the
+// user's progress and review history, so the user can go on studying in Anki.
+func (s *AnkiExportService) Export(domainID uint, userID uint, includeSchedule bool) (*anki.Package, error) {
+	domain, err := dao.NewDomainDAO(s.db).FindByID(domainID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := dao.NewGraphDAO(s.db).ExportDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule *ankiSchedule
+	if includeSchedule {
+		srsDao := dao.NewSRSDao(s.db)
+		progress, err := srsDao.GetDomainNodeProgress(userID, domainID)
+		if err != nil {
+			return nil, err
+		}
+		reviews, err := srsDao.GetDomainExplicitReviews(userID, domainID)
+		if err != nil {
+			return nil, err
+		}
+		schedule = &ankiSchedule{progress: progress, reviews: reviews}
+	}
+	return ankiPackage(domain, data, schedule, time.Now()), nil
+}
+
+// exportedNode is a definition or exercise of an export
+type exportedNode struct {
+	key        string // node key, e.g. definition_12
+	nodeType   string
+	definition dao.DefinitionNode
+	exercise   dao.ExerciseNode
+}
+
+func (n exportedNode) prerequisites() []string {
+	if n.nodeType == "exercise" {
+		return n.exercise.Prerequisites
+	}
+	return n.definition.Prerequisites
+}
+
+func (n exportedNode) tags() []string {
+	if n.nodeType == "exercise" {
+		return n.exercise.Tags
+	}
+	return n.definition.Tags
+}
+
+// ankiPackage maps the export of a domain to an Anki package. Descriptions
+// split on ||| fill the fields Description, Description 2..., prerequisite
+// codes become tags, and with a schedule the cards carry its progress and
+// review history.
+func ankiPackage(domain *models.Domain, data *dao.GraphData, schedule *ankiSchedule, now time.Time) *anki.Package {
+	nodes := orderedNodes(data)
+
+	// Enough description fields for the longest description
+	definitionDescriptions, exerciseDescriptions := 1, 1
+	for _, node := range nodes {
+		if node.nodeType == "exercise" {
+			exerciseDescriptions = max(exerciseDescriptions, len(splitDescription(node.exercise.Description)))
+		} else {
+			definitionDescriptions = max(definitionDescriptions, len(splitDescription(node.definition.Description)))
+		}
+	}
+
+	deckID := ankiDeckIDBase + int64(domain.ID)
+	pkg := &anki.Package{
+		Created:   ankiCreated(domain, schedule, now),
+		NoteTypes: map[int64]anki.NoteType{},
+		Decks:     map[int64]string{deckID: domain.Name},
+		Media:     map[string][]byte{},
+	}
+
+	progress := map[string]*models.UserNodeProgress{}
+	if schedule != nil {
+		for i := range schedule.progress {
+			p := &schedule.progress[i]
+			progress[fmt.Sprintf("%s_%d", p.NodeType, p.NodeID)] = p
+		}
+	}
+
+	cardIDs := map[string]int64{}
+	base := now.UnixMilli()
+	for i, node := range nodes {
+		var noteType anki.NoteType
+		var fields []string
+		if node.nodeType == "exercise" {
+			noteType = exerciseNoteType(exerciseDescriptions)
+			fields = exerciseFields(node.exercise, exerciseDescriptions)
+		} else {
+			noteType = definitionNoteType(definitionDescriptions)
+			fields = definitionFields(node.definition, definitionDescriptions)
+		}
+		pkg.NoteTypes[noteType.ID] = noteType
+
+		note := anki.Note{
+			ID:         base + int64(i),
+			GUID:       "ankidemy-" + node.key,
+			NoteTypeID: noteType.ID,
+			Fields:     fields,
+			Tags:       ankiTags(node, progress[node.key]),
+		}
+		card := ankiCard(pkg, progress[node.key], i+1, now)
+		card.ID, card.NoteID, card.DeckID = note.ID, note.ID, deckID
+		pkg.Notes = append(pkg.Notes, note)
+		pkg.Cards = append(pkg.Cards, card)
+		cardIDs[node.key] = card.ID
+	}
+
+	if schedule != nil {
+		pkg.Reviews = ankiReviews(schedule.reviews, cardIDs)
+	}
+	return pkg
+}
+
+// orderedNodes lists the nodes of an export so that every node comes after
+// its prerequisites, definitions before exercises and by ID otherwise
+func orderedNodes(data *dao.GraphData) []exportedNode {
+	byOrder := map[string]exportedNode{}
+	codes := map[string]string{} // definition code to order key, the oldest definition wins
+	for key, def := range data.Definitions {
+		id, _ := strconv.ParseUint(key, 10, 32)
+		orderKey := fmt.Sprintf("definition_%010d", id)
+		byOrder[orderKey] = exportedNode{key: "definition_" + key, nodeType: "definition", definition: def}
+		if current, exists := codes[def.Code]; !exists || orderKey < current {
+			codes[def.Code] = orderKey
+		}
+	}
+	for key, ex := range data.Exercises {
+		id, _ := strconv.ParseUint(key, 10, 32)
+		byOrder[fmt.Sprintf("exercise_%010d", id)] = exportedNode{key: "exercise_" + key, nodeType: "exercise", exercise: ex}
+	}
+
+	keys := make([]string, 0, len(byOrder))
+	for orderKey := range byOrder {
+		keys = append(keys, orderKey)
+	}
+	sort.Strings(keys)
+	edges := graph.Edges{}
+	for _, orderKey := range keys {
+		for _, code := range byOrder[orderKey].prerequisites() {
+			if prerequisite, exists := codes[code]; exists {
+				edges.Add(orderKey, prerequisite)
+			}
+		}
+	}
+	if order, err := graph.Order(edges, keys); err == nil {
+		keys = order
+	}
+
+	nodes := make([]exportedNode, len(keys))
+	for i, orderKey := range keys {
+		nodes[i] = byOrder[orderKey]
+	}
+	return nodes
+}
+
+// ankiCreated is the day the exported collection starts, from which the due
+// days of review cards count: the day of the domain's creation or of the
+// first review, whichever comes first
+func ankiCreated(domain *models.Domain, schedule *ankiSchedule, now time.Time) time.Time {
+	created := now
+	if !domain.CreatedAt.IsZero() && domain.CreatedAt.Before(created) {
+		created = domain.CreatedAt
+	}
+	if schedule != nil {
+		for _, p := range schedule.progress {
+			if p.LastReview != nil && p.LastReview.Before(created) {
+				created = *p.LastReview
+			}
+		}
+		for _, review := range schedule.reviews {
+			if review.ReviewTime.Before(created) {
+				created = review.ReviewTime
+			}
+		}
+	}
+	created = created.UTC()
+	return time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func splitDescription(description string) []string {
+	if strings.TrimSpace(description) == "" {
+		return nil
+	}
+	parts := strings.Split(description, "|||")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+// descriptionFields names the description fields: Description,
+// Description 2...
+func descriptionFields(count int) []string {
+	names := make([]string, count)
+	for i := range names {
+		names[i] = "Description"
+		if i > 0 {
+			names[i] = fmt.Sprintf("Description %d", i+1)
+		}
+	}
+	return names
+}
+
+// descriptionTemplate shows the filled description fields
+func descriptionTemplate(count int) string {
+	var b strings.Builder
+	for _, name := range descriptionFields(count) {
+		fmt.Fprintf(&b, "{{#%[1]s}}<div class=\"description\">{{%[1]s}}</div>{{/%[1]s}}", name)
+	}
+	return b.String()
+}
+
+func definitionNoteType(descriptions int) anki.NoteType {
+	fields := append([]string{"Code", "Name"}, descriptionFields(descriptions)...)
+	return anki.NoteType{
+		ID:        ankiDefinitionNoteTypeID,
+		Name:      "Ankidemy Definition",
+		Kind:      anki.KindStandard,
+		Fields:    append(fields, "Notes", "References"),
+		SortField: 1,
+		Templates: []anki.Template{{
+			Name:  "Definition",
+			Front: `<div class="code">{{Code}}</div><div class="name">{{Name}}</div>`,
+			Back: `{{FrontSide}}<hr id=answer>` + descriptionTemplate(descriptions) +
+				`{{#Notes}}<div class="notes">{{Notes}}</div>{{/Notes}}` +
+				`{{#References}}<div class="references">{{References}}</div>{{/References}}`,
+		}},
+		CSS: ankiCSS,
+	}
+}
+
+func exerciseNoteType(descriptions int) anki.NoteType {
+	fields := append([]string{"Code", "Name", "Statement", "Difficulty"}, descriptionFields(descriptions)...)
+	return anki.NoteType{
+		ID:        ankiExerciseNoteTypeID,
+		Name:      "Ankidemy Exercise",
+		Kind:      anki.KindStandard,
+		Fields:    append(fields, "Hints", "Result"),
+		SortField: 1,
+		Templates: []anki.Template{{
+			Name: "Exercise",
+			Front: `<div class="code">{{Code}}</div><div class="name">{{Name}}</div>` +
+				`<div class="statement">{{Statement}}</div>{{#Hints}}<div class="hints">{{hint:Hints}}</div>{{/Hints}}`,
+			Back: `{{FrontSide}}<hr id=answer>{{#Result}}<div class="result">{{Result}}</div>{{/Result}}` +
+				descriptionTemplate(descriptions),
+		}},
+		CSS: ankiCSS,
+	}
+}
+
+func definitionFields(def dao.DefinitionNode, descriptions int) []string {
+	references := make([]string, len(def.References))
+	for i, reference := range def.References {
+		references[i] = fieldReplacer.Replace(reference)
+	}
+	fields := []string{fieldReplacer.Replace(def.Code), fieldReplacer.Replace(def.Name)}
+	fields = append(fields, descriptionValues(def.Description, descriptions)...)
+	return append(fields, fieldReplacer.Replace(def.Notes), strings.Join(references, "<br>"))
+}
+
+func exerciseFields(ex dao.ExerciseNode, descriptions int) []string {
+	difficulty := ""
+	if ex.Difficulty > 0 {
+		difficulty = strconv.Itoa(ex.Difficulty)
+	}
+	fields := []string{fieldReplacer.Replace(ex.Code), fieldReplacer.Replace(ex.Name), fieldReplacer.Replace(ex.Statement), difficulty}
+	fields = append(fields, descriptionValues(ex.Description, descriptions)...)
+	return append(fields, fieldReplacer.Replace(ex.Hints), fieldReplacer.Replace(ex.Result))
+}
+
+func descriptionValues(description string, count int) []string {
+	values := make([]string, count)
+	for i, part := range splitDescription(description) {
+		values[i] = fieldReplacer.Replace(part)
+	}
+	return values
+}
+
+// ankiTags are the tags of a node and its prerequisites; Anki tags cannot
+// hold spaces, which become underscores
+func ankiTags(node exportedNode, progress *models.UserNodeProgress) []string {
+	var tags []string
+	for _, tag := range node.tags() {
+		if tag = ankiTag(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	for _, code := range node.prerequisites() {
+		if code = ankiTag(code); code != "" {
+			tags = append(tags, prerequisiteTagPrefix+code)
+		}
+	}
+	if progress != nil && progress.IsLeech {
+		tags = append(tags, "leech")
+	}
+	return tags
+}
+
+func ankiTag(tag string) string {
+	return strings.Join(strings.Fields(tag), "_")
+}
+
+// ankiCard gives a node's card the scheduling state of its progress: nodes
+// never reviewed are new cards at their position in the export, reviewed
+// ones review cards due on their next review day
+func ankiCard(pkg *anki.Package, progress *models.UserNodeProgress, position int, now time.Time) anki.Card {
+	card := anki.Card{Type: anki.CardNew, Queue: anki.QueueNew, Due: int64(position)}
+	if progress == nil {
+		return card
+	}
+
+	if progress.LastReview != nil && progress.NextReview != nil {
+		factor := int(math.Round(progress.EasinessFactor * 1000))
+		card = anki.Card{
+			Type:     anki.CardReview,
+			Queue:    anki.QueueReview,
+			Due:      int64(math.Max(0, math.Floor(progress.NextReview.Sub(pkg.Created).Hours()/24))),
+			Interval: int(math.Max(1, math.Round(progress.IntervalDays))),
+			Factor:   max(factor, 1300),
+			Reps:     progress.TotalReviews,
+			Lapses:   progress.Lapses,
+		}
+		if progress.BuriedUntil != nil && progress.BuriedUntil.After(now) {
+			card.Queue = anki.QueueBuried
+		}
+	}
+	if progress.Suspended {
+		card.Queue = anki.QueueSuspended
+	}
+	return card
+}
+
+// ankiReviews turns the explicit reviews of the exported nodes into the
+// review log of their cards. A node's first review is a learning review,
+// one after a failure a relearning review.
+func ankiReviews(history []models.ReviewHistory, cardIDs map[string]int64) []anki.Review {
+	reviews := []anki.Review{}
+	used := map[int64]bool{}
+	failed := map[int64]bool{}
+	for _, entry := range history {
+		cardID, exists := cardIDs[fmt.Sprintf("%s_%d", entry.NodeType, entry.NodeID)]
+		if !exists {
+			continue
+		}
+
+		// The log is keyed by the review time in milliseconds
+		id := entry.ReviewTime.UnixMilli()
+		for used[id] {
+			id++
+		}
+		used[id] = true
+
+		review := anki.Review{ID: id, CardID: cardID, Ease: 3, Type: anki.ReviewReview}
+		if entry.Quality != nil {
+			review.Ease = scheduler.QualityToGrade(*entry.Quality)
+		} else if !entry.Success {
+			review.Ease = 1
+		}
+		if entry.IntervalAfter != nil {
+			review.Interval = ankiInterval(*entry.IntervalAfter)
+		}
+		if entry.IntervalBefore != nil {
+			review.LastInterval = ankiInterval(*entry.IntervalBefore)
+		}
+		if entry.EasinessFactorAfter != nil {
+			review.Factor = int(math.Round(*entry.EasinessFactorAfter * 1000))
+		}
+		if entry.TimeTaken != nil {
+			review.Duration = *entry.TimeTaken * 1000
+		}
+
+		wasFailed, reviewed := failed[cardID]
+		switch {
+		case !reviewed:
+			review.Type = anki.ReviewLearn
+		case wasFailed:
+			review.Type = anki.ReviewRelearn
+		}
+		failed[cardID] = !entry.Success
+		reviews = append(reviews, review)
+	}
+	return reviews
+}
+
+// ankiInterval writes an interval in days as Anki does: whole days, or
+// negative seconds below a day
+func ankiInterval(days float64) int {
+	if days >= 1 {
+		return int(math.Round(days))
+	}
+	return -int(math.Round(days * 86400))
+}
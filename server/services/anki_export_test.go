@@ -0,0 +1,103 @@
+package services
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"myapp/server/anki"
+	"myapp/server/dao"
+	"myapp/server/models"
+)
+
+func TestAnkiPackage(t *testing.T) {
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	domain := &models.Domain{ID: 4, Name: "Algebra", CreatedAt: created}
+	data := &dao.GraphData{
+		Definitions: map[string]dao.DefinitionNode{
+			"1":  {Code: "SET", Name: "Set", Description: "A collection|||of objects", References: []string{"Halmos"}, Tags: []string{"set theory"}, Prerequisites: []string{"ELEM"}},
+			"10": {Code: "ELEM", Name: "Element", Description: "A member"},
+		},
+		Exercises: map[string]dao.ExerciseNode{
+			"5": {Code: "EX", Name: "Compare", Statement: "Show a < b", Difficulty: 5, Hints: "Subtract", Prerequisites: []string{"SET"}},
+		},
+	}
+
+	lastReview := created.AddDate(0, 0, 1)
+	nextReview := created.AddDate(0, 0, 10).Add(-time.Hour)
+	quality, failed := 4, 1
+	schedule := &ankiSchedule{
+		progress: []models.UserNodeProgress{
+			{NodeID: 1, NodeType: "definition", Status: "grasped", EasinessFactor: 2.6, IntervalDays: 9.6, LastReview: &lastReview, NextReview: &nextReview, TotalReviews: 2, Lapses: 1, IsLeech: true},
+			{NodeID: 5, NodeType: "exercise", Suspended: true},
+		},
+		reviews: []models.ReviewHistory{
+			{NodeID: 1, NodeType: "definition", ReviewTime: created, Quality: &failed},
+			{NodeID: 1, NodeType: "definition", ReviewTime: lastReview, Success: true, Quality: &quality},
+			{NodeID: 99, NodeType: "definition", ReviewTime: lastReview, Success: true},
+		},
+	}
+
+	pkg := ankiPackage(domain, data, schedule, created.AddDate(0, 0, 2))
+
+	if want := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC); !pkg.Created.Equal(want) {
+		t.Errorf("created = %v, want %v", pkg.Created, want)
+	}
+	if len(pkg.Notes) != 3 {
+		t.Fatalf("%d notes, want 3", len(pkg.Notes))
+	}
+	var guids []string
+	for _, note := range pkg.Notes {
+		guids = append(guids, note.GUID)
+	}
+	if want := []string{"ankidemy-definition_10", "ankidemy-definition_1", "ankidemy-exercise_5"}; !reflect.DeepEqual(guids, want) {
+		t.Errorf("notes = %v, want prerequisites first %v", guids, want)
+	}
+
+	set := pkg.Notes[1]
+	if want := []string{"Code", "Name", "Description", "Description 2", "Notes", "References"}; !reflect.DeepEqual(pkg.NoteType(set).Fields, want) {
+		t.Errorf("definition fields = %v, want %v", pkg.NoteType(set).Fields, want)
+	}
+	if want := []string{"SET", "Set", "A collection", "of objects", "", "Halmos"}; !reflect.DeepEqual(set.Fields, want) {
+		t.Errorf("set fields = %q, want %q", set.Fields, want)
+	}
+	if want := []string{"set_theory", "prereq::ELEM", "leech"}; !reflect.DeepEqual(set.Tags, want) {
+		t.Errorf("set tags = %v, want %v", set.Tags, want)
+	}
+	if exercise := pkg.Notes[2]; exercise.Fields[2] != "Show a &lt; b" || exercise.Fields[3] != "5" {
+		t.Errorf("exercise fields = %q", exercise.Fields)
+	}
+
+	elem, setCard, exCard := pkg.Cards[0], pkg.Cards[1], pkg.Cards[2]
+	if elem.Type != anki.CardNew || elem.Due != 1 || elem.DeckID != ankiDeckIDBase+4 {
+		t.Errorf("new card = %+v", elem)
+	}
+	if setCard.Type != anki.CardReview || setCard.Queue != anki.QueueReview || setCard.Due != 10 || setCard.Interval != 10 || setCard.Factor != 2600 || setCard.Lapses != 1 {
+		t.Errorf("review card = %+v", setCard)
+	}
+	if exCard.Type != anki.CardNew || exCard.Queue != anki.QueueSuspended || exCard.Due != 3 {
+		t.Errorf("suspended card = %+v", exCard)
+	}
+
+	if len(pkg.Reviews) != 2 {
+		t.Fatalf("%d reviews, want 2 (other domain skipped)", len(pkg.Reviews))
+	}
+	if first := pkg.Reviews[0]; first.Ease != 1 || first.Type != anki.ReviewLearn || first.CardID != setCard.ID {
+		t.Errorf("first review = %+v", first)
+	}
+	if second := pkg.Reviews[1]; second.Ease != 3 || second.Type != anki.ReviewRelearn {
+		t.Errorf("second review = %+v", second)
+	}
+
+	// Importing the export gives the nodes back
+	imported, _ := ankiGraphData(pkg, AnkiImportOptions{Difficulty: DefaultAnkiDifficulty})
+	def := imported.Definitions[strconv.FormatInt(set.ID, 10)]
+	if def.Code != "SET" || def.Description != "A collection|||of objects" || !reflect.DeepEqual(def.Prerequisites, []string{"ELEM"}) || !reflect.DeepEqual(def.References, []string{"Halmos"}) {
+		t.Errorf("imported definition = %+v", def)
+	}
+	ex := imported.Exercises[strconv.FormatInt(pkg.Notes[2].ID, 10)]
+	if ex.Code != "EX" || ex.Difficulty != 5 || ex.Hints != "Subtract" || !reflect.DeepEqual(ex.Prerequisites, []string{"SET"}) {
+		t.Errorf("imported exercise = %+v", ex)
+	}
+}
@@ -0,0 +1,480 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"myapp/server/anki"
+	"myapp/server/dao"
+	"myapp/server/interchange"
+	"myapp/server/models"
+	"myapp/server/scheduler"
+)
+
+// Limits of the imported node columns
+const (
+	maxCodeLength = 50
+	maxNameLength = 200
+)
+
+// DefaultAnkiDifficulty is the difficulty of exercises imported from Anki,
+// which has none
+const DefaultAnkiDifficulty = 3
+
+// AnkiImportOptions controls how an Anki package becomes a domain
+type AnkiImportOptions struct {
+	DomainName        string
+	Description       string
+	Privacy           string   // public or private (default)
+	ExerciseNoteTypes []string // note types whose notes become exercises, by name; default: cloze note types and those with a Statement field
+	ImportReviews     bool     // turn the review log into review history and progress of the importing user
+	Difficulty        int      // difficulty of the exercises, default DefaultAnkiDifficulty
+}
+
+// AnkiImportResult summarizes an Anki import
+type AnkiImportResult struct {
+	Domain      *models.Domain `json:"domain"`
+	Definitions int            `json:"definitions"`
+	Exercises   int            `json:"exercises"`
+	Reviews     int            `json:"reviews"`  // review history entries created
+	Progress    int            `json:"progress"` // nodes with progress created
+	Media       []string       `json:"media"`    // media files the notes use, which are not imported
+}
+
+// AnkiImportService creates domains from Anki packages
+type AnkiImportService struct {
+	db *gorm.DB
+}
+
+// NewAnkiImportService creates a new Anki import service instance
+func NewAnkiImportService(db *gorm.DB) *AnkiImportService {
+	return &AnkiImportService{db: db}
+}
+
+// ankiNode is the node a note becomes
+type ankiNode struct {
+	code     string
+	nodeType string
+}
+
+// Import creates a domain owned by the user from an Anki package: every
+// note becomes a definition, or an exercise for the exercise note types,
+// and with ImportReviews the review log becomes the user's review history
+// and progress. The domain is created in one transaction, so a failed
+// import leaves nothing behind.
+func (s *AnkiImportService) Import(pkg *anki.Package, userID uint, opts AnkiImportOptions) (*AnkiImportResult, error) {
+	if opts.Privacy == "" {
+		opts.Privacy = "private"
+	}
+	if opts.Difficulty == 0 {
+		opts.Difficulty = DefaultAnkiDifficulty
+	}
+
+	data, nodes := ankiGraphData(pkg, opts)
+	result := &AnkiImportResult{
+		Definitions: len(data.Definitions),
+		Exercises:   len(data.Exercises),
+		Media:       ankiMedia(pkg),
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		domain := &models.Domain{
+			Name:        opts.DomainName,
+			Description: opts.Description,
+			Privacy:     opts.Privacy,
+			OwnerID:     userID,
+		}
+		if err := dao.NewDomainDAO(tx).Create(domain); err != nil {
+			return fmt.Errorf("failed to create domain: %w", err)
+		}
+		result.Domain = domain
+
+		if err := dao.NewGraphDAO(tx).ImportDomain(domain.ID, userID, data); err != nil {
+			return fmt.Errorf("failed to import notes: %w", err)
+		}
+		if err := dao.NewProgressDAO(tx).EnrollUserInDomain(userID, domain.ID); err != nil {
+			return fmt.Errorf("failed to enroll user: %w", err)
+		}
+
+		if opts.ImportReviews {
+			return s.importReviews(tx, pkg, nodes, userID, domain.ID, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// importReviews turns the review log of every note into review history and
+// progress on its node
+func (s *AnkiImportService) importReviews(tx *gorm.DB, pkg *anki.Package, nodes map[int64]ankiNode, userID uint, domainID uint, result *AnkiImportResult) error {
+	srsDao := dao.NewSRSDao(tx)
+	refs, err := srsDao.GetDomainNodes(domainID)
+	if err != nil {
+		return err
+	}
+	nodeIDs := make(map[ankiNode]uint, len(refs))
+	for _, ref := range refs {
+		nodeIDs[ankiNode{code: ref.NodeCode, nodeType: ref.NodeType}] = ref.NodeID
+	}
+
+	settings, err := srsDao.GetSchedulerSettings(userID, domainID)
+	if err != nil {
+		return err
+	}
+	rules := newReviewRules(settings)
+
+	cardsByNote := map[int64][]anki.Card{}
+	noteOfCard := map[int64]int64{}
+	for _, card := range pkg.Cards {
+		cardsByNote[card.NoteID] = append(cardsByNote[card.NoteID], card)
+		noteOfCard[card.ID] = card.NoteID
+	}
+	reviewsByNote := map[int64][]anki.Review{}
+	for _, review := range pkg.Reviews {
+		if noteID, exists := noteOfCard[review.CardID]; exists {
+			reviewsByNote[noteID] = append(reviewsByNote[noteID], review)
+		}
+	}
+
+	for _, note := range pkg.Notes {
+		node := nodes[note.ID]
+		nodeID, exists := nodeIDs[node]
+		if !exists {
+			continue
+		}
+		progress, history := ankiProgress(pkg, note, cardsByNote[note.ID], reviewsByNote[note.ID], rules.graduation)
+		if progress == nil {
+			continue
+		}
+
+		progress.UserID, progress.NodeID, progress.NodeType = userID, nodeID, node.nodeType
+		if err := tx.Create(progress).Error; err != nil {
+			return err
+		}
+		for i := range history {
+			history[i].UserID, history[i].NodeID, history[i].NodeType = userID, nodeID, node.nodeType
+		}
+		if len(history) > 0 {
+			if err := tx.CreateInBatches(history, 500).Error; err != nil {
+				return err
+			}
+		}
+		result.Progress++
+		result.Reviews += len(history)
+	}
+	return nil
+}
+
+// ankiGraphData maps the notes of a package to definitions and exercises in
+// the import format, and tells which node each note becomes. Tags with the
+// prerequisite prefix, as exports carry them, become prerequisites.
+func ankiGraphData(pkg *anki.Package, opts AnkiImportOptions) (*dao.GraphData, map[int64]ankiNode) {
+	exerciseTypes := map[string]bool{}
+	for _, name := range opts.ExerciseNoteTypes {
+		exerciseTypes[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	isExercise := func(noteType anki.NoteType) bool {
+		if len(exerciseTypes) == 0 {
+			return noteType.Kind == anki.KindCloze || hasField(noteType, "statement")
+		}
+		return exerciseTypes[strings.ToLower(noteType.Name)]
+	}
+
+	data := &dao.GraphData{
+		Definitions: map[string]dao.DefinitionNode{},
+		Exercises:   map[string]dao.ExerciseNode{},
+	}
+	nodes := make(map[int64]ankiNode, len(pkg.Notes))
+
+	// The first note giving a code keeps it; the other notes get a code
+	// from their ID that no note uses
+	claimed := map[ankiNode]int64{}
+	for _, note := range pkg.Notes {
+		noteType := pkg.NoteType(note)
+		node := ankiNode{code: mapAnkiFields(noteType, note).code, nodeType: "definition"}
+		if isExercise(noteType) {
+			node.nodeType = "exercise"
+		}
+		if _, exists := claimed[node]; !exists && node.code != "" && len(node.code) <= maxCodeLength {
+			claimed[node] = note.ID
+		}
+		nodes[note.ID] = node
+	}
+	for _, note := range pkg.Notes {
+		node := nodes[note.ID]
+		if owner, exists := claimed[node]; !exists || owner != note.ID {
+			node.code = uniqueAnkiCode(note.ID, node.nodeType, claimed)
+			claimed[node] = note.ID
+			nodes[note.ID] = node
+		}
+	}
+
+	for _, note := range pkg.Notes {
+		noteType := pkg.NoteType(note)
+		fields := mapAnkiFields(noteType, note)
+		node := nodes[note.ID]
+
+		key := fmt.Sprintf("%d", note.ID)
+		tags, prerequisites := splitAnkiTags(note.Tags)
+		if node.nodeType == "exercise" {
+			statement := fields.statement
+			if statement == "" && len(fields.rest) > 0 {
+				statement, fields.rest = fields.rest[0], fields.rest[1:]
+			}
+			name := fields.name
+			if name == "" {
+				name, _ = truncateName(anki.PlainText(statement))
+			}
+			difficulty := fields.difficulty
+			if difficulty < 1 || difficulty > 7 {
+				difficulty = opts.Difficulty
+			}
+			data.Exercises[key] = dao.ExerciseNode{
+				Code:          node.code,
+				Name:          nameOrCode(name, node.code),
+				Statement:     statement,
+				Description:   strings.Join(append(fields.description, fields.rest...), interchange.DescriptionSeparator),
+				Hints:         fields.hints,
+				Result:        fields.result,
+				Difficulty:    difficulty,
+				Tags:          tags,
+				Prerequisites: prerequisites,
+			}
+			continue
+		}
+
+		// A name too long for the column also stays a description
+		name := fields.name
+		if name == "" && len(fields.rest) > 0 {
+			var truncated bool
+			name, truncated = truncateName(anki.PlainText(fields.rest[0]))
+			if !truncated {
+				fields.rest = fields.rest[1:]
+			}
+		}
+		description := append(fields.description, fields.rest...)
+		data.Definitions[key] = dao.DefinitionNode{
+			Code:          node.code,
+			Name:          nameOrCode(name, node.code),
+			Description:   strings.Join(description, interchange.DescriptionSeparator),
+			Notes:         fields.notes,
+			References:    fields.references,
+			Tags:          tags,
+			Prerequisites: prerequisites,
+		}
+	}
+	return data, nodes
+}
+
+// uniqueAnkiCode returns the code ANKI-<note ID> of a note without a usable
+// code, with a suffix if a node of the type already has it
+func uniqueAnkiCode(noteID int64, nodeType string, claimed map[ankiNode]int64) string {
+	code := fmt.Sprintf("ANKI-%d", noteID)
+	for i := 2; ; i++ {
+		if _, exists := claimed[ankiNode{code: code, nodeType: nodeType}]; !exists {
+			return code
+		}
+		code = fmt.Sprintf("ANKI-%d-%d", noteID, i)
+	}
+}
+
+// splitAnkiTags separates the prerequisite codes from the other tags
+func splitAnkiTags(noteTags []string) (tags, prerequisites []string) {
+	for _, tag := range noteTags {
+		if len(tag) > len(prerequisiteTagPrefix) && strings.EqualFold(tag[:len(prerequisiteTagPrefix)], prerequisiteTagPrefix) {
+			prerequisites = append(prerequisites, tag[len(prerequisiteTagPrefix):])
+		} else {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, prerequisites
+}
+
+func hasField(noteType anki.NoteType, name string) bool {
+	for _, field := range noteType.Fields {
+		if strings.EqualFold(strings.TrimSpace(field), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ankiFields are the fields of a note sorted by the node field they fill
+type ankiFields struct {
+	code, name, statement, notes, hints, result string
+	difficulty                                  int
+	description                                 []string // fields named Description, Description 2...
+	references                                  []string // lines of the References field
+	rest                                        []string // other non-empty fields, in order
+}
+
+// mapAnkiFields sorts the fields of a note by name: Code, Name, Statement,
+// Description (and Description 2...), Notes, References, Hints, Result and
+// Difficulty fill the node field of the same name, case-insensitively. The first other field stands
+// for the name of definitions and the statement of exercises, the others are
+// descriptions.
+func mapAnkiFields(noteType anki.NoteType, note anki.Note) ankiFields {
+	var fields ankiFields
+	for i, value := range note.Fields {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		name := ""
+		if i < len(noteType.Fields) {
+			name = strings.ToLower(strings.TrimSpace(noteType.Fields[i]))
+		}
+		switch {
+		case name == "code":
+			fields.code = anki.PlainText(value)
+		case name == "name":
+			fields.name, _ = truncateName(anki.PlainText(value))
+		case name == "statement":
+			fields.statement = value
+		case name == "notes":
+			fields.notes = value
+		case name == "hints":
+			fields.hints = value
+		case name == "result":
+			fields.result = value
+		case name == "difficulty":
+			fields.difficulty, _ = strconv.Atoi(anki.PlainText(value))
+		case name == "references":
+			for _, line := range strings.Split(value, "<br>") {
+				if reference := anki.PlainText(line); reference != "" {
+					fields.references = append(fields.references, reference)
+				}
+			}
+		case name == "description" || strings.HasPrefix(name, "description "):
+			fields.description = append(fields.description, value)
+		default:
+			fields.rest = append(fields.rest, value)
+		}
+	}
+	return fields
+}
+
+// truncateName shortens a name to the name column, telling whether it did
+func truncateName(name string) (string, bool) {
+	if utf8.RuneCountInString(name) <= maxNameLength {
+		return name, false
+	}
+	runes := []rune(name)
+	return string(runes[:maxNameLength-1]) + "…", true
+}
+
+func nameOrCode(name, code string) string {
+	if name == "" {
+		return code
+	}
+	return name
+}
+
+// ankiMedia lists the media files the notes refer to
+func ankiMedia(pkg *anki.Package) []string {
+	seen := map[string]bool{}
+	media := []string{}
+	for _, note := range pkg.Notes {
+		for _, field := range note.Fields {
+			for _, name := range anki.MediaRefs(field) {
+				if !seen[name] {
+					seen[name] = true
+					media = append(media, name)
+				}
+			}
+		}
+	}
+	sort.Strings(media)
+	return media
+}
+
+// ankiProgress builds the review history of a note's node from the review
+// log of its cards, and its progress from the most recently reviewed card.
+// Notes never reviewed get no progress and stay fresh.
+func ankiProgress(pkg *anki.Package, note anki.Note, cards []anki.Card, reviews []anki.Review, graduation scheduler.GraduationPolicy) (*models.UserNodeProgress, []models.ReviewHistory) {
+	sort.Slice(reviews, func(i, j int) bool { return reviews[i].ID < reviews[j].ID })
+
+	history := make([]models.ReviewHistory, 0, len(reviews))
+	progress := &models.UserNodeProgress{
+		Status:         "grasped",
+		EasinessFactor: 2.5,
+		Algorithm:      scheduler.AlgorithmSM2,
+	}
+	var last *anki.Review
+	for i := range reviews {
+		review := reviews[i]
+		if review.Ease == 0 || review.Type == anki.ReviewManual {
+			continue
+		}
+		last = &reviews[i]
+
+		quality := scheduler.GradeToQuality(review.Ease)
+		timeTaken := int(math.Round(float64(review.Duration) / 1000))
+		intervalBefore := review.LastIntervalDays()
+		intervalAfter := review.IntervalDays()
+		entry := models.ReviewHistory{
+			ReviewTime:     review.Time(),
+			ReviewType:     "explicit",
+			Success:        quality >= 3,
+			Quality:        &quality,
+			TimeTaken:      &timeTaken,
+			CreditApplied:  1.0,
+			IntervalBefore: &intervalBefore,
+			IntervalAfter:  &intervalAfter,
+			Algorithm:      scheduler.AlgorithmSM2,
+		}
+		if review.Factor > 0 {
+			ef := float64(review.Factor) / 1000
+			entry.EasinessFactorAfter = &ef
+		}
+		history = append(history, entry)
+
+		progress.TotalReviews++
+		if entry.Success {
+			progress.SuccessfulReviews++
+			progress.Repetitions++
+		} else {
+			progress.Repetitions = 0
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+
+	lastReview := last.Time()
+	progress.LastReview = &lastReview
+	progress.IntervalDays = last.IntervalDays()
+	for _, card := range cards {
+		if card.ID != last.CardID {
+			continue
+		}
+		if card.Factor > 0 {
+			progress.EasinessFactor = float64(card.Factor) / 1000
+		}
+		progress.IntervalDays = card.IntervalDays()
+		progress.NextReview = pkg.DueTime(card)
+		progress.Lapses = card.Lapses
+		progress.Suspended = card.Queue == anki.QueueSuspended
+	}
+	if progress.NextReview == nil {
+		next := lastReview.Add(time.Duration(progress.IntervalDays * 24 * float64(time.Hour)))
+		progress.NextReview = &next
+	}
+	for _, tag := range note.Tags {
+		if strings.EqualFold(tag, "leech") {
+			progress.IsLeech = true
+		}
+	}
+	if graduation.Graduates(progress) {
+		progress.Status = "learned"
+	}
+	return progress, history
+}
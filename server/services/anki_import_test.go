@@ -0,0 +1,143 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"myapp/server/anki"
+	"myapp/server/dao"
+	"myapp/server/scheduler"
+)
+
+func ankiTestPackage() *anki.Package {
+	return &anki.Package{
+		Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NoteTypes: map[int64]anki.NoteType{
+			1: {ID: 1, Name: "Basic", Kind: anki.KindStandard, Fields: []string{"Front", "Back"}},
+			2: {ID: 2, Name: "Cloze", Kind: anki.KindCloze, Fields: []string{"Text", "Extra"}},
+			3: {ID: 3, Name: "Ankidemy", Kind: anki.KindStandard, Fields: []string{"Code", "Name", "Description", "Description 2", "Notes"}},
+		},
+		Notes: []anki.Note{
+			{ID: 100, NoteTypeID: 1, Fields: []string{"<b>Set</b>", "A collection"}, Tags: []string{"math"}},
+			{ID: 101, NoteTypeID: 2, Fields: []string{"{{c1::Paris}} is the capital", ""}},
+			{ID: 102, NoteTypeID: 3, Fields: []string{"GRP", "Group", "A set", "with an operation", "See rings"}},
+			{ID: 103, NoteTypeID: 3, Fields: []string{"GRP", "Group again", "", "", ""}},
+			{ID: 104, NoteTypeID: 1, Fields: []string{strings.Repeat("x", 250), "Back"}},
+		},
+	}
+}
+
+func TestAnkiGraphData(t *testing.T) {
+	data, nodes := ankiGraphData(ankiTestPackage(), AnkiImportOptions{Difficulty: 3})
+
+	set := data.Definitions["100"]
+	if set.Code != "ANKI-100" || set.Name != "Set" || set.Description != "A collection" || !reflect.DeepEqual(set.Tags, []string{"math"}) {
+		t.Errorf("basic note = %+v", set)
+	}
+
+	cloze, ok := data.Exercises["101"]
+	if !ok {
+		t.Fatalf("cloze note is not an exercise: %+v", data)
+	}
+	if cloze.Statement != "{{c1::Paris}} is the capital" || cloze.Name != "Paris is the capital" || cloze.Difficulty != 3 {
+		t.Errorf("cloze note = %+v", cloze)
+	}
+
+	group := data.Definitions["102"]
+	if group.Code != "GRP" || group.Name != "Group" || group.Description != "A set|||with an operation" || group.Notes != "See rings" {
+		t.Errorf("named fields = %+v", group)
+	}
+	if again := data.Definitions["103"]; again.Code != "ANKI-103" {
+		t.Errorf("duplicate code = %s, want ANKI-103", again.Code)
+	}
+	if nodes[102] != (ankiNode{code: "GRP", nodeType: "definition"}) || nodes[101].nodeType != "exercise" {
+		t.Errorf("nodes = %+v", nodes)
+	}
+
+	long := data.Definitions["104"]
+	if n := len([]rune(long.Name)); n != maxNameLength {
+		t.Errorf("long name has %d characters, want %d", n, maxNameLength)
+	}
+	if !strings.HasPrefix(long.Description, strings.Repeat("x", 250)+"|||") {
+		t.Errorf("truncated name is not kept as description: %q", long.Description)
+	}
+
+	// Listing note types replaces the cloze default
+	data, _ = ankiGraphData(ankiTestPackage(), AnkiImportOptions{ExerciseNoteTypes: []string{"basic"}, Difficulty: 3})
+	if _, ok := data.Exercises["100"]; !ok {
+		t.Error("Basic note is not an exercise when listed")
+	}
+	if _, ok := data.Definitions["101"]; !ok {
+		t.Error("Cloze note is an exercise when not listed")
+	}
+}
+
+func TestAnkiGraphDataUniqueCodes(t *testing.T) {
+	pkg := ankiTestPackage()
+	pkg.Notes = []anki.Note{
+		// Note 201 has no code, and the code it would get is taken, as is
+		// the next one
+		{ID: 200, NoteTypeID: 3, Fields: []string{"ANKI-201", "Taken", "", "", ""}},
+		{ID: 201, NoteTypeID: 1, Fields: []string{"Free", "Back"}},
+		{ID: 202, NoteTypeID: 3, Fields: []string{"ANKI-201-2", "Taken too", "", "", ""}},
+		// A duplicate code gets the code of its ID
+		{ID: 203, NoteTypeID: 3, Fields: []string{"ANKI-201", "Duplicate", "", "", ""}},
+	}
+
+	data, _ := ankiGraphData(pkg, AnkiImportOptions{Difficulty: 3})
+	want := map[string]string{"200": "ANKI-201", "201": "ANKI-201-3", "202": "ANKI-201-2", "203": "ANKI-203"}
+	for key, code := range want {
+		if got := data.Definitions[key].Code; got != code {
+			t.Errorf("note %s has code %s, want %s", key, got, code)
+		}
+	}
+	if report := dao.CheckImport(data, dao.ImportModeMerge); len(report.Errors) != 0 {
+		t.Errorf("import errors = %+v, want none", report.Errors)
+	}
+}
+
+func TestAnkiProgress(t *testing.T) {
+	pkg := ankiTestPackage()
+	day := int64(24 * time.Hour / time.Millisecond)
+	start := pkg.Created.UnixMilli()
+	card := anki.Card{ID: 1, NoteID: 100, Type: anki.CardReview, Due: 40, Interval: 30, Factor: 2600, Lapses: 1}
+	reviews := []anki.Review{
+		{ID: start + 10*day, CardID: 1, Ease: 4, Interval: 10, Factor: 2650, Duration: 4000, Type: anki.ReviewReview},
+		{ID: start, CardID: 1, Ease: 3, Interval: 1, Duration: 6000, Type: anki.ReviewLearn},
+		{ID: start + 2*day, CardID: 1, Ease: 1, Interval: -600, LastInterval: 1, Duration: 9000, Type: anki.ReviewReview},
+		{ID: start + 3*day, CardID: 1, Ease: 0, Interval: 30, Type: anki.ReviewManual},
+	}
+
+	progress, history := ankiProgress(pkg, pkg.Notes[0], []anki.Card{card}, reviews, scheduler.GraduationPolicy{MinInterval: 21, MinSuccessRate: 0.6})
+	if len(history) != 3 {
+		t.Fatalf("history has %d entries, want 3 (manual entry skipped)", len(history))
+	}
+	if !history[0].ReviewTime.Equal(pkg.Created) || *history[0].Quality != 4 || *history[0].TimeTaken != 6 {
+		t.Errorf("first entry = %+v", history[0])
+	}
+	if history[1].Success || *history[1].IntervalAfter != 600.0/86400 {
+		t.Errorf("failed entry = %+v", history[1])
+	}
+	if *history[2].Quality != 5 || *history[2].EasinessFactorAfter != 2.65 {
+		t.Errorf("last entry = %+v", history[2])
+	}
+
+	if progress.TotalReviews != 3 || progress.SuccessfulReviews != 2 || progress.Repetitions != 1 {
+		t.Errorf("counts = %d/%d, repetitions %d", progress.SuccessfulReviews, progress.TotalReviews, progress.Repetitions)
+	}
+	if progress.EasinessFactor != 2.6 || progress.IntervalDays != 30 || progress.Lapses != 1 {
+		t.Errorf("card state = %+v", progress)
+	}
+	if want := pkg.Created.AddDate(0, 0, 40); !progress.NextReview.Equal(want) {
+		t.Errorf("next review = %v, want %v", progress.NextReview, want)
+	}
+	if progress.Status != "learned" {
+		t.Errorf("status = %s, want learned at a 30-day interval", progress.Status)
+	}
+
+	if progress, _ := ankiProgress(pkg, pkg.Notes[0], []anki.Card{{ID: 1}}, nil, scheduler.GraduationPolicy{}); progress != nil {
+		t.Errorf("unreviewed note has progress %+v", progress)
+	}
+}
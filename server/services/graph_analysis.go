@@ -0,0 +1,440 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+	"myapp/server/dao"
+	"myapp/server/graph"
+	"myapp/server/models"
+)
+
+// DefaultBottleneckCount is the number of bottleneck nodes reported when the
+// caller does not ask for a number
+const DefaultBottleneckCount = 10
+
+// GraphAnalysisService computes structural diagnostics of domain graphs
+type GraphAnalysisService struct {
+	srsDao        *dao.SRSDao
+	creditService *CreditPropagationService
+}
+
+// NewGraphAnalysisService creates a new graph analysis service instance
+func NewGraphAnalysisService(db *gorm.DB) *GraphAnalysisService {
+	return &GraphAnalysisService{
+		srsDao:        dao.NewSRSDao(db),
+		creditService: NewCreditPropagationService(),
+	}
+}
+
+// analyzedDomain is a domain graph with its structure
+type analyzedDomain struct {
+	refs      map[string]models.GraphNodeRef
+	keys      []string
+	edges     map[[2]string]models.NodePrerequisite // by node and prerequisite key
+	structure *graphStructure
+}
+
+// analyze loads a domain's graph and computes its structure. Only edges
+// between nodes of the domain are kept. A graph with a cycle has no
+// structure; the cycle is returned as a graph.CycleError naming the nodes by
+// code.
+func (a *GraphAnalysisService) analyze(domainID uint) (*analyzedDomain, error) {
+	nodes, err := a.srsDao.GetDomainNodes(domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	prerequisites, err := a.srsDao.GetPrerequisitesByDomain(domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prerequisites: %w", err)
+	}
+
+	refs := make(map[string]models.GraphNodeRef, len(nodes))
+	keys := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		key := a.creditService.getNodeKey(node.NodeID, node.NodeType)
+		refs[key] = node
+		keys = append(keys, key)
+	}
+
+	var inDomain []models.NodePrerequisite
+	edges := make(map[[2]string]models.NodePrerequisite)
+	for _, prereq := range prerequisites {
+		nodeKey := a.creditService.getNodeKey(prereq.NodeID, prereq.NodeType)
+		prereqKey := a.creditService.getNodeKey(prereq.PrerequisiteID, prereq.PrerequisiteType)
+		_, nodeIn := refs[nodeKey]
+		_, prereqIn := refs[prereqKey]
+		if nodeIn && prereqIn {
+			inDomain = append(inDomain, prereq)
+			edges[[2]string{nodeKey, prereqKey}] = prereq
+		}
+	}
+
+	// BuildGraph only knows nodes with edges; add the isolated ones
+	nodeGraph := a.creditService.BuildGraph(inDomain)
+	for key, ref := range refs {
+		if _, exists := nodeGraph[key]; !exists {
+			nodeGraph[key] = &GraphNode{ID: ref.NodeID, Type: ref.NodeType, Prerequisites: []GraphEdge{}, Dependents: []GraphEdge{}}
+		}
+	}
+
+	structure, err := analyzeGraph(nodeGraph, keys)
+	if err != nil {
+		var cycleErr *graph.CycleError
+		if errors.As(err, &cycleErr) {
+			codes := make([]string, len(cycleErr.Cycle))
+			for i, key := range cycleErr.Cycle {
+				codes[i] = refs[key].NodeCode
+			}
+			return nil, &graph.CycleError{Cycle: codes}
+		}
+		return nil, err
+	}
+
+	return &analyzedDomain{refs: refs, keys: keys, edges: edges, structure: structure}, nil
+}
+
+// refsOf returns the nodes of the keys
+func (d *analyzedDomain) refsOf(keys []string) []models.GraphNodeRef {
+	result := make([]models.GraphNodeRef, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, d.refs[key])
+	}
+	return result
+}
+
+// redundantEdges returns the redundant edges with their stored prerequisite
+func (d *analyzedDomain) redundantEdges() []models.RedundantEdge {
+	redundant := []models.RedundantEdge{}
+	for _, edge := range d.structure.redundant {
+		prereq := d.edges[[2]string{edge.node, edge.prerequisite}]
+		redundant = append(redundant, models.RedundantEdge{
+			ID:           prereq.ID,
+			Node:         d.refs[edge.node],
+			Prerequisite: d.refs[edge.prerequisite],
+			Weight:       edge.weight,
+			IsManual:     prereq.IsManual,
+			Via:          d.refsOf(edge.via),
+		})
+	}
+	return redundant
+}
+
+// AnalyzeDomain reports the structure of a domain's prerequisite graph:
+// depth and degrees of every node, orphans, exercises without prerequisites,
+// redundant edges, the longest chain and up to bottlenecks nodes with the
+// highest betweenness. Only edges between nodes of the domain are counted.
+func (a *GraphAnalysisService) AnalyzeDomain(domainID uint, bottlenecks int) (*models.GraphAnalysis, error) {
+	domain, err := a.analyze(domainID)
+	if err != nil {
+		return nil, err
+	}
+	structure := domain.structure
+
+	analysis := &models.GraphAnalysis{
+		DomainID:                      domainID,
+		NodeCount:                     len(domain.keys),
+		EdgeCount:                     len(domain.edges),
+		Nodes:                         make([]models.GraphAnalysisNode, 0, len(domain.keys)),
+		Orphans:                       []models.GraphNodeRef{},
+		ExercisesWithoutPrerequisites: []models.GraphNodeRef{},
+		RedundantEdges:                domain.redundantEdges(),
+		LongestChain:                  domain.refsOf(structure.longest),
+		Bottlenecks:                   []models.GraphAnalysisNode{},
+	}
+
+	for _, key := range domain.keys {
+		ref := domain.refs[key]
+		measures := models.GraphAnalysisNode{
+			GraphNodeRef: ref,
+			Depth:        structure.depth[key],
+			InDegree:     len(structure.prerequisites[key]),
+			OutDegree:    len(structure.dependents[key]),
+			Betweenness:  structure.betweenness[key],
+		}
+		analysis.Nodes = append(analysis.Nodes, measures)
+		analysis.MaxDepth = max(analysis.MaxDepth, measures.Depth)
+
+		if measures.InDegree == 0 && measures.OutDegree == 0 {
+			analysis.Orphans = append(analysis.Orphans, ref)
+		}
+		if ref.NodeType == "exercise" && measures.InDegree == 0 {
+			analysis.ExercisesWithoutPrerequisites = append(analysis.ExercisesWithoutPrerequisites, ref)
+		}
+		if measures.Betweenness > 0 {
+			analysis.Bottlenecks = append(analysis.Bottlenecks, measures)
+		}
+	}
+
+	sort.SliceStable(analysis.Bottlenecks, func(i, j int) bool {
+		return analysis.Bottlenecks[i].Betweenness > analysis.Bottlenecks[j].Betweenness
+	})
+	if len(analysis.Bottlenecks) > bottlenecks {
+		analysis.Bottlenecks = analysis.Bottlenecks[:bottlenecks]
+	}
+
+	return analysis, nil
+}
+
+// ReduceDomain finds the redundant prerequisite edges of a domain: edges
+// A -> C where A also requires C through another prerequisite, e.g. A -> B
+// -> C. Edges marked manual are reported as kept. With apply
+// the other redundant edges are deleted; without, this is only a preview.
+// Removing them all keeps every transitive prerequisite, since in a graph
+// without cycles the remaining edges still connect the same nodes.
+func (a *GraphAnalysisService) ReduceDomain(domainID uint, apply bool) (*models.GraphReduction, error) {
+	domain, err := a.analyze(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	reduction := &models.GraphReduction{
+		DomainID:  domainID,
+		Removable: []models.RedundantEdge{},
+		Kept:      []models.RedundantEdge{},
+	}
+	var ids []uint
+	for _, edge := range domain.redundantEdges() {
+		if edge.IsManual {
+			reduction.Kept = append(reduction.Kept, edge)
+			continue
+		}
+		reduction.Removable = append(reduction.Removable, edge)
+		ids = append(ids, edge.ID)
+	}
+
+	if apply {
+		removed, err := a.srsDao.DeletePrerequisitesByIDs(ids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete prerequisites: %w", err)
+		}
+		reduction.Applied = true
+		reduction.Removed = int(removed)
+	}
+
+	return reduction, nil
+}
+
+// graphStructure holds the structural measures of a graph by node key
+type graphStructure struct {
+	prerequisites map[string][]string // direct, without duplicates
+	dependents    map[string][]string
+	depth         map[string]int
+	longest       []string // from a root to the deepest node
+	redundant     []redundantEdge
+	betweenness   map[string]float64
+}
+
+// redundantEdge is an edge node -> prerequisite implied by a longer path
+type redundantEdge struct {
+	node         string
+	prerequisite string
+	weight       float64
+	via          []string
+}
+
+// analyzeGraph computes the structure of a graph built by BuildGraph. Keys
+// lists every node of the graph; its order is the order of the results and
+// breaks ties, so the same graph always gives the same analysis.
+func analyzeGraph(nodeGraph map[string]*GraphNode, keys []string) (*graphStructure, error) {
+	rank := make(map[string]int, len(keys))
+	for i, key := range keys {
+		rank[key] = i
+	}
+	byRank := func(list []string) {
+		sort.Slice(list, func(i, j int) bool { return rank[list[i]] < rank[list[j]] })
+	}
+
+	s := &graphStructure{
+		prerequisites: make(map[string][]string, len(keys)),
+		dependents:    make(map[string][]string, len(keys)),
+		depth:         make(map[string]int, len(keys)),
+		betweenness:   make(map[string]float64, len(keys)),
+	}
+	weights := make(map[[2]string]float64)
+	for _, key := range keys {
+		for _, edge := range nodeGraph[key].Prerequisites {
+			prereq := fmt.Sprintf("%s_%d", edge.Type, edge.ID)
+			pair := [2]string{key, prereq}
+			if _, seen := weights[pair]; seen {
+				continue
+			}
+			weights[pair] = edge.Weight
+			s.prerequisites[key] = append(s.prerequisites[key], prereq)
+			s.dependents[prereq] = append(s.dependents[prereq], key)
+		}
+	}
+	for _, key := range keys {
+		byRank(s.prerequisites[key])
+		byRank(s.dependents[key])
+	}
+
+	// Topological order, prerequisites first
+	missing := make(map[string]int, len(keys))
+	var order []string
+	for _, key := range keys {
+		missing[key] = len(s.prerequisites[key])
+		if missing[key] == 0 {
+			order = append(order, key)
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		for _, dependent := range s.dependents[order[i]] {
+			if missing[dependent]--; missing[dependent] == 0 {
+				order = append(order, dependent)
+			}
+		}
+	}
+	if len(order) < len(keys) {
+		edges := graph.Edges{}
+		for key, prereqs := range s.prerequisites {
+			edges[key] = prereqs
+		}
+		return nil, &graph.CycleError{Cycle: graph.FindCycles(edges)[0]}
+	}
+
+	// Depth and the deepest prerequisite of every node
+	deepest := make(map[string]string, len(keys))
+	for _, key := range order {
+		for _, prereq := range s.prerequisites[key] {
+			if _, set := deepest[key]; !set || s.depth[prereq]+1 > s.depth[key] {
+				s.depth[key] = s.depth[prereq] + 1
+				deepest[key] = prereq
+			}
+		}
+	}
+	if len(keys) > 0 {
+		end := keys[0]
+		for _, key := range keys {
+			if s.depth[key] > s.depth[end] {
+				end = key
+			}
+		}
+		for node, ok := end, true; ok; node, ok = deepest[node] {
+			s.longest = append([]string{node}, s.longest...)
+		}
+	}
+
+	s.redundant = s.redundantEdges(order, keys, weights)
+	s.betweenness = s.betweennessCentrality(keys)
+	return s, nil
+}
+
+// redundantEdges finds the edges node -> prerequisite where the prerequisite
+// is also a transitive prerequisite of another prerequisite of the node
+func (s *graphStructure) redundantEdges(order []string, keys []string, weights map[[2]string]float64) []redundantEdge {
+	// Transitive prerequisites as bit sets over the topological order
+	index := make(map[string]int, len(order))
+	for i, key := range order {
+		index[key] = i
+	}
+	words := (len(order) + 63) / 64
+	ancestors := make(map[string][]uint64, len(order))
+	for _, key := range order {
+		set := make([]uint64, words)
+		for _, prereq := range s.prerequisites[key] {
+			for w, bits := range ancestors[prereq] {
+				set[w] |= bits
+			}
+			set[index[prereq]/64] |= 1 << (index[prereq] % 64)
+		}
+		ancestors[key] = set
+	}
+	requires := func(node string, prereq string) bool {
+		return ancestors[node][index[prereq]/64]&(1<<(index[prereq]%64)) != 0
+	}
+
+	var redundant []redundantEdge
+	for _, key := range keys {
+		for _, prereq := range s.prerequisites[key] {
+			for _, other := range s.prerequisites[key] {
+				if other != prereq && requires(other, prereq) {
+					redundant = append(redundant, redundantEdge{
+						node:         key,
+						prerequisite: prereq,
+						weight:       weights[[2]string{key, prereq}],
+						via:          s.shortestPath(other, prereq),
+					})
+					break
+				}
+			}
+		}
+	}
+	return redundant
+}
+
+// shortestPath returns the nodes on the shortest prerequisite path from
+// start (included) to end (excluded)
+func (s *graphStructure) shortestPath(start string, end string) []string {
+	parent := map[string]string{start: ""}
+	queue := []string{start}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, prereq := range s.prerequisites[node] {
+			if _, seen := parent[prereq]; seen {
+				continue
+			}
+			parent[prereq] = node
+			if prereq == end {
+				var path []string
+				for n := node; n != ""; n = parent[n] {
+					path = append([]string{n}, path...)
+				}
+				return path
+			}
+			queue = append(queue, prereq)
+		}
+	}
+	return nil
+}
+
+// betweennessCentrality computes for every node the share of shortest paths
+// between two other nodes that run through it (Brandes' algorithm, following
+// edges from prerequisites to dependents), normalized to 0-1
+func (s *graphStructure) betweennessCentrality(keys []string) map[string]float64 {
+	centrality := make(map[string]float64, len(keys))
+	for _, source := range keys {
+		var stack []string
+		preceding := map[string][]string{}
+		paths := map[string]float64{source: 1}
+		distance := map[string]int{source: 0}
+
+		queue := []string{source}
+		for len(queue) > 0 {
+			node := queue[0]
+			queue = queue[1:]
+			stack = append(stack, node)
+			for _, next := range s.dependents[node] {
+				if _, seen := distance[next]; !seen {
+					distance[next] = distance[node] + 1
+					queue = append(queue, next)
+				}
+				if distance[next] == distance[node]+1 {
+					paths[next] += paths[node]
+					preceding[next] = append(preceding[next], node)
+				}
+			}
+		}
+
+		dependency := map[string]float64{}
+		for i := len(stack) - 1; i >= 0; i-- {
+			node := stack[i]
+			for _, prev := range preceding[node] {
+				dependency[prev] += paths[prev] / paths[node] * (1 + dependency[node])
+			}
+			if node != source {
+				centrality[node] += dependency[node]
+			}
+		}
+	}
+
+	if n := float64(len(keys)); n > 2 {
+		for key := range centrality {
+			centrality[key] /= (n - 1) * (n - 2)
+		}
+	}
+	return centrality
+}
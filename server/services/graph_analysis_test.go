@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"myapp/server/graph"
+	"myapp/server/models"
+)
+
+// analysisGraph builds the graph of the prerequisites plus isolated nodes,
+// as AnalyzeDomain does
+func analysisGraph(prerequisites []models.NodePrerequisite, isolated ...uint) (map[string]*GraphNode, []string) {
+	c := NewCreditPropagationService()
+	nodeGraph := c.BuildGraph(prerequisites)
+	for _, id := range isolated {
+		nodeGraph[c.getNodeKey(id, "exercise")] = &GraphNode{ID: id, Type: "exercise"}
+	}
+	var keys []string
+	for key := range nodeGraph {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return nodeGraph, keys
+}
+
+func TestAnalyzeGraph(t *testing.T) {
+	// definition_3 requires definition_2 and definition_1, which definition_2
+	// already requires; exercise_4 requires definition_3; exercise_5 is alone
+	nodeGraph, keys := analysisGraph([]models.NodePrerequisite{
+		{NodeID: 2, NodeType: "definition", PrerequisiteID: 1, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 3, NodeType: "definition", PrerequisiteID: 2, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 3, NodeType: "definition", PrerequisiteID: 1, PrerequisiteType: "definition", Weight: 0.5},
+		{NodeID: 4, NodeType: "exercise", PrerequisiteID: 3, PrerequisiteType: "definition", Weight: 1},
+	}, 5)
+
+	s, err := analyzeGraph(nodeGraph, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantDepth := map[string]int{"definition_1": 0, "definition_2": 1, "definition_3": 2, "exercise_4": 3, "exercise_5": 0}
+	for key, want := range wantDepth {
+		if s.depth[key] != want {
+			t.Errorf("depth of %s = %d, want %d", key, s.depth[key], want)
+		}
+	}
+
+	if got := len(s.prerequisites["definition_3"]); got != 2 {
+		t.Errorf("in-degree of definition_3 = %d, want 2", got)
+	}
+	if got := len(s.dependents["definition_1"]); got != 2 {
+		t.Errorf("out-degree of definition_1 = %d, want 2", got)
+	}
+
+	wantChain := []string{"definition_1", "definition_2", "definition_3", "exercise_4"}
+	if !reflect.DeepEqual(s.longest, wantChain) {
+		t.Errorf("longest chain = %v, want %v", s.longest, wantChain)
+	}
+
+	wantRedundant := []redundantEdge{{node: "definition_3", prerequisite: "definition_1", weight: 0.5, via: []string{"definition_2"}}}
+	if !reflect.DeepEqual(s.redundant, wantRedundant) {
+		t.Errorf("redundant edges = %+v, want %+v", s.redundant, wantRedundant)
+	}
+
+	// Only definition_3 lies inside shortest paths: definition_1 and
+	// definition_2 to exercise_4, normalized by (5-1)*(5-2) ordered pairs
+	for _, key := range keys {
+		want := 0.0
+		if key == "definition_3" {
+			want = 2.0 / 12
+		}
+		if got := s.betweenness[key]; got != want {
+			t.Errorf("betweenness of %s = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestAnalyzeGraphCycle(t *testing.T) {
+	nodeGraph, keys := analysisGraph([]models.NodePrerequisite{
+		{NodeID: 1, NodeType: "definition", PrerequisiteID: 2, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 2, NodeType: "definition", PrerequisiteID: 1, PrerequisiteType: "definition", Weight: 1},
+	})
+
+	_, err := analyzeGraph(nodeGraph, keys)
+	if !errors.Is(err, graph.ErrCycle) {
+		t.Fatalf("error = %v, want a cycle error", err)
+	}
+}
+
+func TestAnalyzeGraphReductionKeepsReachability(t *testing.T) {
+	// A diamond with shortcuts: exercise_5 requires everything directly
+	prerequisites := []models.NodePrerequisite{
+		{NodeID: 2, NodeType: "definition", PrerequisiteID: 1, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 3, NodeType: "definition", PrerequisiteID: 1, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 4, NodeType: "definition", PrerequisiteID: 2, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 4, NodeType: "definition", PrerequisiteID: 3, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 4, NodeType: "definition", PrerequisiteID: 1, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 5, NodeType: "exercise", PrerequisiteID: 4, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 5, NodeType: "exercise", PrerequisiteID: 3, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 5, NodeType: "exercise", PrerequisiteID: 2, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 5, NodeType: "exercise", PrerequisiteID: 1, PrerequisiteType: "definition", Weight: 1},
+	}
+	nodeGraph, keys := analysisGraph(prerequisites)
+	before, err := analyzeGraph(nodeGraph, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(before.redundant) != 4 {
+		t.Fatalf("found %d redundant edges, want 4: %+v", len(before.redundant), before.redundant)
+	}
+
+	removed := map[[2]string]bool{}
+	for _, edge := range before.redundant {
+		removed[[2]string{edge.node, edge.prerequisite}] = true
+	}
+	var reduced []models.NodePrerequisite
+	for _, p := range prerequisites {
+		key := [2]string{fmt.Sprintf("%s_%d", p.NodeType, p.NodeID), fmt.Sprintf("%s_%d", p.PrerequisiteType, p.PrerequisiteID)}
+		if !removed[key] {
+			reduced = append(reduced, p)
+		}
+	}
+
+	nodeGraph, keys = analysisGraph(reduced)
+	after, err := analyzeGraph(nodeGraph, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after.redundant) != 0 {
+		t.Errorf("reduced graph still has redundant edges: %+v", after.redundant)
+	}
+	for _, from := range keys {
+		for _, to := range keys {
+			if (before.shortestPath(from, to) == nil) != (after.shortestPath(from, to) == nil) {
+				t.Errorf("reduction changed whether %s requires %s", from, to)
+			}
+		}
+	}
+}
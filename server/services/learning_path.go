@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"myapp/server/dao"
+	"myapp/server/graph"
+	"myapp/server/models"
+)
+
+// ErrNothingToStudy is returned when every node of a learning path is
+// already grasped
+var ErrNothingToStudy = errors.New("nothing left to study on this path")
+
+// Study time (seconds) assumed for a node nobody has reviewed with a time
+const (
+	DefaultDefinitionStudyTime = 120
+	DefaultExerciseStudyTime   = 600
+)
+
+// Sources of a study time estimate, from the most to the least specific
+const (
+	EstimateUser        = "user"         // the user's own reviews of the node
+	EstimateAllUsers    = "all_users"    // everyone's reviews of the node
+	EstimateUserAverage = "user_average" // the user's reviews of nodes of the same type
+	EstimateDefault     = "default"
+)
+
+// GetLearningPath returns the nodes to study, in order, before the target:
+// all of its transitive prerequisites the user has not grasped yet, then the
+// target itself. The target is found by code; nodeType picks between a
+// definition and an exercise sharing the code (definitions first if empty).
+func (s *SRSService) GetLearningPath(userID uint, domainID uint, targetCode string, nodeType string) (*models.LearningPath, error) {
+	nodes, err := s.srsDao.GetDomainProgress(userID, domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get progress: %w", err)
+	}
+	prerequisites, err := s.srsDao.GetPrerequisitesByDomain(domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prerequisites: %w", err)
+	}
+	times, err := s.srsDao.GetStudyTimes(userID, domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get study times: %w", err)
+	}
+
+	return s.buildLearningPath(domainID, nodes, prerequisites, times, targetCode, nodeType)
+}
+
+// buildLearningPath orders the domain's nodes into the learning path to the
+// target, from the user's progress, the domain's prerequisites and the
+// recorded study times
+func (s *SRSService) buildLearningPath(domainID uint, nodes []models.NodeProgress, prerequisites []models.NodePrerequisite, times []dao.NodeStudyTime, targetCode string, nodeType string) (*models.LearningPath, error) {
+	nodeMap := make(map[string]models.NodeProgress, len(nodes))
+	var target *models.NodeProgress
+	for i, node := range nodes {
+		nodeMap[s.creditService.getNodeKey(node.NodeID, node.NodeType)] = node
+		if node.NodeCode != targetCode || (nodeType != "" && node.NodeType != nodeType) {
+			continue
+		}
+		if target == nil || (target.NodeType != "definition" && node.NodeType == "definition") {
+			target = &nodes[i]
+		}
+	}
+	if target == nil {
+		return nil, ErrNodeNotFound
+	}
+
+	edges := graph.Edges{}
+	for _, p := range prerequisites {
+		edges.Add(s.creditService.getNodeKey(p.NodeID, p.NodeType), s.creditService.getNodeKey(p.PrerequisiteID, p.PrerequisiteType))
+	}
+
+	order, err := graph.Prerequisites(edges, s.creditService.getNodeKey(target.NodeID, target.NodeType))
+	if err != nil {
+		return nil, err
+	}
+
+	estimator := newStudyTimeEstimator(times)
+
+	path := &models.LearningPath{
+		DomainID: domainID,
+		Target:   *target,
+		Nodes:    []models.LearningPathNode{},
+	}
+	for _, key := range order {
+		node, ok := nodeMap[key]
+		if !ok {
+			// Prerequisite outside the domain
+			continue
+		}
+		if node.Status == "grasped" || node.Status == "learned" {
+			path.SkippedCount++
+			continue
+		}
+
+		seconds, source := estimator.estimate(key, node.NodeType)
+		path.Nodes = append(path.Nodes, models.LearningPathNode{
+			NodeProgress:     node,
+			EstimatedSeconds: seconds,
+			EstimateSource:   source,
+		})
+		path.EstimatedSeconds += seconds
+	}
+
+	return path, nil
+}
+
+// StartLearningPathSession starts a study session covering exactly the
+// nodes of the learning path to a target, in path order
+func (s *SRSService) StartLearningPathSession(userID uint, domainID uint, targetCode string, nodeType string) (*models.LearningPath, *models.StudySession, error) {
+	path, err := s.GetLearningPath(userID, domainID, targetCode, nodeType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(path.Nodes) == 0 {
+		return path, nil, ErrNothingToStudy
+	}
+
+	session := newPathSession(userID, path)
+	if err := s.srsDao.CreateSession(session); err != nil {
+		return nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return path, session, nil
+}
+
+// newPathSession is a study session over the nodes of a learning path
+func newPathSession(userID uint, path *models.LearningPath) *models.StudySession {
+	session := &models.StudySession{
+		UserID:      userID,
+		DomainID:    path.DomainID,
+		SessionType: "path",
+		Nodes:       make([]models.SessionNode, 0, len(path.Nodes)),
+	}
+	for _, node := range path.Nodes {
+		session.Nodes = append(session.Nodes, models.SessionNode{NodeID: node.NodeID, NodeType: node.NodeType})
+	}
+	return session
+}
+
+// studyTimeEstimator estimates how long studying a node takes from the
+// review times recorded for the domain
+type studyTimeEstimator struct {
+	nodes       map[string]dao.NodeStudyTime
+	typeAverage map[string]float64 // the user's average per node type
+}
+
+func newStudyTimeEstimator(times []dao.NodeStudyTime) *studyTimeEstimator {
+	e := &studyTimeEstimator{
+		nodes:       make(map[string]dao.NodeStudyTime, len(times)),
+		typeAverage: make(map[string]float64),
+	}
+
+	totals := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, t := range times {
+		e.nodes[fmt.Sprintf("%s_%d", t.NodeType, t.NodeID)] = t
+		if t.UserAverage != nil && t.UserReviews > 0 {
+			totals[t.NodeType] += *t.UserAverage * float64(t.UserReviews)
+			counts[t.NodeType] += t.UserReviews
+		}
+	}
+	for nodeType, total := range totals {
+		e.typeAverage[nodeType] = total / float64(counts[nodeType])
+	}
+
+	return e
+}
+
+// estimate returns the estimated seconds for a node and where they come from
+func (e *studyTimeEstimator) estimate(key string, nodeType string) (int, string) {
+	if t, ok := e.nodes[key]; ok {
+		if t.UserAverage != nil {
+			return int(math.Round(*t.UserAverage)), EstimateUser
+		}
+		return int(math.Round(t.Average)), EstimateAllUsers
+	}
+	if average, ok := e.typeAverage[nodeType]; ok {
+		return int(math.Round(average)), EstimateUserAverage
+	}
+	if nodeType == "exercise" {
+		return DefaultExerciseStudyTime, EstimateDefault
+	}
+	return DefaultDefinitionStudyTime, EstimateDefault
+}
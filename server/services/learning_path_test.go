@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"myapp/server/dao"
+	"myapp/server/models"
+)
+
+func TestStudyTimeEstimator(t *testing.T) {
+	userTime := func(seconds float64) *float64 { return &seconds }
+	estimator := newStudyTimeEstimator([]dao.NodeStudyTime{
+		{NodeID: 1, NodeType: "definition", UserAverage: userTime(40), UserReviews: 1, Average: 90},
+		{NodeID: 2, NodeType: "definition", UserAverage: userTime(100), UserReviews: 3, Average: 80},
+		{NodeID: 3, NodeType: "definition", Average: 75.4},
+		{NodeID: 4, NodeType: "exercise", Average: 300},
+	})
+
+	tests := []struct {
+		name        string
+		key         string
+		nodeType    string
+		wantSeconds int
+		wantSource  string
+	}{
+		{"user's own time", "definition_1", "definition", 40, EstimateUser},
+		{"other users' time", "definition_3", "definition", 75, EstimateAllUsers},
+		{"user's average for the type", "definition_9", "definition", 85, EstimateUserAverage},
+		{"other users' exercise time", "exercise_4", "exercise", 300, EstimateAllUsers},
+		{"default exercise time", "exercise_9", "exercise", DefaultExerciseStudyTime, EstimateDefault},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seconds, source := estimator.estimate(tt.key, tt.nodeType)
+			if seconds != tt.wantSeconds || source != tt.wantSource {
+				t.Errorf("estimate(%s) = %d (%s), want %d (%s)", tt.key, seconds, source, tt.wantSeconds, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestBuildLearningPath(t *testing.T) {
+	service := NewSRSService(nil)
+
+	// X requires C requires B requires A; D is unrelated and A is grasped
+	nodes := []models.NodeProgress{
+		{NodeID: 1, NodeType: "definition", NodeCode: "A", Status: "grasped"},
+		{NodeID: 2, NodeType: "definition", NodeCode: "B", Status: "tackling"},
+		{NodeID: 3, NodeType: "definition", NodeCode: "C", Status: "fresh"},
+		{NodeID: 4, NodeType: "definition", NodeCode: "D", Status: "fresh"},
+		{NodeID: 1, NodeType: "exercise", NodeCode: "X", Status: "fresh"},
+	}
+	prerequisites := []models.NodePrerequisite{
+		{NodeID: 2, NodeType: "definition", PrerequisiteID: 1, PrerequisiteType: "definition"},
+		{NodeID: 3, NodeType: "definition", PrerequisiteID: 2, PrerequisiteType: "definition"},
+		{NodeID: 1, NodeType: "exercise", PrerequisiteID: 3, PrerequisiteType: "definition"},
+		// Prerequisite in another domain
+		{NodeID: 3, NodeType: "definition", PrerequisiteID: 99, PrerequisiteType: "definition"},
+	}
+	userTime := 30.0
+	times := []dao.NodeStudyTime{{NodeID: 2, NodeType: "definition", UserAverage: &userTime, UserReviews: 2, Average: 50}}
+
+	path, err := service.buildLearningPath(7, nodes, prerequisites, times, "X", "")
+	if err != nil {
+		t.Fatalf("Failed to build the path: %v", err)
+	}
+	var codes []string
+	for _, node := range path.Nodes {
+		codes = append(codes, node.NodeCode)
+	}
+	if strings.Join(codes, ",") != "B,C,X" || path.SkippedCount != 1 {
+		t.Errorf("path = %v skipping %d, want B,C,X skipping A", codes, path.SkippedCount)
+	}
+	// C takes the user's average for definitions, X the default
+	if want := 30 + 30 + DefaultExerciseStudyTime; path.EstimatedSeconds != want {
+		t.Errorf("estimated %d seconds, want %d", path.EstimatedSeconds, want)
+	}
+	if path.Target.NodeType != "exercise" || path.DomainID != 7 {
+		t.Errorf("target = %+v in domain %d, want exercise X in domain 7", path.Target, path.DomainID)
+	}
+
+	// A definition sharing the code of an exercise wins unless a type is given
+	nodes = append(nodes, models.NodeProgress{NodeID: 5, NodeType: "definition", NodeCode: "X", Status: "fresh"})
+	if path, err := service.buildLearningPath(7, nodes, prerequisites, nil, "X", ""); err != nil || path.Target.NodeType != "definition" {
+		t.Errorf("target = %+v, %v, want definition X", path, err)
+	}
+
+	if _, err := service.buildLearningPath(7, nodes, prerequisites, nil, "NOPE", ""); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("unknown target error = %v, want ErrNodeNotFound", err)
+	}
+}
+
+func TestNewPathSession(t *testing.T) {
+	db := setupServiceTestDB(t)
+	srsDao := dao.NewSRSDao(db)
+
+	path := &models.LearningPath{DomainID: 3, Nodes: []models.LearningPathNode{
+		{NodeProgress: models.NodeProgress{NodeID: 2, NodeType: "definition"}},
+		{NodeProgress: models.NodeProgress{NodeID: 1, NodeType: "exercise"}},
+	}}
+	session := newPathSession(5, path)
+	if err := srsDao.CreateSession(session); err != nil {
+		t.Fatalf("Failed to create the session: %v", err)
+	}
+
+	stored, err := srsDao.GetSession(session.ID)
+	if err != nil {
+		t.Fatalf("Failed to read the session back: %v", err)
+	}
+	want := []models.SessionNode{{NodeID: 2, NodeType: "definition"}, {NodeID: 1, NodeType: "exercise"}}
+	if stored.SessionType != "path" || stored.UserID != 5 || stored.DomainID != 3 || !reflect.DeepEqual(stored.Nodes, want) {
+		t.Errorf("session = %+v, want a path session of user 5 in domain 3 over %+v", stored, want)
+	}
+}
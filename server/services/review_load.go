@@ -0,0 +1,57 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"myapp/server/dao"
+	"myapp/server/scheduler"
+)
+
+// reviewLoad tracks how many reviews are due per day for a user in a domain,
+// so that new intervals can be spread over the least busy days
+type reviewLoad struct {
+	userID uint
+	counts map[string]int
+}
+
+// loadBalanceHorizon bounds the days loaded for balancing; intervals beyond
+// it are only fuzzed
+const loadBalanceHorizon = 400
+
+// newReviewLoad loads the existing next_review counts of the user and domain
+func newReviewLoad(srsDao *dao.SRSDao, userID uint, domainID uint, currentTime time.Time) (*reviewLoad, error) {
+	start := currentTime.UTC().Truncate(24 * time.Hour)
+	counts, err := srsDao.GetDueCountsByDay(userID, domainID, start, start.AddDate(0, 0, loadBalanceHorizon))
+	if err != nil {
+		return nil, err
+	}
+	return &reviewLoad{userID: userID, counts: counts}, nil
+}
+
+func (l *reviewLoad) dayKey(t time.Time) string {
+	return dao.DueDayKey(t)
+}
+
+// schedule picks a fuzzed, load balanced interval for a node and moves the
+// node's count from its previous due day to the new one. The interval
+// returned is the whole number of days to the review it schedules.
+func (l *reviewLoad) schedule(nodeID uint, nodeType string, reps int, interval float64, previous *time.Time, currentTime time.Time) (float64, time.Time) {
+	seed := fmt.Sprintf("%d:%s_%d:%d", l.userID, nodeType, nodeID, reps)
+
+	balanced := scheduler.BalanceInterval(interval, seed, func(days int) int {
+		return l.counts[l.dayKey(currentTime.AddDate(0, 0, days))]
+	})
+	days := int(math.Max(1, balanced))
+	next := currentTime.AddDate(0, 0, days)
+
+	if previous != nil {
+		if key := l.dayKey(*previous); l.counts[key] > 0 {
+			l.counts[key]--
+		}
+	}
+	l.counts[l.dayKey(next)]++
+
+	return float64(days), next
+}
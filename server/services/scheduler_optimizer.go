@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"myapp/server/dao"
+	"myapp/server/models"
+	"myapp/server/scheduler"
+)
+
+// ErrNotEnoughHistory is returned when a user has too few repeated reviews to fit
+var ErrNotEnoughHistory = errors.New("not enough review history")
+
+// SchedulerOptimizerService fits per-user scheduler parameters from review history
+type SchedulerOptimizerService struct {
+	srsDao *dao.SRSDao
+}
+
+// NewSchedulerOptimizerService creates a new optimizer service instance
+func NewSchedulerOptimizerService(db *gorm.DB) *SchedulerOptimizerService {
+	return &SchedulerOptimizerService{
+		srsDao: dao.NewSRSDao(db),
+	}
+}
+
+// OptimizeUser replays the user's explicit reviews, fits the SM-2 parameters
+// and saves them. The fit starts from the user's current parameters, so the
+// reported log-loss before is that of the parameters in use.
+func (o *SchedulerOptimizerService) OptimizeUser(userID uint) (*models.UserSchedulerParams, error) {
+	history, err := o.srsDao.GetExplicitReviews(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get review history: %w", err)
+	}
+
+	logs := make([]scheduler.ReviewLog, 0, len(history))
+	for _, h := range history {
+		logs = append(logs, scheduler.ReviewLog{
+			NodeKey:    fmt.Sprintf("%s_%d", h.NodeType, h.NodeID),
+			ReviewTime: h.ReviewTime,
+			Quality:    reviewQuality(h),
+			Success:    h.Success,
+		})
+	}
+
+	current, err := o.srsDao.GetSchedulerParams(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduler parameters: %w", err)
+	}
+
+	initial := scheduler.DefaultSM2Params
+	if current != nil {
+		initial = SM2ParamsFromModel(current)
+	}
+
+	if _, scored := scheduler.SM2LogLoss(logs, initial); scored < scheduler.MinReviewsForFit {
+		return nil, fmt.Errorf("%w: %d repeated reviews, need at least %d", ErrNotEnoughHistory, scored, scheduler.MinReviewsForFit)
+	}
+
+	fit := scheduler.FitSM2Params(logs, initial)
+
+	params := current
+	if params == nil {
+		params = NewSchedulerParamsModel(userID)
+	}
+	params.FirstInterval = fit.Params.FirstInterval
+	params.SecondInterval = fit.Params.SecondInterval
+	params.EFBase = fit.Params.EFBase
+	params.EFLinear = fit.Params.EFLinear
+	params.EFQuadratic = fit.Params.EFQuadratic
+	params.ReviewCount = fit.ReviewCount
+	params.LogLossBefore = fit.LogLossBefore
+	params.LogLossAfter = fit.LogLossAfter
+	params.FittedAt = time.Now()
+
+	if err := o.srsDao.SaveSchedulerParams(params); err != nil {
+		return nil, fmt.Errorf("failed to save scheduler parameters: %w", err)
+	}
+
+	return params, nil
+}
+
+// OptimizeAllUsers fits parameters for every user with review history.
+// Users without enough history are skipped and reported in the error map.
+func (o *SchedulerOptimizerService) OptimizeAllUsers() ([]*models.UserSchedulerParams, map[uint]error, error) {
+	userIDs, err := o.srsDao.GetUsersWithReviews()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	var results []*models.UserSchedulerParams
+	failures := make(map[uint]error)
+	for _, userID := range userIDs {
+		params, err := o.OptimizeUser(userID)
+		if err != nil {
+			failures[userID] = err
+			continue
+		}
+		results = append(results, params)
+	}
+
+	return results, failures, nil
+}
+
+// NewSchedulerParamsModel returns the stored parameters of a user not fitted
+// yet, set to the SM-2 defaults
+func NewSchedulerParamsModel(userID uint) *models.UserSchedulerParams {
+	defaults := scheduler.DefaultSM2Params
+	return &models.UserSchedulerParams{
+		UserID:         userID,
+		FirstInterval:  defaults.FirstInterval,
+		SecondInterval: defaults.SecondInterval,
+		EFBase:         defaults.EFBase,
+		EFLinear:       defaults.EFLinear,
+		EFQuadratic:    defaults.EFQuadratic,
+	}
+}
+
+// SM2ParamsFromModel converts stored parameters into scheduler parameters
+func SM2ParamsFromModel(params *models.UserSchedulerParams) scheduler.SM2Params {
+	return scheduler.SM2Params{
+		FirstInterval:  params.FirstInterval,
+		SecondInterval: params.SecondInterval,
+		EFBase:         params.EFBase,
+		EFLinear:       params.EFLinear,
+		EFQuadratic:    params.EFQuadratic,
+	}
+}
+
+// reviewQuality returns the recorded quality, or a neutral one derived from
+// the outcome for reviews stored without a quality
+func reviewQuality(h models.ReviewHistory) int {
+	if h.Quality != nil {
+		return *h.Quality
+	}
+	if h.Success {
+		return 4
+	}
+	return 1
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"sort"
@@ -8,6 +9,7 @@ import (
 	"strings"
 	"time"
 	"myapp/server/models"
+	"myapp/server/scheduler"
 )
 
 // SpacedRepetitionService implements the SM-2 algorithm
@@ -25,44 +27,20 @@ type SRSResult struct {
 	NextReview     time.Time
 }
 
-// CalculateNextInterval implements the SM-2 algorithm
+// CalculateNextInterval implements the SM-2 algorithm with its original
+// constants; reviews are scheduled through the scheduler package
 func (s *SpacedRepetitionService) CalculateNextInterval(
 	progress *models.UserNodeProgress,
 	quality int,
 	currentTime time.Time,
 ) SRSResult {
-	ef := progress.EasinessFactor
-	interval := progress.IntervalDays
-	reps := progress.Repetitions
-
-	// Update easiness factor (EF cannot go below 1.3)
-	ef = math.Max(1.3, ef+(0.1-float64(5-quality)*(0.08+float64(5-quality)*0.02)))
-
-	// Calculate next interval
-	if quality < 3 {
-		// Failed review - restart
-		reps = 0
-		interval = 1
-	} else {
-		// Successful review
-		reps++
-		if reps == 1 {
-			interval = 1
-		} else if reps == 2 {
-			interval = 6
-		} else {
-			interval = math.Round(interval * ef)
-		}
-	}
-
-	// Calculate next review date
-	nextReview := currentTime.AddDate(0, 0, int(interval))
+	ef, interval, reps := scheduler.SM2Step(progress.EasinessFactor, progress.IntervalDays, progress.Repetitions, quality)
 
 	return SRSResult{
 		EasinessFactor: ef,
 		IntervalDays:   interval,
 		Repetitions:    reps,
-		NextReview:     nextReview,
+		NextReview:     currentTime.AddDate(0, 0, int(interval)),
 	}
 }
 
@@ -82,10 +60,23 @@ func (s *SpacedRepetitionService) ApplyPartialCredit(
 }
 
 // CreditPropagationService handles credit flow between nodes
-type CreditPropagationService struct{}
+type CreditPropagationService struct {
+	settings PropagationSettings
+}
 
 func NewCreditPropagationService() *CreditPropagationService {
-	return &CreditPropagationService{}
+	return NewCreditPropagationServiceWithSettings(DefaultPropagationSettings)
+}
+
+// NewCreditPropagationServiceWithSettings creates a credit propagation
+// service with the settings of a domain
+func NewCreditPropagationServiceWithSettings(settings PropagationSettings) *CreditPropagationService {
+	return &CreditPropagationService{settings: settings}
+}
+
+// Settings returns the propagation settings in use
+func (c *CreditPropagationService) Settings() PropagationSettings {
+	return c.settings
 }
 
 // GraphNode represents a node in the knowledge graph
@@ -112,17 +103,159 @@ const (
 	// Constants for credit propagation
 	CreditThreshold = 0.01
 	MaxDistance     = 6
+
+	// Limits of the per-domain propagation settings
+	MaxPropagationDepth = 20
+	MaxCreditMultiplier = 5.0
+)
+
+// Credit decay functions: the share of the path weight that reaches a node
+// at distance d from the reviewed node
+const (
+	DecayHarmonic    = "harmonic"    // 1 / (1 + d)
+	DecayExponential = "exponential" // 1 / 2^d
+	DecayLinear      = "linear"      // 1 - d / (maxDepth + 1)
 )
 
-// PropagateCredit calculates credit flow from an explicit review
+// PropagationSettings configures how credit flows through a domain's graph
+type PropagationSettings struct {
+	Decay             string  `json:"decay"`
+	Threshold         float64 `json:"threshold"`         // smaller credits are dropped
+	MaxDepth          int     `json:"maxDepth"`          // 0 = no propagation
+	SuccessMultiplier float64 `json:"successMultiplier"` // scales credit of successful reviews
+	FailureMultiplier float64 `json:"failureMultiplier"` // scales penalty of failed reviews
+
+	// Review quality and speed scaling
+	QualityScale  []float64 `json:"qualityScale"`  // factor per quality 0-5
+	TargetTime    int       `json:"targetTime"`    // seconds, slower passes get less credit; 0 = ignore time
+	MinTimeFactor float64   `json:"minTimeFactor"` // lower bound of the time factor (0-1)
+}
+
+// DefaultQualityScale gives full credit and full penalty whatever the
+// quality, as propagation did before it was configurable
+var DefaultQualityScale = []float64{1.0, 1.0, 1.0, 1.0, 1.0, 1.0}
+
+// DefaultPropagationSettings are the original fixed propagation rules
+var DefaultPropagationSettings = PropagationSettings{
+	Decay:             DecayHarmonic,
+	Threshold:         CreditThreshold,
+	MaxDepth:          MaxDistance,
+	SuccessMultiplier: 1.0,
+	FailureMultiplier: 1.0,
+	QualityScale:      DefaultQualityScale,
+	TargetTime:        0,
+	MinTimeFactor:     0.5,
+}
+
+// PropagationSettingsFromDomain reads the propagation settings of a domain
+func PropagationSettingsFromDomain(domain *models.Domain) PropagationSettings {
+	settings := PropagationSettings{
+		Decay:             domain.CreditDecay,
+		Threshold:         domain.CreditThreshold,
+		MaxDepth:          domain.CreditMaxDepth,
+		SuccessMultiplier: domain.CreditSuccessMultiplier,
+		FailureMultiplier: domain.CreditFailureMultiplier,
+		QualityScale:      domain.CreditQualityScale,
+		TargetTime:        domain.CreditTargetTime,
+		MinTimeFactor:     domain.CreditMinTimeFactor,
+	}
+	if settings.Decay == "" {
+		// Domain loaded without its settings columns
+		return DefaultPropagationSettings
+	}
+	if len(settings.QualityScale) == 0 {
+		settings.QualityScale = DefaultQualityScale
+	}
+	return settings
+}
+
+// Validate checks that the settings are within the supported ranges
+func (p PropagationSettings) Validate() error {
+	switch p.Decay {
+	case DecayHarmonic, DecayExponential, DecayLinear:
+	default:
+		return fmt.Errorf("invalid credit decay %q. Must be 'harmonic', 'exponential' or 'linear'", p.Decay)
+	}
+	if p.Threshold < 0 || p.Threshold >= 1 {
+		return errors.New("credit threshold must be at least 0 and below 1")
+	}
+	if p.MaxDepth < 0 || p.MaxDepth > MaxPropagationDepth {
+		return fmt.Errorf("credit max depth must be between 0 and %d", MaxPropagationDepth)
+	}
+	if p.SuccessMultiplier < 0 || p.SuccessMultiplier > MaxCreditMultiplier ||
+		p.FailureMultiplier < 0 || p.FailureMultiplier > MaxCreditMultiplier {
+		return fmt.Errorf("credit multipliers must be between 0 and %.0f", MaxCreditMultiplier)
+	}
+	if len(p.QualityScale) != 6 {
+		return errors.New("credit quality scale must have one factor per quality (0-5)")
+	}
+	for _, factor := range p.QualityScale {
+		if factor < 0 || factor > MaxCreditMultiplier {
+			return fmt.Errorf("credit quality factors must be between 0 and %.0f", MaxCreditMultiplier)
+		}
+	}
+	if p.TargetTime < 0 {
+		return errors.New("credit target time must be 0 (ignored) or positive")
+	}
+	if p.MinTimeFactor < 0 || p.MinTimeFactor > 1 {
+		return errors.New("credit minimum time factor must be between 0 and 1")
+	}
+	return nil
+}
+
+// ReviewScale returns the factor applied to the credit propagated by a
+// review: the factor of its quality, and for passes slower than the target
+// time target/timeTaken (bounded by MinTimeFactor). Failures are not
+// scaled by time.
+func (p PropagationSettings) ReviewScale(quality int, timeTaken int) float64 {
+	scale := 1.0
+	if quality >= 0 && quality < len(p.QualityScale) {
+		scale = p.QualityScale[quality]
+	}
+	if quality >= 3 && p.TargetTime > 0 && timeTaken > p.TargetTime {
+		scale *= math.Max(p.MinTimeFactor, float64(p.TargetTime)/float64(timeTaken))
+	}
+	return scale
+}
+
+// decay returns the share of the path weight that reaches a node at the
+// given distance
+func (p PropagationSettings) decay(distance int) float64 {
+	switch p.Decay {
+	case DecayExponential:
+		return math.Pow(0.5, float64(distance))
+	case DecayLinear:
+		return math.Max(0, 1-float64(distance)/float64(p.MaxDepth+1))
+	default:
+		return 1 / (1 + float64(distance))
+	}
+}
+
+// PropagateCredit calculates credit flow from an explicit review at full
+// scale, see PropagateReviewCredit
 func (c *CreditPropagationService) PropagateCredit(
 	reviewedNodeID uint,
 	reviewedNodeType string,
 	success bool,
 	graph map[string]*GraphNode,
+) []models.CreditUpdate {
+	return c.PropagateReviewCredit(reviewedNodeID, reviewedNodeType, success, 1.0, graph)
+}
+
+// PropagateReviewCredit calculates credit flow from an explicit review
+// whose implicit credits are multiplied by scale (see ReviewScale). Every
+// reachable node gets the credit of its best path from the reviewed node,
+// the path whose weight product times the decay for its length is the
+// largest, so the result does not depend on the order the graph is walked
+// in. Credits are listed by distance, then node type and ID.
+func (c *CreditPropagationService) PropagateReviewCredit(
+	reviewedNodeID uint,
+	reviewedNodeType string,
+	success bool,
+	scale float64,
+	graph map[string]*GraphNode,
 ) []models.CreditUpdate {
 	credits := []models.CreditUpdate{}
-	visited := make(map[string]bool)
 
 	// Always include the explicitly reviewed node
 	credits = append(credits, models.CreditUpdate{
@@ -133,91 +266,141 @@ func (c *CreditPropagationService) PropagateCredit(
 	})
 
 	nodeKey := c.getNodeKey(reviewedNodeID, reviewedNodeType)
-	startNode, exists := graph[nodeKey]
-	if !exists {
+	if _, exists := graph[nodeKey]; !exists {
 		return credits
 	}
 
-	// Determine direction of propagation
-	var connections []GraphEdge
-	if success {
-		connections = startNode.Prerequisites
-	} else {
-		connections = startNode.Dependents
-	}
+	paths := c.bestPaths(nodeKey, success, scale, graph)
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].distance != paths[j].distance {
+			return paths[i].distance < paths[j].distance
+		}
+		if paths[i].nodeType != paths[j].nodeType {
+			return paths[i].nodeType < paths[j].nodeType
+		}
+		return paths[i].nodeID < paths[j].nodeID
+	})
 
-	// Start DFS propagation
-	for _, conn := range connections {
-		c.dfsPropagate(conn.ID, conn.Type, 1, conn.Weight, success, graph, visited, &credits)
+	for _, path := range paths {
+		credit := path.credit
+		if !success {
+			credit = -credit
+		}
+		credits = append(credits, models.CreditUpdate{
+			NodeID:   path.nodeID,
+			NodeType: path.nodeType,
+			Credit:   credit,
+			Type:     "implicit",
+			Trace: &models.CreditTrace{
+				Path:       path.hops,
+				Decay:      path.decay,
+				Multiplier: c.multiplier(success, scale),
+			},
+		})
 	}
 
 	return credits
 }
 
-// dfsPropagate performs depth-first search for credit propagation
-func (c *CreditPropagationService) dfsPropagate(
-	nodeID uint,
-	nodeType string,
-	distance int,
-	pathWeight float64,
-	success bool,
-	graph map[string]*GraphNode,
-	visited map[string]bool,
-	credits *[]models.CreditUpdate,
-) {
-	if distance > MaxDistance {
-		return
-	}
+// bestPath is the strongest path found from the reviewed node to a node
+type bestPath struct {
+	nodeID   uint
+	nodeType string
+	credit   float64 // unsigned, decay and multiplier applied
+	distance int
+	hops     []models.CreditHop
+	decay    float64
+}
 
-	nodeKey := c.getNodeKey(nodeID, nodeType)
-	if visited[nodeKey] {
-		return
-	}
-	visited[nodeKey] = true
+// pathStep is the best way to reach a node in a given number of hops
+type pathStep struct {
+	product float64
+	prev    string
+	weight  float64
+}
 
-	node, exists := graph[nodeKey]
-	if !exists {
-		return
-	}
+// bestPaths computes the best path credit of every node within the max
+// depth that reaches the threshold. Since the decay depends on the path
+// length, the walk goes hop by hop and keeps, for each node, the largest
+// weight product reachable in exactly that many hops (a max-product
+// search bounded by depth). Only maxima are kept, so the visiting order
+// of nodes and edges cannot change the result. Ties go to the shorter path,
+// and between predecessors to the smallest node key.
+func (c *CreditPropagationService) bestPaths(startKey string, success bool, scale float64, graph map[string]*GraphNode) []bestPath {
+	multiplier := c.multiplier(success, scale)
+
+	best := make(map[string]*bestPath)
+	layers := []map[string]pathStep{{startKey: {product: 1}}}
+
+	for distance := 1; distance <= c.settings.MaxDepth && len(layers[distance-1]) > 0; distance++ {
+		next := make(map[string]pathStep)
+		for key, step := range layers[distance-1] {
+			node, exists := graph[key]
+			if !exists {
+				continue
+			}
 
-	// Calculate credit amount
-	creditAmount := pathWeight / (1 + float64(distance))
+			// Successes flow to prerequisites, failures to dependents
+			connections := node.Prerequisites
+			if !success {
+				connections = node.Dependents
+			}
 
-	// Apply threshold check
-	if math.Abs(creditAmount) >= CreditThreshold {
-		finalCredit := creditAmount
-		if !success {
-			finalCredit = -creditAmount
+			for _, conn := range connections {
+				connKey := c.getNodeKey(conn.ID, conn.Type)
+				if connKey == startKey || conn.Weight <= 0 {
+					continue
+				}
+				product := step.product * conn.Weight
+				current, seen := next[connKey]
+				if !seen || product > current.product || (product == current.product && key < current.prev) {
+					next[connKey] = pathStep{product: product, prev: key, weight: conn.Weight}
+				}
+			}
 		}
 
-		*credits = append(*credits, models.CreditUpdate{
-			NodeID:   nodeID,
-			NodeType: nodeType,
-			Credit:   finalCredit,
-			Type:     "implicit",
-		})
+		decay := c.settings.decay(distance)
+		for key, step := range next {
+			credit := step.product * decay * multiplier
+			if current, seen := best[key]; !seen || credit > current.credit {
+				nodeID, nodeType := c.parseNodeKey(key)
+				best[key] = &bestPath{nodeID: nodeID, nodeType: nodeType, credit: credit, distance: distance, decay: decay}
+			}
+		}
+
+		layers = append(layers, next)
+	}
+
+	paths := make([]bestPath, 0, len(best))
+	for key, path := range best {
+		// Apply threshold check
+		if path.credit != 0 && path.credit >= c.settings.Threshold {
+			path.hops = c.tracePath(layers, key, path.distance)
+			paths = append(paths, *path)
+		}
 	}
+	return paths
+}
+
+// tracePath walks the layers of bestPaths back from a node to the reviewed
+// node and returns the hops in the direction the credit flowed
+func (c *CreditPropagationService) tracePath(layers []map[string]pathStep, key string, distance int) []models.CreditHop {
+	hops := make([]models.CreditHop, distance)
+	for d := distance; d > 0; d-- {
+		step := layers[d][key]
+		nodeID, nodeType := c.parseNodeKey(key)
+		hops[d-1] = models.CreditHop{NodeID: nodeID, NodeType: nodeType, Weight: step.weight}
+		key = step.prev
+	}
+	return hops
+}
 
-	// Continue propagation
-	var connections []GraphEdge
+// multiplier returns the factor applied to every implicit credit of a review
+func (c *CreditPropagationService) multiplier(success bool, scale float64) float64 {
 	if success {
-		connections = node.Prerequisites
-	} else {
-		connections = node.Dependents
-	}
-
-	for _, conn := range connections {
-		c.dfsPropagate(
-			conn.ID,
-			conn.Type,
-			distance+1,
-			pathWeight*conn.Weight,
-			success,
-			graph,
-			visited,
-			credits,
-		)
+		return c.settings.SuccessMultiplier * scale
 	}
+	return c.settings.FailureMultiplier * scale
 }
 
 // BuildGraph creates a graph representation from prerequisites
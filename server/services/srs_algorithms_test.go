@@ -0,0 +1,402 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"myapp/server/models"
+)
+
+// chain builds a -> b -> c -> d (each node requires the next) with unit weights
+func chain() []models.NodePrerequisite {
+	return []models.NodePrerequisite{
+		{NodeID: 1, NodeType: "exercise", PrerequisiteID: 2, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 2, NodeType: "definition", PrerequisiteID: 3, PrerequisiteType: "definition", Weight: 1},
+		{NodeID: 3, NodeType: "definition", PrerequisiteID: 4, PrerequisiteType: "definition", Weight: 1},
+	}
+}
+
+func creditsByKey(credits []models.CreditUpdate) map[string]float64 {
+	result := make(map[string]float64, len(credits))
+	for _, credit := range credits {
+		result[fmt.Sprintf("%s_%d", credit.NodeType, credit.NodeID)] = credit.Credit
+	}
+	return result
+}
+
+func TestPropagationSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings PropagationSettings
+		success  bool
+		start    uint
+		want     map[string]float64
+	}{
+		{
+			name:     "default harmonic",
+			settings: DefaultPropagationSettings,
+			success:  true,
+			start:    1,
+			want:     map[string]float64{"exercise_1": 1, "definition_2": 1.0 / 2, "definition_3": 1.0 / 3, "definition_4": 1.0 / 4},
+		},
+		{
+			name:     "exponential",
+			settings: PropagationSettings{Decay: DecayExponential, Threshold: 0.01, MaxDepth: 6, SuccessMultiplier: 1, FailureMultiplier: 1},
+			success:  true,
+			start:    1,
+			want:     map[string]float64{"exercise_1": 1, "definition_2": 0.5, "definition_3": 0.25, "definition_4": 0.125},
+		},
+		{
+			name:     "linear",
+			settings: PropagationSettings{Decay: DecayLinear, Threshold: 0.01, MaxDepth: 3, SuccessMultiplier: 1, FailureMultiplier: 1},
+			success:  true,
+			start:    1,
+			want:     map[string]float64{"exercise_1": 1, "definition_2": 0.75, "definition_3": 0.5, "definition_4": 0.25},
+		},
+		{
+			name:     "max depth and threshold",
+			settings: PropagationSettings{Decay: DecayHarmonic, Threshold: 0.3, MaxDepth: 2, SuccessMultiplier: 1, FailureMultiplier: 1},
+			success:  true,
+			start:    1,
+			want:     map[string]float64{"exercise_1": 1, "definition_2": 0.5, "definition_3": 1.0 / 3},
+		},
+		{
+			name:     "failure multiplier",
+			settings: PropagationSettings{Decay: DecayHarmonic, Threshold: 0.01, MaxDepth: 6, SuccessMultiplier: 1, FailureMultiplier: 0.5},
+			success:  false,
+			start:    4,
+			want:     map[string]float64{"definition_4": 1, "definition_3": -0.25, "definition_2": -1.0 / 6, "exercise_1": -0.125},
+		},
+		{
+			name:     "zero success multiplier",
+			settings: PropagationSettings{Decay: DecayHarmonic, Threshold: 0, MaxDepth: 6, SuccessMultiplier: 0, FailureMultiplier: 1},
+			success:  true,
+			start:    1,
+			want:     map[string]float64{"exercise_1": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewCreditPropagationServiceWithSettings(tt.settings)
+			graph := service.BuildGraph(chain())
+			startType := "definition"
+			if tt.start == 1 {
+				startType = "exercise"
+			}
+
+			got := creditsByKey(service.PropagateCredit(tt.start, startType, tt.success, graph))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d credits %v, want %d %v", len(got), got, len(tt.want), tt.want)
+			}
+			for key, want := range tt.want {
+				if math.Abs(got[key]-want) > 1e-9 {
+					t.Errorf("credit of %s = %.4f, want %.4f", key, got[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPropagationSettingsValidate(t *testing.T) {
+	valid := DefaultPropagationSettings
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("default settings should be valid: %v", err)
+	}
+
+	invalid := []PropagationSettings{
+		{Decay: "cubic", Threshold: 0.01, MaxDepth: 6, SuccessMultiplier: 1, FailureMultiplier: 1},
+		{Decay: DecayLinear, Threshold: 1, MaxDepth: 6, SuccessMultiplier: 1, FailureMultiplier: 1},
+		{Decay: DecayLinear, Threshold: 0.01, MaxDepth: MaxPropagationDepth + 1, SuccessMultiplier: 1, FailureMultiplier: 1},
+		{Decay: DecayLinear, Threshold: 0.01, MaxDepth: 6, SuccessMultiplier: -1, FailureMultiplier: 1},
+		{Decay: DecayLinear, Threshold: 0.01, MaxDepth: 6, SuccessMultiplier: 1, FailureMultiplier: MaxCreditMultiplier + 1},
+	}
+	for _, settings := range invalid {
+		if err := settings.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want an error", settings)
+		}
+	}
+}
+
+func prereq(nodeID uint, nodeType string, prereqID uint, prereqType string, weight float64) models.NodePrerequisite {
+	return models.NodePrerequisite{
+		NodeID:           nodeID,
+		NodeType:         nodeType,
+		PrerequisiteID:   prereqID,
+		PrerequisiteType: prereqType,
+		Weight:           weight,
+	}
+}
+
+func TestPropagateCreditBestPath(t *testing.T) {
+	// Diamond: exercise 1 requires definitions 2 and 3, which both require 4
+	diamond := []models.NodePrerequisite{
+		prereq(1, "exercise", 2, "definition", 0.5),
+		prereq(1, "exercise", 3, "definition", 1),
+		prereq(2, "definition", 4, "definition", 1),
+		prereq(3, "definition", 4, "definition", 0.2),
+	}
+
+	// Shortcut: a direct weak edge and a longer strong path to the same node
+	shortcut := []models.NodePrerequisite{
+		prereq(1, "exercise", 4, "definition", 0.2),
+		prereq(1, "exercise", 2, "definition", 1),
+		prereq(2, "definition", 4, "definition", 1),
+	}
+
+	// Deep chain: exercise 1 -> definition 2 -> ... -> definition 10
+	var deep []models.NodePrerequisite
+	deep = append(deep, prereq(1, "exercise", 2, "definition", 1))
+	for i := uint(2); i < 10; i++ {
+		deep = append(deep, prereq(i, "definition", i+1, "definition", 1))
+	}
+
+	tests := []struct {
+		name      string
+		graph     []models.NodePrerequisite
+		startID   uint
+		startType string
+		success   bool
+		want      map[string]float64
+	}{
+		{
+			name:      "diamond takes the stronger branch",
+			graph:     diamond,
+			startID:   1,
+			startType: "exercise",
+			success:   true,
+			// 4 via 2: 0.5 * 1 / 3, via 3: 1 * 0.2 / 3
+			want: map[string]float64{"exercise_1": 1, "definition_2": 0.25, "definition_3": 0.5, "definition_4": 0.5 / 3},
+		},
+		{
+			name:      "diamond failure flows to dependents",
+			graph:     diamond,
+			startID:   4,
+			startType: "definition",
+			success:   false,
+			// 1 via 2: 1 * 0.5 / 3, via 3: 0.2 * 1 / 3
+			want: map[string]float64{"definition_4": 1, "definition_2": -0.5, "definition_3": -0.1, "exercise_1": -0.5 / 3},
+		},
+		{
+			name:      "longer strong path beats direct weak edge",
+			graph:     shortcut,
+			startID:   1,
+			startType: "exercise",
+			success:   true,
+			// 4 direct: 0.2 / 2 = 0.1, via 2: 1 / 3
+			want: map[string]float64{"exercise_1": 1, "definition_2": 0.5, "definition_4": 1.0 / 3},
+		},
+		{
+			name:      "deep chain stops at max depth",
+			graph:     deep,
+			startID:   1,
+			startType: "exercise",
+			success:   true,
+			want: map[string]float64{
+				"exercise_1": 1, "definition_2": 1.0 / 2, "definition_3": 1.0 / 3, "definition_4": 1.0 / 4,
+				"definition_5": 1.0 / 5, "definition_6": 1.0 / 6, "definition_7": 1.0 / 7,
+			},
+		},
+		{
+			name:      "deep chain failure from the middle",
+			graph:     deep,
+			startID:   5,
+			startType: "definition",
+			success:   false,
+			want: map[string]float64{
+				"definition_5": 1, "definition_4": -1.0 / 2, "definition_3": -1.0 / 3, "definition_2": -1.0 / 4, "exercise_1": -1.0 / 5,
+			},
+		},
+	}
+
+	service := NewCreditPropagationService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph := service.BuildGraph(tt.graph)
+			got := creditsByKey(service.PropagateCredit(tt.startID, tt.startType, tt.success, graph))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d credits %v, want %d %v", len(got), got, len(tt.want), tt.want)
+			}
+			for key, want := range tt.want {
+				if math.Abs(got[key]-want) > 1e-9 {
+					t.Errorf("credit of %s = %.4f, want %.4f", key, got[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPropagateCreditIsDeterministic(t *testing.T) {
+	graph := []models.NodePrerequisite{
+		prereq(1, "exercise", 2, "definition", 0.8),
+		prereq(1, "exercise", 3, "definition", 0.8),
+		prereq(2, "definition", 4, "definition", 1),
+		prereq(3, "definition", 4, "definition", 1),
+		prereq(2, "definition", 5, "definition", 0.5),
+		prereq(4, "definition", 5, "definition", 1),
+		prereq(1, "exercise", 6, "exercise", 1),
+		prereq(6, "exercise", 5, "definition", 0.3),
+	}
+
+	service := NewCreditPropagationService()
+	want := service.PropagateCredit(1, "exercise", true, service.BuildGraph(graph))
+
+	// The same edges in any order give the same list
+	for shift := 1; shift < len(graph); shift++ {
+		rotated := append(append([]models.NodePrerequisite{}, graph[shift:]...), graph[:shift]...)
+		for run := 0; run < 5; run++ {
+			got := service.PropagateCredit(1, "exercise", true, service.BuildGraph(rotated))
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("rotation %d run %d: got %v, want %v", shift, run, got, want)
+			}
+		}
+	}
+
+	// Ordered by distance of the best path, then type and ID. definition_5
+	// is best reached in three hops (0.8 / 4) rather than two (0.4 / 3).
+	wantOrder := []string{"exercise_1", "definition_2", "definition_3", "exercise_6", "definition_4", "definition_5"}
+	if len(want) != len(wantOrder) {
+		t.Fatalf("got %d credits, want %d", len(want), len(wantOrder))
+	}
+	for i, credit := range want {
+		if key := fmt.Sprintf("%s_%d", credit.NodeType, credit.NodeID); key != wantOrder[i] {
+			t.Errorf("credit %d is %s, want %s", i, key, wantOrder[i])
+		}
+	}
+	if math.Abs(want[5].Credit-0.2) > 1e-9 {
+		t.Errorf("credit of definition_5 = %.4f, want 0.2000", want[5].Credit)
+	}
+}
+
+func TestPropagateCreditTrace(t *testing.T) {
+	graph := []models.NodePrerequisite{
+		prereq(1, "exercise", 2, "definition", 0.8),
+		prereq(1, "exercise", 3, "definition", 0.8),
+		prereq(2, "definition", 4, "definition", 1),
+		prereq(3, "definition", 4, "definition", 1),
+		prereq(4, "definition", 5, "definition", 0.5),
+	}
+
+	service := NewCreditPropagationServiceWithSettings(PropagationSettings{
+		Decay: DecayHarmonic, Threshold: 0.01, MaxDepth: 6, SuccessMultiplier: 2, FailureMultiplier: 1,
+	})
+	credits := service.PropagateReviewCredit(1, "exercise", true, 0.5, service.BuildGraph(graph))
+
+	if credits[0].Trace != nil {
+		t.Errorf("explicit credit has a trace: %+v", credits[0].Trace)
+	}
+
+	for _, credit := range credits[1:] {
+		if credit.Trace == nil {
+			t.Fatalf("%s_%d has no trace", credit.NodeType, credit.NodeID)
+		}
+		// The trace reproduces the credit and ends at the credited node
+		product := 1.0
+		for _, hop := range credit.Trace.Path {
+			product *= hop.Weight
+		}
+		if got := product * credit.Trace.Decay * credit.Trace.Multiplier; math.Abs(got-credit.Credit) > 1e-9 {
+			t.Errorf("%s_%d: trace gives %.4f, credit is %.4f", credit.NodeType, credit.NodeID, got, credit.Credit)
+		}
+		last := credit.Trace.Path[len(credit.Trace.Path)-1]
+		if last.NodeID != credit.NodeID || last.NodeType != credit.NodeType {
+			t.Errorf("%s_%d: path ends at %s_%d", credit.NodeType, credit.NodeID, last.NodeType, last.NodeID)
+		}
+		if credit.Trace.Multiplier != 1 {
+			t.Errorf("%s_%d: multiplier = %.2f, want 1", credit.NodeType, credit.NodeID, credit.Trace.Multiplier)
+		}
+	}
+
+	// Both branches reach definition 4 equally, the smaller key wins
+	want := []models.CreditHop{
+		{NodeID: 2, NodeType: "definition", Weight: 0.8},
+		{NodeID: 4, NodeType: "definition", Weight: 1},
+		{NodeID: 5, NodeType: "definition", Weight: 0.5},
+	}
+	got := credits[len(credits)-1]
+	if got.NodeID != 5 || !reflect.DeepEqual(got.Trace.Path, want) {
+		t.Errorf("path to definition_5 = %+v, want %+v", got.Trace.Path, want)
+	}
+	if got.Trace.Decay != 0.25 {
+		t.Errorf("decay of definition_5 = %.4f, want 0.25", got.Trace.Decay)
+	}
+}
+
+func TestReviewScale(t *testing.T) {
+	settings := DefaultPropagationSettings
+	settings.QualityScale = []float64{1.0, 0.8, 0.6, 0.6, 0.8, 1.0}
+	settings.TargetTime = 30
+
+	tests := []struct {
+		name      string
+		quality   int
+		timeTaken int
+		want      float64
+	}{
+		{"perfect and fast", 5, 10, 1.0},
+		{"hesitant pass", 4, 30, 0.8},
+		{"difficult pass", 3, 0, 0.6},
+		{"slow perfect pass", 5, 60, 0.5},
+		{"very slow pass is bounded", 5, 600, 0.5},
+		{"slightly slow pass", 4, 40, 0.8 * 0.75},
+		{"blackout failure", 0, 600, 1.0},
+		{"familiar failure", 2, 5, 0.6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := settings.ReviewScale(tt.quality, tt.timeTaken); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("ReviewScale(%d, %d) = %.4f, want %.4f", tt.quality, tt.timeTaken, got, tt.want)
+			}
+		})
+	}
+
+	// Without a target time the response time is ignored
+	if got := DefaultPropagationSettings.ReviewScale(5, 600); got != 1.0 {
+		t.Errorf("ReviewScale without target time = %.4f, want 1", got)
+	}
+
+	// By default the quality scales nothing
+	for quality := 0; quality <= 5; quality++ {
+		if got := DefaultPropagationSettings.ReviewScale(quality, 0); got != 1.0 {
+			t.Errorf("default ReviewScale(%d, 0) = %.4f, want 1", quality, got)
+		}
+	}
+}
+
+func TestPropagateReviewCreditScales(t *testing.T) {
+	service := NewCreditPropagationService()
+	graph := service.BuildGraph(chain())
+
+	credits := creditsByKey(service.PropagateReviewCredit(1, "exercise", true, 0.6, graph))
+	if credits["exercise_1"] != 1 {
+		t.Errorf("explicit credit = %.4f, want 1", credits["exercise_1"])
+	}
+	if math.Abs(credits["definition_2"]-0.3) > 1e-9 {
+		t.Errorf("credit of definition_2 = %.4f, want 0.3000", credits["definition_2"])
+	}
+}
+
+func TestApplyPartialCredit(t *testing.T) {
+	tests := []struct {
+		accumulated, credit float64
+		wantCredit          float64
+		wantReviews         int
+	}{
+		{0, 0.4, 0.4, 0},
+		{0.8, 0.5, 0.3, 1},
+		{-0.5, -0.75, -0.25, 1},
+		{0.5, -0.25, 0.25, 0},
+	}
+
+	service := NewSpacedRepetitionService()
+	for _, tt := range tests {
+		progress := &models.UserNodeProgress{AccumulatedCredit: tt.accumulated}
+		credit, reviews := service.ApplyPartialCredit(progress, tt.credit)
+		if math.Abs(credit-tt.wantCredit) > 1e-9 || reviews != tt.wantReviews {
+			t.Errorf("ApplyPartialCredit(%g, %g) = %g, %d, want %g, %d", tt.accumulated, tt.credit, credit, reviews, tt.wantCredit, tt.wantReviews)
+		}
+	}
+}
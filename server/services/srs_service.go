@@ -3,20 +3,28 @@ package services
 import (
 	"errors"
 	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
 	"time"
-  "math"
-  "log"
-  "strings"
+
+	"gorm.io/gorm"
 	"myapp/server/dao"
 	"myapp/server/models"
-	"gorm.io/gorm"
+	"myapp/server/scheduler"
 )
 
+// ErrNothingToUndo is returned when the user has no review left to undo
+var ErrNothingToUndo = errors.New("no review to undo")
+
+// ErrNodeNotFound is returned when a definition or exercise does not exist
+var ErrNodeNotFound = errors.New("node not found")
+
 // SRSService is the main service for spaced repetition functionality
 type SRSService struct {
 	db               *gorm.DB
 	srsDao           *dao.SRSDao
-	srAlgorithm      *SpacedRepetitionService
 	creditService    *CreditPropagationService
 	optimizationService *ReviewOptimizationService
 }
@@ -26,7 +34,6 @@ func NewSRSService(db *gorm.DB) *SRSService {
 	return &SRSService{
 		db:                  db,
 		srsDao:              dao.NewSRSDao(db),
-		srAlgorithm:         NewSpacedRepetitionService(),
 		creditService:       NewCreditPropagationService(),
 		optimizationService: NewReviewOptimizationService(),
 	}
@@ -66,9 +73,17 @@ func (s *SRSService) SubmitReview(userID uint, request *models.ReviewRequest) (*
 	}
 
 	// Verify node is in reviewable state
-	if progress.Status != "grasped" {
+	if !isScheduled(progress) {
 		tx.Rollback()
-		return nil, fmt.Errorf("cannot review node in status: %s. Only 'grasped' nodes can be reviewed", progress.Status)
+		return nil, fmt.Errorf("cannot review node in status: %s. Only 'grasped' and 'learned' nodes can be reviewed", progress.Status)
+	}
+	if progress.Suspended {
+		tx.Rollback()
+		return nil, errors.New("cannot review a suspended node. Unsuspend it first")
+	}
+	if isBuried(progress, time.Now()) {
+		tx.Rollback()
+		return nil, fmt.Errorf("cannot review a node buried until %s", progress.BuriedUntil.Format(time.RFC3339))
 	}
 
 	// Get domain ID for graph building
@@ -78,29 +93,73 @@ func (s *SRSService) SubmitReview(userID uint, request *models.ReviewRequest) (*
 		return nil, fmt.Errorf("failed to get domain ID: %w", err)
 	}
 
-	// Build graph and calculate credit propagation
-	prerequisites, err := s.srsDao.GetPrerequisitesByDomain(domainID)
+	// Build graph and calculate credit propagation; credit crosses into
+	// other domains the user is enrolled in
+	prerequisites, err := s.srsDao.GetPrerequisitesForUser(userID, domainID)
 	if err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to get prerequisites: %w", err)
 	}
 
-	graph := s.creditService.BuildGraph(prerequisites)
-	credits := s.creditService.PropagateCredit(request.NodeID, request.NodeType, request.Success, graph)
+	propagation, err := s.propagationFor(domainID)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get propagation settings: %w", err)
+	}
+
+	// Better and faster answers propagate more credit
+	graph := propagation.BuildGraph(prerequisites)
+	scale := propagation.Settings().ReviewScale(request.Quality, request.TimeTaken)
+	credits := propagation.PropagateReviewCredit(request.NodeID, request.NodeType, request.Success, scale, graph)
+
+	// Pick the scheduling algorithm for this user and domain
+	sched, err := s.schedulerFor(userID, domainID)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to select scheduler: %w", err)
+	}
+
+	// Leech detection and graduation are configured per domain
+	settings, err := s.srsDao.GetSchedulerSettings(userID, domainID)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get scheduler settings: %w", err)
+	}
+	rules := newReviewRules(settings)
+
+	// Load the existing due counts so new reviews land on quiet days
+	currentTime := time.Now()
+	load, err := newReviewLoad(dao.NewSRSDao(tx), userID, domainID, currentTime)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to load review counts: %w", err)
+	}
 
 	// Apply credits to all affected nodes
-	updatedNodes, err := s.applyCredits(tx, userID, credits, request.Quality, time.Now())
+	updatedNodes, progressBefore, err := s.applyCredits(tx, userID, credits, request.Quality, sched, rules, load, currentTime)
 	if err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to apply credits: %w", err)
 	}
 
-	// Record review history
-	if err := s.recordReviewHistory(tx, userID, request, progress); err != nil {
+	// Record review history for the reviewed node and every node that received credit
+	historyIDs, err := s.recordReviewHistory(tx, userID, request, credits, progressBefore, updatedNodes)
+	if err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to record review history: %w", err)
 	}
 
+	snapshot := &models.ReviewSnapshot{
+		UserID:         userID,
+		NodeID:         request.NodeID,
+		NodeType:       request.NodeType,
+		SessionID:      request.SessionID,
+		Success:        request.Success,
+		CreditFlow:     credits,
+		ProgressBefore: progressBefore,
+		HistoryIDs:     historyIDs,
+	}
+
 	// Update session if provided
 	if request.SessionID != nil {
 		if err := s.updateSessionStats(tx, *request.SessionID, request.Success); err != nil {
@@ -108,10 +167,18 @@ func (s *SRSService) SubmitReview(userID uint, request *models.ReviewRequest) (*
 			return nil, fmt.Errorf("failed to update session: %w", err)
 		}
 
-		if err := s.recordSessionReview(tx, request, time.Now()); err != nil {
+		sessionReview, err := s.recordSessionReview(tx, request, time.Now())
+		if err != nil {
 			tx.Rollback()
 			return nil, fmt.Errorf("failed to record session review: %w", err)
 		}
+		snapshot.SessionReviewIDs = []uint{sessionReview.ID}
+	}
+
+	// Keep what is needed to undo this review
+	if err := s.saveReviewSnapshot(tx, snapshot); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to save review snapshot: %w", err)
 	}
 
 	if err := tx.Commit().Error; err != nil {
@@ -127,141 +194,193 @@ func (s *SRSService) SubmitReview(userID uint, request *models.ReviewRequest) (*
 }
 
 // Enhanced applyCredits with better error handling
-func (s *SRSService) applyCredits(tx *gorm.DB, userID uint, credits []models.CreditUpdate, quality int, currentTime time.Time) ([]models.UserNodeProgress, error) {
-    var updatedNodes []models.UserNodeProgress
-    srsDao := dao.NewSRSDao(tx)
-    var warnings []string
-
-    for _, credit := range credits {
-        // Get or create progress
-        progress, err := srsDao.GetUserProgress(userID, credit.NodeID, credit.NodeType)
-        if err != nil {
-            return nil, err
-        }
-
-        if progress == nil {
-            // For implicit reviews, only apply to nodes that already have progress
-            if credit.Type == "implicit" {
-                continue
-            }
-
-            // Create new progress for explicit review
-            progress = &models.UserNodeProgress{
-                UserID:            userID,
-                NodeID:            credit.NodeID,
-                NodeType:          credit.NodeType,
-                Status:            "grasped",
-                EasinessFactor:    2.5,
-                IntervalDays:      0,
-                Repetitions:       0,
-                AccumulatedCredit: 0,
-                CreditPostponed:   false,
-                TotalReviews:      0,
-                SuccessfulReviews: 0,
-            }
-        }
-
-        // Only apply credits to 'grasped' nodes
-        if progress.Status != "grasped" {
-            continue
-        }
-
-        // Check if review is due - if so, reset credits
-        if progress.NextReview != nil && progress.NextReview.Before(currentTime) {
-            progress.AccumulatedCredit = 0
-            progress.CreditPostponed = false
-        }
-
-        if credit.Type == "explicit" {
-            // Full review - update SRS parameters
-            srResult := s.srAlgorithm.CalculateNextInterval(progress, quality, currentTime)
-
-            progress.EasinessFactor = srResult.EasinessFactor
-            progress.IntervalDays = srResult.IntervalDays
-            progress.Repetitions = srResult.Repetitions
-            progress.LastReview = &currentTime
-            progress.NextReview = &srResult.NextReview
-            progress.TotalReviews++
-            if quality >= 3 {
-                progress.SuccessfulReviews++
-            }
-            progress.AccumulatedCredit = 0
-            progress.CreditPostponed = false
-
-        } else {
-            // Implicit review - handle credit accumulation with enhanced bounds checking
-            originalCredit := progress.AccumulatedCredit
-            newCredit := progress.AccumulatedCredit + credit.Credit
-            creditPostponed := progress.CreditPostponed
-
-            // Apply strict bounds checking to prevent database constraint violations
-            boundedCredit := math.Max(-1.0, math.Min(1.0, newCredit))
-            
-            // Check if we hit the bounds and log a warning
-            if newCredit != boundedCredit {
-                warningMsg := fmt.Sprintf("Credit limit reached for node %d (type: %s). Original: %.3f, Attempted: %.3f, Applied: %.3f", 
-                    credit.NodeID, credit.NodeType, originalCredit, newCredit, boundedCredit)
-                warnings = append(warnings, warningMsg)
-                // Log for debugging
-                log.Printf("Credit limit warning: %s", warningMsg)
-            }
-
-            newCredit = boundedCredit
-
-            // Handle positive credits (successful implicit reviews)
-            if credit.Credit > 0 && !creditPostponed {
-                if newCredit >= 1.0 {
-                    // Reached +100% credit - postpone the review
-                    newCredit = 1.0
-                    creditPostponed = true
-
-                    // Calculate next review based on current SR parameters
-                    srResult := s.srAlgorithm.CalculateNextInterval(progress, 4, currentTime) // Default "good" quality
-                    progress.NextReview = &srResult.NextReview
-                    progress.Repetitions = srResult.Repetitions
-                    progress.IntervalDays = srResult.IntervalDays
-                }
-            }
-
-            // Handle negative credits (failed implicit reviews)
-            if credit.Credit < 0 {
-                if newCredit <= -1.0 {
-                    // Reached -100% credit - anticipate the review to today
-                    newCredit = -1.0
-                    progress.NextReview = &currentTime
-                }
-            }
-
-            // Final assignment with bounds checking
-            progress.AccumulatedCredit = math.Max(-1.0, math.Min(1.0, newCredit))
-            progress.CreditPostponed = creditPostponed
-        }
-
-        // Save progress with error handling
-        if err := srsDao.CreateOrUpdateProgress(progress); err != nil {
-            // Check if it's a constraint violation
-            if strings.Contains(err.Error(), "user_node_progress_accumulated_credit_check") {
-                // This should not happen with our bounds checking, but handle gracefully
-                log.Printf("Constraint violation despite bounds checking for node %d: %v", credit.NodeID, err)
-                // Force the credit to be within bounds and try again
-                progress.AccumulatedCredit = math.Max(-1.0, math.Min(1.0, progress.AccumulatedCredit))
-                if err := srsDao.CreateOrUpdateProgress(progress); err != nil {
-                    return nil, fmt.Errorf("failed to save progress for node %d after bounds correction: %w", credit.NodeID, err)
-                }
-            } else {
-                return nil, fmt.Errorf("failed to save progress for node %d: %w", credit.NodeID, err)
-            }
-        }
-
-        updatedNodes = append(updatedNodes, *progress)
-    }
-
-    // If there were warnings, log them but don't fail the operation
-    if len(warnings) > 0 {
-        log.Printf("Credit application completed with %d warnings", len(warnings))
-    }
-
-    return updatedNodes, nil
+func (s *SRSService) applyCredits(tx *gorm.DB, userID uint, credits []models.CreditUpdate, quality int, sched scheduler.Scheduler, rules reviewRules, load *reviewLoad, currentTime time.Time) ([]models.UserNodeProgress, []models.ProgressSnapshot, error) {
+	var updatedNodes []models.UserNodeProgress
+	var snapshots []models.ProgressSnapshot
+	srsDao := dao.NewSRSDao(tx)
+	var warnings []string
+
+	for _, credit := range credits {
+		// Get or create progress
+		progress, err := srsDao.GetUserProgress(userID, credit.NodeID, credit.NodeType)
+		if err != nil {
+			return nil, nil, err
+		}
+		existed := progress != nil
+
+		if progress == nil {
+			// For implicit reviews, only apply to nodes that already have progress
+			if credit.Type == "implicit" {
+				continue
+			}
+
+			// Create new progress for explicit review
+			progress = &models.UserNodeProgress{
+				UserID:            userID,
+				NodeID:            credit.NodeID,
+				NodeType:          credit.NodeType,
+				Status:            "grasped",
+				EasinessFactor:    2.5,
+				IntervalDays:      0,
+				Repetitions:       0,
+				AccumulatedCredit: 0,
+				CreditPostponed:   false,
+				TotalReviews:      0,
+				SuccessfulReviews: 0,
+			}
+		}
+
+		// Only apply credits to nodes under review ('grasped' and 'learned')
+		if !isScheduled(progress) {
+			continue
+		}
+
+		// Suspended and buried nodes are left out of credit propagation
+		if credit.Type == "implicit" && (progress.Suspended || isBuried(progress, currentTime)) {
+			continue
+		}
+
+		// Remember the untouched state for undo
+		before := *progress
+
+		// Check if review is due - if so, reset credits
+		if progress.NextReview != nil && progress.NextReview.Before(currentTime) {
+			progress.AccumulatedCredit = 0
+			progress.CreditPostponed = false
+		}
+
+		if credit.Type == "explicit" {
+			// A failure after a successful review is a lapse
+			lastReview, err := srsDao.GetLastExplicitReview(userID, credit.NodeID, credit.NodeType)
+			if err != nil {
+				return nil, nil, err
+			}
+			if lastReview != nil && scheduler.IsLapse(reviewQuality(*lastReview), quality) {
+				progress.Lapses++
+				if isLeech, suspend := rules.leech.Check(progress.Lapses); isLeech && !progress.IsLeech {
+					progress.IsLeech = true
+					progress.Suspended = progress.Suspended || suspend
+					log.Printf("Node %d (type: %s) became a leech for user %d after %d lapses", credit.NodeID, credit.NodeType, userID, progress.Lapses)
+				}
+			}
+
+			// Full review - update SRS parameters
+			srResult := sched.CalculateNextInterval(progress, quality, currentTime)
+			interval, nextReview := load.schedule(progress.NodeID, progress.NodeType, srResult.Repetitions, srResult.IntervalDays, progress.NextReview, currentTime)
+
+			progress.EasinessFactor = srResult.EasinessFactor
+			setSchedule(progress, srResult, interval, nextReview)
+			progress.LastReview = &currentTime
+			progress.TotalReviews++
+			if quality >= 3 {
+				progress.SuccessfulReviews++
+			}
+			progress.AccumulatedCredit = 0
+			progress.CreditPostponed = false
+
+			// A failed review demotes a learned node, a good one may graduate it
+			if quality < 3 {
+				if progress.Status == "learned" {
+					progress.Status = "grasped"
+				}
+			} else if progress.Status == "grasped" && rules.graduation.Graduates(progress) {
+				progress.Status = "learned"
+			}
+
+		} else {
+			// Implicit review - handle credit accumulation with enhanced bounds checking
+			originalCredit := progress.AccumulatedCredit
+			newCredit := progress.AccumulatedCredit + credit.Credit
+			creditPostponed := progress.CreditPostponed
+
+			// Apply strict bounds checking to prevent database constraint violations
+			boundedCredit := math.Max(-1.0, math.Min(1.0, newCredit))
+
+			// Check if we hit the bounds and log a warning
+			if newCredit != boundedCredit {
+				warningMsg := fmt.Sprintf("Credit limit reached for node %d (type: %s). Original: %.3f, Attempted: %.3f, Applied: %.3f",
+					credit.NodeID, credit.NodeType, originalCredit, newCredit, boundedCredit)
+				warnings = append(warnings, warningMsg)
+				// Log for debugging
+				log.Printf("Credit limit warning: %s", warningMsg)
+			}
+
+			newCredit = boundedCredit
+
+			// Handle positive credits (successful implicit reviews)
+			if credit.Credit > 0 && !creditPostponed {
+				if newCredit >= 1.0 {
+					// Reached +100% credit - postpone the review
+					newCredit = 1.0
+					creditPostponed = true
+
+					// Calculate next review based on current SR parameters
+					implicitQuality := scheduler.ImplicitQuality(quality, credit.Credit)
+					srResult := sched.CalculateNextInterval(progress, implicitQuality, currentTime)
+					interval, nextReview := load.schedule(progress.NodeID, progress.NodeType, srResult.Repetitions, srResult.IntervalDays, progress.NextReview, currentTime)
+					setSchedule(progress, srResult, interval, nextReview)
+				}
+			}
+
+			// Handle negative credits (failed implicit reviews)
+			if credit.Credit < 0 {
+				if newCredit <= -1.0 {
+					// Reached -100% credit - anticipate the review to today.
+					// No interval is computed, so the scheduler state is left
+					// whole for that review to update.
+					newCredit = -1.0
+					progress.NextReview = &currentTime
+				}
+			}
+
+			// Final assignment with bounds checking
+			progress.AccumulatedCredit = math.Max(-1.0, math.Min(1.0, newCredit))
+			progress.CreditPostponed = creditPostponed
+		}
+
+		// Save progress with error handling
+		if err := srsDao.CreateOrUpdateProgress(progress); err != nil {
+			// Check if it's a constraint violation
+			if strings.Contains(err.Error(), "user_node_progress_accumulated_credit_check") {
+				// This should not happen with our bounds checking, but handle gracefully
+				log.Printf("Constraint violation despite bounds checking for node %d: %v", credit.NodeID, err)
+				// Force the credit to be within bounds and try again
+				progress.AccumulatedCredit = math.Max(-1.0, math.Min(1.0, progress.AccumulatedCredit))
+				if err := srsDao.CreateOrUpdateProgress(progress); err != nil {
+					return nil, nil, fmt.Errorf("failed to save progress for node %d after bounds correction: %w", credit.NodeID, err)
+				}
+			} else {
+				return nil, nil, fmt.Errorf("failed to save progress for node %d: %w", credit.NodeID, err)
+			}
+		}
+
+		updatedNodes = append(updatedNodes, *progress)
+		snapshots = append(snapshots, models.ProgressSnapshot{
+			Existed:      existed,
+			Progress:     before,
+			AfterID:      progress.ID,
+			AfterVersion: progress.Version,
+		})
+	}
+
+	// If there were warnings, log them but don't fail the operation
+	if len(warnings) > 0 {
+		log.Printf("Credit application completed with %d warnings", len(warnings))
+	}
+
+	return updatedNodes, snapshots, nil
+}
+
+// setSchedule stores a scheduler result on a node. The memory state is
+// copied whole, so that a node first scheduled by an implicit review has a
+// complete FSRS state.
+func setSchedule(progress *models.UserNodeProgress, result scheduler.Result, interval float64, nextReview time.Time) {
+	progress.IntervalDays = interval
+	progress.NextReview = &nextReview
+	progress.Repetitions = result.Repetitions
+	progress.Algorithm = result.Algorithm
+	progress.Stability = result.Stability
+	progress.Difficulty = result.Difficulty
 }
 
 // UpdateNodeStatus updates a node's status and handles propagation
@@ -325,7 +444,8 @@ func (s *SRSService) propagateStatus(tx *gorm.DB, userID uint, nodeID uint, node
 		return err
 	}
 
-	prerequisites, err := srsDao.GetPrerequisitesByDomain(domainID)
+	// Status crosses into other domains the user is enrolled in
+	prerequisites, err := srsDao.GetPrerequisitesForUser(userID, domainID)
 	if err != nil {
 		return err
 	}
@@ -343,7 +463,7 @@ func (s *SRSService) propagateStatus(tx *gorm.DB, userID uint, nodeID uint, node
 	}
 
 	switch status {
-	case "grasped":
+	case "grasped", "learned":
 		// Recursively mark prerequisites as grasped if they're fresh/tackling
 		if err := s.propagateGrasped(tx, userID, nodeID, nodeType, prereqMap, make(map[string]bool)); err != nil {
 			return err
@@ -439,7 +559,7 @@ func (s *SRSService) propagateTackling(tx *gorm.DB, userID uint, nodeID uint, no
 			return err
 		}
 
-		// Update status if it's fresh or grasped
+		// Update status if it's fresh, grasped or learned
 		if progress == nil {
 			progress = &models.UserNodeProgress{
 				UserID:            userID,
@@ -454,7 +574,7 @@ func (s *SRSService) propagateTackling(tx *gorm.DB, userID uint, nodeID uint, no
 				TotalReviews:      0,
 				SuccessfulReviews: 0,
 			}
-		} else if progress.Status == "fresh" || progress.Status == "grasped" {
+		} else if progress.Status == "fresh" || progress.Status == "grasped" || progress.Status == "learned" {
 			progress.Status = "tackling"
 		}
 
@@ -471,7 +591,7 @@ func (s *SRSService) propagateTackling(tx *gorm.DB, userID uint, nodeID uint, no
 	return nil
 }
 
-// propagateFresh recursively marks dependents as fresh if they were grasped
+// propagateFresh recursively marks dependents as fresh if they were grasped or learned
 func (s *SRSService) propagateFresh(tx *gorm.DB, userID uint, nodeID uint, nodeType string, dependentMap map[string][]models.NodePrerequisite, visited map[string]bool) error {
 	nodeKey := fmt.Sprintf("%s_%d", nodeType, nodeID)
 	if visited[nodeKey] {
@@ -492,8 +612,8 @@ func (s *SRSService) propagateFresh(tx *gorm.DB, userID uint, nodeID uint, nodeT
 			return err
 		}
 
-		// Only update if it was grasped
-		if progress != nil && progress.Status == "grasped" {
+		// Only update if it was grasped or learned
+		if progress != nil && isScheduled(progress) {
 			progress.Status = "fresh"
 			if err := srsDao.CreateOrUpdateProgress(progress); err != nil {
 				return err
@@ -509,6 +629,71 @@ func (s *SRSService) propagateFresh(tx *gorm.DB, userID uint, nodeID uint, nodeT
 	return nil
 }
 
+// SuspendNode takes a node out of the review queue (suspended) or puts it
+// back, without touching its status. Suspended nodes keep their schedule.
+func (s *SRSService) SuspendNode(userID uint, nodeID uint, nodeType string, suspended bool) (*models.UserNodeProgress, error) {
+	return s.updateSchedulingState(userID, nodeID, nodeType, func(progress *models.UserNodeProgress) {
+		progress.Suspended = suspended
+	})
+}
+
+// BuryNode hides a node from the review queue until the start of the next
+// day (buried) or shows it again right away
+func (s *SRSService) BuryNode(userID uint, nodeID uint, nodeType string, buried bool) (*models.UserNodeProgress, error) {
+	return s.updateSchedulingState(userID, nodeID, nodeType, func(progress *models.UserNodeProgress) {
+		if !buried {
+			progress.BuriedUntil = nil
+			return
+		}
+		now := time.Now()
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		progress.BuriedUntil = &tomorrow
+	})
+}
+
+// UnsuspendDomain unsuspends all the user's nodes in a domain
+func (s *SRSService) UnsuspendDomain(userID uint, domainID uint) (int64, error) {
+	return s.srsDao.UnsuspendDomain(userID, domainID)
+}
+
+// UnburyDomain unburies all the user's nodes in a domain
+func (s *SRSService) UnburyDomain(userID uint, domainID uint) (int64, error) {
+	return s.srsDao.UnburyDomain(userID, domainID)
+}
+
+// updateSchedulingState applies a suspend/bury change to a node's progress.
+// Unlike UpdateNodeStatus nothing is propagated through the graph.
+func (s *SRSService) updateSchedulingState(userID uint, nodeID uint, nodeType string, update func(progress *models.UserNodeProgress)) (*models.UserNodeProgress, error) {
+	if _, err := s.getDomainIDForNode(nodeID, nodeType); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNodeNotFound
+		}
+		return nil, err
+	}
+
+	progress, err := s.srsDao.GetUserProgress(userID, nodeID, nodeType)
+	if err != nil {
+		return nil, err
+	}
+
+	if progress == nil {
+		progress = &models.UserNodeProgress{
+			UserID:         userID,
+			NodeID:         nodeID,
+			NodeType:       nodeType,
+			Status:         "fresh",
+			EasinessFactor: 2.5,
+		}
+	}
+
+	update(progress)
+
+	if err := s.srsDao.CreateOrUpdateProgress(progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
 // GetDueReviews gets optimally ordered due reviews
 func (s *SRSService) GetDueReviews(userID uint, domainID uint, nodeType string) ([]models.NodeProgress, error) {
 	dueNodes, err := s.srsDao.GetDueReviews(userID, domainID, nodeType)
@@ -532,6 +717,17 @@ func (s *SRSService) GetDueReviews(userID uint, domainID uint, nodeType string)
 
 // Helper methods
 
+// isScheduled reports whether a node is under review: grasped nodes and
+// learned ones, which keep being reviewed at long intervals
+func isScheduled(progress *models.UserNodeProgress) bool {
+	return progress.Status == "grasped" || progress.Status == "learned"
+}
+
+// isBuried reports whether a node is still buried at the given time
+func isBuried(progress *models.UserNodeProgress, now time.Time) bool {
+	return progress.BuriedUntil != nil && progress.BuriedUntil.After(now)
+}
+
 func (s *SRSService) getDomainIDForNode(nodeID uint, nodeType string) (uint, error) {
 	var domainID uint
 	
@@ -554,23 +750,487 @@ func (s *SRSService) getDomainIDForNode(nodeID uint, nodeType string) (uint, err
 	return domainID, nil
 }
 
-func (s *SRSService) recordReviewHistory(tx *gorm.DB, userID uint, request *models.ReviewRequest, progressBefore *models.UserNodeProgress) error {
+// propagationFor returns the credit propagation configured for a domain
+func (s *SRSService) propagationFor(domainID uint) (*CreditPropagationService, error) {
+	domain, err := dao.NewDomainDAO(s.db).FindByID(domainID)
+	if err != nil {
+		return nil, err
+	}
+	return NewCreditPropagationServiceWithSettings(PropagationSettingsFromDomain(domain)), nil
+}
+
+// SimulateCreditPropagation computes the credits a review of a node would
+// propagate in its domain, without applying them. Without a quality the
+// credits are not scaled by quality and time.
+func (s *SRSService) SimulateCreditPropagation(domainID uint, nodeID uint, nodeType string, success bool, quality *int, timeTaken int) ([]models.CreditUpdate, *PropagationSettings, error) {
+	propagation, err := s.propagationFor(domainID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get propagation settings: %w", err)
+	}
+
+	prerequisites, err := s.srsDao.GetPrerequisitesByDomain(domainID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get prerequisites: %w", err)
+	}
+
+	graph := propagation.BuildGraph(prerequisites)
+	settings := propagation.Settings()
+	scale := 1.0
+	if quality != nil {
+		scale = settings.ReviewScale(*quality, timeTaken)
+	}
+	return propagation.PropagateReviewCredit(nodeID, nodeType, success, scale, graph), &settings, nil
+}
+
+// reviewRules are the per-domain rules applied on explicit reviews
+type reviewRules struct {
+	leech      scheduler.LeechPolicy
+	graduation scheduler.GraduationPolicy
+}
+
+// newReviewRules reads the review rules from the scheduler settings
+func newReviewRules(settings *models.SchedulerSettings) reviewRules {
+	return reviewRules{
+		leech: scheduler.LeechPolicy{
+			Threshold: settings.LeechThreshold,
+			Action:    settings.LeechAction,
+		},
+		graduation: scheduler.GraduationPolicy{
+			MinInterval:    settings.GraduationInterval,
+			MinSuccessRate: settings.GraduationSuccessRate,
+		},
+	}
+}
+
+// schedulerFor returns the scheduler configured for a user in a domain
+func (s *SRSService) schedulerFor(userID uint, domainID uint) (scheduler.Scheduler, error) {
+	settings, err := s.srsDao.GetSchedulerSettings(userID, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	config := scheduler.Config{
+		Algorithm:        scheduler.ResolveAlgorithm(settings.UserAlgorithm, settings.DomainAlgorithm),
+		DesiredRetention: scheduler.ResolveRetention(settings.UserRetention, settings.DomainRetention),
+	}
+
+	if config.Algorithm == scheduler.AlgorithmSM2 {
+		// Use the parameters fitted from the user's history when available
+		params, err := s.srsDao.GetSchedulerParams(userID)
+		if err != nil {
+			return nil, err
+		}
+		if params != nil {
+			sm2Params := SM2ParamsFromModel(params)
+			config.SM2Params = &sm2Params
+		}
+	}
+
+	return scheduler.NewWithConfig(config)
+}
+
+// EstimateWorkload estimates the daily review load of the user's grasped
+// nodes in a domain if intervals targeted the given retention instead of
+// the current one. A node reviewed every I days costs 1/I reviews a day.
+func (s *SRSService) EstimateWorkload(userID uint, domainID uint, retention float64) (*models.WorkloadEstimate, error) {
+	settings, err := s.srsDao.GetSchedulerSettings(userID, domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduler settings: %w", err)
+	}
+	currentRetention := scheduler.ResolveRetention(settings.UserRetention, settings.DomainRetention)
+	if retention == 0 {
+		retention = currentRetention
+	}
+	if !scheduler.IsValidRetention(retention) {
+		return nil, fmt.Errorf("retention must be between %.2f and %.2f", scheduler.MinDesiredRetention, scheduler.MaxDesiredRetention)
+	}
+
+	progress, err := s.srsDao.GetDomainNodeProgress(userID, domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get progress: %w", err)
+	}
+
+	fsrsCurrent := scheduler.NewFSRSScheduler()
+	fsrsCurrent.DesiredRetention = currentRetention
+	fsrsTarget := scheduler.NewFSRSScheduler()
+	fsrsTarget.DesiredRetention = retention
+	sm2Scale := scheduler.RetentionModifier(retention) / scheduler.RetentionModifier(currentRetention)
+
+	estimate := &models.WorkloadEstimate{
+		DomainID:         domainID,
+		Retention:        retention,
+		CurrentRetention: currentRetention,
+	}
+
+	for _, p := range progress {
+		if !isScheduled(&p) || p.Suspended {
+			continue
+		}
+
+		var current, target float64
+		if p.Algorithm == scheduler.AlgorithmFSRS && p.Stability > 0 {
+			current = fsrsCurrent.NextInterval(p.Stability)
+			target = fsrsTarget.NextInterval(p.Stability)
+		} else {
+			current = math.Max(1, p.IntervalDays)
+			target = math.Max(1, current*sm2Scale)
+		}
+
+		estimate.NodeCount++
+		estimate.CurrentDailyReviews += 1 / current
+		estimate.EstimatedDailyReviews += 1 / target
+	}
+
+	return estimate, nil
+}
+
+// ForecastReviews projects daily review counts for the next days. Each
+// grasped node is counted on its next_review day, then its follow-up reviews
+// are simulated with the user's scheduler assuming a "good" (quality 4)
+// answer each time, until the window ends.
+func (s *SRSService) ForecastReviews(userID uint, domainID uint, days int) (*models.ReviewForecast, error) {
+	sched, err := s.schedulerFor(userID, domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select scheduler: %w", err)
+	}
+
+	progress, err := s.srsDao.GetDomainNodeProgress(userID, domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get progress: %w", err)
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	end := today.AddDate(0, 0, days)
+
+	forecast := &models.ReviewForecast{
+		DomainID:  domainID,
+		Days:      days,
+		StartDate: today.Format("2006-01-02"),
+		Daily:     make([]models.ForecastDay, days),
+	}
+	for i := range forecast.Daily {
+		forecast.Daily[i].Date = today.AddDate(0, 0, i).Format("2006-01-02")
+	}
+
+	dayIndex := func(t time.Time) int {
+		if t.Before(today) {
+			return 0
+		}
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return int(math.Round(day.Sub(today).Hours() / 24))
+	}
+
+	for _, p := range progress {
+		if !isScheduled(&p) || p.Suspended {
+			continue
+		}
+
+		due := now
+		if p.NextReview != nil {
+			due = *p.NextReview
+			if due.Before(today) {
+				forecast.Overdue++
+			}
+		}
+		if due.Before(now) {
+			due = now
+		}
+
+		// Work on a copy so the simulation never touches stored progress
+		simulated := p
+		for first := true; due.Before(end); first = false {
+			index := dayIndex(due)
+			if first {
+				forecast.Daily[index].Scheduled++
+			} else {
+				forecast.Daily[index].FollowUp++
+			}
+			forecast.Daily[index].Total++
+			forecast.Total++
+
+			result := sched.CalculateNextInterval(&simulated, 4, due)
+			simulated.EasinessFactor = result.EasinessFactor
+			simulated.IntervalDays = result.IntervalDays
+			simulated.Repetitions = result.Repetitions
+			simulated.Stability = result.Stability
+			simulated.Difficulty = result.Difficulty
+			reviewTime := due
+			simulated.LastReview = &reviewTime
+			if !result.NextReview.After(due) {
+				break
+			}
+			due = result.NextReview
+		}
+	}
+
+	return forecast, nil
+}
+
+// GetLeeches lists the user's leeches in a domain, most lapses first, each
+// with its direct prerequisites and the user's progress on them
+func (s *SRSService) GetLeeches(userID uint, domainID uint) (*models.LeechReport, error) {
+	settings, err := s.srsDao.GetSchedulerSettings(userID, domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduler settings: %w", err)
+	}
+
+	nodes, err := s.srsDao.GetDomainProgress(userID, domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get progress: %w", err)
+	}
+
+	prerequisites, err := s.srsDao.GetPrerequisitesByDomain(domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prerequisites: %w", err)
+	}
+
+	nodeMap := make(map[string]models.NodeProgress, len(nodes))
+	for _, node := range nodes {
+		nodeMap[s.creditService.getNodeKey(node.NodeID, node.NodeType)] = node
+	}
+
+	report := &models.LeechReport{
+		DomainID:  domainID,
+		Threshold: settings.LeechThreshold,
+		Action:    settings.LeechAction,
+		Leeches:   []models.Leech{},
+	}
+
+	leechIndex := make(map[string]int)
+	for _, node := range nodes {
+		if !node.IsLeech {
+			continue
+		}
+		leechIndex[s.creditService.getNodeKey(node.NodeID, node.NodeType)] = len(report.Leeches)
+		report.Leeches = append(report.Leeches, models.Leech{
+			NodeProgress:  node,
+			Prerequisites: []models.LeechPrerequisite{},
+		})
+	}
+
+	for _, prereq := range prerequisites {
+		i, ok := leechIndex[s.creditService.getNodeKey(prereq.NodeID, prereq.NodeType)]
+		if !ok {
+			continue
+		}
+		node, ok := nodeMap[s.creditService.getNodeKey(prereq.PrerequisiteID, prereq.PrerequisiteType)]
+		if !ok {
+			continue
+		}
+		report.Leeches[i].Prerequisites = append(report.Leeches[i].Prerequisites, models.LeechPrerequisite{
+			NodeProgress: node,
+			Weight:       prereq.Weight,
+		})
+	}
+
+	sort.SliceStable(report.Leeches, func(i, j int) bool {
+		return report.Leeches[i].Lapses > report.Leeches[j].Lapses
+	})
+
+	return report, nil
+}
+
+// ExplainCredit lists the most recent implicit credits a node received,
+// with the explicit review that caused each one and the path the credit
+// took through the prerequisite graph. It reads the credits recorded in the
+// review history, so settings changed since then do not alter the answer.
+func (s *SRSService) ExplainCredit(userID uint, nodeID uint, nodeType string, limit int) (*models.CreditExplanation, error) {
+	domainID, err := s.getDomainIDForNode(nodeID, nodeType)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNodeNotFound
+		}
+		return nil, err
+	}
+
+	nodes, err := s.srsDao.GetDomainProgress(userID, domainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get progress: %w", err)
+	}
+	nodeMap := make(map[string]models.NodeProgress, len(nodes))
+	for _, node := range nodes {
+		nodeMap[s.creditService.getNodeKey(node.NodeID, node.NodeType)] = node
+	}
+
+	implicit := "implicit"
+	history, err := s.srsDao.GetReviewHistory(userID, &nodeID, &nodeType, &implicit, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get review history: %w", err)
+	}
+
+	var sourceIDs []uint
+	for _, h := range history {
+		if h.SourceReviewID != nil {
+			sourceIDs = append(sourceIDs, *h.SourceReviewID)
+		}
+	}
+	sources, err := s.srsDao.GetReviewHistoryByIDs(userID, sourceIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source reviews: %w", err)
+	}
+	sourceMap := make(map[uint]models.ReviewHistory, len(sources))
+	for _, source := range sources {
+		sourceMap[source.ID] = source
+	}
+
+	explanation := &models.CreditExplanation{
+		Node:    nodeMap[s.creditService.getNodeKey(nodeID, nodeType)],
+		Credits: make([]models.CreditEvent, 0, len(history)),
+	}
+
+	for _, h := range history {
+		event := models.CreditEvent{
+			HistoryID:        h.ID,
+			ReviewTime:       h.ReviewTime,
+			Credit:           h.CreditApplied,
+			CreditBefore:     h.CreditBefore,
+			CreditAfter:      h.CreditAfter,
+			NextReviewBefore: h.NextReviewBefore,
+			NextReviewAfter:  h.NextReviewAfter,
+			Path:             []models.CreditPathStep{},
+		}
+
+		if h.SourceReviewID != nil {
+			if source, ok := sourceMap[*h.SourceReviewID]; ok {
+				node := nodeMap[s.creditService.getNodeKey(source.NodeID, source.NodeType)]
+				event.Source = &models.CreditSource{
+					HistoryID: source.ID,
+					NodeID:    source.NodeID,
+					NodeType:  source.NodeType,
+					NodeCode:  node.NodeCode,
+					NodeName:  node.NodeName,
+					Success:   source.Success,
+					Quality:   source.Quality,
+					TimeTaken: source.TimeTaken,
+				}
+			}
+		}
+
+		if h.CreditTrace != nil {
+			for _, hop := range h.CreditTrace.Path {
+				node := nodeMap[s.creditService.getNodeKey(hop.NodeID, hop.NodeType)]
+				event.Path = append(event.Path, models.CreditPathStep{
+					CreditHop: hop,
+					NodeCode:  node.NodeCode,
+					NodeName:  node.NodeName,
+				})
+			}
+			event.Decay = &h.CreditTrace.Decay
+			event.Multiplier = &h.CreditTrace.Multiplier
+		}
+
+		explanation.Credits = append(explanation.Credits, event)
+	}
+
+	return explanation, nil
+}
+
+// recordReviewHistory writes one history row per node changed by the
+// review: the explicit review itself and one implicit row per node whose
+// credit or schedule changed through propagation. Implicit rows point to
+// the explicit one and keep the path their credit took. before and after
+// are parallel slices as returned by applyCredits.
+func (s *SRSService) recordReviewHistory(
+	tx *gorm.DB,
+	userID uint,
+	request *models.ReviewRequest,
+	credits []models.CreditUpdate,
+	before []models.ProgressSnapshot,
+	after []models.UserNodeProgress,
+) ([]uint, error) {
 	srsDao := dao.NewSRSDao(tx)
-	
+
+	creditByNode := make(map[string]models.CreditUpdate, len(credits))
+	for _, credit := range credits {
+		creditByNode[s.creditService.getNodeKey(credit.NodeID, credit.NodeType)] = credit
+	}
+
+	// The explicit row goes first so that implicit rows can reference it
+	var ids []uint
+	var sourceID *uint
+	for i := range after {
+		if after[i].NodeID == request.NodeID && after[i].NodeType == request.NodeType {
+			history := s.explicitHistory(userID, request, &before[i].Progress, &after[i])
+			if err := srsDao.CreateReviewHistory(history); err != nil {
+				return nil, err
+			}
+			ids = append(ids, history.ID)
+			sourceID = &history.ID
+			break
+		}
+	}
+
+	for i := range after {
+		progressBefore := before[i].Progress
+		progressAfter := after[i]
+		if progressAfter.NodeID == request.NodeID && progressAfter.NodeType == request.NodeType {
+			continue
+		}
+		credit := creditByNode[s.creditService.getNodeKey(progressAfter.NodeID, progressAfter.NodeType)]
+
+		history := newReviewHistory(userID, "implicit", &progressBefore, &progressAfter)
+		history.Success = credit.Credit > 0
+		history.CreditApplied = credit.Credit
+		history.SourceReviewID = sourceID
+		history.CreditTrace = credit.Trace
+
+		if err := srsDao.CreateReviewHistory(history); err != nil {
+			return nil, err
+		}
+		ids = append(ids, history.ID)
+	}
+
+	return ids, nil
+}
+
+// explicitHistory builds the history row of the reviewed node
+func (s *SRSService) explicitHistory(userID uint, request *models.ReviewRequest, progressBefore *models.UserNodeProgress, progressAfter *models.UserNodeProgress) *models.ReviewHistory {
+	history := newReviewHistory(userID, "explicit", progressBefore, progressAfter)
+	history.Success = request.Success
+	history.Quality = &request.Quality
+	history.TimeTaken = &request.TimeTaken
+	history.CreditApplied = 1.0
+
+	if progressAfter.Algorithm == scheduler.AlgorithmFSRS && progressBefore.Stability > 0 &&
+		progressBefore.LastReview != nil && progressAfter.LastReview != nil {
+		elapsed := progressAfter.LastReview.Sub(*progressBefore.LastReview).Hours() / 24
+		retrievability := scheduler.Retrievability(math.Max(0, elapsed), progressBefore.Stability)
+		history.Retrievability = &retrievability
+	}
+
+	return history
+}
+
+// newReviewHistory fills the before/after values shared by all history rows
+func newReviewHistory(userID uint, reviewType string, progressBefore *models.UserNodeProgress, progressAfter *models.UserNodeProgress) *models.ReviewHistory {
 	history := &models.ReviewHistory{
-		UserID:                userID,
-		NodeID:                request.NodeID,
-		NodeType:              request.NodeType,
-		ReviewType:            "explicit",
-		Success:               request.Success,
-		Quality:               &request.Quality,
-		TimeTaken:             &request.TimeTaken,
-		CreditApplied:         1.0,
-		EasinessFactorBefore:  &progressBefore.EasinessFactor,
-		IntervalBefore:        &progressBefore.IntervalDays,
+		UserID:               userID,
+		NodeID:               progressAfter.NodeID,
+		NodeType:             progressAfter.NodeType,
+		ReviewType:           reviewType,
+		EasinessFactorBefore: &progressBefore.EasinessFactor,
+		EasinessFactorAfter:  &progressAfter.EasinessFactor,
+		IntervalBefore:       &progressBefore.IntervalDays,
+		IntervalAfter:        &progressAfter.IntervalDays,
+		CreditBefore:         &progressBefore.AccumulatedCredit,
+		CreditAfter:          &progressAfter.AccumulatedCredit,
+		NextReviewBefore:     progressBefore.NextReview,
+		NextReviewAfter:      progressAfter.NextReview,
+		Algorithm:            progressAfter.Algorithm,
+	}
+
+	// FSRS state is kept for both algorithms so switching does not lose it
+	if progressBefore.Stability > 0 {
+		history.StabilityBefore = &progressBefore.Stability
+		history.DifficultyBefore = &progressBefore.Difficulty
+	}
+	if progressAfter.Stability > 0 {
+		history.StabilityAfter = &progressAfter.Stability
+		history.DifficultyAfter = &progressAfter.Difficulty
 	}
 
-	return srsDao.CreateReviewHistory(history)
+	return history
 }
 
 func (s *SRSService) updateSessionStats(tx *gorm.DB, sessionID uint, success bool) error {
@@ -589,9 +1249,9 @@ func (s *SRSService) updateSessionStats(tx *gorm.DB, sessionID uint, success boo
 	return srsDao.UpdateSession(session)
 }
 
-func (s *SRSService) recordSessionReview(tx *gorm.DB, request *models.ReviewRequest, reviewTime time.Time) error {
+func (s *SRSService) recordSessionReview(tx *gorm.DB, request *models.ReviewRequest, reviewTime time.Time) (*models.SessionReview, error) {
 	if request.SessionID == nil {
-		return nil
+		return nil, nil
 	}
 
 	srsDao := dao.NewSRSDao(tx)
@@ -608,5 +1268,148 @@ func (s *SRSService) recordSessionReview(tx *gorm.DB, request *models.ReviewRequ
 		CreditApplied: 1.0,
 	}
 
-	return srsDao.CreateSessionReview(sessionReview)
+	if err := srsDao.CreateSessionReview(sessionReview); err != nil {
+		return nil, err
+	}
+	return sessionReview, nil
+}
+
+// maxReviewSnapshots is how many reviews per user can be undone
+const maxReviewSnapshots = 20
+
+// saveReviewSnapshot stores the undo information of a review and drops the
+// oldest snapshots beyond maxReviewSnapshots
+func (s *SRSService) saveReviewSnapshot(tx *gorm.DB, snapshot *models.ReviewSnapshot) error {
+	srsDao := dao.NewSRSDao(tx)
+
+	if err := srsDao.CreateReviewSnapshot(snapshot); err != nil {
+		return err
+	}
+	return srsDao.PruneReviewSnapshots(snapshot.UserID, maxReviewSnapshots)
+}
+
+// UndoLastReview rolls back the user's most recent review: every node the
+// review touched (explicitly or through credit) gets its earlier progress
+// back, the history and session review rows it created are removed and the
+// session counters are decremented. Calling it again steps further back.
+// Nodes whose progress changed after the review (a status change, a
+// suspension, a reset...) keep their current state and are reported as
+// skipped.
+func (s *SRSService) UndoLastReview(userID uint) (*models.UndoResponse, error) {
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	srsDao := dao.NewSRSDao(tx)
+
+	snapshot, err := srsDao.GetLastReviewSnapshot(userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get last review: %w", err)
+	}
+	if snapshot == nil {
+		tx.Rollback()
+		return nil, ErrNothingToUndo
+	}
+
+	response := &models.UndoResponse{
+		Success:  true,
+		Message:  "Review undone successfully",
+		NodeID:   snapshot.NodeID,
+		NodeType: snapshot.NodeType,
+	}
+
+	// Restore node states, in reverse order of application
+	for i := len(snapshot.ProgressBefore) - 1; i >= 0; i-- {
+		saved := snapshot.ProgressBefore[i]
+		progress := saved.Progress
+
+		current, err := srsDao.GetUserProgress(userID, progress.NodeID, progress.NodeType)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to get progress for node %d: %w", progress.NodeID, err)
+		}
+		if changedAfter(current, saved) {
+			response.SkippedNodes = append(response.SkippedNodes, models.CreditUpdate{
+				NodeID:   progress.NodeID,
+				NodeType: progress.NodeType,
+			})
+			continue
+		}
+
+		if !saved.Existed {
+			if err := srsDao.DeleteProgress(userID, progress.NodeID, progress.NodeType); err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to remove progress for node %d: %w", progress.NodeID, err)
+			}
+			response.RemovedNodes = append(response.RemovedNodes, models.CreditUpdate{
+				NodeID:   progress.NodeID,
+				NodeType: progress.NodeType,
+			})
+			continue
+		}
+
+		if err := srsDao.RestoreProgress(&progress); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to restore progress for node %d: %w", progress.NodeID, err)
+		}
+		response.RestoredNodes = append(response.RestoredNodes, progress)
+	}
+
+	removed, err := srsDao.DeleteReviewHistory(userID, snapshot.HistoryIDs)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to remove review history: %w", err)
+	}
+	response.HistoryRemoved = int(removed)
+
+	// Roll back the session
+	if snapshot.SessionID != nil {
+		if err := srsDao.DeleteSessionReviews(snapshot.SessionReviewIDs); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to remove session review: %w", err)
+		}
+
+		session, err := srsDao.GetSession(*snapshot.SessionID)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to get session: %w", err)
+		}
+		if session.TotalReviews > 0 {
+			session.TotalReviews--
+		}
+		if snapshot.Success && session.SuccessfulReviews > 0 {
+			session.SuccessfulReviews--
+		}
+		if err := srsDao.UpdateSession(session); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to update session: %w", err)
+		}
+	}
+
+	if err := srsDao.DeleteReviewSnapshot(snapshot.ID); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to remove review snapshot: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return response, nil
+}
+
+// changedAfter reports whether a node's progress was written after the
+// review that saved it: the row was deleted, or it is not the row and
+// version the review left. Versions rather than updated_at are compared,
+// since the database sets updated_at on every write, restores included, on
+// its own clock.
+func changedAfter(current *models.UserNodeProgress, saved models.ProgressSnapshot) bool {
+	if current == nil {
+		return saved.Existed
+	}
+	return current.ID != saved.AfterID || current.Version != saved.AfterVersion
 }
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"myapp/server/dao"
+	"myapp/server/models"
+	"myapp/server/scheduler"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupServiceTestDB opens a private database with every table. It is a
+// file so that reads outside a service's transaction get a connection.
+func setupServiceTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Domain{},
+		&models.Definition{},
+		&models.Reference{},
+		&models.Exercise{},
+		&models.UserDomainProgress{},
+		&models.NodePrerequisite{},
+		&models.UserNodeProgress{},
+		&models.StudySession{},
+		&models.SessionReview{},
+		&models.ReviewHistory{},
+		&models.ReviewSnapshot{},
+		&models.UserSchedulerParams{},
+	); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+// undoFixture is a domain where B requires A, with both nodes scheduled
+type undoFixture struct {
+	db      *gorm.DB
+	service *SRSService
+	userID  uint
+	a, b    models.Definition
+}
+
+func newUndoFixture(t *testing.T) *undoFixture {
+	t.Helper()
+	db := setupServiceTestDB(t)
+	f := &undoFixture{db: db, service: NewSRSService(db)}
+
+	user := models.User{Username: "learner", Email: "learner@example.com", Password: "x"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	f.userID = user.ID
+	domain := models.Domain{Name: "Algebra", Privacy: "public", OwnerID: user.ID}
+	if err := db.Create(&domain).Error; err != nil {
+		t.Fatalf("Failed to create domain: %v", err)
+	}
+	f.a = models.Definition{Code: "A", Name: "A", Description: "a", DomainID: domain.ID, OwnerID: user.ID}
+	f.b = models.Definition{Code: "B", Name: "B", Description: "b", DomainID: domain.ID, OwnerID: user.ID}
+	for _, def := range []*models.Definition{&f.a, &f.b} {
+		if err := db.Create(def).Error; err != nil {
+			t.Fatalf("Failed to create definition: %v", err)
+		}
+	}
+	edge := models.NodePrerequisite{NodeID: f.b.ID, NodeType: "definition", PrerequisiteID: f.a.ID, PrerequisiteType: "definition", Weight: 1}
+	if err := db.Create(&edge).Error; err != nil {
+		t.Fatalf("Failed to create prerequisite: %v", err)
+	}
+
+	due := time.Now().Add(-48 * time.Hour)
+	lastReview := due.AddDate(0, 0, -3)
+	for _, def := range []models.Definition{f.a, f.b} {
+		progress := models.UserNodeProgress{
+			UserID: user.ID, NodeID: def.ID, NodeType: "definition", Status: "grasped",
+			EasinessFactor: 2.5, IntervalDays: 3, Repetitions: 2, TotalReviews: 2, SuccessfulReviews: 2,
+			LastReview: &lastReview, NextReview: &due, Algorithm: scheduler.AlgorithmSM2,
+		}
+		if err := db.Create(&progress).Error; err != nil {
+			t.Fatalf("Failed to create progress: %v", err)
+		}
+	}
+	return f
+}
+
+func (f *undoFixture) progress(t *testing.T, def models.Definition) models.UserNodeProgress {
+	t.Helper()
+	progress, err := dao.NewSRSDao(f.db).GetUserProgress(f.userID, def.ID, "definition")
+	if err != nil || progress == nil {
+		t.Fatalf("Failed to get progress of %s: %v", def.Code, err)
+	}
+	return *progress
+}
+
+func (f *undoFixture) review(t *testing.T, def models.Definition) {
+	t.Helper()
+	request := &models.ReviewRequest{NodeID: def.ID, NodeType: "definition", Success: true, Quality: 4}
+	if _, err := f.service.SubmitReview(f.userID, request); err != nil {
+		t.Fatalf("Failed to review %s: %v", def.Code, err)
+	}
+}
+
+func sameSchedule(a, b models.UserNodeProgress) bool {
+	return a.IntervalDays == b.IntervalDays && a.Repetitions == b.Repetitions &&
+		a.AccumulatedCredit == b.AccumulatedCredit && a.TotalReviews == b.TotalReviews &&
+		a.NextReview.Equal(*b.NextReview)
+}
+
+func TestUndoLastReviewTwiceWithDatabaseTimestamps(t *testing.T) {
+	f := newUndoFixture(t)
+	beforeA, beforeB := f.progress(t, f.a), f.progress(t, f.b)
+
+	// As the Postgres trigger does, the database sets updated_at on every
+	// update, restores included
+	trigger := `CREATE TRIGGER progress_updated_at AFTER UPDATE ON user_node_progress
+		BEGIN UPDATE user_node_progress SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id; END`
+	if err := f.db.Exec(trigger).Error; err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+
+	// Review A, then B, which credits A; the reviews were a minute ago
+	f.review(t, f.a)
+	f.review(t, f.b)
+	if err := f.db.Model(&models.ReviewSnapshot{}).Where("user_id = ?", f.userID).
+		Update("created_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("Failed to backdate snapshots: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		response, err := f.service.UndoLastReview(f.userID)
+		if err != nil {
+			t.Fatalf("Failed to undo review %d: %v", i+1, err)
+		}
+		if len(response.SkippedNodes) != 0 {
+			t.Errorf("undo %d skipped %+v, want no skipped nodes", i+1, response.SkippedNodes)
+		}
+	}
+	if after := f.progress(t, f.a); !sameSchedule(after, beforeA) {
+		t.Errorf("progress of %s after both undos = %+v, want %+v", f.a.Code, after, beforeA)
+	}
+	if after := f.progress(t, f.b); !sameSchedule(after, beforeB) {
+		t.Errorf("progress of %s after both undos = %+v, want %+v", f.b.Code, after, beforeB)
+	}
+}
+
+func TestSetScheduleImplicitFSRS(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	progress := &models.UserNodeProgress{EasinessFactor: 2.5, Status: "grasped"}
+
+	// A node first scheduled by implicit credit gets a complete FSRS state
+	result := scheduler.NewFSRSScheduler().CalculateNextInterval(progress, scheduler.ImplicitQuality(4, 0.8), now)
+	setSchedule(progress, result, result.IntervalDays, result.NextReview)
+
+	if progress.Stability <= 0 || progress.Difficulty <= 0 {
+		t.Fatalf("stability = %g, difficulty = %g, want both initialized", progress.Stability, progress.Difficulty)
+	}
+	if progress.Difficulty != result.Difficulty || progress.Algorithm != scheduler.AlgorithmFSRS {
+		t.Errorf("progress = %+v, want the scheduler result %+v", progress, result)
+	}
+	if progress.NextReview == nil || !progress.NextReview.Equal(result.NextReview) {
+		t.Errorf("next review = %v, want %v", progress.NextReview, result.NextReview)
+	}
+}
+
+func TestReviewLoadScheduleWholeDays(t *testing.T) {
+	now := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	previous := now.AddDate(0, 0, 2)
+	load := &reviewLoad{userID: 1, counts: map[string]int{dao.DueDayKey(previous): 1}}
+
+	for _, interval := range []float64{0.4, 3.7, 12.5} {
+		days, next := load.schedule(5, "definition", 3, interval, &previous, now)
+		if days != math.Trunc(days) || days < 1 {
+			t.Errorf("schedule(%g) interval = %g, want whole days", interval, days)
+		}
+		if want := now.AddDate(0, 0, int(days)); !next.Equal(want) {
+			t.Errorf("schedule(%g) next = %v, want %v for %g days", interval, next, want, days)
+		}
+		if load.counts[dao.DueDayKey(next)] == 0 {
+			t.Errorf("schedule(%g) did not count the review on %s", interval, dao.DueDayKey(next))
+		}
+	}
+}
+
+func TestUndoLastReview(t *testing.T) {
+	f := newUndoFixture(t)
+	before := f.progress(t, f.a)
+
+	f.review(t, f.a)
+	if reviewed := f.progress(t, f.a); sameSchedule(reviewed, before) {
+		t.Fatalf("review did not change %s: %+v", f.a.Code, reviewed)
+	}
+
+	response, err := f.service.UndoLastReview(f.userID)
+	if err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+	if after := f.progress(t, f.a); !sameSchedule(after, before) {
+		t.Errorf("progress after undo = %+v, want %+v", after, before)
+	}
+	if response.HistoryRemoved == 0 || len(response.SkippedNodes) != 0 {
+		t.Errorf("response = %+v, want the history removed and no skipped nodes", response)
+	}
+
+	if _, err := f.service.UndoLastReview(f.userID); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("second undo error = %v, want ErrNothingToUndo", err)
+	}
+}
+
+func TestUndoLastReviewImplicitCredit(t *testing.T) {
+	f := newUndoFixture(t)
+	beforeA, beforeB := f.progress(t, f.a), f.progress(t, f.b)
+
+	// Reviewing B credits its prerequisite A
+	f.review(t, f.b)
+	if credited := f.progress(t, f.a); sameSchedule(credited, beforeA) {
+		t.Fatalf("review of %s did not credit %s: %+v", f.b.Code, f.a.Code, credited)
+	}
+
+	response, err := f.service.UndoLastReview(f.userID)
+	if err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+	if after := f.progress(t, f.a); !sameSchedule(after, beforeA) {
+		t.Errorf("credited progress after undo = %+v, want %+v", after, beforeA)
+	}
+	if after := f.progress(t, f.b); !sameSchedule(after, beforeB) {
+		t.Errorf("reviewed progress after undo = %+v, want %+v", after, beforeB)
+	}
+	if len(response.RestoredNodes) != 2 {
+		t.Errorf("restored %d nodes, want 2", len(response.RestoredNodes))
+	}
+}
+
+func TestUndoLastReviewKeepsLaterChanges(t *testing.T) {
+	f := newUndoFixture(t)
+	beforeB := f.progress(t, f.b)
+
+	f.review(t, f.b)
+
+	// A is suspended after the review
+	changed := f.progress(t, f.a)
+	changed.Suspended = true
+	if err := dao.NewSRSDao(f.db).CreateOrUpdateProgress(&changed); err != nil {
+		t.Fatalf("Failed to suspend %s: %v", f.a.Code, err)
+	}
+
+	response, err := f.service.UndoLastReview(f.userID)
+	if err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+	if after := f.progress(t, f.a); !after.Suspended || !sameSchedule(after, changed) {
+		t.Errorf("changed progress after undo = %+v, want the later state %+v", after, changed)
+	}
+	if after := f.progress(t, f.b); !sameSchedule(after, beforeB) {
+		t.Errorf("reviewed progress after undo = %+v, want %+v", after, beforeB)
+	}
+	if len(response.SkippedNodes) != 1 || response.SkippedNodes[0].NodeID != f.a.ID {
+		t.Errorf("skipped nodes = %+v, want %s", response.SkippedNodes, f.a.Code)
+	}
+}